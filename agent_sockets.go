@@ -0,0 +1,168 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// agentSocketDirAnnotation is the pod annotation recording the
+	// directory holding the agent sockets of a pod, if they were not
+	// created by virtcontainers.
+	agentSocketDirAnnotation = hypervisorAnnotationPrefix + "agent_socket_dir"
+
+	// agentSocketDirMode is the mode of the directory holding the agent
+	// sockets of a pod.
+	agentSocketDirMode = 0750
+
+	// maxSocketPathLen is the maximum length of the path of a UNIX
+	// socket, which must fit in sockaddr_un.sun_path with its trailing
+	// NUL byte.
+	maxSocketPathLen = 107
+)
+
+// agentSockets lists the names of the sockets the hypervisor creates for
+// the agent of a pod: its control channel, then its TTY channel.
+var agentSockets = []string{"hyper.sock", "tty.sock"}
+
+// agentSocketDir is the directory below which the agent sockets of each
+// pod are created, set by the socket_dir option of the agent
+// configuration. virtcontainers creates them below podRunStatePath if it
+// is empty.
+var agentSocketDir string
+
+// getAgentSocketDir returns the directory below which the agent sockets
+// of each pod are created.
+func getAgentSocketDir() string {
+	if agentSocketDir == "" {
+		return podRunStatePath
+	}
+
+	return agentSocketDir
+}
+
+// setAgentSockets makes the hypervisor create the agent sockets of the
+// specified pod below agentSocketDir and records the directory holding
+// them in the pod annotations. The directory is created by
+// createAgentSocketDir().
+func setAgentSockets(podConfig *vc.PodConfig) error {
+	if agentSocketDir == "" {
+		// The builtin delete is shadowed by the delete command.
+		if _, ok := podConfig.Annotations[agentSocketDirAnnotation]; ok {
+			podConfig.Annotations[agentSocketDirAnnotation] = ""
+		}
+		return nil
+	}
+
+	// virtcontainers uses the default configuration if none is set.
+	var agentConfig vc.HyperConfig
+
+	if podConfig.AgentConfig != nil {
+		var ok bool
+
+		agentConfig, ok = podConfig.AgentConfig.(vc.HyperConfig)
+		if !ok {
+			return fmt.Errorf("Cannot set the agent sockets of pod %v: unexpected agent configuration", podConfig.ID)
+		}
+	}
+
+	dir := filepath.Join(agentSocketDir, podConfig.ID)
+
+	// The sockets are named the same way as virtcontainers does.
+	agentConfig.Sockets = nil
+
+	for i, name := range agentSockets {
+		path := filepath.Join(dir, name)
+
+		if len(path) > maxSocketPathLen {
+			return fmt.Errorf("Agent socket path %v is longer than %d characters", path, maxSocketPathLen)
+		}
+
+		agentConfig.Sockets = append(agentConfig.Sockets, vc.Socket{
+			DeviceID: fmt.Sprintf("channel%d", i),
+			ID:       fmt.Sprintf("charch%d", i),
+			HostPath: path,
+			Name:     fmt.Sprintf("sh.hyper.channel.%d", i),
+		})
+	}
+
+	agentConfig.SockCtlName = agentConfig.Sockets[0].HostPath
+	agentConfig.SockTtyName = agentConfig.Sockets[1].HostPath
+
+	podConfig.AgentConfig = agentConfig
+
+	if podConfig.Annotations == nil {
+		podConfig.Annotations = make(map[string]string)
+	}
+
+	podConfig.Annotations[agentSocketDirAnnotation] = dir
+
+	ccLog.WithFields(logrus.Fields{
+		"pod":        podConfig.ID,
+		"socket-dir": dir,
+	}).Debug("Set agent sockets")
+
+	return nil
+}
+
+// createAgentSocketDir creates the directory holding the agent sockets
+// of the specified pod, if they were set by setAgentSockets().
+func createAgentSocketDir(podConfig vc.PodConfig) error {
+	dir := podConfig.Annotations[agentSocketDirAnnotation]
+	if dir == "" {
+		return nil
+	}
+
+	return os.MkdirAll(dir, agentSocketDirMode)
+}
+
+// getPodAgentSocketDir returns the directory holding the agent sockets of
+// the specified pod recorded when it was created, or "" if they were
+// created by virtcontainers or the pod cannot be found.
+func getPodAgentSocketDir(podID string) string {
+	status, err := vci.StatusPod(podID)
+	if err != nil {
+		return ""
+	}
+
+	return status.Annotations[agentSocketDirAnnotation]
+}
+
+// removeAgentSockets removes the agent sockets created in the specified
+// directory, as recorded by setAgentSockets(), and the directory itself.
+// Nothing else is removed, so that an unexpected directory is left alone.
+func removeAgentSockets(dir string) error {
+	if dir == "" {
+		return nil
+	}
+
+	for _, name := range agentSockets {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if err := os.Remove(dir); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
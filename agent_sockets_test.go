@@ -0,0 +1,260 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/vcMock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetAgentSocketsDefault(t *testing.T) {
+	assert := assert.New(t)
+
+	savedAgentSocketDir := agentSocketDir
+	agentSocketDir = ""
+
+	defer func() {
+		agentSocketDir = savedAgentSocketDir
+	}()
+
+	// a socket directory set by the bundle is ignored
+	podConfig := vc.PodConfig{
+		ID:          testPodID,
+		AgentConfig: vc.HyperConfig{},
+		Annotations: map[string]string{
+			agentSocketDirAnnotation: "/etc",
+		},
+	}
+
+	err := setAgentSockets(&podConfig)
+	assert.NoError(err)
+	assert.Equal(vc.HyperConfig{}, podConfig.AgentConfig)
+	assert.Equal("", podConfig.Annotations[agentSocketDirAnnotation])
+
+	assert.NoError(createAgentSocketDir(podConfig))
+
+	assert.Equal(podRunStatePath, getAgentSocketDir())
+	assert.NoError(removeAgentSockets(""))
+}
+
+func TestSetAgentSockets(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	savedAgentSocketDir := agentSocketDir
+	agentSocketDir = filepath.Join(tmpdir, "sockets")
+
+	defer func() {
+		agentSocketDir = savedAgentSocketDir
+	}()
+
+	assert.Equal(agentSocketDir, getAgentSocketDir())
+
+	// unexpected agent configuration
+	podConfig := vc.PodConfig{
+		ID:          testPodID,
+		AgentConfig: vc.CCProxyConfig{},
+	}
+
+	err = setAgentSockets(&podConfig)
+	assert.Error(err)
+
+	podConfig.AgentConfig = vc.HyperConfig{PauseBinPath: "/pause"}
+
+	err = setAgentSockets(&podConfig)
+	assert.NoError(err)
+
+	dir := filepath.Join(agentSocketDir, testPodID)
+	assert.False(fileExists(dir))
+
+	assert.Equal(dir, podConfig.Annotations[agentSocketDirAnnotation])
+
+	err = createAgentSocketDir(podConfig)
+	assert.NoError(err)
+	assert.True(fileExists(dir))
+
+	agentConfig, ok := podConfig.AgentConfig.(vc.HyperConfig)
+	assert.True(ok)
+
+	assert.Equal("/pause", agentConfig.PauseBinPath)
+	assert.Equal(filepath.Join(dir, "hyper.sock"), agentConfig.SockCtlName)
+	assert.Equal(filepath.Join(dir, "tty.sock"), agentConfig.SockTtyName)
+
+	assert.Equal([]vc.Socket{
+		{DeviceID: "channel0", ID: "charch0", HostPath: agentConfig.SockCtlName, Name: "sh.hyper.channel.0"},
+		{DeviceID: "channel1", ID: "charch1", HostPath: agentConfig.SockTtyName, Name: "sh.hyper.channel.1"},
+	}, agentConfig.Sockets)
+
+	for _, path := range []string{agentConfig.SockCtlName, agentConfig.SockTtyName} {
+		err = ioutil.WriteFile(path, []byte{}, testFileMode)
+		assert.NoError(err)
+	}
+
+	// The sockets are removed using the directory recorded with the
+	// pod, not the current configuration.
+	agentSocketDir = filepath.Join(tmpdir, "other")
+
+	err = removeAgentSockets(dir)
+	assert.NoError(err)
+	assert.False(fileExists(dir))
+
+	// removing again is not an error
+	err = removeAgentSockets(dir)
+	assert.NoError(err)
+
+	// socket path too long
+	podConfig = vc.PodConfig{
+		ID:          strings.Repeat("a", maxSocketPathLen),
+		AgentConfig: vc.HyperConfig{},
+	}
+
+	err = setAgentSockets(&podConfig)
+	assert.Error(err)
+}
+
+func TestRemoveAgentSocketsUnexpectedFile(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	path := filepath.Join(tmpdir, "file")
+
+	err = ioutil.WriteFile(path, []byte{}, testFileMode)
+	assert.NoError(err)
+
+	// only the agent sockets are removed
+	err = removeAgentSockets(tmpdir)
+	assert.Error(err)
+	assert.True(fileExists(path))
+}
+
+func TestGetPodAgentSocketDir(t *testing.T) {
+	assert := assert.New(t)
+
+	testingImpl.StatusPodFunc = func(podID string) (vc.PodStatus, error) {
+		if podID != testPodID {
+			return vc.PodStatus{}, fmt.Errorf("pod %s not found", podID)
+		}
+
+		return vc.PodStatus{
+			ID: podID,
+			Annotations: map[string]string{
+				agentSocketDirAnnotation: "/run/test/" + podID,
+			},
+		}, nil
+	}
+
+	defer func() {
+		testingImpl.StatusPodFunc = nil
+	}()
+
+	assert.Equal("/run/test/"+testPodID, getPodAgentSocketDir(testPodID))
+	assert.Equal("", getPodAgentSocketDir(testContainerID))
+}
+
+func TestCreateAgentSockets(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	savedAgentSocketDir := agentSocketDir
+	agentSocketDir = filepath.Join(tmpdir, "sockets")
+
+	defer func() {
+		agentSocketDir = savedAgentSocketDir
+	}()
+
+	pod := &vcMock.Pod{
+		MockID: testContainerID,
+		MockContainers: []*vcMock.Container{
+			{MockID: testContainerID},
+		},
+	}
+
+	var socketPaths []string
+
+	// Create the sockets as the hypervisor would.
+	testingImpl.CreatePodFunc = func(podConfig vc.PodConfig) (vc.VCPod, error) {
+		agentConfig := podConfig.AgentConfig.(vc.HyperConfig)
+
+		for _, s := range agentConfig.Sockets {
+			l, err := net.Listen("unix", s.HostPath)
+			if err != nil {
+				return nil, err
+			}
+			defer l.Close()
+
+			socketPaths = append(socketPaths, s.HostPath)
+		}
+
+		return pod, nil
+	}
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		// No pre-existing pods
+		return []vc.PodStatus{}, nil
+	}
+
+	defer func() {
+		testingImpl.CreatePodFunc = nil
+		testingImpl.ListPodFunc = nil
+	}()
+
+	runtimeConfig, err := newTestRuntimeConfig(tmpdir, testConsole, true)
+	assert.NoError(err)
+
+	bundlePath := filepath.Join(tmpdir, "bundle")
+
+	err = makeOCIBundle(bundlePath)
+	assert.NoError(err)
+
+	ociConfigFile := filepath.Join(bundlePath, "config.json")
+
+	spec, err := readOCIConfigFile(ociConfigFile)
+	assert.NoError(err)
+
+	spec.Annotations = map[string]string{
+		testContainerTypeAnnotation: testContainerTypePod,
+	}
+
+	err = writeOCIConfigFile(spec, ociConfigFile)
+	assert.NoError(err)
+
+	err = create(testContainerID, bundlePath, testConsole, filepath.Join(tmpdir, "pidfile.txt"), true, runtimeConfig, consoleLogConfig{})
+	assert.NoError(err)
+
+	dir := filepath.Join(agentSocketDir, testContainerID)
+
+	assert.Equal([]string{
+		filepath.Join(dir, "hyper.sock"),
+		filepath.Join(dir, "tty.sock"),
+	}, socketPaths)
+}
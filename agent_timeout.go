@@ -0,0 +1,220 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// defaultAgentTimeout is the default maximum amount of time to wait for
+// the agent of a pod to respond.
+const defaultAgentTimeout = 30 * time.Second
+
+// agentTimeout is the maximum amount of time to wait for the agent of a
+// pod to respond, set by the agent_timeout option of the runtime
+// configuration or the --timeout global option. Zero means waiting
+// forever.
+var agentTimeout = defaultAgentTimeout
+
+// proxyRetryDelay is the delay before the first new attempt to connect to
+// the proxy. It doubles after each attempt, up to maxProxyRetryDelay.
+var proxyRetryDelay = 100 * time.Millisecond
+
+// maxProxyRetryDelay is the maximum delay between two attempts to connect
+// to the proxy.
+var maxProxyRetryDelay = 2 * time.Second
+
+// maxAgentReconnects is the maximum number of times a virtcontainers call
+// is run again after losing its connection to the agent.
+var maxAgentReconnects = 3
+
+// stopVMFunc is used to stop the VM of a pod whose agent did not respond.
+// It is a variable to allow tests to mock it.
+var stopVMFunc = stopVM
+
+// agentTimeoutError is returned when the agent of a pod did not respond
+// within agentTimeout.
+type agentTimeoutError struct {
+	timeout time.Duration
+}
+
+func (e agentTimeoutError) Error() string {
+	return fmt.Sprintf("agent did not respond within %v", e.timeout)
+}
+
+// stopVM asks the hypervisor of the specified pod to exit, killing it if
+// it does not answer.
+func stopVM(podID string) error {
+	if err := qmpRun(podID, "quit", nil); err == nil {
+		return nil
+	}
+
+	return killVM(podID)
+}
+
+// withAgentTimeout runs fn, a virtcontainers call which needs the agent
+// of the specified pod to respond. If fn does not return within
+// agentTimeout, the VM of the pod is stopped and an agentTimeoutError is
+// returned.
+//
+// XXX: virtcontainers waits forever for the proxy to reach the agent and
+// cannot be cancelled, so fn is waited for once the VM is gone, which
+// makes it fail, for up to agentTimeout. This prevents it from changing
+// the state of the pod after the caller cleaned it up.
+func withAgentTimeout(podID string, fn func() error) error {
+	if agentTimeout == 0 {
+		return fn()
+	}
+
+	result := make(chan error, 1)
+
+	go func() {
+		result <- fn()
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(agentTimeout):
+	}
+
+	if err := stopVMFunc(podID); err != nil {
+		ccLog.WithFields(logrus.Fields{
+			"pod":   podID,
+			"error": err,
+		}).Warn("Cannot stop VM of unresponsive agent")
+	}
+
+	select {
+	case <-result:
+	case <-time.After(agentTimeout):
+		ccLog.WithField("pod", podID).Warn("Call to unresponsive agent did not return after stopping VM")
+	}
+
+	return agentTimeoutError{timeout: agentTimeout}
+}
+
+// isProxyConnectionError returns true if err means the proxy could not be
+// reached, for example because it is being restarted.
+func isProxyConnectionError(err error) bool {
+	opErr, ok := err.(*net.OpError)
+
+	return ok && opErr.Op == "dial"
+}
+
+// isAgentDisconnectError returns true if err means the connection to the
+// proxy or the agent was lost after being established, which a new
+// connection may not suffer from.
+func isAgentDisconnectError(err error) bool {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return true
+	}
+
+	opErr, ok := err.(*net.OpError)
+	if !ok || opErr.Op == "dial" {
+		return false
+	}
+
+	errno := opErr.Err
+	if sysErr, ok := errno.(*os.SyscallError); ok {
+		errno = sysErr.Err
+	}
+
+	return errno == syscall.ECONNRESET || errno == syscall.EPIPE
+}
+
+// withAgentReconnect runs fn, a virtcontainers call which connects to the
+// agent of the specified pod, again if it loses its connection, up to
+// maxAgentReconnects times. virtcontainers connects to the proxy of the
+// pod anew on every call, using the proxy URL and token stored in the pod
+// state. If the VM of the pod is no longer running, fn is not retried and
+// an error saying so is returned. Reconnections are logged with log.
+//
+// fn may have changed the state of the pod before losing its connection.
+// If canRetry is set, it is called before running fn again and returns an
+// error if fn cannot be run again in the current state of the pod.
+func withAgentReconnect(log *logrus.Entry, podID string, canRetry func() error, fn func() error) error {
+	for reconnects := 0; ; reconnects++ {
+		err := fn()
+		if err == nil || !isAgentDisconnectError(err) {
+			return err
+		}
+
+		if !vmRunningFunc(podID) {
+			return fmt.Errorf("VM of pod %v is not running: %v", podID, err)
+		}
+
+		if canRetry != nil {
+			if retryErr := canRetry(); retryErr != nil {
+				return fmt.Errorf("Lost connection to agent (%v) and cannot retry: %v", err, retryErr)
+			}
+		}
+
+		if reconnects >= maxAgentReconnects {
+			return err
+		}
+
+		log.WithFields(logrus.Fields{
+			"reconnect": reconnects + 1,
+			"error":     err,
+		}).Info("Lost connection to agent, reconnecting")
+
+		time.Sleep(proxyRetryDelay)
+	}
+}
+
+// withProxyRetry runs fn, a virtcontainers call which connects to the
+// proxy of the specified pod, until it does not fail to connect. The
+// delay between two attempts grows exponentially and fn is not retried
+// once agentTimeout would be exceeded. fn is also run again if it loses
+// its connection, as described for withAgentReconnect(), which log and
+// canRetry are passed to.
+//
+// fn must not have changed the state of the pod if it failed to connect.
+func withProxyRetry(log *logrus.Entry, podID string, canRetry func() error, fn func() error) error {
+	deadline := time.Now().Add(agentTimeout)
+	delay := proxyRetryDelay
+
+	for attempt := 1; ; attempt++ {
+		err := withAgentReconnect(log, podID, canRetry, fn)
+		if err == nil || !isProxyConnectionError(err) {
+			return err
+		}
+
+		if agentTimeout != 0 && time.Now().Add(delay).After(deadline) {
+			return err
+		}
+
+		log.WithFields(logrus.Fields{
+			"attempt": attempt,
+			"delay":   delay.String(),
+			"error":   err,
+		}).Debug("Cannot connect to proxy, retrying")
+
+		time.Sleep(delay)
+
+		delay *= 2
+		if delay > maxProxyRetryDelay {
+			delay = maxProxyRetryDelay
+		}
+	}
+}
@@ -0,0 +1,654 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/containers/virtcontainers/pkg/vcMock"
+	"github.com/stretchr/testify/assert"
+)
+
+const testAgentTimeout = 50 * time.Millisecond
+
+// testProxyConnectionError is returned when the proxy rejects the
+// connection.
+var testProxyConnectionError = &net.OpError{Op: "dial", Net: "unix", Err: syscall.ECONNREFUSED}
+
+// setTestAgentTimeout sets the agent timeout and mocks the stopping of
+// the VM, returning the pods whose VM was stopped.
+func setTestAgentTimeout(timeout time.Duration) (*[]string, func()) {
+	savedTimeout := agentTimeout
+	savedStopVM := stopVMFunc
+	savedRetryDelay := proxyRetryDelay
+
+	var stopped []string
+
+	agentTimeout = timeout
+	proxyRetryDelay = time.Millisecond
+	stopVMFunc = func(podID string) error {
+		stopped = append(stopped, podID)
+		return nil
+	}
+
+	return &stopped, func() {
+		agentTimeout = savedTimeout
+		stopVMFunc = savedStopVM
+		proxyRetryDelay = savedRetryDelay
+	}
+}
+
+func TestWithAgentTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	stopped, restore := setTestAgentTimeout(testAgentTimeout)
+	defer restore()
+
+	expectedErr := errors.New("foo")
+
+	err := withAgentTimeout(testPodID, func() error {
+		return expectedErr
+	})
+	assert.Equal(expectedErr, err)
+	assert.Empty(*stopped)
+
+	err = withAgentTimeout(testPodID, func() error {
+		return nil
+	})
+	assert.NoError(err)
+	assert.Empty(*stopped)
+
+	// the agent never answers
+	block := make(chan struct{})
+	defer close(block)
+
+	err = withAgentTimeout(testPodID, func() error {
+		<-block
+		return nil
+	})
+	assert.Error(err)
+	assert.Contains(err.Error(), "agent did not respond within 50ms")
+	assert.Equal([]string{testPodID}, *stopped)
+}
+
+func TestWithAgentTimeoutWait(t *testing.T) {
+	assert := assert.New(t)
+
+	_, restore := setTestAgentTimeout(testAgentTimeout)
+	defer restore()
+
+	// the call fails once the VM is stopped
+	vmStopped := make(chan struct{})
+	stopVMFunc = func(podID string) error {
+		close(vmStopped)
+		return nil
+	}
+
+	returned := false
+
+	err := withAgentTimeout(testPodID, func() error {
+		<-vmStopped
+		returned = true
+		return errors.New("VM stopped")
+	})
+	assert.Error(err)
+	assert.IsType(agentTimeoutError{}, err)
+	assert.True(returned)
+}
+
+func TestWithAgentTimeoutDisabled(t *testing.T) {
+	assert := assert.New(t)
+
+	stopped, restore := setTestAgentTimeout(0)
+	defer restore()
+
+	err := withAgentTimeout(testPodID, func() error {
+		time.Sleep(2 * testAgentTimeout)
+		return nil
+	})
+	assert.NoError(err)
+	assert.Empty(*stopped)
+}
+
+func TestStopVM(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	savedProcPath := procPath
+	procPath = filepath.Join(tmpdir, "proc")
+
+	defer func() {
+		procPath = savedProcPath
+	}()
+
+	// without a QMP server, the hypervisor is killed
+	cmd := exec.Command("sleep", "60")
+	err = cmd.Start()
+	assert.NoError(err)
+
+	createFakeProcess(assert, cmd.Process.Pid, "/usr/bin/qemu-lite-system-x86_64", "-name", vmNamePrefix+testPodID)
+
+	err = stopVM(testPodID)
+	assert.NoError(err)
+
+	err = cmd.Wait()
+	assert.Error(err)
+
+	commands, restore := setTestQMPServer(assert, tmpdir, testPodID, nil)
+	defer restore()
+
+	err = stopVM(testPodID)
+	assert.NoError(err)
+
+	var received []string
+	for command := range commands {
+		received = append(received, command)
+	}
+
+	assert.Equal([]string{"qmp_capabilities", "quit"}, received)
+}
+
+func TestCreateAgentTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	stopped, restore := setTestAgentTimeout(testAgentTimeout)
+	defer restore()
+
+	// a stub agent that never answers
+	block := make(chan struct{})
+	defer close(block)
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		// No pre-existing pods
+		return []vc.PodStatus{}, nil
+	}
+
+	testingImpl.CreatePodFunc = func(podConfig vc.PodConfig) (vc.VCPod, error) {
+		<-block
+		return nil, errors.New("VM stopped")
+	}
+
+	deleted := false
+
+	testingImpl.DeletePodFunc = func(podID string) (vc.VCPod, error) {
+		deleted = true
+		return &vcMock.Pod{MockID: podID}, nil
+	}
+
+	defer func() {
+		testingImpl.ListPodFunc = nil
+		testingImpl.CreatePodFunc = nil
+		testingImpl.DeletePodFunc = nil
+	}()
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	runtimeConfig, err := newTestRuntimeConfig(tmpdir, testConsole, true)
+	assert.NoError(err)
+
+	bundlePath := filepath.Join(tmpdir, "bundle")
+
+	err = makeOCIBundle(bundlePath)
+	assert.NoError(err)
+
+	ociConfigFile := filepath.Join(bundlePath, "config.json")
+
+	spec, err := readOCIConfigFile(ociConfigFile)
+	assert.NoError(err)
+
+	spec.Annotations = map[string]string{
+		testContainerTypeAnnotation: testContainerTypePod,
+	}
+
+	err = writeOCIConfigFile(spec, ociConfigFile)
+	assert.NoError(err)
+
+	err = create(testContainerID, bundlePath, testConsole, filepath.Join(tmpdir, "pidfile"), true, runtimeConfig, consoleLogConfig{})
+	assert.Error(err)
+	assert.Contains(err.Error(), "agent did not respond within 50ms")
+	assert.Equal([]string{testContainerID}, *stopped)
+	assert.True(deleted)
+}
+
+func TestStartAgentTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	stopped, restore := setTestAgentTimeout(testAgentTimeout)
+	defer restore()
+
+	configPath := testConfigSetup(t)
+	configJSON, err := readOCIConfigJSON(configPath)
+	assert.NoError(err)
+
+	// a stub agent that never answers
+	block := make(chan struct{})
+	defer close(block)
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{
+			{
+				ID: testPodID,
+				ContainersStatus: []vc.ContainerStatus{
+					{
+						ID: testPodID,
+						Annotations: map[string]string{
+							oci.ContainerTypeKey: string(vc.PodSandbox),
+							oci.ConfigJSONKey:    configJSON,
+						},
+					},
+				},
+			},
+		}, nil
+	}
+
+	testingImpl.StartPodFunc = func(podID string) (vc.VCPod, error) {
+		<-block
+		return &vcMock.Pod{MockID: podID}, nil
+	}
+
+	defer func() {
+		testingImpl.ListPodFunc = nil
+		testingImpl.StartPodFunc = nil
+	}()
+
+	_, err = start(testPodID)
+	assert.Error(err)
+	assert.Contains(err.Error(), "agent did not respond within 50ms")
+	assert.Equal([]string{testPodID}, *stopped)
+}
+
+func TestIsProxyConnectionError(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(isProxyConnectionError(testProxyConnectionError))
+	assert.False(isProxyConnectionError(&net.OpError{Op: "read", Net: "unix", Err: syscall.ECONNRESET}))
+	assert.False(isProxyConnectionError(errors.New("foo")))
+	assert.False(isProxyConnectionError(nil))
+}
+
+func TestWithAgentRetry(t *testing.T) {
+	assert := assert.New(t)
+
+	_, restore := setTestAgentTimeout(testAgentTimeout)
+	defer restore()
+
+	attempts := 0
+
+	// the proxy rejects the first attempts
+	err := withProxyRetry(ccLog, testPodID, nil, func() error {
+		attempts++
+		if attempts <= 3 {
+			return testProxyConnectionError
+		}
+		return nil
+	})
+	assert.NoError(err)
+	assert.Equal(4, attempts)
+
+	// other errors are not retried
+	attempts = 0
+	expectedErr := errors.New("foo")
+
+	err = withProxyRetry(ccLog, testPodID, nil, func() error {
+		attempts++
+		return expectedErr
+	})
+	assert.Equal(expectedErr, err)
+	assert.Equal(1, attempts)
+
+	// the proxy never accepts the connection
+	attempts = 0
+
+	err = withProxyRetry(ccLog, testPodID, nil, func() error {
+		attempts++
+		return testProxyConnectionError
+	})
+	assert.Equal(testProxyConnectionError, err)
+	assert.True(attempts > 1)
+}
+
+func TestWithAgentRetryBackoff(t *testing.T) {
+	assert := assert.New(t)
+
+	_, restore := setTestAgentTimeout(time.Second)
+	defer restore()
+
+	savedMaxRetryDelay := maxProxyRetryDelay
+	maxProxyRetryDelay = 4 * time.Millisecond
+	defer func() {
+		maxProxyRetryDelay = savedMaxRetryDelay
+	}()
+
+	var times []time.Time
+
+	err := withProxyRetry(ccLog, testPodID, nil, func() error {
+		times = append(times, time.Now())
+		if len(times) <= 4 {
+			return testProxyConnectionError
+		}
+		return nil
+	})
+	assert.NoError(err)
+	assert.Len(times, 5)
+
+	// 1ms, 2ms, 4ms then capped to 4ms
+	expected := []time.Duration{1, 2, 4, 4}
+
+	for i, delay := range expected {
+		assert.True(times[i+1].Sub(times[i]) >= delay*time.Millisecond)
+	}
+}
+
+func TestStartProxyRetry(t *testing.T) {
+	assert := assert.New(t)
+
+	stopped, restore := setTestAgentTimeout(time.Second)
+	defer restore()
+
+	configPath := testConfigSetup(t)
+	configJSON, err := readOCIConfigJSON(configPath)
+	assert.NoError(err)
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{
+			{
+				ID: testPodID,
+				ContainersStatus: []vc.ContainerStatus{
+					{
+						ID: testPodID,
+						Annotations: map[string]string{
+							oci.ContainerTypeKey: string(vc.PodSandbox),
+							oci.ConfigJSONKey:    configJSON,
+						},
+					},
+				},
+			},
+		}, nil
+	}
+
+	attempts := 0
+
+	// a proxy which rejects the first attempts
+	testingImpl.StartPodFunc = func(podID string) (vc.VCPod, error) {
+		attempts++
+		if attempts <= 2 {
+			return nil, testProxyConnectionError
+		}
+		return &vcMock.Pod{MockID: podID}, nil
+	}
+
+	defer func() {
+		testingImpl.ListPodFunc = nil
+		testingImpl.StartPodFunc = nil
+	}()
+
+	pod, err := start(testPodID)
+	assert.NoError(err)
+	assert.Equal(testPodID, pod.ID())
+	assert.Equal(3, attempts)
+	assert.Empty(*stopped)
+}
+
+// setTestVMRunning mocks the check of whether the VM of a pod is running.
+func setTestVMRunning(running bool) func() {
+	savedVMRunningFunc := vmRunningFunc
+
+	vmRunningFunc = func(podID string) bool {
+		return running
+	}
+
+	return func() {
+		vmRunningFunc = savedVMRunningFunc
+	}
+}
+
+// testAgentStub is a stub agent listening on a UNIX socket which drops
+// the first connections and answers "ok" to the next ones.
+func testAgentStub(l net.Listener, drops int) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		if drops > 0 {
+			drops--
+		} else {
+			conn.Write([]byte("ok"))
+		}
+
+		conn.Close()
+	}
+}
+
+// testAgentRPC connects to the stub agent at path and reads its answer.
+func testAgentRPC(path string) error {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	answer := make([]byte, 2)
+
+	_, err = io.ReadFull(conn, answer)
+	return err
+}
+
+func TestIsAgentDisconnectError(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(isAgentDisconnectError(io.EOF))
+	assert.True(isAgentDisconnectError(io.ErrUnexpectedEOF))
+	assert.True(isAgentDisconnectError(&net.OpError{Op: "read", Net: "unix", Err: syscall.ECONNRESET}))
+	assert.True(isAgentDisconnectError(&net.OpError{Op: "write", Net: "unix",
+		Err: os.NewSyscallError("write", syscall.EPIPE)}))
+
+	assert.False(isAgentDisconnectError(testProxyConnectionError))
+	assert.False(isAgentDisconnectError(&net.OpError{Op: "read", Net: "unix", Err: syscall.EINVAL}))
+	assert.False(isAgentDisconnectError(errors.New("foo")))
+	assert.False(isAgentDisconnectError(nil))
+}
+
+func TestWithAgentReconnect(t *testing.T) {
+	assert := assert.New(t)
+
+	_, restore := setTestAgentTimeout(testAgentTimeout)
+	defer restore()
+
+	defer setTestVMRunning(true)()
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	path := filepath.Join(tmpdir, "agent.sock")
+
+	l, err := net.Listen("unix", path)
+	assert.NoError(err)
+	defer l.Close()
+
+	// the stub agent drops the connection once then recovers
+	go testAgentStub(l, 1)
+
+	attempts := 0
+
+	err = withAgentReconnect(ccLog, testPodID, nil, func() error {
+		attempts++
+		return testAgentRPC(path)
+	})
+	assert.NoError(err)
+	assert.Equal(2, attempts)
+
+	// other errors are not retried
+	attempts = 0
+	expectedErr := errors.New("foo")
+
+	err = withAgentReconnect(ccLog, testPodID, nil, func() error {
+		attempts++
+		return expectedErr
+	})
+	assert.Equal(expectedErr, err)
+	assert.Equal(1, attempts)
+
+	// the connection is always lost
+	attempts = 0
+
+	err = withAgentReconnect(ccLog, testPodID, nil, func() error {
+		attempts++
+		return io.EOF
+	})
+	assert.Equal(io.EOF, err)
+	assert.Equal(maxAgentReconnects+1, attempts)
+}
+
+func TestWithAgentReconnectVMNotRunning(t *testing.T) {
+	assert := assert.New(t)
+
+	_, restore := setTestAgentTimeout(testAgentTimeout)
+	defer restore()
+
+	defer setTestVMRunning(false)()
+
+	attempts := 0
+
+	err := withAgentReconnect(ccLog, testPodID, nil, func() error {
+		attempts++
+		return io.EOF
+	})
+	assert.Error(err)
+	assert.Contains(err.Error(), "not running")
+	assert.Equal(1, attempts)
+}
+
+func TestKillAgentReconnect(t *testing.T) {
+	assert := assert.New(t)
+
+	_, restore := setTestAgentTimeout(testAgentTimeout)
+	defer restore()
+
+	defer setTestVMRunning(true)()
+
+	state := vc.State{
+		State: vc.StateRunning,
+	}
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return newSingleContainerPodStatusList(testPodID, testContainerID, state, state, map[string]string{}), nil
+	}
+
+	attempts := 0
+
+	// the connection to the agent is lost during the first attempt
+	testingImpl.KillContainerFunc = func(podID, containerID string, signal syscall.Signal, all bool) error {
+		attempts++
+		if attempts == 1 {
+			return &net.OpError{Op: "read", Net: "unix", Err: syscall.ECONNRESET}
+		}
+		return nil
+	}
+
+	defer func() {
+		testingImpl.KillContainerFunc = nil
+		testingImpl.ListPodFunc = nil
+	}()
+
+	err := kill(testContainerID, "SIGTERM", false)
+	assert.NoError(err)
+	assert.Equal(2, attempts)
+}
+
+func TestStartPodAgentReconnect(t *testing.T) {
+	assert := assert.New(t)
+
+	_, restore := setTestAgentTimeout(time.Second)
+	defer restore()
+
+	defer setTestVMRunning(true)()
+
+	configPath := testConfigSetup(t)
+	configJSON, err := readOCIConfigJSON(configPath)
+	assert.NoError(err)
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{
+			{
+				ID: testPodID,
+				ContainersStatus: []vc.ContainerStatus{
+					{
+						ID: testPodID,
+						Annotations: map[string]string{
+							oci.ContainerTypeKey: string(vc.PodSandbox),
+							oci.ConfigJSONKey:    configJSON,
+						},
+					},
+				},
+			},
+		}, nil
+	}
+
+	podState := vc.StateReady
+
+	testingImpl.StatusPodFunc = func(podID string) (vc.PodStatus, error) {
+		return vc.PodStatus{ID: podID, State: vc.State{State: podState}}, nil
+	}
+
+	attempts := 0
+
+	// the connection to the agent is lost during the first attempt
+	testingImpl.StartPodFunc = func(podID string) (vc.VCPod, error) {
+		attempts++
+		if attempts == 1 {
+			return nil, io.EOF
+		}
+		return &vcMock.Pod{MockID: podID}, nil
+	}
+
+	defer func() {
+		testingImpl.ListPodFunc = nil
+		testingImpl.StatusPodFunc = nil
+		testingImpl.StartPodFunc = nil
+	}()
+
+	// the pod is still ready, so starting it is retried
+	_, err = start(testPodID)
+	assert.NoError(err)
+	assert.Equal(2, attempts)
+
+	// the pod was started before the connection was lost
+	attempts = 0
+	podState = vc.StateRunning
+
+	_, err = start(testPodID)
+	assert.Error(err)
+	assert.Contains(err.Error(), "cannot retry")
+	assert.Equal(1, attempts)
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	vc "github.com/containers/virtcontainers"
+)
+
+// OCI annotations that override the hypervisor configuration of a pod.
+const (
+	hypervisorAnnotationPrefix = "com.github.containers.virtcontainers."
+
+	// memoryAnnotation specifies the memory of the VM in MiB.
+	memoryAnnotation = hypervisorAnnotationPrefix + "memory"
+
+	// vcpusAnnotation specifies the number of vCPUs of the VM.
+	vcpusAnnotation = hypervisorAnnotationPrefix + "vcpus"
+
+	// kernelParamsAnnotation specifies additional space-separated
+	// guest kernel parameters.
+	kernelParamsAnnotation = hypervisorAnnotationPrefix + "kernel_params"
+
+	// kernelModulesAnnotation specifies a comma-separated list of
+	// additional kernel modules to load in the guest at boot.
+	kernelModulesAnnotation = hypervisorAnnotationPrefix + "kernel_modules"
+)
+
+const (
+	// minAnnotationMemory is the minimum memory in MiB that can be
+	// specified by memoryAnnotation. The maximum is the memory of the
+	// host.
+	minAnnotationMemory = 8
+
+	// maxAnnotationVCPUs is the maximum number of vCPUs that can be
+	// specified by vcpusAnnotation (qemu supports max 255).
+	maxAnnotationVCPUs = 255
+)
+
+// applyHypervisorAnnotations overrides the hypervisor configuration with
+// the values of any hypervisor annotations found in the OCI annotations.
+//
+// Unknown annotations are ignored. Resources requested by the OCI
+// specification (such as a memory limit) still take priority over the
+// values set here.
+func applyHypervisorAnnotations(annotations map[string]string, config *vc.HypervisorConfig) error {
+	if value, ok := annotations[memoryAnnotation]; ok {
+		hostMemory, _, err := getHostMemoryInfo()
+		if err != nil {
+			return fmt.Errorf("Cannot check annotation %s: %v", memoryAnnotation, err)
+		}
+
+		memory, err := strconv.ParseUint(value, 10, 32)
+		if err != nil || memory < minAnnotationMemory || memory > hostMemory {
+			return fmt.Errorf("Invalid annotation %s=%q: must be between %d and %d, the host memory (MiB)",
+				memoryAnnotation, value, minAnnotationMemory, hostMemory)
+		}
+
+		config.DefaultMemSz = uint32(memory)
+	}
+
+	if value, ok := annotations[vcpusAnnotation]; ok {
+		vcpus, err := strconv.ParseUint(value, 10, 32)
+		if err != nil || vcpus < 1 || vcpus > maxAnnotationVCPUs {
+			return fmt.Errorf("Invalid annotation %s=%q: must be between 1 and %d",
+				vcpusAnnotation, value, maxAnnotationVCPUs)
+		}
+
+		config.DefaultVCPUs = uint32(vcpus)
+	}
+
+	if value, ok := annotations[kernelParamsAnnotation]; ok {
+		for _, p := range vc.DeserializeParams(strings.Fields(value)) {
+			if err := config.AddKernelParam(p); err != nil {
+				return fmt.Errorf("Invalid annotation %s=%q: %v",
+					kernelParamsAnnotation, value, err)
+			}
+		}
+	}
+
+	if value, ok := annotations[kernelModulesAnnotation]; ok {
+		modules, err := parseKernelModules(strings.Split(value, ","))
+		if err != nil {
+			return fmt.Errorf("Invalid annotation %s=%q: %v",
+				kernelModulesAnnotation, value, err)
+		}
+
+		if err := config.AddKernelParam(kernelModulesParam(modules)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,203 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/vcMock"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// testHostMemory is the host memory in MiB set by setTestHostMemory().
+const testHostMemory = 16384
+
+// setTestHostMemory makes the host memory testHostMemory and returns a
+// function restoring the real value.
+func setTestHostMemory(assert *assert.Assertions, dir string) func() {
+	savedProcMemInfo := procMemInfo
+	procMemInfo = filepath.Join(dir, "meminfo")
+
+	err := ioutil.WriteFile(procMemInfo, []byte(fmt.Sprintf("MemTotal: %d kB\nMemFree: 1024 kB\n", testHostMemory*1024)), testFileMode)
+	assert.NoError(err)
+
+	return func() {
+		procMemInfo = savedProcMemInfo
+	}
+}
+
+func TestApplyHypervisorAnnotations(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	defer setTestHostMemory(assert, tmpdir)()
+
+	type testData struct {
+		annotations    map[string]string
+		expectFailure  bool
+		expectedMemory uint32
+		expectedVCPUs  uint32
+		expectedParams []vc.Param
+	}
+
+	data := []testData{
+		{nil, false, 2048, 1, nil},
+		{map[string]string{}, false, 2048, 1, nil},
+
+		// unknown annotations are ignored
+		{map[string]string{"foo": "bar"}, false, 2048, 1, nil},
+		{map[string]string{hypervisorAnnotationPrefix + "foo": "bar"}, false, 2048, 1, nil},
+
+		{map[string]string{memoryAnnotation: "4096"}, false, 4096, 1, nil},
+		{map[string]string{memoryAnnotation: "8"}, false, 8, 1, nil},
+		{map[string]string{memoryAnnotation: ""}, true, 0, 0, nil},
+		{map[string]string{memoryAnnotation: "7"}, true, 0, 0, nil},
+		{map[string]string{memoryAnnotation: "-1"}, true, 0, 0, nil},
+		{map[string]string{memoryAnnotation: "2G"}, true, 0, 0, nil},
+		{map[string]string{memoryAnnotation: "16384"}, false, testHostMemory, 1, nil},
+		{map[string]string{memoryAnnotation: "16385"}, true, 0, 0, nil},
+		{map[string]string{memoryAnnotation: "4294967295"}, true, 0, 0, nil},
+
+		{map[string]string{vcpusAnnotation: "4"}, false, 2048, 4, nil},
+		{map[string]string{vcpusAnnotation: "255"}, false, 2048, 255, nil},
+		{map[string]string{vcpusAnnotation: "0"}, true, 0, 0, nil},
+		{map[string]string{vcpusAnnotation: "256"}, true, 0, 0, nil},
+		{map[string]string{vcpusAnnotation: "one"}, true, 0, 0, nil},
+
+		{map[string]string{kernelParamsAnnotation: ""}, false, 2048, 1, nil},
+		{map[string]string{kernelParamsAnnotation: "quiet foo=bar"}, false, 2048, 1,
+			[]vc.Param{{Key: "quiet", Value: ""}, {Key: "foo", Value: "bar"}}},
+		{map[string]string{kernelParamsAnnotation: "=bar"}, true, 0, 0, nil},
+
+		{map[string]string{kernelModulesAnnotation: "overlay"}, false, 2048, 1,
+			[]vc.Param{{Key: modulesLoadParam, Value: "overlay"}}},
+		{map[string]string{kernelModulesAnnotation: "overlay, nf_conntrack"}, false, 2048, 1,
+			[]vc.Param{{Key: modulesLoadParam, Value: "overlay,nf_conntrack"}}},
+		{map[string]string{kernelModulesAnnotation: ""}, true, 0, 0, nil},
+		{map[string]string{kernelModulesAnnotation: "overlay,"}, true, 0, 0, nil},
+		{map[string]string{kernelModulesAnnotation: "/lib/modules/foo.ko"}, true, 0, 0, nil},
+
+		{
+			map[string]string{
+				memoryAnnotation:       "512",
+				vcpusAnnotation:        "2",
+				kernelParamsAnnotation: "debug",
+			},
+			false, 512, 2,
+			[]vc.Param{{Key: "debug", Value: ""}},
+		},
+	}
+
+	for _, d := range data {
+		config := vc.HypervisorConfig{
+			DefaultMemSz: 2048,
+			DefaultVCPUs: 1,
+		}
+
+		err := applyHypervisorAnnotations(d.annotations, &config)
+		if d.expectFailure {
+			assert.Error(err, "test data: %+v", d)
+			continue
+		}
+
+		assert.NoError(err, "test data: %+v", d)
+		assert.Equal(d.expectedMemory, config.DefaultMemSz, "test data: %+v", d)
+		assert.Equal(d.expectedVCPUs, config.DefaultVCPUs, "test data: %+v", d)
+		assert.Equal(d.expectedParams, config.KernelParams, "test data: %+v", d)
+	}
+
+	// the host memory is unknown
+	procMemInfo = filepath.Join(tmpdir, "does-not-exist")
+
+	err = applyHypervisorAnnotations(map[string]string{memoryAnnotation: "512"}, &vc.HypervisorConfig{})
+	assert.Error(err)
+}
+
+func TestCreatePodHypervisorAnnotations(t *testing.T) {
+	assert := assert.New(t)
+
+	var podConfig vc.PodConfig
+
+	testingImpl.CreatePodFunc = func(config vc.PodConfig) (vc.VCPod, error) {
+		podConfig = config
+		return &vcMock.Pod{
+			MockID: testPodID,
+			MockContainers: []*vcMock.Container{
+				{MockID: testContainerID},
+			},
+		}, nil
+	}
+
+	defer func() {
+		testingImpl.CreatePodFunc = nil
+	}()
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	defer setTestHostMemory(assert, tmpdir)()
+
+	runtimeConfig, err := newTestRuntimeConfig(tmpdir, testConsole, true)
+	assert.NoError(err)
+
+	bundlePath := filepath.Join(tmpdir, "bundle")
+
+	err = makeOCIBundle(bundlePath)
+	assert.NoError(err)
+
+	spec, err := readOCIConfigFile(filepath.Join(bundlePath, "config.json"))
+	assert.NoError(err)
+
+	spec.Annotations = map[string]string{
+		memoryAnnotation: "1024",
+		vcpusAnnotation:  "3",
+	}
+
+	_, err = createPod(spec, runtimeConfig, testContainerID, bundlePath, testConsole, true)
+	assert.NoError(err)
+
+	// the annotations override the configured defaults
+	assert.Equal(uint32(1024), podConfig.HypervisorConfig.DefaultMemSz)
+	assert.Equal(uint32(3), podConfig.HypervisorConfig.DefaultVCPUs)
+	assert.Equal(uint(0), podConfig.VMConfig.Memory)
+
+	// OCI resources take priority over the annotations
+	limit := uint64(4096 * 1024 * 1024)
+	spec.Linux.Resources.Memory = &specs.LinuxMemory{
+		Limit: &limit,
+	}
+
+	_, err = createPod(spec, runtimeConfig, testContainerID, bundlePath, testConsole, true)
+	assert.NoError(err)
+
+	assert.Equal(uint32(1024), podConfig.HypervisorConfig.DefaultMemSz)
+	assert.Equal(uint(4096), podConfig.VMConfig.Memory)
+
+	spec.Annotations[memoryAnnotation] = "lots"
+
+	_, err = createPod(spec, runtimeConfig, testContainerID, bundlePath, testConsole, true)
+	assert.Error(err)
+	assert.False(vcMock.IsMockError(err))
+}
@@ -0,0 +1,259 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/containers/virtcontainers/pkg/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// minBlockIOWeight and maxBlockIOWeight are the bounds of a block IO
+	// weight. A zero weight leaves the weight unset.
+	minBlockIOWeight = 10
+	maxBlockIOWeight = 1000
+
+	// maxDriveIDSize is the maximum size of the ID of a drive given to
+	// the hypervisor when the VM is created, which virtcontainers
+	// truncates the longer IDs to.
+	maxDriveIDSize = 31
+)
+
+// sysDevBlockPath is the directory describing the host block devices. It
+// is a variable to allow tests to modify it.
+var sysDevBlockPath = "/sys/dev/block"
+
+// blockIOThrottle holds the arguments of the block_set_io_throttle QMP
+// command, which limits the bandwidth of a drive of the VM. A zero limit
+// means no limit.
+type blockIOThrottle struct {
+	Device string `json:"device,omitempty"`
+	ID     string `json:"id,omitempty"`
+	Bps    uint64 `json:"bps"`
+	BpsRd  uint64 `json:"bps_rd"`
+	BpsWr  uint64 `json:"bps_wr"`
+	Iops   uint64 `json:"iops"`
+	IopsRd uint64 `json:"iops_rd"`
+	IopsWr uint64 `json:"iops_wr"`
+}
+
+// getBlockIO returns the block IO settings of the specified OCI
+// configuration, or nil if it does not specify any.
+func getBlockIO(ociSpec oci.CompatOCISpec) *specs.LinuxBlockIO {
+	if ociSpec.Linux == nil || ociSpec.Linux.Resources == nil {
+		return nil
+	}
+
+	return ociSpec.Linux.Resources.BlockIO
+}
+
+// validateBlockIOWeight checks the specified weight, if any, is within
+// the valid range.
+func validateBlockIOWeight(weight *uint16) error {
+	if weight == nil || *weight == 0 {
+		return nil
+	}
+
+	if *weight < minBlockIOWeight || *weight > maxBlockIOWeight {
+		return fmt.Errorf("Invalid block IO weight %d: expected a value between %d and %d",
+			*weight, minBlockIOWeight, maxBlockIOWeight)
+	}
+
+	return nil
+}
+
+// validateBlockIO checks the weights of the specified block IO settings
+// are valid.
+func validateBlockIO(blockIO specs.LinuxBlockIO) error {
+	if err := validateBlockIOWeight(blockIO.Weight); err != nil {
+		return err
+	}
+
+	if err := validateBlockIOWeight(blockIO.LeafWeight); err != nil {
+		return err
+	}
+
+	for _, d := range blockIO.WeightDevice {
+		if err := validateBlockIOWeight(d.Weight); err != nil {
+			return fmt.Errorf("Device %d:%d: %v", d.Major, d.Minor, err)
+		}
+
+		if err := validateBlockIOWeight(d.LeafWeight); err != nil {
+			return fmt.Errorf("Device %d:%d: %v", d.Major, d.Minor, err)
+		}
+	}
+
+	return nil
+}
+
+// hasBlockIOWeight returns true if the specified block IO settings
+// specify a weight.
+func hasBlockIOWeight(blockIO specs.LinuxBlockIO) bool {
+	return blockIO.Weight != nil || blockIO.LeafWeight != nil || len(blockIO.WeightDevice) > 0
+}
+
+// hasBlockIOThrottle returns true if the specified block IO settings
+// specify a bandwidth limit.
+func hasBlockIOThrottle(blockIO specs.LinuxBlockIO) bool {
+	return len(blockIO.ThrottleReadBpsDevice) > 0 || len(blockIO.ThrottleWriteBpsDevice) > 0 ||
+		len(blockIO.ThrottleReadIOPSDevice) > 0 || len(blockIO.ThrottleWriteIOPSDevice) > 0
+}
+
+// checkBlockIO validates the block IO settings of the specified OCI
+// configuration, if any.
+//
+// XXX: the agent cannot set up the blkio cgroup of the container, so the
+// weights are not applied. The bandwidth limits are applied by the
+// hypervisor, but only to the drive backing the container rootfs.
+func checkBlockIO(containerID string, ociSpec oci.CompatOCISpec) error {
+	blockIO := getBlockIO(ociSpec)
+	if blockIO == nil {
+		return nil
+	}
+
+	if err := validateBlockIO(*blockIO); err != nil {
+		return err
+	}
+
+	if hasBlockIOWeight(*blockIO) {
+		ccLog.WithField("container", containerID).Warn("Block IO weights are not applied inside the VM")
+	}
+
+	return nil
+}
+
+// getThrottleRate returns the rate limiting the specified device in the
+// specified list, or 0 if the device is not limited.
+func getThrottleRate(devices []specs.LinuxThrottleDevice, major, minor int64) uint64 {
+	var rate uint64
+
+	// As with the cgroup files, the last entry for a device wins.
+	for _, d := range devices {
+		if d.Major == major && d.Minor == minor {
+			rate = d.Rate
+		}
+	}
+
+	return rate
+}
+
+// getBlockIOThrottle returns the bandwidth limits of the specified block
+// IO settings that apply to the host device major:minor, or nil if the
+// device is not limited. The drive they should be applied to is not set.
+func getBlockIOThrottle(blockIO specs.LinuxBlockIO, major, minor int64) *blockIOThrottle {
+	throttle := blockIOThrottle{
+		BpsRd:  getThrottleRate(blockIO.ThrottleReadBpsDevice, major, minor),
+		BpsWr:  getThrottleRate(blockIO.ThrottleWriteBpsDevice, major, minor),
+		IopsRd: getThrottleRate(blockIO.ThrottleReadIOPSDevice, major, minor),
+		IopsWr: getThrottleRate(blockIO.ThrottleWriteIOPSDevice, major, minor),
+	}
+
+	if throttle == (blockIOThrottle{}) {
+		return nil
+	}
+
+	return &throttle
+}
+
+// getRootfsDevice returns the major and minor numbers of the host device
+// holding the specified container rootfs.
+func getRootfsDevice(rootfs string) (major, minor int64, err error) {
+	var st syscall.Stat_t
+
+	if err := syscall.Stat(rootfs, &st); err != nil {
+		return 0, 0, err
+	}
+
+	dev := uint64(st.Dev)
+
+	major = int64(((dev >> 8) & 0xfff) | ((dev >> 32) & 0xfffff000))
+	minor = int64((dev & 0xff) | ((dev >> 12) & 0xffffff00))
+
+	return major, minor, nil
+}
+
+// isDeviceMapper returns true if the host device major:minor is a
+// device-mapper device, in which case virtcontainers passes it to the VM
+// as a drive rather than sharing the rootfs over 9p.
+func isDeviceMapper(major, minor int64) bool {
+	_, err := os.Stat(filepath.Join(sysDevBlockPath, fmt.Sprintf("%d:%d", major, minor), "dm"))
+	return err == nil
+}
+
+// setRootfsDrive sets the drive the specified throttle applies to, which
+// is the drive backing the rootfs of the specified container. The drive
+// of the sandbox container is given to the hypervisor when the VM is
+// created while the others are hot plugged and have to be referred to by
+// their guest device ID.
+func setRootfsDrive(throttle *blockIOThrottle, podID, containerID string) {
+	drive := "drive-" + containerID
+
+	if containerID != podID {
+		throttle.ID = "virtio-" + drive
+		return
+	}
+
+	if len(drive) > maxDriveIDSize {
+		drive = drive[:maxDriveIDSize]
+	}
+
+	throttle.Device = drive
+}
+
+// applyBlockIOThrottle limits the bandwidth of the drive backing the
+// rootfs of the specified container according to the block IO settings
+// of its OCI configuration. Limits for other devices cannot be applied.
+func applyBlockIOThrottle(podID, containerID, rootfs string, ociSpec oci.CompatOCISpec) error {
+	blockIO := getBlockIO(ociSpec)
+	if blockIO == nil || !hasBlockIOThrottle(*blockIO) {
+		return nil
+	}
+
+	major, minor, err := getRootfsDevice(rootfs)
+	if err != nil {
+		return fmt.Errorf("Cannot find the device of container %v rootfs: %v", containerID, err)
+	}
+
+	throttle := getBlockIOThrottle(*blockIO, major, minor)
+
+	if throttle == nil || !isDeviceMapper(major, minor) {
+		ccLog.WithFields(logrus.Fields{
+			"container": containerID,
+			"device":    fmt.Sprintf("%d:%d", major, minor),
+		}).Warn("Block IO limits only apply to a device-mapper rootfs device")
+		return nil
+	}
+
+	setRootfsDrive(throttle, podID, containerID)
+
+	if err := qmpRunWithArgs(podID, "block_set_io_throttle", throttle, nil); err != nil {
+		return fmt.Errorf("Cannot limit the block IO of container %v: %v", containerID, err)
+	}
+
+	ccLog.WithFields(logrus.Fields{
+		"container": containerID,
+		"device":    fmt.Sprintf("%d:%d", major, minor),
+		"bps-read":  throttle.BpsRd,
+		"bps-write": throttle.BpsWr,
+	}).Debug("Limited container block IO")
+
+	return nil
+}
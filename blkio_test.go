@@ -0,0 +1,251 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/containers/virtcontainers/pkg/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestThrottleDevice(major, minor int64, rate uint64) specs.LinuxThrottleDevice {
+	var d specs.LinuxThrottleDevice
+
+	d.Major = major
+	d.Minor = minor
+	d.Rate = rate
+
+	return d
+}
+
+func TestValidateBlockIO(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		blockIO       specs.LinuxBlockIO
+		expectFailure bool
+	}
+
+	weight := func(w uint16) *uint16 {
+		return &w
+	}
+
+	weightDevice := func(w uint16) []specs.LinuxWeightDevice {
+		var d specs.LinuxWeightDevice
+
+		d.Major = 8
+		d.Weight = &w
+
+		return []specs.LinuxWeightDevice{d}
+	}
+
+	data := []testData{
+		{specs.LinuxBlockIO{}, false},
+		{specs.LinuxBlockIO{Weight: weight(0)}, false},
+		{specs.LinuxBlockIO{Weight: weight(10)}, false},
+		{specs.LinuxBlockIO{Weight: weight(1000)}, false},
+		{specs.LinuxBlockIO{LeafWeight: weight(500)}, false},
+		{specs.LinuxBlockIO{WeightDevice: weightDevice(100)}, false},
+
+		{specs.LinuxBlockIO{Weight: weight(9)}, true},
+		{specs.LinuxBlockIO{Weight: weight(1001)}, true},
+		{specs.LinuxBlockIO{LeafWeight: weight(5)}, true},
+		{specs.LinuxBlockIO{WeightDevice: weightDevice(2000)}, true},
+	}
+
+	for _, d := range data {
+		err := validateBlockIO(d.blockIO)
+		if d.expectFailure {
+			assert.Error(err, "test data: %+v", d)
+		} else {
+			assert.NoError(err, "test data: %+v", d)
+		}
+	}
+}
+
+func TestCheckBlockIO(t *testing.T) {
+	assert := assert.New(t)
+
+	var ociSpec oci.CompatOCISpec
+
+	err := checkBlockIO(testContainerID, ociSpec)
+	assert.NoError(err)
+
+	weight := uint16(1)
+
+	ociSpec.Linux = &specs.Linux{
+		Resources: &specs.LinuxResources{
+			BlockIO: &specs.LinuxBlockIO{
+				Weight: &weight,
+			},
+		},
+	}
+
+	err = checkBlockIO(testContainerID, ociSpec)
+	assert.Error(err)
+
+	weight = 100
+
+	err = checkBlockIO(testContainerID, ociSpec)
+	assert.NoError(err)
+}
+
+func TestGetBlockIOThrottle(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		blockIO  specs.LinuxBlockIO
+		expected *blockIOThrottle
+	}
+
+	data := []testData{
+		{specs.LinuxBlockIO{}, nil},
+
+		// other devices
+		{
+			specs.LinuxBlockIO{
+				ThrottleReadBpsDevice:  []specs.LinuxThrottleDevice{newTestThrottleDevice(8, 0, 1024)},
+				ThrottleWriteBpsDevice: []specs.LinuxThrottleDevice{newTestThrottleDevice(253, 2, 1024)},
+			},
+			nil,
+		},
+
+		{
+			specs.LinuxBlockIO{
+				ThrottleReadBpsDevice: []specs.LinuxThrottleDevice{newTestThrottleDevice(253, 1, 1048576)},
+			},
+			&blockIOThrottle{BpsRd: 1048576},
+		},
+		{
+			specs.LinuxBlockIO{
+				ThrottleReadBpsDevice: []specs.LinuxThrottleDevice{
+					newTestThrottleDevice(8, 0, 1024),
+					newTestThrottleDevice(253, 1, 2048),
+				},
+				ThrottleWriteBpsDevice: []specs.LinuxThrottleDevice{newTestThrottleDevice(253, 1, 4096)},
+			},
+			&blockIOThrottle{BpsRd: 2048, BpsWr: 4096},
+		},
+		{
+			specs.LinuxBlockIO{
+				ThrottleReadIOPSDevice:  []specs.LinuxThrottleDevice{newTestThrottleDevice(253, 1, 100)},
+				ThrottleWriteIOPSDevice: []specs.LinuxThrottleDevice{newTestThrottleDevice(253, 1, 50)},
+			},
+			&blockIOThrottle{IopsRd: 100, IopsWr: 50},
+		},
+
+		// the last entry wins
+		{
+			specs.LinuxBlockIO{
+				ThrottleWriteBpsDevice: []specs.LinuxThrottleDevice{
+					newTestThrottleDevice(253, 1, 1024),
+					newTestThrottleDevice(253, 1, 512),
+				},
+			},
+			&blockIOThrottle{BpsWr: 512},
+		},
+	}
+
+	for _, d := range data {
+		throttle := getBlockIOThrottle(d.blockIO, 253, 1)
+		assert.Equal(d.expected, throttle, "test data: %+v", d)
+	}
+}
+
+func TestSetRootfsDrive(t *testing.T) {
+	assert := assert.New(t)
+
+	var throttle blockIOThrottle
+
+	setRootfsDrive(&throttle, "pod", "pod")
+	assert.Equal(blockIOThrottle{Device: "drive-pod"}, throttle)
+
+	id := strings.Repeat("a", 64)
+
+	throttle = blockIOThrottle{}
+	setRootfsDrive(&throttle, id, id)
+	assert.Equal(blockIOThrottle{Device: ("drive-" + id)[:maxDriveIDSize]}, throttle)
+
+	throttle = blockIOThrottle{}
+	setRootfsDrive(&throttle, "pod", id)
+	assert.Equal(blockIOThrottle{ID: "virtio-drive-" + id}, throttle)
+}
+
+func TestApplyBlockIOThrottle(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	savedSysDevBlockPath := sysDevBlockPath
+	sysDevBlockPath = filepath.Join(tmpdir, "block")
+
+	defer func() {
+		sysDevBlockPath = savedSysDevBlockPath
+	}()
+
+	rootfs := filepath.Join(tmpdir, "rootfs")
+	err = os.Mkdir(rootfs, testDirMode)
+	assert.NoError(err)
+
+	major, minor, err := getRootfsDevice(rootfs)
+	assert.NoError(err)
+
+	var ociSpec oci.CompatOCISpec
+
+	// no block IO settings
+	err = applyBlockIOThrottle(testPodID, testPodID, rootfs, ociSpec)
+	assert.NoError(err)
+
+	ociSpec.Linux = &specs.Linux{
+		Resources: &specs.LinuxResources{
+			BlockIO: &specs.LinuxBlockIO{
+				ThrottleReadBpsDevice: []specs.LinuxThrottleDevice{newTestThrottleDevice(major, minor, 1024)},
+			},
+		},
+	}
+
+	// no such rootfs
+	err = applyBlockIOThrottle(testPodID, testPodID, filepath.Join(tmpdir, "foo"), ociSpec)
+	assert.Error(err)
+
+	// not a device-mapper device
+	err = applyBlockIOThrottle(testPodID, testPodID, rootfs, ociSpec)
+	assert.NoError(err)
+
+	err = os.MkdirAll(filepath.Join(sysDevBlockPath, fmt.Sprintf("%d:%d", major, minor), "dm"), testDirMode)
+	assert.NoError(err)
+
+	// no hypervisor
+	err = applyBlockIOThrottle(testPodID, testPodID, rootfs, ociSpec)
+	assert.Error(err)
+
+	commands, restore := setTestQMPServer(assert, tmpdir, testPodID, nil)
+	defer restore()
+
+	err = applyBlockIOThrottle(testPodID, testPodID, rootfs, ociSpec)
+	assert.NoError(err)
+
+	assert.Equal("qmp_capabilities", <-commands)
+	assert.Equal("block_set_io_throttle", <-commands)
+}
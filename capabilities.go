@@ -0,0 +1,144 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// knownCapabilities lists the Linux capabilities a process can be given.
+var knownCapabilities = map[string]bool{
+	"CAP_CHOWN":              true,
+	"CAP_DAC_OVERRIDE":       true,
+	"CAP_DAC_READ_SEARCH":    true,
+	"CAP_FOWNER":             true,
+	"CAP_FSETID":             true,
+	"CAP_KILL":               true,
+	"CAP_SETGID":             true,
+	"CAP_SETUID":             true,
+	"CAP_SETPCAP":            true,
+	"CAP_LINUX_IMMUTABLE":    true,
+	"CAP_NET_BIND_SERVICE":   true,
+	"CAP_NET_BROADCAST":      true,
+	"CAP_NET_ADMIN":          true,
+	"CAP_NET_RAW":            true,
+	"CAP_IPC_LOCK":           true,
+	"CAP_IPC_OWNER":          true,
+	"CAP_SYS_MODULE":         true,
+	"CAP_SYS_RAWIO":          true,
+	"CAP_SYS_CHROOT":         true,
+	"CAP_SYS_PTRACE":         true,
+	"CAP_SYS_PACCT":          true,
+	"CAP_SYS_ADMIN":          true,
+	"CAP_SYS_BOOT":           true,
+	"CAP_SYS_NICE":           true,
+	"CAP_SYS_RESOURCE":       true,
+	"CAP_SYS_TIME":           true,
+	"CAP_SYS_TTY_CONFIG":     true,
+	"CAP_MKNOD":              true,
+	"CAP_LEASE":              true,
+	"CAP_AUDIT_WRITE":        true,
+	"CAP_AUDIT_CONTROL":      true,
+	"CAP_SETFCAP":            true,
+	"CAP_MAC_OVERRIDE":       true,
+	"CAP_MAC_ADMIN":          true,
+	"CAP_SYSLOG":             true,
+	"CAP_WAKE_ALARM":         true,
+	"CAP_BLOCK_SUSPEND":      true,
+	"CAP_AUDIT_READ":         true,
+	"CAP_PERFMON":            true,
+	"CAP_BPF":                true,
+	"CAP_CHECKPOINT_RESTORE": true,
+}
+
+// parseCapabilities returns the capability sets of the capabilities of
+// an OCI process, which are either a list (runtime-spec v1.0.0-rc4) or a
+// structure holding each set (v1.0.0-rc5 and later). A list specifies
+// all the sets but the ambient one.
+func parseCapabilities(capabilities interface{}) (specs.LinuxCapabilities, error) {
+	var caps specs.LinuxCapabilities
+
+	if capabilities == nil {
+		return caps, nil
+	}
+
+	bytes, err := json.Marshal(capabilities)
+	if err != nil {
+		return caps, err
+	}
+
+	var list []string
+
+	if err := json.Unmarshal(bytes, &list); err == nil {
+		caps.Bounding = list
+		caps.Effective = list
+		caps.Inheritable = list
+		caps.Permitted = list
+
+		return caps, nil
+	}
+
+	if err := json.Unmarshal(bytes, &caps); err != nil {
+		return caps, fmt.Errorf("Invalid process capabilities: %v", err)
+	}
+
+	return caps, nil
+}
+
+// validateCapabilities checks the specified capability sets only hold
+// known capabilities and that the ambient capabilities can be raised.
+func validateCapabilities(caps specs.LinuxCapabilities) error {
+	sets := []struct {
+		name string
+		caps []string
+	}{
+		{"bounding", caps.Bounding},
+		{"effective", caps.Effective},
+		{"inheritable", caps.Inheritable},
+		{"permitted", caps.Permitted},
+		{"ambient", caps.Ambient},
+	}
+
+	for _, set := range sets {
+		for _, c := range set.caps {
+			if !knownCapabilities[c] {
+				return fmt.Errorf("Unknown capability %q in the %s set", c, set.name)
+			}
+		}
+	}
+
+	// The kernel only allows raising an ambient capability that is
+	// both permitted and inheritable.
+	permitted := make(map[string]bool)
+	for _, c := range caps.Permitted {
+		permitted[c] = true
+	}
+
+	inheritable := make(map[string]bool)
+	for _, c := range caps.Inheritable {
+		inheritable[c] = true
+	}
+
+	for _, c := range caps.Ambient {
+		if !permitted[c] || !inheritable[c] {
+			return fmt.Errorf("Ambient capability %q must also be in the permitted and inheritable sets", c)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCapabilities(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		json          string
+		expectFailure bool
+		expected      specs.LinuxCapabilities
+	}
+
+	caps := []string{"CAP_CHOWN", "CAP_KILL"}
+
+	data := []testData{
+		{`null`, false, specs.LinuxCapabilities{}},
+
+		// runtime-spec v1.0.0-rc4
+		{`["CAP_CHOWN","CAP_KILL"]`, false, specs.LinuxCapabilities{
+			Bounding:    caps,
+			Effective:   caps,
+			Inheritable: caps,
+			Permitted:   caps,
+		}},
+
+		// runtime-spec v1.0.0-rc5
+		{`{"bounding":["CAP_CHOWN","CAP_KILL"],"ambient":["CAP_KILL"]}`, false, specs.LinuxCapabilities{
+			Bounding: caps,
+			Ambient:  []string{"CAP_KILL"},
+		}},
+
+		{`"CAP_CHOWN"`, true, specs.LinuxCapabilities{}},
+		{`{"bounding":"CAP_CHOWN"}`, true, specs.LinuxCapabilities{}},
+	}
+
+	for _, d := range data {
+		// decode the capabilities as oci.ParseConfigJSON() does
+		var capabilities interface{}
+
+		err := json.Unmarshal([]byte(d.json), &capabilities)
+		assert.NoError(err, "test data: %+v", d)
+
+		parsed, err := parseCapabilities(capabilities)
+		if d.expectFailure {
+			assert.Error(err, "test data: %+v", d)
+			continue
+		}
+
+		assert.NoError(err, "test data: %+v", d)
+		assert.Equal(d.expected, parsed, "test data: %+v", d)
+	}
+}
+
+func TestValidateCapabilities(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		caps          specs.LinuxCapabilities
+		expectFailure bool
+	}
+
+	data := []testData{
+		{specs.LinuxCapabilities{}, false},
+		{specs.LinuxCapabilities{
+			Bounding:  []string{"CAP_CHOWN", "CAP_NET_RAW"},
+			Effective: []string{"CAP_CHOWN"},
+		}, false},
+		{specs.LinuxCapabilities{
+			Inheritable: []string{"CAP_NET_BIND_SERVICE"},
+			Permitted:   []string{"CAP_NET_BIND_SERVICE", "CAP_CHOWN"},
+			Ambient:     []string{"CAP_NET_BIND_SERVICE"},
+		}, false},
+
+		// unknown capabilities
+		{specs.LinuxCapabilities{Bounding: []string{"CAP_FOO"}}, true},
+		{specs.LinuxCapabilities{Effective: []string{"chown"}}, true},
+		{specs.LinuxCapabilities{Inheritable: []string{"CAP_chown"}}, true},
+		{specs.LinuxCapabilities{Permitted: []string{""}}, true},
+
+		// ambient capabilities must be permitted and inheritable
+		{specs.LinuxCapabilities{
+			Ambient: []string{"CAP_NET_BIND_SERVICE"},
+		}, true},
+		{specs.LinuxCapabilities{
+			Permitted: []string{"CAP_NET_BIND_SERVICE"},
+			Ambient:   []string{"CAP_NET_BIND_SERVICE"},
+		}, true},
+		{specs.LinuxCapabilities{
+			Inheritable: []string{"CAP_NET_BIND_SERVICE"},
+			Ambient:     []string{"CAP_NET_BIND_SERVICE"},
+		}, true},
+		{specs.LinuxCapabilities{
+			Inheritable: []string{"CAP_FOO"},
+			Permitted:   []string{"CAP_FOO"},
+			Ambient:     []string{"CAP_FOO"},
+		}, true},
+	}
+
+	for _, d := range data {
+		err := validateCapabilities(d.caps)
+		if d.expectFailure {
+			assert.Error(err, "test data: %+v", d)
+		} else {
+			assert.NoError(err, "test data: %+v", d)
+		}
+	}
+}
@@ -16,6 +16,9 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
@@ -40,13 +43,18 @@ const (
 	successMessage        = "System is capable of running " + project
 	failMessage           = "System is not capable of running " + project
 	kernelPropertyCorrect = "Kernel property value correct"
+
+	nestedNone     = "none"
+	nestedEnabled  = "enabled"
+	nestedDisabled = "disabled"
 )
 
 // variables rather than consts to allow tests to modify them
 var (
-	procCPUInfo  = "/proc/cpuinfo"
-	sysModuleDir = "/sys/module"
-	modInfoCmd   = "modinfo"
+	procCPUInfo       = "/proc/cpuinfo"
+	sysModuleDir      = "/sys/module"
+	sysHypervisorType = "/sys/hypervisor/type"
+	modInfoCmd        = "modinfo"
 )
 
 // requiredCPUFlags maps a CPU flag value to search for and a
@@ -126,10 +134,86 @@ func getCPUFlags(cpuinfo string) string {
 	return ""
 }
 
+// kvmVendorModules lists the vendor-specific KVM modules, one of which
+// needs to be loaded in addition to the generic "kvm" module.
+var kvmVendorModules = []string{"kvm_intel", "kvm_amd"}
+
+// kernelModuleLoaded returns true if the specified module is loaded (or
+// built into the kernel).
+func kernelModuleLoaded(module string) bool {
+	return fileExists(filepath.Join(sysModuleDir, module))
+}
+
+// kvmModuleLoaded returns true if the generic KVM module and one of the
+// vendor-specific KVM modules are loaded.
+func kvmModuleLoaded() bool {
+	if !kernelModuleLoaded("kvm") {
+		return false
+	}
+
+	for _, module := range kvmVendorModules {
+		if kernelModuleLoaded(module) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// runningOnHypervisor returns true if the host is itself a virtual
+// machine, either because the CPU advertises the hypervisor flag or
+// because the kernel reports a hypervisor type.
+func runningOnHypervisor() (bool, error) {
+	onVMM, err := vc.RunningOnVMM(procCPUInfo)
+	if err != nil {
+		return false, err
+	}
+
+	if onVMM {
+		return true, nil
+	}
+
+	hypervisorType, err := getFileContents(sysHypervisorType)
+	if err != nil {
+		return false, nil
+	}
+
+	return strings.TrimSpace(hypervisorType) != "", nil
+}
+
+// getNestedStatus returns nestedNone if the host is not a virtual machine.
+// Otherwise, it returns nestedEnabled if a vendor-specific KVM module
+// allows nested virtualization and nestedDisabled if not.
+func getNestedStatus() (string, error) {
+	onHypervisor, err := runningOnHypervisor()
+	if err != nil {
+		return "", err
+	}
+
+	if !onHypervisor {
+		return nestedNone, nil
+	}
+
+	for _, module := range kvmVendorModules {
+		path := filepath.Join(sysModuleDir, module, moduleParamDir, "nested")
+		value, err := getFileContents(path)
+		if err != nil {
+			continue
+		}
+
+		// Intel uses "Y" whereas AMD uses "1".
+		switch strings.TrimSpace(value) {
+		case "Y", "1":
+			return nestedEnabled, nil
+		}
+	}
+
+	return nestedDisabled, nil
+}
+
 func haveKernelModule(module string) bool {
 	// First, check to see if the module is already loaded
-	path := filepath.Join(sysModuleDir, module)
-	if fileExists(path) {
+	if kernelModuleLoaded(module) {
 		return true
 	}
 
@@ -284,13 +368,192 @@ func hostIsClearContainersCapable(cpuinfoFile string) error {
 	return fmt.Errorf("ERROR: %s", failMessage)
 }
 
+// ccCheck represents a single test performed by the "cc-check" command.
+type ccCheck struct {
+	// description
+	desc string
+
+	// performs the check, returning an error explaining why the
+	// check failed.
+	check func() error
+}
+
+// checkSkipped is returned by a check that could not be performed.
+type checkSkipped struct {
+	reason string
+}
+
+func (s checkSkipped) Error() string {
+	return s.reason
+}
+
+// checkExecutable returns an error unless path refers to an executable
+// file.
+func checkExecutable(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%q is not a file", path)
+	}
+
+	if info.Mode().Perm()&0111 == 0 {
+		return fmt.Errorf("%q is not executable", path)
+	}
+
+	return nil
+}
+
+// checkHypervisor checks that the hypervisor specified by the runtime
+// configuration exists and is executable. The check is skipped if no
+// configuration file can be found since cc-check may be run before the
+// runtime is installed.
+func checkHypervisor(configPath string) error {
+	if configPath == "" {
+		if _, err := getDefaultConfigFile(); err != nil {
+			return checkSkipped{reason: fmt.Sprintf("no configuration file found (%v)", err)}
+		}
+	}
+
+	_, _, config, err := loadConfiguration(configPath, true)
+	if err != nil {
+		return err
+	}
+
+	return checkExecutable(config.HypervisorConfig.HypervisorPath)
+}
+
+// checkKVMModule checks that the generic KVM module and one of the
+// vendor-specific KVM modules are loaded, since the hypervisor cannot use
+// /dev/kvm otherwise.
+func checkKVMModule() error {
+	if !kernelModuleLoaded("kvm") {
+		return fmt.Errorf("kvm module is not loaded (try \"modprobe kvm\")")
+	}
+
+	if !kvmModuleLoaded() {
+		return fmt.Errorf("none of the %s modules is loaded (try \"modprobe %s\" for an Intel CPU)",
+			strings.Join(kvmVendorModules, ", "), kvmVendorModules[0])
+	}
+
+	return nil
+}
+
+// checkNestedVirtualization checks that nested virtualization is enabled
+// when the host is itself a virtual machine. The check is skipped on bare
+// metal.
+func checkNestedVirtualization() error {
+	status, err := getNestedStatus()
+	if err != nil {
+		return err
+	}
+
+	switch status {
+	case nestedNone:
+		return checkSkipped{reason: "not running in a virtual machine"}
+	case nestedDisabled:
+		return fmt.Errorf("running in a virtual machine but the nested parameter of the %s modules is not enabled",
+			strings.Join(kvmVendorModules, ", "))
+	}
+
+	return nil
+}
+
+// getChecks returns the list of checks performed by the "cc-check"
+// command.
+func getChecks(configPath string) []ccCheck {
+	return []ccCheck{
+		{
+			desc: "CPU and kernel module requirements",
+			check: func() error {
+				return hostIsClearContainersCapable(procCPUInfo)
+			},
+		},
+		{
+			desc:  "KVM kernel modules are loaded",
+			check: checkKVMModule,
+		},
+		{
+			desc:  "nested virtualization is enabled",
+			check: checkNestedVirtualization,
+		},
+		{
+			desc: "hypervisor is executable",
+			check: func() error {
+				return checkHypervisor(configPath)
+			},
+		},
+	}
+}
+
+// runChecks performs all the specified checks, writing the result of each
+// to the specified writer, and returns the number of checks that failed.
+// If verbose is set, the reason for each failed or skipped check is also
+// displayed.
+func runChecks(checks []ccCheck, out io.Writer, verbose bool) (failures int) {
+	for _, c := range checks {
+		err := c.check()
+
+		result := "PASS"
+
+		if err != nil {
+			if _, ok := err.(checkSkipped); ok {
+				result = "SKIP"
+			} else {
+				result = "FAIL"
+				failures++
+			}
+		}
+
+		fmt.Fprintf(out, "%s: %s\n", result, c.desc)
+
+		if err != nil && verbose {
+			fmt.Fprintf(out, "      %v\n", err)
+		}
+	}
+
+	return failures
+}
+
 var ccCheckCLICommand = cli.Command{
 	Name:  "cc-check",
 	Usage: "tests if system can run " + project,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "verbose, v",
+			Usage: "explain why checks failed",
+		},
+		cli.BoolFlag{
+			Name:  "quiet, q",
+			Usage: "display no output, only set the exit code",
+		},
+	},
 	Action: func(context *cli.Context) error {
-		err := hostIsClearContainersCapable(procCPUInfo)
-		if err != nil {
-			return err
+		quiet := context.Bool("quiet")
+
+		out := io.Writer(defaultOutputFile)
+
+		if quiet {
+			out = ioutil.Discard
+
+			savedLogOutput := ccLog.Logger.Out
+			ccLog.Logger.Out = ioutil.Discard
+
+			defer func() {
+				ccLog.Logger.Out = savedLogOutput
+			}()
+		}
+
+		checks := getChecks(context.GlobalString("cc-config"))
+
+		if failures := runChecks(checks, out, context.Bool("verbose")); failures > 0 {
+			if quiet {
+				return cli.NewExitError("", 1)
+			}
+
+			return fmt.Errorf("ERROR: %s", failMessage)
 		}
 
 		ccLog.Info(successMessage)
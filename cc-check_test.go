@@ -16,6 +16,8 @@ package main
 
 import (
 	"bytes"
+	"errors"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -339,6 +341,235 @@ func TestCheckHaveKernelModule(t *testing.T) {
 	assert.True(result)
 }
 
+func TestCheckKVMModuleLoaded(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	savedSysModuleDir := sysModuleDir
+
+	// XXX: override
+	sysModuleDir = filepath.Join(dir, "sys/module")
+
+	defer func() {
+		sysModuleDir = savedSysModuleDir
+	}()
+
+	type testData struct {
+		modules        []string
+		expectedLoaded bool
+	}
+
+	data := []testData{
+		{[]string{}, false},
+		{[]string{"kvm"}, false},
+		{[]string{"kvm_intel"}, false},
+		{[]string{"kvm_amd"}, false},
+		{[]string{"kvm", "foo"}, false},
+		{[]string{"kvm", "kvm_intel"}, true},
+		{[]string{"kvm", "kvm_amd"}, true},
+	}
+
+	for _, d := range data {
+		err = os.RemoveAll(sysModuleDir)
+		assert.NoError(err)
+
+		for _, module := range d.modules {
+			err = os.MkdirAll(filepath.Join(sysModuleDir, module), testDirMode)
+			assert.NoError(err)
+		}
+
+		assert.Equal(d.expectedLoaded, kvmModuleLoaded(), "%+v", d)
+	}
+}
+
+func TestCheckGetNestedStatus(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	savedSysModuleDir := sysModuleDir
+	savedSysHypervisorType := sysHypervisorType
+	savedProcCPUInfo := procCPUInfo
+
+	// XXX: override
+	sysModuleDir = filepath.Join(dir, "sys/module")
+	sysHypervisorType = filepath.Join(dir, "sys/hypervisor/type")
+	procCPUInfo = filepath.Join(dir, "cpuinfo")
+
+	defer func() {
+		sysModuleDir = savedSysModuleDir
+		sysHypervisorType = savedSysHypervisorType
+		procCPUInfo = savedProcCPUInfo
+	}()
+
+	const (
+		hostFlags  = "flags\t: vmx lm sse4_1\n"
+		guestFlags = "flags\t: vmx lm sse4_1 hypervisor\n"
+	)
+
+	type testData struct {
+		cpuinfo        string
+		hypervisorType string
+		module         string
+		nested         string
+		expectedStatus string
+	}
+
+	data := []testData{
+		{hostFlags, "", "", "", nestedNone},
+		{hostFlags, "", "kvm_intel", "Y", nestedNone},
+		{guestFlags, "", "", "", nestedDisabled},
+		{guestFlags, "", "kvm_intel", "Y", nestedEnabled},
+		{guestFlags, "", "kvm_intel", "N", nestedDisabled},
+		{guestFlags, "", "kvm_amd", "1", nestedEnabled},
+		{guestFlags, "", "kvm_amd", "0", nestedDisabled},
+		{hostFlags, "xen", "", "", nestedDisabled},
+		{hostFlags, "xen", "kvm_intel", "Y", nestedEnabled},
+	}
+
+	for _, d := range data {
+		for _, path := range []string{sysModuleDir, sysHypervisorType} {
+			err = os.RemoveAll(path)
+			assert.NoError(err)
+		}
+
+		err = createFile(procCPUInfo, d.cpuinfo)
+		assert.NoError(err)
+
+		if d.hypervisorType != "" {
+			err = os.MkdirAll(filepath.Dir(sysHypervisorType), testDirMode)
+			assert.NoError(err)
+
+			err = createFile(sysHypervisorType, d.hypervisorType+"\n")
+			assert.NoError(err)
+		}
+
+		if d.module != "" {
+			paramDir := filepath.Join(sysModuleDir, d.module, moduleParamDir)
+			err = os.MkdirAll(paramDir, testDirMode)
+			assert.NoError(err)
+
+			err = createFile(filepath.Join(paramDir, "nested"), d.nested+"\n")
+			assert.NoError(err)
+		}
+
+		status, err := getNestedStatus()
+		assert.NoError(err, "%+v", d)
+		assert.Equal(d.expectedStatus, status, "%+v", d)
+	}
+
+	// cpuinfo is required
+	err = os.Remove(procCPUInfo)
+	assert.NoError(err)
+
+	_, err = getNestedStatus()
+	assert.Error(err)
+}
+
+func TestCheckCheckKVMModule(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	savedSysModuleDir := sysModuleDir
+
+	// XXX: override
+	sysModuleDir = filepath.Join(dir, "sys/module")
+
+	defer func() {
+		sysModuleDir = savedSysModuleDir
+	}()
+
+	err = checkKVMModule()
+	assert.Error(err)
+	assert.Contains(err.Error(), "kvm module")
+
+	err = os.MkdirAll(filepath.Join(sysModuleDir, "kvm"), testDirMode)
+	assert.NoError(err)
+
+	err = checkKVMModule()
+	assert.Error(err)
+	assert.Contains(err.Error(), "kvm_intel")
+
+	err = os.MkdirAll(filepath.Join(sysModuleDir, "kvm_amd"), testDirMode)
+	assert.NoError(err)
+
+	err = checkKVMModule()
+	assert.NoError(err)
+}
+
+func TestCheckCheckNestedVirtualization(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	savedSysModuleDir := sysModuleDir
+	savedSysHypervisorType := sysHypervisorType
+	savedProcCPUInfo := procCPUInfo
+
+	// XXX: override
+	sysModuleDir = filepath.Join(dir, "sys/module")
+	sysHypervisorType = filepath.Join(dir, "sys/hypervisor/type")
+	procCPUInfo = filepath.Join(dir, "cpuinfo")
+
+	defer func() {
+		sysModuleDir = savedSysModuleDir
+		sysHypervisorType = savedSysHypervisorType
+		procCPUInfo = savedProcCPUInfo
+	}()
+
+	// cpuinfo is required
+	err = checkNestedVirtualization()
+	assert.Error(err)
+	_, ok := err.(checkSkipped)
+	assert.False(ok)
+
+	// bare metal
+	err = createFile(procCPUInfo, "flags\t: vmx lm sse4_1\n")
+	assert.NoError(err)
+
+	err = checkNestedVirtualization()
+	_, ok = err.(checkSkipped)
+	assert.True(ok)
+
+	// virtual machine without nested virtualization
+	err = createFile(procCPUInfo, "flags\t: vmx lm sse4_1 hypervisor\n")
+	assert.NoError(err)
+
+	err = checkNestedVirtualization()
+	assert.Error(err)
+	_, ok = err.(checkSkipped)
+	assert.False(ok)
+	assert.Contains(err.Error(), "nested")
+
+	paramDir := filepath.Join(sysModuleDir, "kvm_intel", moduleParamDir)
+	err = os.MkdirAll(paramDir, testDirMode)
+	assert.NoError(err)
+
+	err = createFile(filepath.Join(paramDir, "nested"), "Y\n")
+	assert.NoError(err)
+
+	err = checkNestedVirtualization()
+	assert.NoError(err)
+}
+
 func TestCheckCheckKernelModules(t *testing.T) {
 	assert := assert.New(t)
 
@@ -742,6 +973,16 @@ func TestCCCheckCLIFunction(t *testing.T) {
 		{filepath.Join(sysModuleDir, "kvm_intel/parameters/nested"), false, "Y"},
 	}
 
+	err = os.MkdirAll(filepath.Join(sysModuleDir, "kvm"), testDirMode)
+	assert.NoError(err)
+
+	savedSysHypervisorType := sysHypervisorType
+	sysHypervisorType = filepath.Join(dir, "sys/hypervisor/type")
+
+	defer func() {
+		sysHypervisorType = savedSysHypervisorType
+	}()
+
 	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0666)
 	assert.NoError(err)
 
@@ -763,8 +1004,20 @@ func TestCCCheckCLIFunction(t *testing.T) {
 
 	assert.True(fileExists(logfile))
 
+	configFile, _, err := makeRuntimeConfig(dir)
+	assert.NoError(err)
+
+	savedOutputFile := defaultOutputFile
+	defaultOutputFile = devNull
+
+	defer func() {
+		defaultOutputFile = savedOutputFile
+	}()
+
 	app := cli.NewApp()
-	ctx := cli.NewContext(app, nil, nil)
+	set := flag.NewFlagSet("", 0)
+	set.String("cc-config", configFile, "")
+	ctx := cli.NewContext(app, set, nil)
 	app.Name = "foo"
 
 	fn, ok := ccCheckCLICommand.Action.(func(context *cli.Context) error)
@@ -795,8 +1048,18 @@ func TestCCCheckCLIFunctionFail(t *testing.T) {
 		procCPUInfo = oldProcCPUInfo
 	}()
 
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0666)
+	assert.NoError(err)
+
+	savedOutputFile := defaultOutputFile
+	defaultOutputFile = devNull
+
+	defer func() {
+		defaultOutputFile = savedOutputFile
+	}()
+
 	app := cli.NewApp()
-	ctx := cli.NewContext(app, nil, nil)
+	ctx := cli.NewContext(app, flag.NewFlagSet("", 0), nil)
 	app.Name = "foo"
 
 	fn, ok := ccCheckCLICommand.Action.(func(context *cli.Context) error)
@@ -805,3 +1068,187 @@ func TestCCCheckCLIFunctionFail(t *testing.T) {
 	err = fn(ctx)
 	assert.Error(err)
 }
+
+func TestCCCheckCLIFunctionQuiet(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	oldProcCPUInfo := procCPUInfo
+
+	// doesn't exist
+	procCPUInfo = filepath.Join(dir, "cpuinfo")
+
+	defer func() {
+		procCPUInfo = oldProcCPUInfo
+	}()
+
+	outFile := filepath.Join(dir, "output")
+	output, err := os.Create(outFile)
+	assert.NoError(err)
+	defer output.Close()
+
+	savedOutputFile := defaultOutputFile
+	defaultOutputFile = output
+
+	defer func() {
+		defaultOutputFile = savedOutputFile
+	}()
+
+	app := cli.NewApp()
+	set := flag.NewFlagSet("", 0)
+	set.Bool("quiet", true, "")
+	ctx := cli.NewContext(app, set, nil)
+	app.Name = "foo"
+
+	fn, ok := ccCheckCLICommand.Action.(func(context *cli.Context) error)
+	assert.True(ok)
+
+	err = fn(ctx)
+	assert.Error(err)
+
+	exitErr, ok := err.(*cli.ExitError)
+	assert.True(ok)
+	assert.Equal(1, exitErr.ExitCode())
+	assert.Empty(exitErr.Error())
+
+	contents, err := getFileContents(outFile)
+	assert.NoError(err)
+	assert.Empty(contents)
+}
+
+func TestCheckCheckExecutable(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "file")
+	err = createEmptyFile(file)
+	assert.NoError(err)
+
+	executable := filepath.Join(dir, "executable")
+	err = makeVersionBinary(executable, "1.0")
+	assert.NoError(err)
+
+	type testData struct {
+		path        string
+		expectError bool
+	}
+
+	data := []testData{
+		{"", true},
+		{filepath.Join(dir, "does-not-exist"), true},
+		{dir, true},
+		{file, true},
+		{executable, false},
+	}
+
+	for _, d := range data {
+		err := checkExecutable(d.path)
+		if d.expectError {
+			assert.Error(err, "%+v", d)
+		} else {
+			assert.NoError(err, "%+v", d)
+		}
+	}
+}
+
+func TestCheckCheckHypervisor(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	configFile, config, err := makeRuntimeConfig(dir)
+	assert.NoError(err)
+
+	err = checkHypervisor(configFile)
+	assert.NoError(err)
+
+	// explicitly specified config file must exist
+	err = checkHypervisor(filepath.Join(dir, "does-not-exist"))
+	assert.Error(err)
+	_, ok := err.(checkSkipped)
+	assert.False(ok)
+
+	// hypervisor exists, but cannot be run
+	err = os.Chmod(config.HypervisorConfig.HypervisorPath, testFileMode)
+	assert.NoError(err)
+
+	err = checkHypervisor(configFile)
+	assert.Error(err)
+}
+
+func TestCheckCheckHypervisorNoConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	savedConf := defaultRuntimeConfiguration
+	savedSysConf := defaultSysConfRuntimeConfiguration
+
+	defaultRuntimeConfiguration = filepath.Join(dir, "does-not-exist")
+	defaultSysConfRuntimeConfiguration = filepath.Join(dir, "does-not-exist-either")
+
+	defer func() {
+		defaultRuntimeConfiguration = savedConf
+		defaultSysConfRuntimeConfiguration = savedSysConf
+	}()
+
+	err = checkHypervisor("")
+	assert.Error(err)
+	_, ok := err.(checkSkipped)
+	assert.True(ok)
+}
+
+func TestCheckRunChecks(t *testing.T) {
+	assert := assert.New(t)
+
+	checks := []ccCheck{
+		{
+			desc:  "passing check",
+			check: func() error { return nil },
+		},
+		{
+			desc:  "failing check",
+			check: func() error { return errors.New("failure reason") },
+		},
+		{
+			desc:  "skipped check",
+			check: func() error { return checkSkipped{reason: "skip reason"} },
+		},
+	}
+
+	var buf bytes.Buffer
+
+	failures := runChecks(checks, &buf, false)
+	assert.Equal(1, failures)
+
+	expected := "PASS: passing check\nFAIL: failing check\nSKIP: skipped check\n"
+	assert.Equal(expected, buf.String())
+
+	buf.Reset()
+
+	failures = runChecks(checks, &buf, true)
+	assert.Equal(1, failures)
+
+	expected = "PASS: passing check\n" +
+		"FAIL: failing check\n      failure reason\n" +
+		"SKIP: skipped check\n      skip reason\n"
+	assert.Equal(expected, buf.String())
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/urfave/cli"
+)
+
+// generatedConfigMode is the mode used to create a config file.
+const generatedConfigMode = os.FileMode(0644)
+
+// hypervisorCommands lists the names of the hypervisor binaries to look
+// for in $PATH if the default hypervisor cannot be found.
+var hypervisorCommands = []string{"qemu-lite-system-x86_64", "qemu-system-x86_64"}
+
+// installPrefixes lists the prefixes the runtime components may be
+// installed below. If a default path does not exist, the same path below
+// each of these prefixes is tried.
+var installPrefixes = []string{"/usr/local", "/usr"}
+
+// generatedConfig contains the values used to generate a config file.
+type generatedConfig struct {
+	HypervisorPath        string
+	KernelPath            string
+	ImagePath             string
+	MachineType           string
+	KernelParams          string
+	DefaultVCPUs          uint32
+	DefaultMemSz          uint32
+	DisableBlockDeviceUse bool
+	ProxyURL              string
+	ShimPath              string
+	PauseRootPath         string
+	GlobalLogPath         string
+}
+
+var ccConfigCLICommand = cli.Command{
+	Name:      "cc-config",
+	Usage:     "generate a default configuration file",
+	ArgsUsage: "[path]",
+	Description: `The cc-config command writes a default configuration file to the specified
+   path, or to standard output if no path is given. The locations of the
+   hypervisor, kernel, image, shim and pause bundle are detected on the host
+   where possible.`,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "force, f",
+			Usage: "overwrite the file if it already exists",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		return generateConfig(context.Args().First(), context.Bool("force"))
+	},
+}
+
+// detectPath returns the path to use for a runtime component. If
+// defaultPath does not exist, the same path below each of the
+// installPrefixes is tried. If none of those exist either, defaultPath is
+// returned.
+func detectPath(defaultPath string) string {
+	if fileExists(defaultPath) {
+		return defaultPath
+	}
+
+	for _, prefix := range installPrefixes {
+		if !strings.HasPrefix(defaultPath, prefix+"/") {
+			continue
+		}
+
+		relativePath := strings.TrimPrefix(defaultPath, prefix)
+
+		for _, newPrefix := range installPrefixes {
+			path := filepath.Join(newPrefix, relativePath)
+			if fileExists(path) {
+				return path
+			}
+		}
+
+		break
+	}
+
+	return defaultPath
+}
+
+// detectHypervisorPath returns the path to the hypervisor, looking for it
+// in $PATH if it cannot be found below any of the installPrefixes.
+func detectHypervisorPath() string {
+	path := detectPath(defaultHypervisorPath)
+	if fileExists(path) {
+		return path
+	}
+
+	for _, cmd := range hypervisorCommands {
+		if path, err := exec.LookPath(cmd); err == nil {
+			return path
+		}
+	}
+
+	return defaultHypervisorPath
+}
+
+// newGeneratedConfig returns the values to use for a generated config
+// file.
+func newGeneratedConfig() generatedConfig {
+	return generatedConfig{
+		HypervisorPath:        detectHypervisorPath(),
+		KernelPath:            detectPath(defaultKernelPath),
+		ImagePath:             detectPath(defaultImagePath),
+		MachineType:           defaultMachineType,
+		KernelParams:          defaultKernelParams,
+		DefaultVCPUs:          defaultVCPUCount,
+		DefaultMemSz:          defaultMemSize,
+		DisableBlockDeviceUse: defaultDisableBlockDeviceUse,
+		ProxyURL:              defaultProxyURL,
+		ShimPath:              detectPath(defaultShimPath),
+		PauseRootPath:         detectPath(defaultPauseRootPath),
+		GlobalLogPath:         filepath.Join(defaultRuntimeLib, "runtime", "runtime.log"),
+	}
+}
+
+// writeConfig writes a config file containing the specified values.
+func writeConfig(w io.Writer, config generatedConfig) error {
+	t, err := template.New("config").Parse(generatedConfigTemplate)
+	if err != nil {
+		return err
+	}
+
+	return t.Execute(w, struct {
+		generatedConfig
+		Name string
+	}{config, name})
+}
+
+// generateConfig writes a default config file to the specified path or to
+// the default output file if path is blank. An existing file is only
+// overwritten if force is set.
+func generateConfig(path string, force bool) error {
+	config := newGeneratedConfig()
+
+	if path == "" {
+		return writeConfig(defaultOutputFile, config)
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if !force {
+		flags |= os.O_EXCL
+	}
+
+	f, err := os.OpenFile(path, flags, generatedConfigMode)
+	if os.IsExist(err) {
+		return fmt.Errorf("Config file %v already exists (use --force to overwrite)", path)
+	} else if err != nil {
+		return err
+	}
+
+	if err := writeConfig(f, config); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCCConfigDetectPath(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	savedPrefixes := installPrefixes
+	defer func() {
+		installPrefixes = savedPrefixes
+	}()
+
+	localPrefix := filepath.Join(tmpdir, "usr/local")
+	usrPrefix := filepath.Join(tmpdir, "usr")
+	installPrefixes = []string{localPrefix, usrPrefix}
+
+	localPath := filepath.Join(localPrefix, "share/kernel")
+	usrPath := filepath.Join(usrPrefix, "share/kernel")
+	otherPath := filepath.Join(tmpdir, "opt/kernel")
+
+	// nothing exists
+	assert.Equal(localPath, detectPath(localPath))
+	assert.Equal(otherPath, detectPath(otherPath))
+
+	err = os.MkdirAll(filepath.Dir(usrPath), testDirMode)
+	assert.NoError(err)
+	err = createEmptyFile(usrPath)
+	assert.NoError(err)
+
+	// found below another prefix
+	assert.Equal(usrPath, detectPath(localPath))
+	assert.Equal(usrPath, detectPath(usrPath))
+
+	err = os.MkdirAll(filepath.Dir(localPath), testDirMode)
+	assert.NoError(err)
+	err = createEmptyFile(localPath)
+	assert.NoError(err)
+
+	// the default is preferred
+	assert.Equal(localPath, detectPath(localPath))
+	assert.Equal(usrPath, detectPath(usrPath))
+}
+
+func TestCCConfigGenerateConfigStdout(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	outputFile := filepath.Join(tmpdir, "output")
+
+	f, err := os.Create(outputFile)
+	assert.NoError(err)
+
+	savedOutputFile := defaultOutputFile
+	defaultOutputFile = f
+
+	defer func() {
+		defaultOutputFile = savedOutputFile
+	}()
+
+	err = generateConfig("", false)
+	assert.NoError(err)
+	f.Close()
+
+	var buf bytes.Buffer
+	err = writeConfig(&buf, newGeneratedConfig())
+	assert.NoError(err)
+
+	data, err := ioutil.ReadFile(outputFile)
+	assert.NoError(err)
+	assert.Equal(buf.String(), string(data))
+}
+
+func TestCCConfigGenerateConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	configFile := filepath.Join(tmpdir, "configuration.toml")
+
+	err = generateConfig(configFile, false)
+	assert.NoError(err)
+
+	var tomlConf tomlConfig
+	_, err = toml.DecodeFile(configFile, &tomlConf)
+	assert.NoError(err)
+
+	expected := newGeneratedConfig()
+
+	h := tomlConf.Hypervisor[qemuHypervisorTableType]
+	assert.Equal(expected.HypervisorPath, h.Path)
+	assert.Equal(expected.KernelPath, h.Kernel)
+	assert.Equal(expected.ImagePath, h.Image)
+	assert.Equal(expected.MachineType, h.MachineType)
+	assert.Equal(expected.KernelParams, h.KernelParams)
+	assert.Equal(expected.DisableBlockDeviceUse, h.DisableBlockDeviceUse)
+
+	assert.Equal(expected.ProxyURL, tomlConf.Proxy[ccProxyTableType].URL)
+	assert.Equal(expected.ShimPath, tomlConf.Shim[ccShimTableType].Path)
+	assert.Equal(expected.PauseRootPath, tomlConf.Agent[hyperstartAgentTableType].PauseRootPath)
+
+	// global logging is disabled by default
+	assert.Equal("", tomlConf.Runtime.GlobalLogPath)
+
+	// existing files are not overwritten
+	err = ioutil.WriteFile(configFile, []byte("foo"), testFileMode)
+	assert.NoError(err)
+
+	err = generateConfig(configFile, false)
+	assert.Error(err)
+
+	data, err := ioutil.ReadFile(configFile)
+	assert.NoError(err)
+	assert.Equal("foo", string(data))
+
+	err = generateConfig(configFile, true)
+	assert.NoError(err)
+
+	_, err = toml.DecodeFile(configFile, &tomlConf)
+	assert.NoError(err)
+}
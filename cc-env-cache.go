@@ -0,0 +1,239 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+)
+
+const (
+	// envCacheMode is the mode used to create the cc-env cache file.
+	envCacheMode = os.FileMode(0644)
+
+	// envCacheDirMode is the mode used to create the directory of the
+	// cc-env cache file.
+	envCacheDirMode = os.FileMode(0755)
+)
+
+// envCachePath is the file used to cache the details displayed by the
+// "cc-env" command. It is a variable to allow tests to modify it.
+var envCachePath = filepath.Join(defaultRuntimeRun, "cc-env.cache")
+
+// procBootID changes every time the host boots, which invalidates the
+// cache.
+var procBootID = "/proc/sys/kernel/random/boot_id"
+
+// envCache is the format of the cc-env cache file.
+type envCache struct {
+	// Key identifies the files and host the details were collected
+	// from.
+	Key string
+	Env EnvInfo
+}
+
+// hashFileStat adds the path, size and modification time of the
+// specified file to the hash. Missing files are hashed too so that
+// creating them invalidates the cache.
+func hashFileStat(h io.Writer, path string) {
+	st, err := os.Stat(path)
+	if err != nil {
+		fmt.Fprintf(h, "%s:missing\n", path)
+		return
+	}
+
+	fmt.Fprintf(h, "%s:%d:%d\n", path, st.Size(), st.ModTime().UnixNano())
+}
+
+// hashFileContents adds the contents of the specified file to the hash.
+func hashFileContents(h io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fmt.Fprintf(h, "%s:", path)
+	_, err = io.Copy(h, f)
+
+	return err
+}
+
+// getEnvCacheKey returns the key identifying the details cached for the
+// specified configuration. It changes when the host reboots, the CPU
+// details change, or any of the runtime components or the config file
+// is modified. Only the components are stat'ed, so computing the key is
+// much cheaper than collecting the details again.
+func getEnvCacheKey(configFile, logfilePath string, config oci.RuntimeConfig) (string, error) {
+	h := sha256.New()
+
+	fmt.Fprintf(h, "%s:%s:%s:%s\n", formatVersion, version, commit, logfilePath)
+
+	for _, path := range []string{procBootID, procCPUInfo} {
+		if err := hashFileContents(h, path); err != nil {
+			return "", err
+		}
+	}
+
+	paths := []string{
+		configFile,
+		config.HypervisorConfig.HypervisorPath,
+		config.HypervisorConfig.KernelPath,
+		config.HypervisorConfig.ImagePath,
+		defaultProxyPath,
+	}
+
+	if shimConfig, ok := config.ShimConfig.(vc.CCShimConfig); ok {
+		paths = append(paths, shimConfig.Path)
+	}
+
+	if agentConfig, ok := config.AgentConfig.(vc.HyperConfig); ok {
+		paths = append(paths, agentConfig.PauseBinPath)
+	}
+
+	for _, path := range paths {
+		hashFileStat(h, path)
+	}
+
+	// The configuration may also have been modified by environment
+	// variables or command-line options.
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+
+	h.Write(configJSON)
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// readEnvCache returns the details cached with the specified key. false
+// is returned if there is no such cache.
+func readEnvCache(key string) (EnvInfo, bool) {
+	data, err := ioutil.ReadFile(envCachePath)
+	if err != nil {
+		return EnvInfo{}, false
+	}
+
+	var cache envCache
+
+	if err := json.Unmarshal(data, &cache); err != nil || cache.Key != key {
+		return EnvInfo{}, false
+	}
+
+	return cache.Env, true
+}
+
+// writeEnvCache caches the specified details with the specified key. The
+// file is replaced atomically so that concurrent readers never see a
+// partial cache.
+func writeEnvCache(key string, env EnvInfo) error {
+	data, err := json.Marshal(envCache{Key: key, Env: env})
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(envCachePath)
+
+	if err := os.MkdirAll(dir, envCacheDirMode); err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(dir, filepath.Base(envCachePath))
+	if err != nil {
+		return err
+	}
+
+	tmpPath := f.Name()
+
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Chmod(tmpPath, envCacheMode)
+	}
+
+	if err == nil {
+		err = os.Rename(tmpPath, envCachePath)
+	}
+
+	if err != nil {
+		os.Remove(tmpPath)
+	}
+
+	return err
+}
+
+// refreshEnvInfo updates the cached details that change while the host
+// is running.
+func refreshEnvInfo(env *EnvInfo) error {
+	memTotal, memAvailable, err := getHostMemoryInfo()
+	if err != nil {
+		return err
+	}
+
+	hugePages, err := getHugePagesInfo()
+	if err != nil {
+		return err
+	}
+
+	env.Host.MemoryTotalMB = memTotal
+	env.Host.MemoryAvailableMB = memAvailable
+	env.Host.HugePages = hugePages
+	env.Host.KVMModuleLoaded = kvmModuleLoaded()
+
+	return nil
+}
+
+// getCachedEnvInfo returns the same details as getEnvInfo, using the
+// cache file if it is still valid for the specified configuration and
+// updating it otherwise. Failing to use the cache is not fatal.
+func getCachedEnvInfo(configFile, logfilePath string, config oci.RuntimeConfig) (EnvInfo, error) {
+	key, err := getEnvCacheKey(configFile, logfilePath, config)
+	if err != nil {
+		ccLog.WithError(err).Debug("Cannot use cc-env cache")
+		return getEnvInfo(configFile, logfilePath, config)
+	}
+
+	if env, ok := readEnvCache(key); ok {
+		if err := refreshEnvInfo(&env); err != nil {
+			return EnvInfo{}, err
+		}
+
+		return env, nil
+	}
+
+	env, err := getEnvInfo(configFile, logfilePath, config)
+	if err != nil {
+		return EnvInfo{}, err
+	}
+
+	if err := writeEnvCache(key, env); err != nil {
+		ccLog.WithError(err).Debug("Cannot write cc-env cache")
+	}
+
+	return env, nil
+}
@@ -0,0 +1,293 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/stretchr/testify/assert"
+)
+
+// setTestEnvCache makes cc-env use a cache and boot ID below dir and
+// returns a function that restores the defaults.
+func setTestEnvCache(dir string) (func(), error) {
+	savedCachePath := envCachePath
+	savedBootID := procBootID
+
+	envCachePath = filepath.Join(dir, "cache", "cc-env.cache")
+	procBootID = filepath.Join(dir, "boot_id")
+
+	if err := ioutil.WriteFile(procBootID, []byte("boot-1\n"), testFileMode); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		envCachePath = savedCachePath
+		procBootID = savedBootID
+	}, nil
+}
+
+// makeEnvCacheTestConfig creates a runtime config and host details below
+// dir and returns the details cc-env is expected to display.
+func makeEnvCacheTestConfig(dir, logFile string) (string, oci.RuntimeConfig, EnvInfo, error) {
+	configFile, config, err := makeRuntimeConfig(dir)
+	if err != nil {
+		return "", oci.RuntimeConfig{}, EnvInfo{}, err
+	}
+
+	expected, err := getExpectedSettings(config, dir, configFile, logFile)
+	if err != nil {
+		return "", oci.RuntimeConfig{}, EnvInfo{}, err
+	}
+
+	return configFile, config, expected, nil
+}
+
+func TestCCEnvCacheKey(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	restore, err := setTestEnvCache(tmpdir)
+	assert.NoError(err)
+	defer restore()
+
+	const logFile = "/tmp/file.log"
+
+	configFile, config, _, err := makeEnvCacheTestConfig(tmpdir, logFile)
+	assert.NoError(err)
+
+	key, err := getEnvCacheKey(configFile, logFile, config)
+	assert.NoError(err)
+
+	sameKey, err := getEnvCacheKey(configFile, logFile, config)
+	assert.NoError(err)
+	assert.Equal(key, sameKey)
+
+	// a different log file
+	newKey, err := getEnvCacheKey(configFile, "/tmp/other.log", config)
+	assert.NoError(err)
+	assert.NotEqual(key, newKey)
+
+	// a different configuration
+	newConfig := config
+	newConfig.HypervisorConfig.DefaultVCPUs++
+	newKey, err = getEnvCacheKey(configFile, logFile, newConfig)
+	assert.NoError(err)
+	assert.NotEqual(key, newKey)
+
+	// an updated component
+	future := time.Now().Add(time.Hour)
+	err = os.Chtimes(config.HypervisorConfig.KernelPath, future, future)
+	assert.NoError(err)
+
+	newKey, err = getEnvCacheKey(configFile, logFile, config)
+	assert.NoError(err)
+	assert.NotEqual(key, newKey)
+	key = newKey
+
+	// an updated config file
+	err = os.Chtimes(configFile, future, future)
+	assert.NoError(err)
+
+	newKey, err = getEnvCacheKey(configFile, logFile, config)
+	assert.NoError(err)
+	assert.NotEqual(key, newKey)
+	key = newKey
+
+	// a reboot
+	err = ioutil.WriteFile(procBootID, []byte("boot-2\n"), testFileMode)
+	assert.NoError(err)
+
+	newKey, err = getEnvCacheKey(configFile, logFile, config)
+	assert.NoError(err)
+	assert.NotEqual(key, newKey)
+
+	// no boot ID
+	err = os.Remove(procBootID)
+	assert.NoError(err)
+
+	_, err = getEnvCacheKey(configFile, logFile, config)
+	assert.Error(err)
+}
+
+func TestCCEnvGetCachedEnvInfo(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	restore, err := setTestEnvCache(tmpdir)
+	assert.NoError(err)
+	defer restore()
+
+	const logFile = "/tmp/file.log"
+
+	configFile, config, expected, err := makeEnvCacheTestConfig(tmpdir, logFile)
+	assert.NoError(err)
+
+	// no cache yet
+	env, err := getCachedEnvInfo(configFile, logFile, config)
+	assert.NoError(err)
+	assert.Equal(expected, env)
+	assert.True(fileExists(envCachePath))
+
+	st, err := os.Stat(envCachePath)
+	assert.NoError(err)
+	assert.Equal(envCacheMode, st.Mode())
+
+	// Details that are not part of the key are not collected again...
+	err = ioutil.WriteFile(osRelease, []byte("NAME=\"Bar\"\nVERSION_ID=\"1\"\n"), testFileMode)
+	assert.NoError(err)
+
+	// ... apart from those that change while the host is running.
+	err = ioutil.WriteFile(procMemInfo, []byte("MemTotal: 2048 kB\nMemAvailable: 1024 kB\n"), testFileMode)
+	assert.NoError(err)
+
+	expected.Host.MemoryTotalMB = 2
+	expected.Host.MemoryAvailableMB = 1
+	expected.Host.HugePages.DefaultSizeKB = 0
+	expected.Host.HugePages.Total = 0
+	expected.Host.HugePages.Free = 0
+
+	env, err = getCachedEnvInfo(configFile, logFile, config)
+	assert.NoError(err)
+	assert.Equal(expected, env)
+
+	// the cache is ignored once the key changes
+	future := time.Now().Add(time.Hour)
+	err = os.Chtimes(configFile, future, future)
+	assert.NoError(err)
+
+	expected.Host.Distro = DistroInfo{Name: "Bar", Version: "1"}
+
+	env, err = getCachedEnvInfo(configFile, logFile, config)
+	assert.NoError(err)
+	assert.Equal(expected, env)
+}
+
+func TestCCEnvGetCachedEnvInfoInvalidCache(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	restore, err := setTestEnvCache(tmpdir)
+	assert.NoError(err)
+	defer restore()
+
+	const logFile = "/tmp/file.log"
+
+	configFile, config, expected, err := makeEnvCacheTestConfig(tmpdir, logFile)
+	assert.NoError(err)
+
+	err = os.MkdirAll(filepath.Dir(envCachePath), testDirMode)
+	assert.NoError(err)
+
+	err = ioutil.WriteFile(envCachePath, []byte("{"), testFileMode)
+	assert.NoError(err)
+
+	env, err := getCachedEnvInfo(configFile, logFile, config)
+	assert.NoError(err)
+	assert.Equal(expected, env)
+
+	key, err := getEnvCacheKey(configFile, logFile, config)
+	assert.NoError(err)
+
+	// the invalid cache was replaced
+	_, ok := readEnvCache(key)
+	assert.True(ok)
+}
+
+func TestCCEnvGetCachedEnvInfoUnwritableCache(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	restore, err := setTestEnvCache(tmpdir)
+	assert.NoError(err)
+	defer restore()
+
+	const logFile = "/tmp/file.log"
+
+	configFile, config, expected, err := makeEnvCacheTestConfig(tmpdir, logFile)
+	assert.NoError(err)
+
+	// the cache directory cannot be created
+	err = createEmptyFile(filepath.Dir(envCachePath))
+	assert.NoError(err)
+
+	env, err := getCachedEnvInfo(configFile, logFile, config)
+	assert.NoError(err)
+	assert.Equal(expected, env)
+}
+
+func benchmarkCCEnvGetEnvInfo(b *testing.B, useCache bool) {
+	tmpdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	restore, err := setTestEnvCache(tmpdir)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer restore()
+
+	const logFile = "/tmp/file.log"
+
+	configFile, config, _, err := makeEnvCacheTestConfig(tmpdir, logFile)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	getInfo := getEnvInfo
+	if useCache {
+		getInfo = getCachedEnvInfo
+
+		// prime the cache
+		if _, err := getInfo(configFile, logFile, config); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := getInfo(configFile, logFile, config); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCCEnvGetEnvInfo(b *testing.B) {
+	benchmarkCCEnvGetEnvInfo(b, false)
+}
+
+func BenchmarkCCEnvGetEnvInfoCached(b *testing.B) {
+	benchmarkCCEnvGetEnvInfo(b, true)
+}
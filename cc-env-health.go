@@ -0,0 +1,174 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+)
+
+// vmNamePrefix is the prefix of the "-name" QEMU option virtcontainers
+// uses for the VM of a pod, followed by the pod ID.
+const vmNamePrefix = "pod-"
+
+// HealthInfo stores the details of the pods and processes left behind by
+// pods that were not deleted cleanly.
+type HealthInfo struct {
+	// DeadPods lists the pods with state but no running VM or shim,
+	// whose state "cc-prune" removes.
+	DeadPods []string
+
+	// OrphanVMs lists the hypervisors running a VM for a pod that has no
+	// state.
+	OrphanVMs []OrphanProcessInfo
+
+	// OrphanShims lists the shims of containers that are not part of
+	// any pod.
+	OrphanShims []OrphanProcessInfo
+}
+
+// OrphanProcessInfo describes a process left behind by a pod or a
+// container, identified by ID.
+type OrphanProcessInfo struct {
+	PID int
+	ID  string
+}
+
+// hostProcess describes a process running on the host.
+type hostProcess struct {
+	pid  int
+	args []string
+}
+
+// getHostProcesses returns the processes described in procPath. Processes
+// that exit while being read are ignored.
+func getHostProcesses() ([]hostProcess, error) {
+	entries, err := ioutil.ReadDir(procPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var processes []hostProcess
+
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+
+		cmdline, err := ioutil.ReadFile(filepath.Join(procPath, entry.Name(), "cmdline"))
+		if err != nil || len(cmdline) == 0 {
+			continue
+		}
+
+		args := strings.Split(strings.TrimRight(string(cmdline), "\x00"), "\x00")
+
+		processes = append(processes, hostProcess{pid: pid, args: args})
+	}
+
+	return processes, nil
+}
+
+// getOptionValue returns the value of the specified option in args, or ""
+// if it is not present.
+func getOptionValue(args []string, option string) string {
+	for i := 1; i < len(args)-1; i++ {
+		if args[i] == option {
+			return args[i+1]
+		}
+	}
+
+	return ""
+}
+
+// getHealthInfo cross-checks the state of the pods with the host
+// processes. A VM is recognised by its "-name" option and a shim by its
+// path and "-c" option.
+//
+// XXX: the proxy is shared by all the pods, so it is never orphaned.
+func getHealthInfo(config oci.RuntimeConfig) (HealthInfo, error) {
+	podIDs, err := getStatePodIDs()
+	if err != nil {
+		return HealthInfo{}, err
+	}
+
+	podList, err := vci.ListPod()
+	if err != nil {
+		return HealthInfo{}, err
+	}
+
+	pids := getPodPIDs(podList)
+
+	processes, err := getHostProcesses()
+	if err != nil {
+		return HealthInfo{}, err
+	}
+
+	health := HealthInfo{
+		DeadPods:    []string{},
+		OrphanVMs:   []OrphanProcessInfo{},
+		OrphanShims: []OrphanProcessInfo{},
+	}
+
+	statePods := make(map[string]bool)
+
+	for _, podID := range podIDs {
+		statePods[podID] = true
+
+		if podDead(podID, pids[podID]) {
+			health.DeadPods = append(health.DeadPods, podID)
+		}
+	}
+
+	containers := make(map[string]bool)
+
+	for _, pod := range podList {
+		for _, container := range pod.ContainersStatus {
+			containers[container.ID] = true
+		}
+	}
+
+	shimName := ""
+	if shimConfig, ok := config.ShimConfig.(vc.CCShimConfig); ok && shimConfig.Path != "" {
+		shimName = filepath.Base(shimConfig.Path)
+	}
+
+	for _, p := range processes {
+		if name := getOptionValue(p.args, "-name"); strings.HasPrefix(name, vmNamePrefix) {
+			podID := strings.TrimPrefix(name, vmNamePrefix)
+
+			if !statePods[podID] {
+				health.OrphanVMs = append(health.OrphanVMs, OrphanProcessInfo{PID: p.pid, ID: podID})
+			}
+
+			continue
+		}
+
+		if shimName == "" || filepath.Base(p.args[0]) != shimName {
+			continue
+		}
+
+		if containerID := getOptionValue(p.args, "-c"); containerID != "" && !containers[containerID] {
+			health.OrphanShims = append(health.OrphanShims, OrphanProcessInfo{PID: p.pid, ID: containerID})
+		}
+	}
+
+	return health, nil
+}
@@ -0,0 +1,166 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	vc "github.com/containers/virtcontainers"
+	"github.com/stretchr/testify/assert"
+)
+
+// createFakeProcess creates the procPath entry of a process running the
+// specified command.
+func createFakeProcess(assert *assert.Assertions, pid int, args ...string) {
+	dir := filepath.Join(procPath, strconv.Itoa(pid))
+
+	err := os.MkdirAll(dir, testDirMode)
+	assert.NoError(err)
+
+	cmdline := ""
+	if len(args) > 0 {
+		cmdline = strings.Join(args, "\x00") + "\x00"
+	}
+
+	err = ioutil.WriteFile(filepath.Join(dir, "cmdline"), []byte(cmdline), testFileMode)
+	assert.NoError(err)
+}
+
+func TestGetOptionValue(t *testing.T) {
+	assert := assert.New(t)
+
+	args := []string{"qemu", "-name", "pod-foo", "-c"}
+
+	assert.Equal("pod-foo", getOptionValue(args, "-name"))
+	assert.Equal("", getOptionValue(args, "-c"))
+	assert.Equal("", getOptionValue(args, "-uuid"))
+	assert.Equal("", getOptionValue([]string{"-name"}, "-name"))
+}
+
+func TestCCEnvHandleSettingsHealth(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	const logFile = "/tmp/file.log"
+
+	configFile, config, err := makeRuntimeConfig(tmpdir)
+	assert.NoError(err)
+
+	_, err = getExpectedSettings(config, tmpdir, configFile, logFile)
+	assert.NoError(err)
+
+	shimPath := config.ShimConfig.(vc.CCShimConfig).Path
+
+	// A process that has exited.
+	cmd := exec.Command("true")
+	err = cmd.Run()
+	assert.NoError(err)
+	deadPID := cmd.Process.Pid
+
+	savedProcPath := procPath
+	savedPodStatePaths := podStatePaths
+	savedVMRunningFunc := vmRunningFunc
+
+	procPath = filepath.Join(tmpdir, "proc")
+	podStatePaths = []string{filepath.Join(tmpdir, "pods")}
+	vmRunningFunc = func(podID string) bool {
+		return false
+	}
+
+	defer func() {
+		procPath = savedProcPath
+		podStatePaths = savedPodStatePaths
+		vmRunningFunc = savedVMRunningFunc
+		testingImpl.ListPodFunc = nil
+	}()
+
+	old := time.Now().Add(-2 * pruneGracePeriod)
+
+	for _, id := range []string{"live", "dead"} {
+		dir := filepath.Join(podStatePaths[0], id)
+
+		err := os.MkdirAll(dir, testDirMode)
+		assert.NoError(err)
+
+		err = os.Chtimes(dir, old, old)
+		assert.NoError(err)
+	}
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{
+			{ID: "live", ContainersStatus: []vc.ContainerStatus{{ID: "live-ctr", PID: os.Getpid()}}},
+			{ID: "dead", ContainersStatus: []vc.ContainerStatus{{ID: "dead-ctr", PID: deadPID}}},
+		}, nil
+	}
+
+	qemuPath := config.HypervisorConfig.HypervisorPath
+
+	createFakeProcess(assert, 100, qemuPath, "-name", "pod-live", "-uuid", "0")
+	createFakeProcess(assert, 101, qemuPath, "-name", "pod-gone", "-uuid", "0")
+	createFakeProcess(assert, 102, shimPath, "-c", "live-ctr", "-t", "token")
+	createFakeProcess(assert, 103, shimPath, "-c", "gone-ctr", "-t", "token")
+	createFakeProcess(assert, 104, "/bin/bash", "-c", "gone-ctr")
+	createFakeProcess(assert, 105)
+
+	err = os.MkdirAll(filepath.Join(procPath, "self"), testDirMode)
+	assert.NoError(err)
+
+	expectedHealth := HealthInfo{
+		DeadPods:    []string{"dead"},
+		OrphanVMs:   []OrphanProcessInfo{{PID: 101, ID: "gone"}},
+		OrphanShims: []OrphanProcessInfo{{PID: 103, ID: "gone-ctr"}},
+	}
+
+	health, err := getHealthInfo(config)
+	assert.NoError(err)
+	assert.Equal(expectedHealth, health)
+
+	m := map[string]interface{}{
+		"configFile":    configFile,
+		"logfilePath":   logFile,
+		"runtimeConfig": config,
+	}
+
+	for _, withHealth := range []bool{false, true} {
+		tmpfile, err := ioutil.TempFile("", "")
+		assert.NoError(err)
+		defer os.Remove(tmpfile.Name())
+
+		err = handleSettings(tmpfile, m, false, false, withHealth)
+		assert.NoError(err)
+
+		var ccEnv EnvInfo
+
+		_, err = toml.DecodeFile(tmpfile.Name(), &ccEnv)
+		assert.NoError(err)
+
+		if withHealth {
+			assert.Equal(&expectedHealth, ccEnv.Health)
+		} else {
+			assert.Nil(ccEnv.Health)
+		}
+	}
+}
@@ -16,13 +16,21 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	vc "github.com/containers/virtcontainers"
 	"github.com/containers/virtcontainers/pkg/oci"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
 )
 
@@ -30,7 +38,31 @@ import (
 //
 // XXX: Increment for every change to the output format
 // (meaning any change to the EnvInfo type).
-const formatVersion = "1.0.4"
+const formatVersion = "1.0.20"
+
+// blockDeviceDriver is the driver virtcontainers uses to present block
+// devices to the VM. It is not configurable.
+const blockDeviceDriver = "virtio-blk"
+
+// sharedFS is the filesystem virtcontainers uses to share the container
+// rootfs and volumes with the VM. It is not configurable.
+const sharedFS = "9p"
+
+// noBlockDeviceDriver is reported when the use of block devices is
+// disabled.
+const noBlockDeviceDriver = "none"
+
+// transportVirtioSerial is the transport used between the proxy and the
+// hyperstart agent.
+const transportVirtioSerial = "virtio-serial"
+
+// versionProbeTimeout is the maximum amount of time to wait for a
+// component to display its version, in case a binary does not recognise
+// "--version" and would otherwise never return.
+var versionProbeTimeout = 5 * time.Second
+
+// variable rather than const to allow tests to modify it
+var sysHugePagesDir = "/sys/kernel/mm/hugepages"
 
 // MetaInfo stores information on the format of the output itself
 type MetaInfo struct {
@@ -42,17 +74,32 @@ type MetaInfo struct {
 type KernelInfo struct {
 	Path       string
 	Parameters string
+
+	// Checksum is the SHA-256 digest of the kernel, only set by
+	// "cc-env --checksums".
+	Checksum string `toml:",omitempty"`
 }
 
 // ImageInfo stores root filesystem image details
 type ImageInfo struct {
 	Path string
+
+	// Checksum is the SHA-256 digest of the image, only set by
+	// "cc-env --checksums".
+	Checksum string `toml:",omitempty"`
+
+	// ChecksumVerification is true if the image is verified against
+	// ExpectedChecksum, the image_checksum option, before booting a VM.
+	ChecksumVerification bool
+	ExpectedChecksum     string
 }
 
 // CPUInfo stores host CPU details
 type CPUInfo struct {
-	Vendor string
-	Model  string
+	Vendor         string
+	Model          string
+	CPUs           int
+	HyperThreading bool
 }
 
 // RuntimeConfigInfo stores runtime config details.
@@ -76,23 +123,29 @@ type RuntimeVersionInfo struct {
 
 // HypervisorInfo stores hypervisor details
 type HypervisorInfo struct {
-	MachineType string
-	Version     string
-	Path        string
+	MachineType       string
+	Version           string
+	Path              string
+	BlockDeviceDriver string
+	SharedFS          string
+	DefaultVCPUs      uint32
+	DefaultMemoryMB   uint32
 }
 
 // ProxyInfo stores proxy details
 type ProxyInfo struct {
-	Type    string
-	Version string
-	URL     string
+	Type      string
+	Version   string
+	URL       string
+	Transport string
 }
 
 // ShimInfo stores shim details
 type ShimInfo struct {
-	Type    string
-	Version string
-	Path    string
+	Type     string
+	Version  string
+	Path     string
+	Resolved string
 }
 
 // AgentInfo stores agent details
@@ -100,6 +153,8 @@ type AgentInfo struct {
 	Type         string
 	Version      string
 	PauseBinPath string
+	Resolved     string
+	SocketDir    string
 }
 
 // DistroInfo stores host operating system distribution details.
@@ -108,12 +163,36 @@ type DistroInfo struct {
 	Version string
 }
 
+// HugePagePoolInfo stores details of the host hugepages of a particular
+// size.
+type HugePagePoolInfo struct {
+	SizeKB uint64
+	Total  uint64
+	Free   uint64
+}
+
+// HugePagesInfo stores host hugepage details. The totals relate to the
+// default hugepage size.
+type HugePagesInfo struct {
+	DefaultSizeKB uint64
+	Total         uint64
+	Free          uint64
+	Pools         []HugePagePoolInfo
+}
+
 // HostInfo stores host details
 type HostInfo struct {
-	Kernel    string
-	Distro    DistroInfo
-	CPU       CPUInfo
-	CCCapable bool
+	Kernel            string
+	Distro            DistroInfo
+	CPU               CPUInfo
+	MemoryTotalMB     uint64
+	MemoryAvailableMB uint64
+	KVMModuleLoaded   bool
+	Nested            string
+	HugePages         HugePagesInfo
+	CgroupVersion     int
+	CgroupMount       string
+	CCCapable         bool
 }
 
 // EnvInfo collects all information that will be displayed by the
@@ -130,6 +209,7 @@ type EnvInfo struct {
 	Shim       ShimInfo
 	Agent      AgentInfo
 	Host       HostInfo
+	Health     *HealthInfo `toml:",omitempty"`
 }
 
 func getMetaInfo() MetaInfo {
@@ -138,12 +218,16 @@ func getMetaInfo() MetaInfo {
 	}
 }
 
-func getRuntimeInfo(configFile, logFile string, config oci.RuntimeConfig) RuntimeInfo {
-	runtimeVersion := RuntimeVersionInfo{
+func getRuntimeVersionInfo() RuntimeVersionInfo {
+	return RuntimeVersionInfo{
 		Semver: version,
 		Commit: commit,
 		OCI:    specs.Version,
 	}
+}
+
+func getRuntimeInfo(configFile, logFile string, config oci.RuntimeConfig) RuntimeInfo {
+	runtimeVersion := getRuntimeVersionInfo()
 
 	runtimeConfig := RuntimeConfigInfo{
 		GlobalLogPath: logFile,
@@ -156,6 +240,85 @@ func getRuntimeInfo(configFile, logFile string, config oci.RuntimeConfig) Runtim
 	}
 }
 
+// getHugePagePools returns details of the hugepages of each size available
+// on the host, ordered by page size. No pools are returned if the host does
+// not support hugepages.
+func getHugePagePools() ([]HugePagePoolInfo, error) {
+	entries, err := ioutil.ReadDir(sysHugePagesDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var pools []HugePagePoolInfo
+
+	for _, entry := range entries {
+		// format is "hugepages-<size>kB"
+		name := entry.Name()
+		if !strings.HasPrefix(name, "hugepages-") || !strings.HasSuffix(name, "kB") {
+			continue
+		}
+
+		size, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, "hugepages-"), "kB"), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hugepage directory %v: %v", name, err)
+		}
+
+		pool := HugePagePoolInfo{
+			SizeKB: size,
+		}
+
+		for file, value := range map[string]*uint64{
+			"nr_hugepages":   &pool.Total,
+			"free_hugepages": &pool.Free,
+		} {
+			path := filepath.Join(sysHugePagesDir, name, file)
+
+			contents, err := getFileContents(path)
+			if err != nil {
+				return nil, err
+			}
+
+			*value, err = strconv.ParseUint(strings.TrimSpace(contents), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value in %v: %v", path, err)
+			}
+		}
+
+		pools = append(pools, pool)
+	}
+
+	sort.Slice(pools, func(i, j int) bool {
+		return pools[i].SizeKB < pools[j].SizeKB
+	})
+
+	return pools, nil
+}
+
+// getHugePagesInfo returns details of the host hugepage configuration.
+func getHugePagesInfo() (HugePagesInfo, error) {
+	values, err := getMemInfoValues()
+	if err != nil {
+		return HugePagesInfo{}, err
+	}
+
+	pools, err := getHugePagePools()
+	if err != nil {
+		return HugePagesInfo{}, err
+	}
+
+	// All values are zero if the kernel does not support hugepages.
+	return HugePagesInfo{
+		DefaultSizeKB: values["Hugepagesize"],
+		Total:         values["HugePages_Total"],
+		Free:          values["HugePages_Free"],
+		Pools:         pools,
+	}, nil
+}
+
 func getHostInfo() (HostInfo, error) {
 	hostKernelVersion, err := getKernelVersion()
 	if err != nil {
@@ -172,6 +335,33 @@ func getHostInfo() (HostInfo, error) {
 		return HostInfo{}, err
 	}
 
+	cpus, hyperThreading, err := getCPUTopology()
+	if err != nil {
+		return HostInfo{}, err
+	}
+
+	memTotal, memAvailable, err := getHostMemoryInfo()
+	if err != nil {
+		return HostInfo{}, err
+	}
+
+	nested, err := getNestedStatus()
+	if err != nil {
+		return HostInfo{}, err
+	}
+
+	hugePages, err := getHugePagesInfo()
+	if err != nil {
+		return HostInfo{}, err
+	}
+
+	// A version of 0 means that no cgroup filesystem is mounted.
+	cgroupVersion, cgroupMount, err := getCgroupMount(procMountInfo)
+	if err != nil {
+		cgroupVersion = 0
+		cgroupMount = ""
+	}
+
 	hostCCCapable := true
 	err = hostIsClearContainersCapable(procCPUInfo)
 	if err != nil {
@@ -184,20 +374,43 @@ func getHostInfo() (HostInfo, error) {
 	}
 
 	hostCPU := CPUInfo{
-		Vendor: cpuVendor,
-		Model:  cpuModel,
+		Vendor:         cpuVendor,
+		Model:          cpuModel,
+		CPUs:           cpus,
+		HyperThreading: hyperThreading,
 	}
 
 	ccHost := HostInfo{
-		Kernel:    hostKernelVersion,
-		Distro:    hostDistro,
-		CPU:       hostCPU,
-		CCCapable: hostCCCapable,
+		Kernel:            hostKernelVersion,
+		Distro:            hostDistro,
+		CPU:               hostCPU,
+		MemoryTotalMB:     memTotal,
+		MemoryAvailableMB: memAvailable,
+		KVMModuleLoaded:   kvmModuleLoaded(),
+		Nested:            nested,
+		HugePages:         hugePages,
+		CgroupVersion:     cgroupVersion,
+		CgroupMount:       cgroupMount,
+		CCCapable:         hostCCCapable,
 	}
 
 	return ccHost, nil
 }
 
+// getProxyTransport returns the transport the proxy uses to communicate
+// with the agent running inside the VM.
+//
+// XXX: virtcontainers does not yet support vsock, so the only known
+// transport is the virtio-serial channel used by hyperstart.
+func getProxyTransport(agentType vc.AgentType) string {
+	switch agentType {
+	case vc.HyperstartAgent:
+		return transportVirtioSerial
+	default:
+		return unknown
+	}
+}
+
 func getProxyInfo(config oci.RuntimeConfig) (ProxyInfo, error) {
 	proxyConfig, ok := config.ProxyConfig.(vc.CCProxyConfig)
 
@@ -207,22 +420,60 @@ func getProxyInfo(config oci.RuntimeConfig) (ProxyInfo, error) {
 
 	proxyURL := proxyConfig.URL
 
-	version, err := getCommandVersion(defaultProxyPath)
-	if err != nil {
+	version, err := commandVersionFunc(defaultProxyPath)
+	if err != nil || version == "" {
 		version = unknown
 	}
 
 	ccProxy := ProxyInfo{
-		Type:    string(config.ProxyType),
-		Version: version,
-		URL:     proxyURL,
+		Type:      string(config.ProxyType),
+		Version:   version,
+		URL:       proxyURL,
+		Transport: getProxyTransport(config.AgentType),
 	}
 
 	return ccProxy, nil
 }
 
+// getCommandVersion returns the version details displayed by the
+// specified command when run with "--version".
 func getCommandVersion(cmd string) (string, error) {
-	return runCommand([]string{cmd, "--version"})
+	output, err := runCommandTimeout([]string{cmd, "--version"}, versionProbeTimeout)
+	if err != nil {
+		return "", err
+	}
+
+	return parseVersionOutput(output)
+}
+
+// parseVersionOutput returns the version details from the output of a
+// command run with "--version". Since some commands (such as qemu) display
+// additional details such as copyright information, only the first
+// non-blank line is considered.
+func parseVersionOutput(output string) (string, error) {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			return line, nil
+		}
+	}
+
+	return "", fmt.Errorf("no version details found in output %q", output)
+}
+
+// resolveOptionalPath returns the fully resolved value of the specified
+// path, or "" if the path does not exist. Any other error is returned.
+func resolveOptionalPath(path string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+
+		return "", err
+	}
+
+	return resolved, nil
 }
 
 func getShimInfo(config oci.RuntimeConfig) (ShimInfo, error) {
@@ -233,15 +484,21 @@ func getShimInfo(config oci.RuntimeConfig) (ShimInfo, error) {
 
 	shimPath := shimConfig.Path
 
-	version, err := getCommandVersion(shimPath)
+	resolved, err := resolveOptionalPath(shimPath)
 	if err != nil {
+		return ShimInfo{}, err
+	}
+
+	version, err := commandVersionFunc(shimPath)
+	if err != nil || version == "" {
 		version = unknown
 	}
 
 	ccShim := ShimInfo{
-		Type:    string(config.ShimType),
-		Version: version,
-		Path:    shimPath,
+		Type:     string(config.ShimType),
+		Version:  version,
+		Path:     shimPath,
+		Resolved: resolved,
 	}
 
 	return ccShim, nil
@@ -255,10 +512,20 @@ func getAgentInfo(config oci.RuntimeConfig) (AgentInfo, error) {
 
 	agentBinPath := agentConfig.PauseBinPath
 
+	resolved, err := resolveOptionalPath(agentBinPath)
+	if err != nil {
+		return AgentInfo{}, err
+	}
+
+	// The agent runs inside the VM, so its version cannot be found on the
+	// host. The pause binary must not be run to find it out since it
+	// ignores its arguments and only exits when killed.
 	ccAgent := AgentInfo{
 		Type:         string(config.AgentType),
 		Version:      unknown,
 		PauseBinPath: agentBinPath,
+		Resolved:     resolved,
+		SocketDir:    getAgentSocketDir(),
 	}
 
 	return ccAgent, nil
@@ -267,47 +534,92 @@ func getAgentInfo(config oci.RuntimeConfig) (AgentInfo, error) {
 func getHypervisorInfo(config oci.RuntimeConfig) HypervisorInfo {
 	hypervisorPath := config.HypervisorConfig.HypervisorPath
 
-	version, err := getCommandVersion(hypervisorPath)
-	if err != nil {
+	version, err := commandVersionFunc(hypervisorPath)
+	if err != nil || version == "" {
 		version = unknown
 	}
 
+	driver := blockDeviceDriver
+	if config.HypervisorConfig.DisableBlockDeviceUse {
+		driver = noBlockDeviceDriver
+	}
+
 	return HypervisorInfo{
-		MachineType: config.HypervisorConfig.HypervisorMachineType,
-		Version:     version,
-		Path:        hypervisorPath,
+		MachineType:       config.HypervisorConfig.HypervisorMachineType,
+		Version:           version,
+		Path:              hypervisorPath,
+		BlockDeviceDriver: driver,
+		SharedFS:          sharedFS,
+		DefaultVCPUs:      config.HypervisorConfig.DefaultVCPUs,
+		DefaultMemoryMB:   config.HypervisorConfig.DefaultMemSz,
 	}
 }
 
+// getEnvInfo collects the details displayed by the "cc-env" command. The
+// host and component details are independent and some of them require
+// running the components to determine their version, so they are
+// collected concurrently. If several of them fail, the error returned is
+// always that of the first one in the order of the EnvInfo fields.
 func getEnvInfo(configFile, logfilePath string, config oci.RuntimeConfig) (env EnvInfo, err error) {
 	meta := getMetaInfo()
 
 	ccRuntime := getRuntimeInfo(configFile, logfilePath, config)
 
-	ccHost, err := getHostInfo()
-	if err != nil {
-		return EnvInfo{}, err
-	}
-
-	ccProxy, err := getProxyInfo(config)
-	if err != nil {
-		return EnvInfo{}, err
-	}
-
-	ccShim, err := getShimInfo(config)
-	if err != nil {
-		return EnvInfo{}, err
+	var (
+		wg         sync.WaitGroup
+		hypervisor HypervisorInfo
+		ccProxy    ProxyInfo
+		ccShim     ShimInfo
+		ccAgent    AgentInfo
+		ccHost     HostInfo
+		proxyErr   error
+		shimErr    error
+		agentErr   error
+		hostErr    error
+	)
+
+	wg.Add(5)
+
+	go func() {
+		defer wg.Done()
+		hypervisor = getHypervisorInfo(config)
+	}()
+
+	go func() {
+		defer wg.Done()
+		ccProxy, proxyErr = getProxyInfo(config)
+	}()
+
+	go func() {
+		defer wg.Done()
+		ccShim, shimErr = getShimInfo(config)
+	}()
+
+	go func() {
+		defer wg.Done()
+		ccAgent, agentErr = getAgentInfo(config)
+	}()
+
+	go func() {
+		defer wg.Done()
+		ccHost, hostErr = getHostInfo()
+	}()
+
+	wg.Wait()
+
+	for _, err := range []error{proxyErr, shimErr, agentErr, hostErr} {
+		if err != nil {
+			return EnvInfo{}, err
+		}
 	}
 
-	ccAgent, err := getAgentInfo(config)
-	if err != nil {
-		return EnvInfo{}, err
+	image := ImageInfo{
+		Path:                 config.HypervisorConfig.ImagePath,
+		ChecksumVerification: imageChecksum != "",
 	}
 
-	hypervisor := getHypervisorInfo(config)
-
-	image := ImageInfo{
-		Path: config.HypervisorConfig.ImagePath,
+	if imageChecksum != "" {
+		image.ExpectedChecksum = imageChecksumPrefix + imageChecksum
 	}
 
 	kernel := KernelInfo{
@@ -341,7 +653,30 @@ func showSettings(ccEnv EnvInfo, file *os.File) error {
 	return nil
 }
 
-func handleSettings(file *os.File, metadata map[string]interface{}) error {
+// setChecksums sets the SHA-256 digests of the image and the kernel.
+func setChecksums(env *EnvInfo) error {
+	for _, file := range []struct {
+		path     string
+		checksum *string
+	}{
+		{env.Image.Path, &env.Image.Checksum},
+		{env.Kernel.Path, &env.Kernel.Checksum},
+	} {
+		checksum, err := getFileChecksum(file.path)
+		if err != nil {
+			return fmt.Errorf("Cannot compute the checksum of %v: %v", file.path, err)
+		}
+
+		*file.checksum = imageChecksumPrefix + checksum
+	}
+
+	return nil
+}
+
+// handleSettings writes the environment details to the specified file,
+// using the cc-env cache if useCache is set. The checksums of the image and
+// the kernel, and the health of the pods, are only added if requested.
+func handleSettings(file *os.File, metadata map[string]interface{}, useCache, checksums, health bool) error {
 	if file == nil {
 		return errors.New("Invalid output file specified")
 	}
@@ -361,18 +696,271 @@ func handleSettings(file *os.File, metadata map[string]interface{}) error {
 		return errors.New("cannot determine logfile config")
 	}
 
-	ccEnv, err := getEnvInfo(configFile, logfilePath, runtimeConfig)
+	getInfo := getEnvInfo
+	if useCache {
+		getInfo = getCachedEnvInfo
+	}
+
+	ccEnv, err := getInfo(configFile, logfilePath, runtimeConfig)
 	if err != nil {
 		return err
 	}
 
+	// The files are hashed every time as they can be modified in place.
+	if checksums {
+		if err := setChecksums(&ccEnv); err != nil {
+			return err
+		}
+	}
+
+	// The pods and processes change all the time.
+	if health {
+		healthInfo, err := getHealthInfo(runtimeConfig)
+		if err != nil {
+			return err
+		}
+
+		ccEnv.Health = &healthInfo
+	}
+
 	return showSettings(ccEnv, file)
 }
 
+// configProblem describes an issue with a file specified by the runtime
+// configuration.
+type configProblem struct {
+	component string
+	path      string
+	err       error
+}
+
+// checkReadable returns an error unless path refers to a file that can be
+// read.
+func checkReadable(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%q is not a file", path)
+	}
+
+	return nil
+}
+
+// getConfigProblems checks that all the files specified by the runtime
+// configuration exist and are usable, returning details of every problem
+// found.
+func getConfigProblems(config oci.RuntimeConfig) []configProblem {
+	type fileCheck struct {
+		component string
+		path      string
+		check     func(string) error
+	}
+
+	checks := []fileCheck{
+		{"hypervisor", config.HypervisorConfig.HypervisorPath, checkExecutable},
+		{"kernel", config.HypervisorConfig.KernelPath, checkReadable},
+		{"image", config.HypervisorConfig.ImagePath, checkReadable},
+		{"proxy", defaultProxyPath, checkExecutable},
+	}
+
+	if shimConfig, ok := config.ShimConfig.(vc.CCShimConfig); ok {
+		checks = append(checks, fileCheck{"shim", shimConfig.Path, checkExecutable})
+	}
+
+	if agentConfig, ok := config.AgentConfig.(vc.HyperConfig); ok {
+		checks = append(checks, fileCheck{"agent", agentConfig.PauseBinPath, checkExecutable})
+	}
+
+	var problems []configProblem
+
+	for _, c := range checks {
+		if err := c.check(c.path); err != nil {
+			problems = append(problems, configProblem{
+				component: c.component,
+				path:      c.path,
+				err:       err,
+			})
+		}
+	}
+
+	return problems
+}
+
+// getConfigFileProblems checks the specified config file for options that
+// the runtime does not recognise, returning details of every problem found.
+func getConfigFileProblems(configFile string) []configProblem {
+	data, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return []configProblem{{component: "config", path: configFile, err: err}}
+	}
+
+	_, unknownKeys, err := decodeConfig(configFile, string(data))
+	if err != nil {
+		return []configProblem{{component: "config", path: configFile, err: err}}
+	}
+
+	var problems []configProblem
+
+	for _, key := range unknownKeys {
+		problems = append(problems, configProblem{
+			component: "config",
+			path:      fmt.Sprintf("%v:%d", configFile, findConfigKeyLine(string(data), key)),
+			err:       fmt.Errorf("unknown option %q", key),
+		})
+	}
+
+	return problems
+}
+
+// validateSettings logs a warning for every problem found with the runtime
+// configuration. If strict is set, an error is also returned if any
+// problems were found.
+func validateSettings(metadata map[string]interface{}, strict bool) error {
+	runtimeConfig, ok := metadata["runtimeConfig"].(oci.RuntimeConfig)
+	if !ok {
+		return errors.New("cannot determine runtime config")
+	}
+
+	problems := getConfigProblems(runtimeConfig)
+
+	if configFile, ok := metadata["configFile"].(string); ok && configFile != "" {
+		problems = append(getConfigFileProblems(configFile), problems...)
+	}
+
+	for _, p := range problems {
+		ccLog.WithFields(logrus.Fields{
+			"component": p.component,
+			"path":      p.path,
+		}).Warn(p.err)
+	}
+
+	if strict && len(problems) > 0 {
+		return fmt.Errorf("found %d configuration problem(s)", len(problems))
+	}
+
+	return nil
+}
+
+// parseMajorVersion returns the major version number of the specified
+// semantic version string.
+func parseMajorVersion(version string) (uint64, error) {
+	fields := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	if len(fields) > 3 {
+		return 0, fmt.Errorf("invalid version %q", version)
+	}
+
+	var numbers []uint64
+
+	for _, field := range fields {
+		n, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid version %q", version)
+		}
+
+		numbers = append(numbers, n)
+	}
+
+	return numbers[0], nil
+}
+
+// checkFormatVersion returns an error unless the major version of the
+// output format matches the major version of the required version.
+func checkFormatVersion(required string) error {
+	requiredMajor, err := parseMajorVersion(required)
+	if err != nil {
+		return err
+	}
+
+	major, err := parseMajorVersion(formatVersion)
+	if err != nil {
+		return err
+	}
+
+	if major != requiredMajor {
+		return fmt.Errorf("output format version %s is not compatible with required version %s",
+			formatVersion, required)
+	}
+
+	return nil
+}
+
+// getConfigMetadata loads the specified configuration file and returns
+// the same metadata that beforeSubcommands() makes available to the
+// sub-commands.
+func getConfigMetadata(configPath string) (map[string]interface{}, error) {
+	configFile, logfilePath, runtimeConfig, err := loadConfiguration(configPath, true)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load configuration file %q: %v", configPath, err)
+	}
+
+	return map[string]interface{}{
+		"runtimeConfig": runtimeConfig,
+		"configFile":    configFile,
+		"logfilePath":   logfilePath,
+	}, nil
+}
+
 var ccEnvCLICommand = cli.Command{
 	Name:  "cc-env",
 	Usage: "display settings",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "config",
+			Usage: "display settings for the specified configuration file rather than the one the runtime would load",
+		},
+		cli.BoolFlag{
+			Name:  "validate",
+			Usage: "fail if the config file has unknown options or any of the configured files are missing or unusable",
+		},
+		cli.StringFlag{
+			Name:  "require-version",
+			Usage: "fail unless the output format is compatible with the specified semantic version",
+		},
+		cli.BoolFlag{
+			Name:  "checksums",
+			Usage: "display the SHA-256 digests of the image and kernel, which requires reading them in full",
+		},
+		cli.BoolFlag{
+			Name:  "health",
+			Usage: "also display the pods with no running VM or shim and the VMs and shims left behind by deleted pods",
+		},
+		cli.BoolFlag{
+			Name:  "cache",
+			Usage: "use the details cached by a previous invocation if they are still valid, and cache them otherwise",
+		},
+	},
 	Action: func(context *cli.Context) error {
-		return handleSettings(defaultOutputFile, context.App.Metadata)
+		if required := context.String("require-version"); required != "" {
+			if err := checkFormatVersion(required); err != nil {
+				return err
+			}
+		}
+
+		metadata := context.App.Metadata
+
+		if configPath := context.String("config"); configPath != "" {
+			var err error
+
+			metadata, err = getConfigMetadata(configPath)
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := handleSettings(defaultOutputFile, metadata, context.Bool("cache"), context.Bool("checksums"),
+			context.Bool("health")); err != nil {
+			return err
+		}
+
+		return validateSettings(metadata, context.Bool("validate"))
 	},
 }
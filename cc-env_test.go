@@ -16,6 +16,7 @@ package main
 
 import (
 	"bytes"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -23,6 +24,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	vc "github.com/containers/virtcontainers"
@@ -144,9 +146,10 @@ func getExpectedProxyDetails(config oci.RuntimeConfig) (ProxyInfo, error) {
 	}
 
 	return ProxyInfo{
-		Type:    string(config.ProxyType),
-		Version: testProxyVersion,
-		URL:     proxyConfig.URL,
+		Type:      string(config.ProxyType),
+		Version:   testProxyVersion,
+		URL:       proxyConfig.URL,
+		Transport: transportVirtioSerial,
 	}, nil
 }
 
@@ -159,9 +162,10 @@ func getExpectedShimDetails(config oci.RuntimeConfig) (ShimInfo, error) {
 	shimPath := shimConfig.Path
 
 	return ShimInfo{
-		Type:    string(config.ShimType),
-		Version: testShimVersion,
-		Path:    shimPath,
+		Type:     string(config.ShimType),
+		Version:  testShimVersion,
+		Path:     shimPath,
+		Resolved: shimPath,
 	}, nil
 }
 
@@ -177,6 +181,8 @@ func getExpectedAgentDetails(config oci.RuntimeConfig) (AgentInfo, error) {
 		Type:         string(config.AgentType),
 		Version:      unknown,
 		PauseBinPath: agentBinPath,
+		Resolved:     agentBinPath,
+		SocketDir:    getAgentSocketDir(),
 	}, nil
 }
 
@@ -194,15 +200,45 @@ func getExpectedHostDetails(tmpdir string) (HostInfo, error) {
 	}
 
 	expectedCPU := CPUInfo{
-		Vendor: "moi",
-		Model:  "awesome XI",
+		Vendor:         "moi",
+		Model:          "awesome XI",
+		CPUs:           1,
+		HyperThreading: false,
+	}
+
+	const expectedMemTotal = 16384
+	const expectedMemAvailable = 8192
+
+	expectedHugePages := HugePagesInfo{
+		DefaultSizeKB: 2048,
+		Total:         16,
+		Free:          8,
+		Pools: []HugePagePoolInfo{
+			{SizeKB: 2048, Total: 16, Free: 8},
+			{SizeKB: 1048576, Total: 2, Free: 1},
+		},
+	}
+
+	// The host cgroup layout is not overridden since it is also used
+	// to place the shim in its cgroups.
+	expectedCgroupVersion, expectedCgroupMount, err := getCgroupMount(procMountInfo)
+	if err != nil {
+		expectedCgroupVersion = 0
+		expectedCgroupMount = ""
 	}
 
 	expectedHostDetails := HostInfo{
-		Kernel:    expectedKernelVersion,
-		Distro:    expectedDistro,
-		CPU:       expectedCPU,
-		CCCapable: false,
+		Kernel:            expectedKernelVersion,
+		Distro:            expectedDistro,
+		CPU:               expectedCPU,
+		MemoryTotalMB:     expectedMemTotal,
+		MemoryAvailableMB: expectedMemAvailable,
+		KVMModuleLoaded:   false,
+		Nested:            nestedNone,
+		HugePages:         expectedHugePages,
+		CgroupVersion:     expectedCgroupVersion,
+		CgroupMount:       expectedCgroupMount,
+		CCCapable:         false,
 	}
 
 	testProcCPUInfo := filepath.Join(tmpdir, "cpuinfo")
@@ -215,13 +251,23 @@ func getExpectedHostDetails(tmpdir string) (HostInfo, error) {
 	testOSReleaseClr := filepath.Join(tmpdir, "os-release-clr")
 
 	testProcVersion := filepath.Join(tmpdir, "proc-version")
+	testProcMemInfo := filepath.Join(tmpdir, "meminfo")
 
 	// override
 	procVersion = testProcVersion
+	procMemInfo = testProcMemInfo
 	osRelease = testOSRelease
 	osReleaseClr = testOSReleaseClr
 	procCPUInfo = testProcCPUInfo
 
+	// XXX: this directory is *NOT* created on purpose so that no
+	// modules are considered to be loaded.
+	sysModuleDir = filepath.Join(tmpdir, "sys/module")
+
+	// XXX: not created either so that the host is not considered to
+	// be a virtual machine.
+	sysHypervisorType = filepath.Join(tmpdir, "sys/hypervisor/type")
+
 	procVersionContents := fmt.Sprintf("Linux version %s a b c",
 		expectedKernelVersion)
 
@@ -231,14 +277,44 @@ VERSION_ID="%s"
 `, expectedDistro.Name, expectedDistro.Version)
 
 	procCPUInfoContents := fmt.Sprintf(`
+processor	: 0
 vendor_id	: %s
 model name	: %s
+flags		: lm
 `, expectedCPU.Vendor, expectedCPU.Model)
 
+	procMemInfoContents := fmt.Sprintf(`MemTotal:       %d kB
+MemFree:         1024 kB
+MemAvailable:   %d kB
+HugePages_Total:      %d
+HugePages_Free:       %d
+HugePages_Rsvd:        0
+HugePages_Surp:        0
+Hugepagesize:       %d kB
+`, expectedMemTotal*1024, expectedMemAvailable*1024,
+		expectedHugePages.Total, expectedHugePages.Free,
+		expectedHugePages.DefaultSizeKB)
+
+	sysHugePagesDir = filepath.Join(tmpdir, "hugepages")
+
 	data := []filesToCreate{
 		{procVersion, procVersionContents},
 		{osRelease, osReleaseContents},
 		{procCPUInfo, procCPUInfoContents},
+		{procMemInfo, procMemInfoContents},
+	}
+
+	for _, pool := range expectedHugePages.Pools {
+		poolDir := filepath.Join(sysHugePagesDir, fmt.Sprintf("hugepages-%dkB", pool.SizeKB))
+
+		err := os.MkdirAll(poolDir, testDirMode)
+		if err != nil {
+			return HostInfo{}, err
+		}
+
+		data = append(data,
+			filesToCreate{filepath.Join(poolDir, "nr_hugepages"), fmt.Sprintf("%d\n", pool.Total)},
+			filesToCreate{filepath.Join(poolDir, "free_hugepages"), fmt.Sprintf("%d\n", pool.Free)})
 	}
 
 	for _, d := range data {
@@ -252,10 +328,19 @@ model name	: %s
 }
 
 func getExpectedHypervisor(config oci.RuntimeConfig) HypervisorInfo {
+	driver := blockDeviceDriver
+	if config.HypervisorConfig.DisableBlockDeviceUse {
+		driver = noBlockDeviceDriver
+	}
+
 	return HypervisorInfo{
-		Version:     testHypervisorVersion,
-		Path:        config.HypervisorConfig.HypervisorPath,
-		MachineType: config.HypervisorConfig.HypervisorMachineType,
+		Version:           testHypervisorVersion,
+		Path:              config.HypervisorConfig.HypervisorPath,
+		MachineType:       config.HypervisorConfig.HypervisorMachineType,
+		BlockDeviceDriver: driver,
+		SharedFS:          sharedFS,
+		DefaultVCPUs:      config.HypervisorConfig.DefaultVCPUs,
+		DefaultMemoryMB:   config.HypervisorConfig.DefaultMemSz,
 	}
 }
 
@@ -411,6 +496,51 @@ func TestCCEnvGetHostInfoNoProcVersion(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestCCEnvGetHostInfoNoProcMemInfo(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	_, err = getExpectedHostDetails(tmpdir)
+	assert.NoError(t, err)
+
+	err = os.Remove(procMemInfo)
+	assert.NoError(t, err)
+
+	_, err = getHostInfo()
+	assert.Error(t, err)
+}
+
+func TestCCEnvGetHostInfoKVMModuleLoaded(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	savedSysModuleDir := sysModuleDir
+	defer func() {
+		sysModuleDir = savedSysModuleDir
+	}()
+
+	expectedHostDetails, err := getExpectedHostDetails(tmpdir)
+	assert.NoError(t, err)
+
+	for _, module := range []string{"kvm", "kvm_intel"} {
+		err = os.MkdirAll(filepath.Join(sysModuleDir, module), testDirMode)
+		assert.NoError(t, err)
+	}
+
+	expectedHostDetails.KVMModuleLoaded = true
+
+	ccHost, err := getHostInfo()
+	assert.NoError(t, err)
+
+	assert.Equal(t, expectedHostDetails, ccHost)
+}
+
 func TestCCEnvGetEnvInfo(t *testing.T) {
 	tmpdir, err := ioutil.TempDir("", "")
 	if err != nil {
@@ -432,6 +562,63 @@ func TestCCEnvGetEnvInfo(t *testing.T) {
 	assert.Equal(t, expectedCCEnv, ccEnv)
 }
 
+func TestCCEnvGetEnvInfoImageChecksum(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	const logFile = "/tmp/file.log"
+
+	configFile, config, err := makeRuntimeConfig(tmpdir)
+	assert.NoError(err)
+
+	_, err = getExpectedSettings(config, tmpdir, configFile, logFile)
+	assert.NoError(err)
+
+	savedImageChecksum := imageChecksum
+	defer func() {
+		imageChecksum = savedImageChecksum
+	}()
+
+	ccEnv, err := getEnvInfo(configFile, logFile, config)
+	assert.NoError(err)
+
+	assert.False(ccEnv.Image.ChecksumVerification)
+	assert.Empty(ccEnv.Image.ExpectedChecksum)
+
+	imageChecksum = testImageChecksum
+
+	ccEnv, err = getEnvInfo(configFile, logFile, config)
+	assert.NoError(err)
+
+	assert.True(ccEnv.Image.ChecksumVerification)
+	assert.Equal(imageChecksumPrefix+testImageChecksum, ccEnv.Image.ExpectedChecksum)
+}
+
+func TestCCEnvGetEnvInfoKernelParams(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	const logFile = "/tmp/file.log"
+
+	configFile, config, err := makeRuntimeConfig(tmpdir)
+	assert.NoError(t, err)
+
+	_, err = getExpectedSettings(config, tmpdir, configFile, logFile)
+	assert.NoError(t, err)
+
+	ccEnv, err := getEnvInfo(configFile, logFile, config)
+	assert.NoError(t, err)
+
+	// the value specified in the config file by makeRuntimeConfig()
+	assert.Equal(t, "foo=bar xyz", ccEnv.Kernel.Parameters)
+}
+
 func TestCCEnvGetEnvInfoNoOSRelease(t *testing.T) {
 	tmpdir, err := ioutil.TempDir("", "")
 	if err != nil {
@@ -574,6 +761,28 @@ func TestCCEnvGetProxyInfo(t *testing.T) {
 	assert.Equal(t, expectedProxy, ccProxy)
 }
 
+func TestCCEnvGetProxyTransport(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		agentType         vc.AgentType
+		expectedTransport string
+	}
+
+	data := []testData{
+		{vc.HyperstartAgent, transportVirtioSerial},
+		{vc.SSHdAgent, unknown},
+		{vc.NoopAgentType, unknown},
+		{vc.AgentType(""), unknown},
+		{vc.AgentType("foo"), unknown},
+	}
+
+	for _, d := range data {
+		transport := getProxyTransport(d.agentType)
+		assert.Equal(d.expectedTransport, transport, "%+v", d)
+	}
+}
+
 func TestCCEnvGetProxyInfoNoVersion(t *testing.T) {
 	tmpdir, err := ioutil.TempDir("", "")
 	if err != nil {
@@ -701,6 +910,37 @@ func TestCCEnvGetAgentInfo(t *testing.T) {
 	assert.Equal(t, expectedAgent, ccAgent)
 }
 
+func TestCCEnvGetAgentInfoPauseBinary(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	_, config, err := makeRuntimeConfig(tmpdir)
+	assert.NoError(t, err)
+
+	expectedAgent, err := getExpectedAgentDetails(config)
+	assert.NoError(t, err)
+
+	// like the real pause binary, ignore the arguments and never exit.
+	err = createFile(expectedAgent.PauseBinPath, `#!/bin/sh
+	exec sleep 60`)
+	assert.NoError(t, err)
+
+	err = os.Chmod(expectedAgent.PauseBinPath, testExeFileMode)
+	assert.NoError(t, err)
+
+	start := time.Now()
+
+	ccAgent, err := getAgentInfo(config)
+	assert.NoError(t, err)
+
+	// the pause binary is not run
+	assert.True(t, time.Since(start) < versionProbeTimeout/2)
+	assert.Equal(t, expectedAgent, ccAgent)
+}
+
 func TestCCEnvGetAgentInfoInvalidType(t *testing.T) {
 	tmpdir, err := ioutil.TempDir("", "")
 	if err != nil {
@@ -719,6 +959,38 @@ func TestCCEnvGetAgentInfoInvalidType(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestCCEnvParseVersionOutput(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		output          string
+		expectedVersion string
+		expectError     bool
+	}
+
+	data := []testData{
+		{"", "", true},
+		{" ", "", true},
+		{"\n\n", "", true},
+		{"foo version 1.2.3", "foo version 1.2.3", false},
+		{"  foo version 1.2.3  ", "foo version 1.2.3", false},
+		{"\nfoo version 1.2.3\n", "foo version 1.2.3", false},
+		{testHypervisorVersion + "\nCopyright (c) 2003-2017 Fabrice Bellard and the QEMU Project developers", testHypervisorVersion, false},
+		{"cc-shim version 3.0.0 (commit: abc123)\n", "cc-shim version 3.0.0 (commit: abc123)", false},
+	}
+
+	for _, d := range data {
+		version, err := parseVersionOutput(d.output)
+		if d.expectError {
+			assert.Error(err, "output: %q", d.output)
+			continue
+		}
+
+		assert.NoError(err, "output: %q", d.output)
+		assert.Equal(d.expectedVersion, version, "output: %q", d.output)
+	}
+}
+
 func testCCEnvShowSettings(t *testing.T, tmpdir string, tmpfile *os.File) error {
 
 	ccRuntime := RuntimeInfo{}
@@ -846,7 +1118,7 @@ func TestCCEnvHandleSettings(t *testing.T) {
 	assert.NoError(t, err)
 	defer os.Remove(tmpfile.Name())
 
-	err = handleSettings(tmpfile, m)
+	err = handleSettings(tmpfile, m, false, false, false)
 	assert.NoError(t, err)
 
 	var ccEnv EnvInfo
@@ -855,13 +1127,71 @@ func TestCCEnvHandleSettings(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestCCEnvHandleSettingsChecksums(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	const logFile = "/tmp/file.log"
+
+	configFile, config, err := makeRuntimeConfig(tmpdir)
+	assert.NoError(err)
+
+	_, err = getExpectedSettings(config, tmpdir, configFile, logFile)
+	assert.NoError(err)
+
+	// the fixture files
+	err = ioutil.WriteFile(config.HypervisorConfig.ImagePath, []byte(testImageData), testFileMode)
+	assert.NoError(err)
+
+	err = ioutil.WriteFile(config.HypervisorConfig.KernelPath, []byte{}, testFileMode)
+	assert.NoError(err)
+
+	m := map[string]interface{}{
+		"configFile":    configFile,
+		"logfilePath":   logFile,
+		"runtimeConfig": config,
+	}
+
+	for _, checksums := range []bool{false, true} {
+		tmpfile, err := ioutil.TempFile("", "")
+		assert.NoError(err)
+		defer os.Remove(tmpfile.Name())
+
+		err = handleSettings(tmpfile, m, false, checksums, false)
+		assert.NoError(err)
+
+		var ccEnv EnvInfo
+
+		_, err = toml.DecodeFile(tmpfile.Name(), &ccEnv)
+		assert.NoError(err)
+
+		if checksums {
+			assert.Equal(imageChecksumPrefix+testImageChecksum, ccEnv.Image.Checksum)
+			assert.Equal(imageChecksumPrefix+testOtherChecksum, ccEnv.Kernel.Checksum)
+		} else {
+			assert.Empty(ccEnv.Image.Checksum)
+			assert.Empty(ccEnv.Kernel.Checksum)
+		}
+	}
+
+	// the kernel cannot be read
+	err = os.Remove(config.HypervisorConfig.KernelPath)
+	assert.NoError(err)
+
+	err = handleSettings(os.Stdout, m, false, true, false)
+	assert.Error(err)
+}
+
 func TestCCEnvHandleSettingsInvalidParams(t *testing.T) {
-	err := handleSettings(nil, map[string]interface{}{})
+	err := handleSettings(nil, map[string]interface{}{}, false, false, false)
 	assert.Error(t, err)
 }
 
 func TestCCEnvHandleSettingsEmptyMap(t *testing.T) {
-	err := handleSettings(os.Stdout, map[string]interface{}{})
+	err := handleSettings(os.Stdout, map[string]interface{}{}, false, false, false)
 	assert.Error(t, err)
 }
 
@@ -872,7 +1202,7 @@ func TestCCEnvHandleSettingsInvalidFile(t *testing.T) {
 		"runtimeConfig": oci.RuntimeConfig{},
 	}
 
-	err := handleSettings(nil, m)
+	err := handleSettings(nil, m, false, false, false)
 	assert.Error(t, err)
 }
 
@@ -883,7 +1213,7 @@ func TestCCEnvHandleSettingsInvalidConfigFileType(t *testing.T) {
 		"runtimeConfig": oci.RuntimeConfig{},
 	}
 
-	err := handleSettings(os.Stderr, m)
+	err := handleSettings(os.Stderr, m, false, false, false)
 	assert.Error(t, err)
 }
 
@@ -894,7 +1224,7 @@ func TestCCEnvHandleSettingsInvalidLogfileType(t *testing.T) {
 		"runtimeConfig": oci.RuntimeConfig{},
 	}
 
-	err := handleSettings(os.Stderr, m)
+	err := handleSettings(os.Stderr, m, false, false, false)
 	assert.Error(t, err)
 }
 
@@ -905,7 +1235,7 @@ func TestCCEnvHandleSettingsInvalidRuntimeConfigType(t *testing.T) {
 		"runtimeConfig": true,
 	}
 
-	err := handleSettings(os.Stderr, m)
+	err := handleSettings(os.Stderr, m, false, false, false)
 	assert.Error(t, err)
 }
 
@@ -925,7 +1255,7 @@ func TestCCEnvCLIFunction(t *testing.T) {
 	assert.NoError(t, err)
 
 	app := cli.NewApp()
-	ctx := cli.NewContext(app, nil, nil)
+	ctx := cli.NewContext(app, flag.NewFlagSet("", 0), nil)
 	app.Name = "foo"
 
 	ctx.App.Metadata = map[string]interface{}{
@@ -952,59 +1282,988 @@ func TestCCEnvCLIFunction(t *testing.T) {
 	assert.NoError(t, err)
 }
 
-func TestCCEnvCLIFunctionFail(t *testing.T) {
+func TestCCEnvCLIFunctionCache(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	savedEnvCachePath := envCachePath
+	envCachePath = filepath.Join(tmpdir, "cc-env.cache")
+
+	defer func() {
+		envCachePath = savedEnvCachePath
+	}()
+
+	configFile, config, err := makeRuntimeConfig(tmpdir)
+	assert.NoError(err)
+
+	const logFile = "/tmp/file.log"
+
+	_, err = getExpectedSettings(config, tmpdir, configFile, logFile)
+	assert.NoError(err)
+
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0666)
+	assert.NoError(err)
+
+	savedOutputFile := defaultOutputFile
+	defaultOutputFile = devNull
+
+	defer func() {
+		defaultOutputFile = savedOutputFile
+	}()
+
+	fn, ok := ccEnvCLICommand.Action.(func(context *cli.Context) error)
+	assert.True(ok)
+
+	for _, cache := range []bool{false, true} {
+		app := cli.NewApp()
+		set := flag.NewFlagSet("", 0)
+		set.Bool("cache", cache, "")
+		ctx := cli.NewContext(app, set, nil)
+
+		ctx.App.Metadata = map[string]interface{}{
+			"configFile":    configFile,
+			"logfilePath":   logFile,
+			"runtimeConfig": config,
+		}
+
+		err = fn(ctx)
+		assert.NoError(err)
+
+		// the cache is only written if requested
+		assert.Equal(cache, fileExists(envCachePath))
+	}
+}
+
+func TestCCEnvCLIFunctionConfigFlag(t *testing.T) {
+	assert := assert.New(t)
+
 	tmpdir, err := ioutil.TempDir("", "")
 	if err != nil {
 		panic(err)
 	}
 	defer os.RemoveAll(tmpdir)
 
-	const logFile = "/tmp/file.log"
-
 	configFile, config, err := makeRuntimeConfig(tmpdir)
-	assert.NoError(t, err)
+	assert.NoError(err)
 
-	_, err = getExpectedSettings(config, tmpdir, configFile, logFile)
-	assert.NoError(t, err)
+	// matches the log path used by makeRuntimeConfig()
+	const logFile = "/log/path"
+
+	expectedEnv, err := getExpectedSettings(config, tmpdir, configFile, logFile)
+	assert.NoError(err)
 
 	app := cli.NewApp()
-	ctx := cli.NewContext(app, nil, nil)
+	set := flag.NewFlagSet("", 0)
+	set.String("config", configFile, "")
+	ctx := cli.NewContext(app, set, nil)
 	app.Name = "foo"
 
-	ctx.App.Metadata = map[string]interface{}{
-		"configFile":    configFile,
-		"logfilePath":   logFile,
-		"runtimeConfig": config,
-	}
+	// the metadata for the default configuration must be ignored
+	ctx.App.Metadata = map[string]interface{}{}
 
 	fn, ok := ccEnvCLICommand.Action.(func(context *cli.Context) error)
-	assert.True(t, ok)
+	assert.True(ok)
+
+	outFile := filepath.Join(tmpdir, "output")
+	output, err := os.Create(outFile)
+	assert.NoError(err)
+	defer output.Close()
 
 	savedOutputFile := defaultOutputFile
-	// invalidate
-	defaultOutputFile = nil
+	defaultOutputFile = output
 
 	defer func() {
 		defaultOutputFile = savedOutputFile
 	}()
 
 	err = fn(ctx)
-	assert.Error(t, err)
+	assert.NoError(err)
+
+	var ccEnv EnvInfo
+
+	_, err = toml.DecodeFile(outFile, &ccEnv)
+	assert.NoError(err)
+	assert.Equal(expectedEnv, ccEnv)
 }
 
-func TestGetHypervisorInfo(t *testing.T) {
+func TestCCEnvCLIFunctionConfigFlagFail(t *testing.T) {
 	assert := assert.New(t)
 
 	tmpdir, err := ioutil.TempDir("", "")
-	assert.NoError(err)
+	if err != nil {
+		panic(err)
+	}
 	defer os.RemoveAll(tmpdir)
 
-	const logFile = "/tmp/file.log"
+	invalidConfig := filepath.Join(tmpdir, "invalid.toml")
+	err = createFile(invalidConfig, "[[[ not toml")
+	assert.NoError(err)
 
-	_, config, err := makeRuntimeConfig(tmpdir)
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0666)
 	assert.NoError(err)
 
-	info := getHypervisorInfo(config)
+	savedOutputFile := defaultOutputFile
+	defaultOutputFile = devNull
 
-	assert.Equal(info.Version, testHypervisorVersion)
+	defer func() {
+		defaultOutputFile = savedOutputFile
+	}()
+
+	fn, ok := ccEnvCLICommand.Action.(func(context *cli.Context) error)
+	assert.True(ok)
+
+	for _, configPath := range []string{filepath.Join(tmpdir, "does-not-exist"), invalidConfig} {
+		app := cli.NewApp()
+		set := flag.NewFlagSet("", 0)
+		set.String("config", configPath, "")
+		ctx := cli.NewContext(app, set, nil)
+		app.Name = "foo"
+
+		err = fn(ctx)
+		assert.Error(err)
+		assert.Contains(err.Error(), configPath)
+	}
+}
+
+func TestCCEnvCLIFunctionFail(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	const logFile = "/tmp/file.log"
+
+	configFile, config, err := makeRuntimeConfig(tmpdir)
+	assert.NoError(t, err)
+
+	_, err = getExpectedSettings(config, tmpdir, configFile, logFile)
+	assert.NoError(t, err)
+
+	app := cli.NewApp()
+	ctx := cli.NewContext(app, flag.NewFlagSet("", 0), nil)
+	app.Name = "foo"
+
+	ctx.App.Metadata = map[string]interface{}{
+		"configFile":    configFile,
+		"logfilePath":   logFile,
+		"runtimeConfig": config,
+	}
+
+	fn, ok := ccEnvCLICommand.Action.(func(context *cli.Context) error)
+	assert.True(t, ok)
+
+	savedOutputFile := defaultOutputFile
+	// invalidate
+	defaultOutputFile = nil
+
+	defer func() {
+		defaultOutputFile = savedOutputFile
+	}()
+
+	err = fn(ctx)
+	assert.Error(t, err)
+}
+
+func TestGetHypervisorInfo(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	const logFile = "/tmp/file.log"
+
+	_, config, err := makeRuntimeConfig(tmpdir)
+	assert.NoError(err)
+
+	info := getHypervisorInfo(config)
+
+	assert.Equal(info.Version, testHypervisorVersion)
+}
+
+func TestGetHypervisorInfoBlockDeviceDriver(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	const logFile = "/tmp/file.log"
+
+	configFile, config, err := makeRuntimeConfig(tmpdir)
+	assert.NoError(err)
+
+	// makeRuntimeConfig() disables block devices
+	assert.True(config.HypervisorConfig.DisableBlockDeviceUse)
+
+	_, err = getExpectedSettings(config, tmpdir, configFile, logFile)
+	assert.NoError(err)
+
+	outFile := filepath.Join(tmpdir, "output")
+
+	for _, disable := range []bool{true, false} {
+		config.HypervisorConfig.DisableBlockDeviceUse = disable
+
+		expectedDriver := blockDeviceDriver
+		if disable {
+			expectedDriver = noBlockDeviceDriver
+		}
+
+		ccEnv, err := getEnvInfo(configFile, logFile, config)
+		assert.NoError(err)
+
+		output, err := os.Create(outFile)
+		assert.NoError(err)
+
+		err = showSettings(ccEnv, output)
+		assert.NoError(err)
+		output.Close()
+
+		var decoded EnvInfo
+
+		_, err = toml.DecodeFile(outFile, &decoded)
+		assert.NoError(err)
+		assert.Equal(expectedDriver, decoded.Hypervisor.BlockDeviceDriver)
+	}
+}
+
+func TestGetHypervisorInfoSharedFS(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	const logFile = "/tmp/file.log"
+
+	configFile, config, err := makeRuntimeConfig(tmpdir)
+	assert.NoError(err)
+
+	_, err = getExpectedSettings(config, tmpdir, configFile, logFile)
+	assert.NoError(err)
+
+	ccEnv, err := getEnvInfo(configFile, logFile, config)
+	assert.NoError(err)
+	assert.Equal("9p", ccEnv.Hypervisor.SharedFS)
+
+	outFile := filepath.Join(tmpdir, "output")
+	output, err := os.Create(outFile)
+	assert.NoError(err)
+	defer output.Close()
+
+	err = showSettings(ccEnv, output)
+	assert.NoError(err)
+
+	var decoded EnvInfo
+
+	_, err = toml.DecodeFile(outFile, &decoded)
+	assert.NoError(err)
+	assert.Equal("9p", decoded.Hypervisor.SharedFS)
+}
+
+func TestCCEnvCheckReadable(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	file := filepath.Join(tmpdir, "file")
+	err = createEmptyFile(file)
+	assert.NoError(err)
+
+	type testData struct {
+		path        string
+		expectError bool
+	}
+
+	data := []testData{
+		{"", true},
+		{filepath.Join(tmpdir, "does-not-exist"), true},
+		{tmpdir, true},
+		{file, false},
+	}
+
+	for _, d := range data {
+		err := checkReadable(d.path)
+		if d.expectError {
+			assert.Error(err, "%+v", d)
+		} else {
+			assert.NoError(err, "%+v", d)
+		}
+	}
+}
+
+func TestCCEnvGetConfigProblems(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	_, config, err := makeRuntimeConfig(tmpdir)
+	assert.NoError(err)
+
+	agentConfig, ok := config.AgentConfig.(vc.HyperConfig)
+	assert.True(ok)
+
+	// makeRuntimeConfig() creates an empty pause binary
+	problems := getConfigProblems(config)
+	assert.Len(problems, 1)
+	assert.Equal("agent", problems[0].component)
+	assert.Equal(agentConfig.PauseBinPath, problems[0].path)
+
+	err = os.Chmod(agentConfig.PauseBinPath, testExeFileMode)
+	assert.NoError(err)
+
+	problems = getConfigProblems(config)
+	assert.Empty(problems)
+
+	shimConfig, ok := config.ShimConfig.(vc.CCShimConfig)
+	assert.True(ok)
+
+	err = os.Remove(config.HypervisorConfig.KernelPath)
+	assert.NoError(err)
+
+	err = os.Chmod(shimConfig.Path, testFileMode)
+	assert.NoError(err)
+
+	problems = getConfigProblems(config)
+	assert.Len(problems, 2)
+
+	var components []string
+	for _, p := range problems {
+		assert.Error(p.err)
+		components = append(components, p.component)
+	}
+
+	assert.Equal([]string{"kernel", "shim"}, components)
+}
+
+func TestCCEnvValidateSettings(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	_, config, err := makeRuntimeConfig(tmpdir)
+	assert.NoError(err)
+
+	m := map[string]interface{}{
+		"runtimeConfig": config,
+	}
+
+	// the pause binary created by makeRuntimeConfig() is not
+	// executable, so problems are only fatal in strict mode.
+	err = validateSettings(m, false)
+	assert.NoError(err)
+
+	err = validateSettings(m, true)
+	assert.Error(err)
+
+	err = validateSettings(map[string]interface{}{}, false)
+	assert.Error(err)
+}
+
+func TestCCEnvGetConfigFileProblems(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	configFile, config, err := makeRuntimeConfig(tmpdir)
+	assert.NoError(err)
+
+	problems := getConfigFileProblems(configFile)
+	assert.Empty(problems)
+
+	data, err := ioutil.ReadFile(configFile)
+	assert.NoError(err)
+
+	lines := strings.Count(string(data), "\n")
+
+	err = ioutil.WriteFile(configFile, append(data, []byte("enable_debugging = true\n")...), testFileMode)
+	assert.NoError(err)
+
+	problems = getConfigFileProblems(configFile)
+	assert.Len(problems, 1)
+	assert.Equal("config", problems[0].component)
+	assert.Equal(fmt.Sprintf("%v:%d", configFile, lines+1), problems[0].path)
+	assert.Contains(problems[0].err.Error(), "runtime.enable_debugging")
+
+	err = os.Chmod(config.AgentConfig.(vc.HyperConfig).PauseBinPath, testExeFileMode)
+	assert.NoError(err)
+
+	m := map[string]interface{}{
+		"runtimeConfig": config,
+		"configFile":    configFile,
+	}
+
+	// unknown options are only fatal in strict mode
+	err = validateSettings(m, false)
+	assert.NoError(err)
+
+	err = validateSettings(m, true)
+	assert.Error(err)
+
+	// a missing config file is a problem
+	problems = getConfigFileProblems(filepath.Join(tmpdir, "missing.toml"))
+	assert.Len(problems, 1)
+	assert.Error(problems[0].err)
+}
+
+func TestCCEnvCLIFunctionValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	const logFile = "/tmp/file.log"
+
+	configFile, config, err := makeRuntimeConfig(tmpdir)
+	assert.NoError(err)
+
+	_, err = getExpectedSettings(config, tmpdir, configFile, logFile)
+	assert.NoError(err)
+
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0666)
+	assert.NoError(err)
+
+	savedOutputFile := defaultOutputFile
+	defaultOutputFile = devNull
+
+	defer func() {
+		defaultOutputFile = savedOutputFile
+	}()
+
+	fn, ok := ccEnvCLICommand.Action.(func(context *cli.Context) error)
+	assert.True(ok)
+
+	app := cli.NewApp()
+	set := flag.NewFlagSet("", 0)
+	set.Bool("validate", true, "")
+	ctx := cli.NewContext(app, set, nil)
+	app.Name = "foo"
+
+	ctx.App.Metadata = map[string]interface{}{
+		"configFile":    configFile,
+		"logfilePath":   logFile,
+		"runtimeConfig": config,
+	}
+
+	err = fn(ctx)
+	assert.Error(err)
+
+	agentConfig, ok := config.AgentConfig.(vc.HyperConfig)
+	assert.True(ok)
+
+	err = os.Chmod(agentConfig.PauseBinPath, testExeFileMode)
+	assert.NoError(err)
+
+	err = fn(ctx)
+	assert.NoError(err)
+
+	// a missing file does not prevent loading the configuration but is
+	// reported as a problem
+	err = os.Remove(config.HypervisorConfig.ImagePath)
+	assert.NoError(err)
+
+	_, _, config, err = loadConfiguration(configFile, true)
+	assert.NoError(err)
+
+	ctx.App.Metadata["runtimeConfig"] = config
+
+	err = fn(ctx)
+	assert.Error(err)
+
+	err = set.Set("validate", "false")
+	assert.NoError(err)
+
+	err = fn(ctx)
+	assert.NoError(err)
+}
+
+func TestCCEnvResolveOptionalPath(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	// ensure the expected values are fully resolved
+	tmpdir, err = filepath.EvalSymlinks(tmpdir)
+	assert.NoError(err)
+
+	file := filepath.Join(tmpdir, "file")
+	err = createEmptyFile(file)
+	assert.NoError(err)
+
+	link := filepath.Join(tmpdir, "link")
+	err = os.Symlink(file, link)
+	assert.NoError(err)
+
+	loop := filepath.Join(tmpdir, "loop")
+	err = os.Symlink(loop, loop)
+	assert.NoError(err)
+
+	type testData struct {
+		path             string
+		expectedResolved string
+		expectError      bool
+	}
+
+	data := []testData{
+		{file, file, false},
+		{link, file, false},
+		{filepath.Join(tmpdir, "does-not-exist"), "", false},
+		{loop, "", true},
+	}
+
+	for _, d := range data {
+		resolved, err := resolveOptionalPath(d.path)
+		if d.expectError {
+			assert.Error(err, "%+v", d)
+			continue
+		}
+
+		assert.NoError(err, "%+v", d)
+		assert.Equal(d.expectedResolved, resolved, "%+v", d)
+	}
+}
+
+func TestCCEnvCLIFunctionMissingBinaries(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	const logFile = "/tmp/file.log"
+
+	configFile, config, err := makeRuntimeConfig(tmpdir)
+	assert.NoError(err)
+
+	_, err = getExpectedSettings(config, tmpdir, configFile, logFile)
+	assert.NoError(err)
+
+	shimPath := config.ShimConfig.(vc.CCShimConfig).Path
+	pauseBinPath := config.AgentConfig.(vc.HyperConfig).PauseBinPath
+
+	for _, path := range []string{shimPath, pauseBinPath} {
+		err = os.Remove(path)
+		assert.NoError(err)
+	}
+
+	// the configuration can still be loaded
+	_, _, config, err = loadConfiguration(configFile, true)
+	assert.NoError(err)
+
+	outFile := filepath.Join(tmpdir, "output")
+	output, err := os.Create(outFile)
+	assert.NoError(err)
+	defer output.Close()
+
+	savedOutputFile := defaultOutputFile
+	defaultOutputFile = output
+
+	defer func() {
+		defaultOutputFile = savedOutputFile
+	}()
+
+	fn, ok := ccEnvCLICommand.Action.(func(context *cli.Context) error)
+	assert.True(ok)
+
+	app := cli.NewApp()
+	ctx := cli.NewContext(app, flag.NewFlagSet("", 0), nil)
+	app.Name = "foo"
+
+	ctx.App.Metadata = map[string]interface{}{
+		"configFile":    configFile,
+		"logfilePath":   logFile,
+		"runtimeConfig": config,
+	}
+
+	err = fn(ctx)
+	assert.NoError(err)
+
+	var ccEnv EnvInfo
+
+	_, err = toml.DecodeFile(outFile, &ccEnv)
+	assert.NoError(err)
+
+	assert.Equal(shimPath, ccEnv.Shim.Path)
+	assert.Empty(ccEnv.Shim.Resolved)
+	assert.Equal(unknown, ccEnv.Shim.Version)
+
+	assert.Equal(pauseBinPath, ccEnv.Agent.PauseBinPath)
+	assert.Empty(ccEnv.Agent.Resolved)
+
+	// the remaining details are still available
+	assert.Equal(config.HypervisorConfig.HypervisorPath, ccEnv.Hypervisor.Path)
+}
+
+func TestCCEnvParseMajorVersion(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		version       string
+		expectedMajor uint64
+		expectError   bool
+	}
+
+	data := []testData{
+		{"", 0, true},
+		{"foo", 0, true},
+		{"1.", 0, true},
+		{"1.a.3", 0, true},
+		{"-1.0.0", 0, true},
+		{"1.2.3.4", 0, true},
+		{"1", 1, false},
+		{"1.2", 1, false},
+		{"1.2.3", 1, false},
+		{"v2.0.1", 2, false},
+		{"10.0.0", 10, false},
+	}
+
+	for _, d := range data {
+		major, err := parseMajorVersion(d.version)
+		if d.expectError {
+			assert.Error(err, "%+v", d)
+			continue
+		}
+
+		assert.NoError(err, "%+v", d)
+		assert.Equal(d.expectedMajor, major, "%+v", d)
+	}
+}
+
+func TestCCEnvCheckFormatVersion(t *testing.T) {
+	assert := assert.New(t)
+
+	major, err := parseMajorVersion(formatVersion)
+	assert.NoError(err)
+
+	type testData struct {
+		required    string
+		expectError bool
+	}
+
+	data := []testData{
+		// equal
+		{formatVersion, false},
+		{fmt.Sprintf("%d", major), false},
+		{fmt.Sprintf("%d.999.999", major), false},
+
+		// older
+		{fmt.Sprintf("%d.0.0", major-1), true},
+
+		// newer
+		{fmt.Sprintf("%d.0.0", major+1), true},
+
+		{"invalid", true},
+	}
+
+	for _, d := range data {
+		err := checkFormatVersion(d.required)
+		if d.expectError {
+			assert.Error(err, "%+v", d)
+		} else {
+			assert.NoError(err, "%+v", d)
+		}
+	}
+}
+
+func TestCCEnvCLIFunctionRequireVersion(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	outFile := filepath.Join(tmpdir, "output")
+	output, err := os.Create(outFile)
+	assert.NoError(err)
+	defer output.Close()
+
+	savedOutputFile := defaultOutputFile
+	defaultOutputFile = output
+
+	defer func() {
+		defaultOutputFile = savedOutputFile
+	}()
+
+	fn, ok := ccEnvCLICommand.Action.(func(context *cli.Context) error)
+	assert.True(ok)
+
+	app := cli.NewApp()
+	set := flag.NewFlagSet("", 0)
+	set.String("require-version", "999.0.0", "")
+	ctx := cli.NewContext(app, set, nil)
+	app.Name = "foo"
+
+	// no metadata is required as the version check happens first
+	ctx.App.Metadata = map[string]interface{}{}
+
+	err = fn(ctx)
+	assert.Error(err)
+	assert.Contains(err.Error(), formatVersion)
+
+	contents, err := getFileContents(outFile)
+	assert.NoError(err)
+	assert.Empty(contents)
+}
+
+func TestCCEnvGetHugePagePools(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	savedSysHugePagesDir := sysHugePagesDir
+	sysHugePagesDir = filepath.Join(tmpdir, "hugepages")
+
+	defer func() {
+		sysHugePagesDir = savedSysHugePagesDir
+	}()
+
+	// no hugepage support
+	pools, err := getHugePagePools()
+	assert.NoError(err)
+	assert.Empty(pools)
+
+	poolDir := filepath.Join(sysHugePagesDir, "hugepages-2048kB")
+	err = os.MkdirAll(poolDir, testDirMode)
+	assert.NoError(err)
+
+	// unrelated entries are ignored
+	err = os.MkdirAll(filepath.Join(sysHugePagesDir, "foo"), testDirMode)
+	assert.NoError(err)
+
+	// pool files are required
+	_, err = getHugePagePools()
+	assert.Error(err)
+
+	err = createFile(filepath.Join(poolDir, "nr_hugepages"), "4\n")
+	assert.NoError(err)
+
+	err = createFile(filepath.Join(poolDir, "free_hugepages"), "invalid\n")
+	assert.NoError(err)
+
+	_, err = getHugePagePools()
+	assert.Error(err)
+
+	err = createFile(filepath.Join(poolDir, "free_hugepages"), "3\n")
+	assert.NoError(err)
+
+	pools, err = getHugePagePools()
+	assert.NoError(err)
+	assert.Equal([]HugePagePoolInfo{{SizeKB: 2048, Total: 4, Free: 3}}, pools)
+
+	err = os.MkdirAll(filepath.Join(sysHugePagesDir, "hugepages-invalidkB"), testDirMode)
+	assert.NoError(err)
+
+	_, err = getHugePagePools()
+	assert.Error(err)
+}
+
+func TestCCEnvGetHugePagesInfoNoHugePages(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	savedProcMemInfo := procMemInfo
+	savedSysHugePagesDir := sysHugePagesDir
+
+	procMemInfo = filepath.Join(tmpdir, "meminfo")
+	sysHugePagesDir = filepath.Join(tmpdir, "hugepages")
+
+	defer func() {
+		procMemInfo = savedProcMemInfo
+		sysHugePagesDir = savedSysHugePagesDir
+	}()
+
+	// ENOENT
+	_, err = getHugePagesInfo()
+	assert.Error(err)
+
+	err = createFile(procMemInfo, "MemTotal: 2048 kB\nMemFree: 1024 kB\n")
+	assert.NoError(err)
+
+	info, err := getHugePagesInfo()
+	assert.NoError(err)
+	assert.Equal(HugePagesInfo{}, info)
+}
+
+func TestGetHypervisorInfoDefaultResources(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	const logFile = "/tmp/file.log"
+
+	configFile, config, err := makeRuntimeConfig(tmpdir)
+	assert.NoError(err)
+
+	// makeRuntimeConfig() specifies the built-in defaults
+	assert.Equal(defaultVCPUCount, config.HypervisorConfig.DefaultVCPUs)
+	assert.Equal(defaultMemSize, config.HypervisorConfig.DefaultMemSz)
+
+	_, err = getExpectedSettings(config, tmpdir, configFile, logFile)
+	assert.NoError(err)
+
+	const expectedVCPUs = 3
+	const expectedMemoryMB = 4096
+
+	config.HypervisorConfig.DefaultVCPUs = expectedVCPUs
+	config.HypervisorConfig.DefaultMemSz = expectedMemoryMB
+
+	ccEnv, err := getEnvInfo(configFile, logFile, config)
+	assert.NoError(err)
+
+	outFile := filepath.Join(tmpdir, "output")
+	output, err := os.Create(outFile)
+	assert.NoError(err)
+	defer output.Close()
+
+	err = showSettings(ccEnv, output)
+	assert.NoError(err)
+
+	var decoded EnvInfo
+
+	_, err = toml.DecodeFile(outFile, &decoded)
+	assert.NoError(err)
+	assert.Equal(uint32(expectedVCPUs), decoded.Hypervisor.DefaultVCPUs)
+	assert.Equal(uint32(expectedMemoryMB), decoded.Hypervisor.DefaultMemoryMB)
+}
+
+// benchmarkCCEnvGetEnvInfoSlowVersion runs getInfo with components that
+// take a while to display their version.
+func benchmarkCCEnvGetEnvInfoSlowVersion(b *testing.B, getInfo func(string, string, oci.RuntimeConfig) (EnvInfo, error)) {
+	tmpdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	const logFile = "/tmp/file.log"
+
+	configFile, config, err := makeRuntimeConfig(tmpdir)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	if _, err := getExpectedSettings(config, tmpdir, configFile, logFile); err != nil {
+		b.Fatal(err)
+	}
+
+	shimConfig, ok := config.ShimConfig.(vc.CCShimConfig)
+	if !ok {
+		b.Fatal("failed to get shim config")
+	}
+
+	for _, file := range []string{config.HypervisorConfig.HypervisorPath, defaultProxyPath, shimConfig.Path} {
+		err := createFile(file, `#!/bin/sh
+	sleep 0.05
+	[ "$1" = "--version" ] && echo "version 1.0"`)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := getInfo(configFile, logFile, config); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCCEnvGetEnvInfoSlowVersion(b *testing.B) {
+	benchmarkCCEnvGetEnvInfoSlowVersion(b, getEnvInfo)
+}
+
+// BenchmarkCCEnvGetEnvInfoSlowVersionSequential collects the same details
+// as getEnvInfo one after the other, for comparison.
+func BenchmarkCCEnvGetEnvInfoSlowVersionSequential(b *testing.B) {
+	benchmarkCCEnvGetEnvInfoSlowVersion(b, func(configFile, logfilePath string, config oci.RuntimeConfig) (EnvInfo, error) {
+		var env EnvInfo
+		var err error
+
+		env.Meta = getMetaInfo()
+		env.Runtime = getRuntimeInfo(configFile, logfilePath, config)
+		env.Hypervisor = getHypervisorInfo(config)
+
+		if env.Proxy, err = getProxyInfo(config); err != nil {
+			return EnvInfo{}, err
+		}
+
+		if env.Shim, err = getShimInfo(config); err != nil {
+			return EnvInfo{}, err
+		}
+
+		if env.Agent, err = getAgentInfo(config); err != nil {
+			return EnvInfo{}, err
+		}
+
+		if env.Host, err = getHostInfo(); err != nil {
+			return EnvInfo{}, err
+		}
+
+		return env, nil
+	})
+}
+
+func TestCCEnvGetHostInfoCgroup(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	_, err = getExpectedHostDetails(tmpdir)
+	assert.NoError(err)
+
+	savedMountInfo := procMountInfo
+	procMountInfo = filepath.Join(tmpdir, "mountinfo")
+
+	defer func() {
+		procMountInfo = savedMountInfo
+	}()
+
+	type testData struct {
+		contents        string
+		expectedVersion int
+		expectedMount   string
+	}
+
+	data := []testData{
+		{"33 32 0:29 / /sys/fs/cgroup/cpu rw,relatime - cgroup cgroup rw,cpu\n", 1, "/sys/fs/cgroup"},
+		{"42 32 0:38 / /sys/fs/cgroup rw,relatime - cgroup2 cgroup2 rw\n", 2, "/sys/fs/cgroup"},
+		{"42 32 0:38 / /sys/fs/cgroup/unified rw,relatime - cgroup2 cgroup2 rw\n" +
+			"33 32 0:29 / /sys/fs/cgroup/cpu rw,relatime - cgroup cgroup rw,cpu\n", 1, "/sys/fs/cgroup"},
+		{"", 0, ""},
+	}
+
+	for _, d := range data {
+		err := ioutil.WriteFile(procMountInfo, []byte(d.contents), testFileMode)
+		assert.NoError(err)
+
+		host, err := getHostInfo()
+		assert.NoError(err)
+		assert.Equal(d.expectedVersion, host.CgroupVersion, "test data: %+v", d)
+		assert.Equal(d.expectedMount, host.CgroupMount, "test data: %+v", d)
+	}
 }
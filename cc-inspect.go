@@ -0,0 +1,210 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/urfave/cli"
+)
+
+// inspectInfo holds the virtcontainers configuration a container would
+// be created with.
+type inspectInfo struct {
+	ContainerID   string
+	ContainerType string
+
+	// Pod is the configuration of the pod a sandbox container creates,
+	// including its hypervisor configuration.
+	Pod *vc.PodConfig `json:",omitempty"`
+
+	// Container is the configuration of a container created in an
+	// existing pod.
+	Container *vc.ContainerConfig `json:",omitempty"`
+
+	// HypervisorCommand is the QEMU command line a sandbox container
+	// launches the VM of its pod with.
+	HypervisorCommand []string `json:",omitempty"`
+}
+
+// qemuMachineAccelerators are the accelerators virtcontainers always
+// enables, before those set by the machine_accelerators option.
+const qemuMachineAccelerators = "kvm,kernel_irqchip,nvdimm"
+
+// getHypervisorCommand returns the QEMU command line virtcontainers builds
+// for the VM of the specified pod, as far as it depends on the pod
+// configuration: the hypervisor, machine, CPU, memory, kernel, image and
+// firmware options. The sockets and the shared directories, consoles and
+// network interfaces virtcontainers adds for the pod, and the kernel
+// parameters it sets by default, are not included.
+func getHypervisorCommand(podConfig vc.PodConfig) ([]string, error) {
+	config := podConfig.HypervisorConfig
+
+	machine := config.HypervisorMachineType
+	if machine == "" {
+		machine = vc.QemuPCLite
+	}
+
+	accelerators := qemuMachineAccelerators
+	if config.MachineAccelerators != "" {
+		accelerators += "," + strings.TrimPrefix(config.MachineAccelerators, ",")
+	}
+
+	cpuModel := "host"
+	if !config.DisableNestingChecks {
+		nested, err := vc.RunningOnVMM(procCPUInfo)
+		if err != nil {
+			return nil, err
+		}
+
+		if nested {
+			cpuModel += ",pmu=off"
+		}
+	}
+
+	memory := config.DefaultMemSz
+	if podConfig.VMConfig.Memory > 0 {
+		memory = uint32(podConfig.VMConfig.Memory)
+	}
+
+	vcpus := config.DefaultVCPUs
+	if podConfig.VMConfig.VCPUs > 0 {
+		vcpus = uint32(podConfig.VMConfig.VCPUs)
+	}
+
+	image, err := os.Stat(config.ImagePath)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := []string{
+		config.HypervisorPath,
+		"-name", fmt.Sprintf("pod-%s", podConfig.ID),
+		"-machine", fmt.Sprintf("%s,accel=%s", machine, accelerators),
+		"-cpu", cpuModel,
+		"-m", fmt.Sprintf("%dM", memory),
+		"-smp", fmt.Sprintf("%d,cores=%d,threads=1,sockets=1", vcpus, vcpus),
+		"-device", "nvdimm,id=nv0,memdev=mem0",
+		"-object", fmt.Sprintf("memory-backend-file,id=mem0,mem-path=%s,size=%d", config.ImagePath, image.Size()),
+		"-kernel", config.KernelPath,
+	}
+
+	if params := vc.SerializeParams(config.KernelParams, "="); len(params) > 0 {
+		cmd = append(cmd, "-append", strings.Join(params, " "))
+	}
+
+	if config.FirmwarePath != "" {
+		cmd = append(cmd, "-bios", config.FirmwarePath)
+	}
+
+	return cmd, nil
+}
+
+var ccInspectCLICommand = cli.Command{
+	Name:      "cc-inspect",
+	Usage:     "display the virtcontainers configuration and QEMU command line of a bundle",
+	ArgsUsage: "<container-id>",
+	Description: `The cc-inspect command converts the OCI specification of a bundle to the
+   virtcontainers pod or container configuration create would use, and
+   displays it in JSON format, along with the QEMU command line of the VM of
+   a pod. The configuration file and the annotations of the specification
+   are taken into account, but nothing is created.`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "bundle, b",
+			Value: "",
+			Usage: "path to the root of the bundle directory, defaults to the current directory",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		runtimeConfig, ok := context.App.Metadata["runtimeConfig"].(oci.RuntimeConfig)
+		if !ok {
+			return errors.New("invalid runtime config")
+		}
+
+		return inspect(defaultOutputFile, context.Args().First(), context.String("bundle"), runtimeConfig)
+	},
+}
+
+// getInspectInfo returns the virtcontainers configuration create would
+// use for the specified container.
+func getInspectInfo(containerID, bundlePath string, runtimeConfig oci.RuntimeConfig) (inspectInfo, error) {
+	ociSpec, bundlePath, err := getCreateSpec(containerID, bundlePath)
+	if err != nil {
+		return inspectInfo{}, err
+	}
+
+	containerType, err := ociSpec.ContainerType()
+	if err != nil {
+		return inspectInfo{}, err
+	}
+
+	info := inspectInfo{
+		ContainerID:   containerID,
+		ContainerType: string(containerType),
+	}
+
+	disableOutput := noNeedForOutput(true, ociSpec.Process.Terminal)
+
+	switch containerType {
+	case vc.PodSandbox:
+		setup, err := checkPod(ociSpec, runtimeConfig)
+		if err != nil {
+			return inspectInfo{}, err
+		}
+
+		podConfig, err := getCreatePodConfig(ociSpec, runtimeConfig, setup, containerID, bundlePath, "", disableOutput)
+		if err != nil {
+			return inspectInfo{}, err
+		}
+
+		info.Pod = &podConfig
+
+		info.HypervisorCommand, err = getHypervisorCommand(podConfig)
+		if err != nil {
+			return inspectInfo{}, err
+		}
+	case vc.PodContainer:
+		contConfig, err := getContainerConfig(ociSpec, containerID, bundlePath, "", disableOutput)
+		if err != nil {
+			return inspectInfo{}, err
+		}
+
+		info.Container = &contConfig
+	}
+
+	return info, nil
+}
+
+// inspect writes the virtcontainers configuration create would use for
+// the specified container to w.
+func inspect(w io.Writer, containerID, bundlePath string, runtimeConfig oci.RuntimeConfig) error {
+	info, err := getInspectInfo(containerID, bundlePath, runtimeConfig)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(info)
+}
@@ -0,0 +1,399 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+// inspectTestBundle creates a bundle with the specified annotations
+// below dir and returns its path.
+func inspectTestBundle(assert *assert.Assertions, dir string, annotations map[string]string) string {
+	bundlePath := filepath.Join(dir, "bundle")
+
+	err := makeOCIBundle(bundlePath)
+	assert.NoError(err)
+
+	ociConfigFile := filepath.Join(bundlePath, "config.json")
+
+	spec, err := readOCIConfigFile(ociConfigFile)
+	assert.NoError(err)
+
+	spec.Annotations = annotations
+
+	err = writeOCIConfigFile(spec, ociConfigFile)
+	assert.NoError(err)
+
+	return bundlePath
+}
+
+func TestInspectPodAnnotations(t *testing.T) {
+	assert := assert.New(t)
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		// No pre-existing pods
+		return []vc.PodStatus{}, nil
+	}
+
+	defer func() {
+		testingImpl.ListPodFunc = nil
+	}()
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	defer setTestHostMemory(assert, tmpdir)()
+
+	runtimeConfig, err := newTestRuntimeConfig(tmpdir, testConsole, true)
+	assert.NoError(err)
+
+	// the QEMU CPU model does not depend on the host
+	runtimeConfig.HypervisorConfig.DisableNestingChecks = true
+
+	bundlePath := inspectTestBundle(assert, tmpdir, map[string]string{
+		testContainerTypeAnnotation: testContainerTypePod,
+		memoryAnnotation:            "4096",
+		vcpusAnnotation:             "3",
+		kernelParamsAnnotation:      "foo=bar",
+	})
+
+	var buf bytes.Buffer
+
+	err = inspect(&buf, testContainerID, bundlePath, runtimeConfig)
+	assert.NoError(err)
+
+	var info struct {
+		ContainerID   string
+		ContainerType string
+		Pod           *struct {
+			ID               string
+			HypervisorConfig vc.HypervisorConfig
+		}
+		Container         *json.RawMessage
+		HypervisorCommand []string
+	}
+
+	err = json.Unmarshal(buf.Bytes(), &info)
+	assert.NoError(err)
+
+	assert.Equal(testContainerID, info.ContainerID)
+	assert.Equal(string(vc.PodSandbox), info.ContainerType)
+	assert.Nil(info.Container)
+
+	if !assert.NotNil(info.Pod) {
+		return
+	}
+
+	assert.Equal(testContainerID, info.Pod.ID)
+
+	// the annotations override the configuration file
+	hypervisorConfig := info.Pod.HypervisorConfig
+	assert.Equal(uint32(4096), hypervisorConfig.DefaultMemSz)
+	assert.Equal(uint32(3), hypervisorConfig.DefaultVCPUs)
+	assert.Contains(hypervisorConfig.KernelParams, vc.Param{Key: "foo", Value: "bar"})
+	assert.Equal(runtimeConfig.HypervisorConfig.KernelPath, hypervisorConfig.KernelPath)
+
+	// the QEMU command line uses the same values
+	cmd := info.HypervisorCommand
+	if assert.NotEmpty(cmd) {
+		assert.Equal(runtimeConfig.HypervisorConfig.HypervisorPath, cmd[0])
+	}
+
+	assertHypervisorArg(assert, cmd, "-kernel", runtimeConfig.HypervisorConfig.KernelPath)
+	assertHypervisorArg(assert, cmd, "-m", "4096M")
+	assertHypervisorArg(assert, cmd, "-smp", "3,cores=3,threads=1,sockets=1")
+	assertHypervisorArg(assert, cmd, "-name", "pod-"+testContainerID)
+
+	object := hypervisorArg(cmd, "-object")
+	assert.Contains(object, "mem-path="+runtimeConfig.HypervisorConfig.ImagePath+",")
+	assert.Contains(hypervisorArg(cmd, "-append"), "foo=bar")
+
+	// without annotations, the configuration file values are used
+	os.RemoveAll(bundlePath)
+	bundlePath = inspectTestBundle(assert, tmpdir, map[string]string{
+		testContainerTypeAnnotation: testContainerTypePod,
+	})
+
+	info.Pod = nil
+	buf.Reset()
+
+	err = inspect(&buf, testContainerID, bundlePath, runtimeConfig)
+	assert.NoError(err)
+
+	err = json.Unmarshal(buf.Bytes(), &info)
+	assert.NoError(err)
+
+	if assert.NotNil(info.Pod) {
+		assert.Equal(runtimeConfig.HypervisorConfig.DefaultMemSz, info.Pod.HypervisorConfig.DefaultMemSz)
+		assert.Equal(runtimeConfig.HypervisorConfig.DefaultVCPUs, info.Pod.HypervisorConfig.DefaultVCPUs)
+	}
+
+	assertHypervisorArg(assert, info.HypervisorCommand, "-m", fmt.Sprintf("%dM", runtimeConfig.HypervisorConfig.DefaultMemSz))
+}
+
+// hypervisorArg returns the value of the specified option in the QEMU
+// command line cmd.
+func hypervisorArg(cmd []string, option string) string {
+	for i := 0; i < len(cmd)-1; i++ {
+		if cmd[i] == option {
+			return cmd[i+1]
+		}
+	}
+
+	return ""
+}
+
+func assertHypervisorArg(assert *assert.Assertions, cmd []string, option, value string) {
+	assert.Equal(value, hypervisorArg(cmd, option), "option %v of %v", option, cmd)
+}
+
+func TestGetHypervisorCommandNoImage(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	podConfig := vc.PodConfig{
+		ID: testContainerID,
+		HypervisorConfig: vc.HypervisorConfig{
+			ImagePath:            filepath.Join(tmpdir, "image"),
+			DisableNestingChecks: true,
+		},
+	}
+
+	_, err = getHypervisorCommand(podConfig)
+	assert.Error(err)
+}
+
+func TestGetHypervisorCommandMachine(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	image := filepath.Join(tmpdir, "image")
+	err = ioutil.WriteFile(image, []byte("image"), testFileMode)
+	assert.NoError(err)
+
+	podConfig := vc.PodConfig{
+		ID: testContainerID,
+		HypervisorConfig: vc.HypervisorConfig{
+			HypervisorPath:       "/usr/bin/qemu-lite-system-x86_64",
+			KernelPath:           "/usr/share/clear-containers/vmlinuz",
+			ImagePath:            image,
+			FirmwarePath:         "/usr/share/clear-containers/bios.bin",
+			MachineAccelerators:  ",foo",
+			DefaultMemSz:         1024,
+			DefaultVCPUs:         1,
+			DisableNestingChecks: true,
+		},
+		VMConfig: vc.Resources{
+			Memory: 2048,
+			VCPUs:  2,
+		},
+	}
+
+	cmd, err := getHypervisorCommand(podConfig)
+	assert.NoError(err)
+
+	assertHypervisorArg(assert, cmd, "-machine", vc.QemuPCLite+",accel="+qemuMachineAccelerators+",foo")
+	assertHypervisorArg(assert, cmd, "-cpu", "host")
+	assertHypervisorArg(assert, cmd, "-m", "2048M")
+	assertHypervisorArg(assert, cmd, "-smp", "2,cores=2,threads=1,sockets=1")
+	assertHypervisorArg(assert, cmd, "-object", "memory-backend-file,id=mem0,mem-path="+image+",size=5")
+	assertHypervisorArg(assert, cmd, "-bios", "/usr/share/clear-containers/bios.bin")
+	assertHypervisorArg(assert, cmd, "-append", "")
+
+	savedProcCPUInfo := procCPUInfo
+	procCPUInfo = filepath.Join(tmpdir, "cpuinfo")
+
+	defer func() {
+		procCPUInfo = savedProcCPUInfo
+	}()
+
+	err = createFile(procCPUInfo, "flags\t: vmx lm sse4_1 hypervisor\n")
+	assert.NoError(err)
+
+	podConfig.HypervisorConfig.DisableNestingChecks = false
+
+	cmd, err = getHypervisorCommand(podConfig)
+	assert.NoError(err)
+	assertHypervisorArg(assert, cmd, "-cpu", "host,pmu=off")
+}
+
+func TestInspectInvalidAnnotation(t *testing.T) {
+	assert := assert.New(t)
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		// No pre-existing pods
+		return []vc.PodStatus{}, nil
+	}
+
+	defer func() {
+		testingImpl.ListPodFunc = nil
+	}()
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	runtimeConfig, err := newTestRuntimeConfig(tmpdir, testConsole, true)
+	assert.NoError(err)
+
+	bundlePath := inspectTestBundle(assert, tmpdir, map[string]string{
+		testContainerTypeAnnotation: testContainerTypePod,
+		vcpusAnnotation:             "0",
+	})
+
+	var buf bytes.Buffer
+
+	err = inspect(&buf, testContainerID, bundlePath, runtimeConfig)
+	assert.Error(err)
+	assert.Empty(buf.Bytes())
+}
+
+func TestInspectContainer(t *testing.T) {
+	assert := assert.New(t)
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		// No pre-existing pods
+		return []vc.PodStatus{}, nil
+	}
+
+	defer func() {
+		testingImpl.ListPodFunc = nil
+	}()
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	runtimeConfig, err := newTestRuntimeConfig(tmpdir, testConsole, true)
+	assert.NoError(err)
+
+	bundlePath := inspectTestBundle(assert, tmpdir, map[string]string{
+		testContainerTypeAnnotation: testContainerTypeContainer,
+		testSandboxIDAnnotation:     testPodID,
+	})
+
+	info, err := getInspectInfo(testContainerID, bundlePath, runtimeConfig)
+	assert.NoError(err)
+
+	assert.Equal(string(vc.PodContainer), info.ContainerType)
+	assert.Nil(info.Pod)
+
+	if assert.NotNil(info.Container) {
+		assert.Equal(testContainerID, info.Container.ID)
+		assert.Equal(filepath.Join(bundlePath, "rootfs"), info.Container.RootFs)
+	}
+}
+
+func TestInspectCLIFunction(t *testing.T) {
+	assert := assert.New(t)
+
+	set := flag.NewFlagSet("", 0)
+	ctx := cli.NewContext(cli.NewApp(), set, nil)
+
+	fn, ok := ccInspectCLICommand.Action.(func(context *cli.Context) error)
+	assert.True(ok)
+
+	// no runtime config
+	err := fn(ctx)
+	assert.Error(err)
+
+	ctx.App.Metadata = map[string]interface{}{
+		"runtimeConfig": oci.RuntimeConfig{},
+	}
+
+	// no container ID
+	err = fn(ctx)
+	assert.Error(err)
+}
+
+func TestInspectPodAgentSockets(t *testing.T) {
+	assert := assert.New(t)
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		// No pre-existing pods
+		return []vc.PodStatus{}, nil
+	}
+
+	defer func() {
+		testingImpl.ListPodFunc = nil
+	}()
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	savedAgentSocketDir := agentSocketDir
+	agentSocketDir = filepath.Join(tmpdir, "sockets")
+
+	defer func() {
+		agentSocketDir = savedAgentSocketDir
+	}()
+
+	runtimeConfig, err := newTestRuntimeConfig(tmpdir, testConsole, true)
+	assert.NoError(err)
+
+	// the QEMU CPU model does not depend on the host
+	runtimeConfig.HypervisorConfig.DisableNestingChecks = true
+
+	bundlePath := inspectTestBundle(assert, tmpdir, map[string]string{
+		testContainerTypeAnnotation: testContainerTypePod,
+	})
+
+	var buf bytes.Buffer
+
+	err = inspect(&buf, testContainerID, bundlePath, runtimeConfig)
+	assert.NoError(err)
+
+	var info struct {
+		Pod *struct {
+			AgentConfig struct {
+				SockCtlName string
+				SockTtyName string
+			}
+		}
+	}
+
+	err = json.Unmarshal(buf.Bytes(), &info)
+	assert.NoError(err)
+
+	if !assert.NotNil(info.Pod) {
+		return
+	}
+
+	// the sockets create would use are shown, but not created
+	dir := filepath.Join(agentSocketDir, testContainerID)
+	assert.Equal(filepath.Join(dir, "hyper.sock"), info.Pod.AgentConfig.SockCtlName)
+	assert.Equal(filepath.Join(dir, "tty.sock"), info.Pod.AgentConfig.SockTtyName)
+	assert.False(fileExists(dir))
+}
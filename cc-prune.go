@@ -0,0 +1,209 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// pruneGracePeriod is how long the state of a pod is left alone after it
+// was last modified, since the state of a pod being created exists before
+// its VM is started.
+var pruneGracePeriod = time.Minute
+
+// vmRunningFunc is used to check whether the VM of a pod is running. It is
+// a variable to allow tests to mock it.
+var vmRunningFunc = vmRunning
+
+var ccPruneCLICommand = cli.Command{
+	Name:  "cc-prune",
+	Usage: "remove the state left behind by pods whose VM is no longer running",
+	Description: `The cc-prune command removes the state of the pods whose VM and shims
+   have all exited, for example because the host crashed or the pods were not
+   deleted. The ID of each of these pods is displayed. Pods whose state was
+   modified in the last minute, which may still be being created, are skipped.`,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "only display the pods whose state would be removed",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		return prune(defaultOutputFile, context.Bool("dry-run"))
+	},
+}
+
+// getVMPIDs returns the PIDs of the hypervisor processes of the specified
+// pod, recognised by their "-name" option.
+func getVMPIDs(podID string) ([]int, error) {
+	processes, err := getHostProcesses()
+	if err != nil {
+		return nil, err
+	}
+
+	var pids []int
+
+	for _, p := range processes {
+		if getOptionValue(p.args, "-name") == vmNamePrefix+podID {
+			pids = append(pids, p.pid)
+		}
+	}
+
+	return pids, nil
+}
+
+// vmRunning returns true if the hypervisor process of the specified pod is
+// running. A hypervisor which is busy or paused would not answer on its
+// QMP socket, so the processes are checked instead. If they cannot be
+// listed, the VM is assumed to be running so that its pod is not removed.
+func vmRunning(podID string) bool {
+	pids, err := getVMPIDs(podID)
+	if err != nil {
+		ccLog.WithError(err).Warn("Cannot list the host processes")
+		return true
+	}
+
+	return len(pids) > 0
+}
+
+// getStatePodIDs returns the ID of every pod with a state directory.
+func getStatePodIDs() ([]string, error) {
+	ids := make(map[string]bool)
+
+	for _, statePath := range podStatePaths {
+		entries, err := ioutil.ReadDir(statePath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() {
+				ids[entry.Name()] = true
+			}
+		}
+	}
+
+	var podIDs []string
+
+	for id := range ids {
+		podIDs = append(podIDs, id)
+	}
+
+	sort.Strings(podIDs)
+
+	return podIDs, nil
+}
+
+// getPodPIDs returns the shim PIDs of the containers of each of the
+// specified pods.
+func getPodPIDs(podList []vc.PodStatus) map[string][]int {
+	pids := make(map[string][]int)
+
+	for _, pod := range podList {
+		pids[pod.ID] = []int{}
+
+		for _, container := range pod.ContainersStatus {
+			if container.PID > 0 {
+				pids[pod.ID] = append(pids[pod.ID], container.PID)
+			}
+		}
+	}
+
+	return pids
+}
+
+// podModTime returns the last time the state of the specified pod was
+// modified.
+func podModTime(podID string) time.Time {
+	var modTime time.Time
+
+	for _, statePath := range podStatePaths {
+		info, err := os.Stat(filepath.Join(statePath, podID))
+		if err == nil && info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+
+	return modTime
+}
+
+// podDead returns true if neither the VM nor any of the shims of the
+// specified pod are running.
+func podDead(podID string, pids []int) bool {
+	if time.Since(podModTime(podID)) < pruneGracePeriod {
+		return false
+	}
+
+	for _, pid := range pids {
+		if !processExited(pid) {
+			return false
+		}
+	}
+
+	return !vmRunningFunc(podID)
+}
+
+// prune removes the state of the pods that are no longer running and
+// writes their IDs to w. If dryRun is set, nothing is removed.
+func prune(w io.Writer, dryRun bool) error {
+	podIDs, err := getStatePodIDs()
+	if err != nil {
+		return err
+	}
+
+	podList, err := vci.ListPod()
+	if err != nil {
+		return err
+	}
+
+	pids := getPodPIDs(podList)
+
+	for _, podID := range podIDs {
+		if !podDead(podID, pids[podID]) {
+			continue
+		}
+
+		fmt.Fprintln(w, podID)
+
+		if dryRun {
+			continue
+		}
+
+		ccLog.WithFields(logrus.Fields{
+			"pod":  podID,
+			"pids": pids[podID],
+		}).Info("Removing state of dead pod")
+
+		if err := forceDeletePod(podID); err != nil {
+			return fmt.Errorf("Cannot remove the state of pod %v: %v", podID, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrune(t *testing.T) {
+	assert := assert.New(t)
+
+	// A process that has exited.
+	cmd := exec.Command("true")
+	err := cmd.Run()
+	assert.NoError(err)
+	deadPID := cmd.Process.Pid
+
+	const (
+		liveVMPod   = "prune-live-vm"
+		liveShimPod = "prune-live-shim"
+		deadPod     = "prune-dead"
+		orphanPod   = "prune-orphan"
+		recentPod   = "prune-recent"
+	)
+
+	old := time.Now().Add(-2 * pruneGracePeriod)
+
+	for _, id := range []string{liveVMPod, liveShimPod, deadPod, orphanPod, recentPod} {
+		dir := filepath.Join(podStatePaths[0], id)
+
+		err := os.MkdirAll(filepath.Join(dir, testContainerID), testDirMode)
+		assert.NoError(err)
+		defer os.RemoveAll(dir)
+
+		if id != recentPod {
+			err = os.Chtimes(dir, old, old)
+			assert.NoError(err)
+		}
+	}
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{
+			{ID: liveVMPod, ContainersStatus: []vc.ContainerStatus{{ID: testContainerID, PID: deadPID}}},
+			{ID: liveShimPod, ContainersStatus: []vc.ContainerStatus{{ID: testContainerID, PID: os.Getpid()}}},
+			{ID: deadPod, ContainersStatus: []vc.ContainerStatus{{ID: testContainerID, PID: deadPID}}},
+			{ID: recentPod, ContainersStatus: []vc.ContainerStatus{{ID: testContainerID, PID: deadPID}}},
+		}, nil
+	}
+
+	savedVMRunningFunc := vmRunningFunc
+	vmRunningFunc = func(podID string) bool {
+		return podID == liveVMPod
+	}
+
+	defer func() {
+		testingImpl.ListPodFunc = nil
+		vmRunningFunc = savedVMRunningFunc
+	}()
+
+	var buf bytes.Buffer
+
+	// nothing is removed by a dry run
+	err = prune(&buf, true)
+	assert.NoError(err)
+	assert.Equal(deadPod+"\n"+orphanPod+"\n", buf.String())
+
+	for _, id := range []string{liveVMPod, liveShimPod, deadPod, orphanPod, recentPod} {
+		assert.True(fileExists(filepath.Join(podStatePaths[0], id)), "pod %v", id)
+	}
+
+	buf.Reset()
+
+	err = prune(&buf, false)
+	assert.NoError(err)
+	assert.Equal(deadPod+"\n"+orphanPod+"\n", buf.String())
+
+	for _, id := range []string{liveVMPod, liveShimPod, recentPod} {
+		assert.True(fileExists(filepath.Join(podStatePaths[0], id)), "pod %v", id)
+	}
+
+	for _, id := range []string{deadPod, orphanPod} {
+		assert.False(fileExists(filepath.Join(podStatePaths[0], id)), "pod %v", id)
+	}
+}
+
+func TestVMRunning(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	savedProcPath := procPath
+	procPath = filepath.Join(tmpdir, "proc")
+
+	defer func() {
+		procPath = savedProcPath
+	}()
+
+	// the processes cannot be listed
+	assert.True(vmRunning(testPodID))
+
+	createFakeProcess(assert, 100, "/usr/bin/qemu-lite-system-x86_64", "-name", vmNamePrefix+testPodID)
+	createFakeProcess(assert, 101, "/usr/bin/qemu-lite-system-x86_64", "-name", vmNamePrefix+testPodID+"-other")
+	createFakeProcess(assert, 102, "/usr/bin/cc-shim", "-c", testContainerID)
+
+	assert.True(vmRunning(testPodID))
+	assert.False(vmRunning("other-pod"))
+
+	err = os.RemoveAll(filepath.Join(procPath, "100"))
+	assert.NoError(err)
+
+	assert.False(vmRunning(testPodID))
+}
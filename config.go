@@ -18,9 +18,13 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path/filepath"
+	"reflect"
 	goruntime "runtime"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	vc "github.com/containers/virtcontainers"
@@ -74,19 +78,24 @@ type tomlConfig struct {
 }
 
 type hypervisor struct {
-	Path                  string `toml:"path"`
-	Kernel                string `toml:"kernel"`
-	Image                 string `toml:"image"`
-	KernelParams          string `toml:"kernel_params"`
-	MachineType           string `toml:"machine_type"`
-	DefaultVCPUs          int32  `toml:"default_vcpus"`
-	DefaultMemSz          uint32 `toml:"default_memory"`
-	DisableBlockDeviceUse bool   `toml:"disable_block_device_use"`
-	MemPrealloc           bool   `toml:"enable_mem_prealloc"`
-	HugePages             bool   `toml:"enable_hugepages"`
-	Swap                  bool   `toml:"enable_swap"`
-	Debug                 bool   `toml:"enable_debug"`
-	DisableNestingChecks  bool   `toml:"disable_nesting_checks"`
+	Path                  string   `toml:"path"`
+	Kernel                string   `toml:"kernel"`
+	Image                 string   `toml:"image"`
+	Initrd                string   `toml:"initrd"`
+	KernelParams          string   `toml:"kernel_params"`
+	KernelModules         []string `toml:"kernel_modules"`
+	MachineType           string   `toml:"machine_type"`
+	DefaultVCPUs          int32    `toml:"default_vcpus"`
+	DefaultMemSz          uint32   `toml:"default_memory"`
+	DisableBlockDeviceUse bool     `toml:"disable_block_device_use"`
+	MemPrealloc           bool     `toml:"enable_mem_prealloc"`
+	HugePages             bool     `toml:"enable_hugepages"`
+	Swap                  bool     `toml:"enable_swap"`
+	Debug                 bool     `toml:"enable_debug"`
+	DisableNestingChecks  bool     `toml:"disable_nesting_checks"`
+	NUMAPinning           bool     `toml:"enable_numa_pinning"`
+	ImageChecksum         string   `toml:"image_checksum"`
+	ExtraArgs             []string `toml:"extra_args"`
 }
 
 type proxy struct {
@@ -96,6 +105,10 @@ type proxy struct {
 type runtime struct {
 	GlobalLogPath string `toml:"global_log_path"`
 	Debug         bool   `toml:"enable_debug"`
+	LogLevel      string `toml:"log_level"`
+	TraceEndpoint string `toml:"trace_endpoint"`
+	AgentTimeout  int    `toml:"agent_timeout"`
+	SyncGuestTime bool   `toml:"sync_guest_time"`
 }
 
 type shim struct {
@@ -105,6 +118,75 @@ type shim struct {
 
 type agent struct {
 	PauseRootPath string `toml:"pause_root_path"`
+	SocketDir     string `toml:"socket_dir"`
+}
+
+// expandPath expands "$VAR" and "${VAR}" references in the specified path
+// using the environment. "$$" expands to a literal "$". It is an error to
+// reference a variable that is not set.
+func expandPath(path string) (string, error) {
+	var err error
+
+	expanded := os.Expand(path, func(name string) string {
+		if name == "$" {
+			return "$"
+		}
+
+		value, ok := os.LookupEnv(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("environment variable %q referenced by %q is not set", name, path)
+		}
+
+		return value
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return expanded, nil
+}
+
+// expandAndResolvePath expands any environment variables in the specified
+// path before resolving it.
+func expandAndResolvePath(path string) (string, error) {
+	expanded, err := expandPath(path)
+	if err != nil {
+		return "", err
+	}
+
+	return resolvePath(expanded)
+}
+
+// expandAndResolveOptionalPath is like expandAndResolvePath() but returns
+// the absolute, unresolved path if it does not exist. The commands needing
+// the file check it exists with checkRuntimeFiles() so that a missing
+// binary does not prevent loading the configuration.
+func expandAndResolveOptionalPath(path string) (string, error) {
+	expanded, err := expandPath(path)
+	if err != nil {
+		return "", err
+	}
+
+	if expanded == "" {
+		return "", fmt.Errorf("path must be specified")
+	}
+
+	absolute, err := filepath.Abs(expanded)
+	if err != nil {
+		return "", err
+	}
+
+	resolved, err := resolveOptionalPath(absolute)
+	if err != nil {
+		return "", err
+	}
+
+	if resolved == "" {
+		return absolute, nil
+	}
+
+	return resolved, nil
 }
 
 func (h hypervisor) path() (string, error) {
@@ -114,7 +196,7 @@ func (h hypervisor) path() (string, error) {
 		p = defaultHypervisorPath
 	}
 
-	return resolvePath(p)
+	return expandAndResolveOptionalPath(p)
 }
 
 func (h hypervisor) kernel() (string, error) {
@@ -124,7 +206,7 @@ func (h hypervisor) kernel() (string, error) {
 		p = defaultKernelPath
 	}
 
-	return resolvePath(p)
+	return expandAndResolveOptionalPath(p)
 }
 
 func (h hypervisor) image() (string, error) {
@@ -134,7 +216,25 @@ func (h hypervisor) image() (string, error) {
 		p = defaultImagePath
 	}
 
-	return resolvePath(p)
+	return expandAndResolveOptionalPath(p)
+}
+
+// checkBootMethod checks the guest is booted from an image. The image and
+// initrd options are mutually exclusive.
+//
+// XXX: virtcontainers always presents the image to the VM as an NVDIMM
+// device and has no way to pass an initrd to QEMU, so the initrd option
+// cannot be honoured.
+func (h hypervisor) checkBootMethod() error {
+	if h.Initrd == "" {
+		return nil
+	}
+
+	if h.Image != "" {
+		return errors.New("image and initrd are mutually exclusive")
+	}
+
+	return errors.New("booting from an initrd is not supported")
 }
 
 func (h hypervisor) kernelParams() string {
@@ -167,6 +267,17 @@ func (h hypervisor) defaultVCPUs() uint32 {
 	return uint32(h.DefaultVCPUs)
 }
 
+func (r runtime) agentTimeout() time.Duration {
+	if r.AgentTimeout < 0 {
+		return 0
+	}
+	if r.AgentTimeout == 0 { // or unspecified
+		return defaultAgentTimeout
+	}
+
+	return time.Duration(r.AgentTimeout) * time.Second
+}
+
 func (h hypervisor) defaultMemSz() uint32 {
 	if h.DefaultMemSz < 8 {
 		return defaultMemSize // MiB
@@ -190,7 +301,7 @@ func (s shim) path() (string, error) {
 		p = defaultShimPath
 	}
 
-	return resolvePath(p)
+	return expandAndResolveOptionalPath(p)
 }
 
 func (s shim) debug() bool {
@@ -204,39 +315,74 @@ func (a agent) pauseRootPath() (string, error) {
 		p = defaultPauseRootPath
 	}
 
-	return resolvePath(p)
+	return expandAndResolveOptionalPath(p)
+}
+
+// socketDir returns the directory below which the agent sockets of each
+// pod are created, or an empty string for the virtcontainers default. The
+// directory does not need to exist.
+func (a agent) socketDir() (string, error) {
+	if a.SocketDir == "" {
+		return "", nil
+	}
+
+	p, err := expandPath(a.SocketDir)
+	if err != nil {
+		return "", err
+	}
+
+	if !filepath.IsAbs(p) {
+		return "", fmt.Errorf("%q is not an absolute path", a.SocketDir)
+	}
+
+	return filepath.Clean(p), nil
 }
 
+// newQemuHypervisorConfig returns the hypervisor configuration for h.
+// Errors name the invalid configuration option.
 func newQemuHypervisorConfig(h hypervisor) (vc.HypervisorConfig, error) {
 	hypervisor, err := h.path()
 	if err != nil {
-		return vc.HypervisorConfig{}, err
+		return vc.HypervisorConfig{}, fmt.Errorf("path: %v", err)
 	}
 
 	kernel, err := h.kernel()
 	if err != nil {
-		return vc.HypervisorConfig{}, err
+		return vc.HypervisorConfig{}, fmt.Errorf("kernel: %v", err)
+	}
+
+	if err := h.checkBootMethod(); err != nil {
+		return vc.HypervisorConfig{}, fmt.Errorf("initrd: %v", err)
 	}
 
 	image, err := h.image()
 	if err != nil {
-		return vc.HypervisorConfig{}, err
+		return vc.HypervisorConfig{}, fmt.Errorf("image: %v", err)
 	}
 
-	kernelParams := h.kernelParams()
+	kernelParams := vc.DeserializeParams(strings.Fields(h.kernelParams()))
 	machineType := h.machineType()
 
-	for _, file := range []string{hypervisor, kernel, image} {
-		if !fileExists(file) {
-			return vc.HypervisorConfig{},
-				fmt.Errorf("File does not exist: %v", file)
+	if len(h.KernelModules) > 0 {
+		modules, err := parseKernelModules(h.KernelModules)
+		if err != nil {
+			return vc.HypervisorConfig{}, fmt.Errorf("kernel_modules: %v", err)
 		}
+
+		kernelParams = append(kernelParams, kernelModulesParam(modules))
 	}
+
+	// virtcontainers builds the QEMU command line without the hypervisor
+	// parameters, so extra arguments would silently be ignored.
+	if len(h.ExtraArgs) > 0 {
+		return vc.HypervisorConfig{}, fmt.Errorf("extra_args: extra hypervisor arguments are not supported")
+	}
+
 	return vc.HypervisorConfig{
 		HypervisorPath:        hypervisor,
 		KernelPath:            kernel,
 		ImagePath:             image,
-		KernelParams:          vc.DeserializeParams(strings.Fields(kernelParams)),
+		KernelParams:          kernelParams,
 		HypervisorMachineType: machineType,
 		DefaultVCPUs:          h.defaultVCPUs(),
 		DefaultMemSz:          h.defaultMemSz(),
@@ -252,15 +398,11 @@ func newQemuHypervisorConfig(h hypervisor) (vc.HypervisorConfig, error) {
 func newHyperstartAgentConfig(a agent) (vc.HyperConfig, error) {
 	dir, err := a.pauseRootPath()
 	if err != nil {
-		return vc.HyperConfig{}, err
+		return vc.HyperConfig{}, fmt.Errorf("pause_root_path: %v", err)
 	}
 
 	path := filepath.Join(dir, pauseBinRelativePath)
 
-	if !fileExists(path) {
-		return vc.HyperConfig{}, fmt.Errorf("File does not exist: %v", path)
-	}
-
 	return vc.HyperConfig{
 		PauseBinPath: path,
 	}, nil
@@ -269,7 +411,7 @@ func newHyperstartAgentConfig(a agent) (vc.HyperConfig, error) {
 func newCCShimConfig(s shim) (vc.CCShimConfig, error) {
 	path, err := s.path()
 	if err != nil {
-		return vc.CCShimConfig{}, err
+		return vc.CCShimConfig{}, fmt.Errorf("path: %v", err)
 	}
 
 	return vc.CCShimConfig{
@@ -278,16 +420,59 @@ func newCCShimConfig(s shim) (vc.CCShimConfig, error) {
 	}, nil
 }
 
+// checkRuntimeFiles checks the files the runtime configuration points to
+// exist, which loading the configuration does not require. The hypervisor,
+// kernel and image are only needed to create a pod.
+func checkRuntimeFiles(config oci.RuntimeConfig, pod bool) error {
+	type file struct {
+		key  string
+		path string
+	}
+
+	var files []file
+
+	if pod {
+		files = append(files,
+			file{"hypervisor path", config.HypervisorConfig.HypervisorPath},
+			file{"kernel", config.HypervisorConfig.KernelPath},
+			file{"image", config.HypervisorConfig.ImagePath})
+	}
+
+	if shimConfig, ok := config.ShimConfig.(vc.CCShimConfig); ok {
+		files = append(files, file{"shim path", shimConfig.Path})
+	}
+
+	if agentConfig, ok := config.AgentConfig.(vc.HyperConfig); ok && pod {
+		files = append(files, file{"pause binary", agentConfig.PauseBinPath})
+	}
+
+	for _, f := range files {
+		if !fileExists(f.path) {
+			return fmt.Errorf("%s: File does not exist: %v", f.key, f.path)
+		}
+	}
+
+	return nil
+}
+
 func updateRuntimeConfig(configPath string, tomlConf tomlConfig, config *oci.RuntimeConfig) error {
 	for k, hypervisor := range tomlConf.Hypervisor {
 		switch k {
 		case qemuHypervisorTableType:
 			hConfig, err := newQemuHypervisorConfig(hypervisor)
 			if err != nil {
-				return fmt.Errorf("%v: %v", configPath, err)
+				return fmt.Errorf("%v: hypervisor.%v.%v", configPath, k, err)
 			}
 
 			config.HypervisorConfig = hConfig
+			numaPinning = hypervisor.NUMAPinning
+
+			if hypervisor.ImageChecksum != "" {
+				imageChecksum, err = parseImageChecksum(hypervisor.ImageChecksum)
+				if err != nil {
+					return fmt.Errorf("%v: hypervisor.%v.image_checksum: %v", configPath, k, err)
+				}
+			}
 
 			break
 		}
@@ -312,11 +497,16 @@ func updateRuntimeConfig(configPath string, tomlConf tomlConfig, config *oci.Run
 		case hyperstartAgentTableType:
 			agentConfig, err := newHyperstartAgentConfig(agent)
 			if err != nil {
-				return fmt.Errorf("%v: %v", configPath, err)
+				return fmt.Errorf("%v: agent.%v.%v", configPath, k, err)
 			}
 
 			config.AgentConfig = agentConfig
 
+			agentSocketDir, err = agent.socketDir()
+			if err != nil {
+				return fmt.Errorf("%v: agent.%v.socket_dir: %v", configPath, k, err)
+			}
+
 			break
 		}
 	}
@@ -326,7 +516,7 @@ func updateRuntimeConfig(configPath string, tomlConf tomlConfig, config *oci.Run
 		case ccShimTableType:
 			shConfig, err := newCCShimConfig(shim)
 			if err != nil {
-				return fmt.Errorf("%v: %v", configPath, err)
+				return fmt.Errorf("%v: shim.%v.%v", configPath, k, err)
 			}
 
 			config.ShimType = vc.CCShimType
@@ -367,6 +557,13 @@ func loadConfiguration(configPath string, ignoreLogging bool) (resolvedConfigPat
 			pauseBinRelativePath),
 	}
 
+	numaPinning = false
+	imageChecksum = ""
+	traceEndpoint = ""
+	agentTimeout = defaultAgentTimeout
+	syncGuestTime = false
+	agentSocketDir = ""
+
 	config = oci.RuntimeConfig{
 		HypervisorType:   defaultHypervisor,
 		HypervisorConfig: defaultHypervisorConfig,
@@ -393,15 +590,29 @@ func loadConfiguration(configPath string, ignoreLogging bool) (resolvedConfigPat
 		return "", "", config, err
 	}
 
-	var tomlConf tomlConfig
-	_, err = toml.Decode(string(configData), &tomlConf)
+	tomlConf, unknownKeys, err := decodeConfig(resolved, string(configData))
 	if err != nil {
 		return "", "", config, err
 	}
 
-	logfilePath = tomlConf.Runtime.GlobalLogPath
+	traceEndpoint = tomlConf.Runtime.TraceEndpoint
+	agentTimeout = tomlConf.Runtime.agentTimeout()
+	syncGuestTime = tomlConf.Runtime.SyncGuestTime
+
+	logfilePath, err = expandPath(tomlConf.Runtime.GlobalLogPath)
+	if err != nil {
+		return "", "", config, fmt.Errorf("%v: runtime.global_log_path: %v", resolved, err)
+	}
+
+	if tomlConf.Runtime.LogLevel != "" {
+		// An explicit log level takes priority over enable_debug.
+		level, err := parseLogLevel(tomlConf.Runtime.LogLevel)
+		if err != nil {
+			return "", "", config, fmt.Errorf("%v: runtime.log_level: %v", resolved, err)
+		}
 
-	if !tomlConf.Runtime.Debug {
+		ccLog.Logger.Level = level
+	} else if !tomlConf.Runtime.Debug {
 		// If debug is not required, switch back to the original
 		// default log priority, otherwise continue in debug mode.
 		ccLog.Logger.Level = originalLoggerLevel
@@ -422,6 +633,14 @@ func loadConfiguration(configPath string, ignoreLogging bool) (resolvedConfigPat
 			}).Debugf("loaded configuration")
 	}
 
+	for _, key := range unknownKeys {
+		ccLog.WithFields(logrus.Fields{
+			"file": resolved,
+			"key":  key,
+			"line": findConfigKeyLine(string(configData), key),
+		}).Warn("Ignoring unknown configuration key")
+	}
+
 	if err := updateRuntimeConfig(resolved, tomlConf, &config); err != nil {
 		return "", "", config, err
 	}
@@ -458,3 +677,180 @@ func getDefaultConfigFile() (string, error) {
 
 	return "", errors.New(strings.Join(errs, ", "))
 }
+
+// decodeConfig decodes the specified TOML configuration data read from
+// configPath. It also returns the keys that do not correspond to any
+// configuration option.
+//
+// Errors name the config file and, where possible, the offending key and
+// the line it is defined on.
+func decodeConfig(configPath, configData string) (tomlConfig, []string, error) {
+	var tomlConf tomlConfig
+
+	md, err := toml.Decode(configData, &tomlConf)
+	if err != nil {
+		// Syntax errors already specify the line, but type
+		// errors do not mention the key at all.
+		if key := findConfigTypeError(configData); key != "" {
+			return tomlConfig{}, nil, fmt.Errorf("%v:%d: invalid value for %s: %v",
+				configPath, findConfigKeyLine(configData, key), key, err)
+		}
+
+		return tomlConfig{}, nil, fmt.Errorf("%v: %v", configPath, err)
+	}
+
+	var unknownKeys []string
+
+	for _, key := range md.Undecoded() {
+		unknownKeys = append(unknownKeys, key.String())
+	}
+
+	return tomlConf, unknownKeys, nil
+}
+
+// findConfigTypeError returns the first key in the TOML configuration
+// data whose value has the wrong type for the corresponding configuration
+// option, or "" if no such key is found.
+func findConfigTypeError(configData string) string {
+	var data map[string]interface{}
+
+	if _, err := toml.Decode(configData, &data); err != nil {
+		return ""
+	}
+
+	return findTypeError("", data, reflect.TypeOf(tomlConfig{}))
+}
+
+// findTypeError returns the name of the first key below prefix whose value
+// cannot be stored in a variable of type t, or "" if all of the keys can be.
+// Keys that do not correspond to a field are ignored. An array holding a
+// value of the wrong type is reported as a whole.
+func findTypeError(prefix string, value interface{}, t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		var list []interface{}
+
+		switch v := value.(type) {
+		case []interface{}:
+			list = v
+		case []map[string]interface{}:
+			// arrays of tables
+			for _, table := range v {
+				list = append(list, table)
+			}
+		default:
+			return prefix
+		}
+
+		for _, elem := range list {
+			if findTypeError(prefix, elem, t.Elem()) != "" {
+				return prefix
+			}
+		}
+	case reflect.Struct, reflect.Map:
+		table, ok := value.(map[string]interface{})
+		if !ok {
+			return prefix
+		}
+
+		var keys []string
+		for key := range table {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			name := key
+			if prefix != "" {
+				name = prefix + "." + key
+			}
+
+			fieldType := t
+			if t.Kind() == reflect.Map {
+				fieldType = t.Elem()
+			} else {
+				field, ok := findConfigField(t, key)
+				if !ok {
+					continue
+				}
+
+				fieldType = field.Type
+			}
+
+			if bad := findTypeError(name, table[key], fieldType); bad != "" {
+				return bad
+			}
+		}
+	case reflect.String:
+		if _, ok := value.(string); !ok {
+			return prefix
+		}
+	case reflect.Bool:
+		if _, ok := value.(bool); !ok {
+			return prefix
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if _, ok := value.(int64); !ok {
+			return prefix
+		}
+	}
+
+	return ""
+}
+
+// findConfigField returns the field of the struct type t that the
+// specified TOML key is decoded into.
+func findConfigField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		name := field.Tag.Get("toml")
+		if name == "" {
+			name = field.Name
+		}
+
+		if strings.EqualFold(name, key) {
+			return field, true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
+
+// findConfigKeyLine returns the number of the line defining the specified
+// dotted key (or table) in the TOML configuration data, or 0 if the line
+// cannot be determined.
+func findConfigKeyLine(configData, key string) int {
+	table := ""
+
+	for i, line := range strings.Split(configData, "\n") {
+		line = strings.TrimSpace(line)
+
+		if strings.HasPrefix(line, "[") {
+			table = strings.TrimSpace(strings.Trim(line, "[]"))
+			if table == key {
+				return i + 1
+			}
+
+			continue
+		}
+
+		fields := strings.SplitN(line, "=", 2)
+		if strings.HasPrefix(line, "#") || len(fields) != 2 {
+			continue
+		}
+
+		name := strings.Trim(strings.TrimSpace(fields[0]), `"'`)
+		if table != "" {
+			name = table + "." + name
+		}
+
+		if name == key {
+			return i + 1
+		}
+	}
+
+	return 0
+}
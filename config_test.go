@@ -26,9 +26,11 @@ import (
 	"strings"
 	"syscall"
 	"testing"
+	"time"
 
 	vc "github.com/containers/virtcontainers"
 	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -324,126 +326,61 @@ func TestConfigLoadConfigurationFailSymLinkLoop(t *testing.T) {
 		})
 }
 
-func TestConfigLoadConfigurationFailMissingPauseBinary(t *testing.T) {
-	tmpdir, err := ioutil.TempDir(testDir, "runtime-config-")
-	assert.NoError(t, err)
-	defer os.RemoveAll(tmpdir)
-
-	testLoadConfiguration(t, tmpdir,
-		func(config testRuntimeConfig, configFile string, ignoreLogging bool) (bool, error) {
-			expectFail := true
-
-			hyperConfig, ok := config.RuntimeConfig.AgentConfig.(vc.HyperConfig)
-			if !ok {
-				return expectFail, fmt.Errorf("cannot determine agent config")
-			}
-
-			err = os.Remove(hyperConfig.PauseBinPath)
-			if err != nil {
-				return expectFail, err
-			}
-
-			return expectFail, nil
-		})
-}
-
-func TestConfigLoadConfigurationFailMissingPauseDir(t *testing.T) {
-	tmpdir, err := ioutil.TempDir(testDir, "runtime-config-")
-	assert.NoError(t, err)
-	defer os.RemoveAll(tmpdir)
-
-	testLoadConfiguration(t, tmpdir,
-		func(config testRuntimeConfig, configFile string, ignoreLogging bool) (bool, error) {
-			expectFail := true
-
-			hyperConfig, ok := config.RuntimeConfig.AgentConfig.(vc.HyperConfig)
-			if !ok {
-				return expectFail, fmt.Errorf("cannot determine agent config")
-			}
-
-			err = os.RemoveAll(filepath.Dir(hyperConfig.PauseBinPath))
-			if err != nil {
-				return expectFail, err
-			}
-
-			return expectFail, nil
-		})
-}
+func TestConfigLoadConfigurationMissingFiles(t *testing.T) {
+	assert := assert.New(t)
 
-func TestConfigLoadConfigurationFailMissingHypervisor(t *testing.T) {
 	tmpdir, err := ioutil.TempDir(testDir, "runtime-config-")
-	assert.NoError(t, err)
+	assert.NoError(err)
 	defer os.RemoveAll(tmpdir)
 
-	testLoadConfiguration(t, tmpdir,
-		func(config testRuntimeConfig, configFile string, ignoreLogging bool) (bool, error) {
-			expectFail := true
+	type testData struct {
+		// remove returns the path to remove
+		remove func(config oci.RuntimeConfig) string
 
-			err = os.Remove(config.RuntimeConfig.HypervisorConfig.HypervisorPath)
-			if err != nil {
-				return expectFail, err
-			}
-
-			return expectFail, nil
-		})
-}
-
-func TestConfigLoadConfigurationFailMissingImage(t *testing.T) {
-	tmpdir, err := ioutil.TempDir(testDir, "runtime-config-")
-	assert.NoError(t, err)
-	defer os.RemoveAll(tmpdir)
-
-	testLoadConfiguration(t, tmpdir,
-		func(config testRuntimeConfig, configFile string, ignoreLogging bool) (bool, error) {
-			expectFail := true
-
-			err = os.Remove(config.RuntimeConfig.HypervisorConfig.ImagePath)
-			if err != nil {
-				return expectFail, err
-			}
-
-			return expectFail, nil
-		})
-}
+		// pod is true if the file is only needed to create a pod
+		pod bool
+	}
 
-func TestConfigLoadConfigurationFailMissingKernel(t *testing.T) {
-	tmpdir, err := ioutil.TempDir(testDir, "runtime-config-")
-	assert.NoError(t, err)
-	defer os.RemoveAll(tmpdir)
+	data := []testData{
+		{func(config oci.RuntimeConfig) string { return config.HypervisorConfig.HypervisorPath }, true},
+		{func(config oci.RuntimeConfig) string { return config.HypervisorConfig.KernelPath }, true},
+		{func(config oci.RuntimeConfig) string { return config.HypervisorConfig.ImagePath }, true},
+		{func(config oci.RuntimeConfig) string { return config.AgentConfig.(vc.HyperConfig).PauseBinPath }, true},
+		{func(config oci.RuntimeConfig) string { return filepath.Dir(config.AgentConfig.(vc.HyperConfig).PauseBinPath) }, true},
+		{func(config oci.RuntimeConfig) string { return config.ShimConfig.(vc.CCShimConfig).Path }, false},
+	}
 
-	testLoadConfiguration(t, tmpdir,
-		func(config testRuntimeConfig, configFile string, ignoreLogging bool) (bool, error) {
-			expectFail := true
+	for i, d := range data {
+		dir := filepath.Join(tmpdir, strconv.Itoa(i))
+		err = os.MkdirAll(dir, testDirMode)
+		assert.NoError(err)
 
-			err = os.Remove(config.RuntimeConfig.HypervisorConfig.KernelPath)
-			if err != nil {
-				return expectFail, err
-			}
+		testConfig, err := createAllRuntimeConfigFiles(dir, "qemu")
+		assert.NoError(err)
 
-			return expectFail, nil
-		})
-}
+		err = checkRuntimeFiles(testConfig.RuntimeConfig, true)
+		assert.NoError(err, "test %d", i)
 
-func TestConfigLoadConfigurationFailMissingShim(t *testing.T) {
-	tmpdir, err := ioutil.TempDir(testDir, "runtime-config-")
-	assert.NoError(t, err)
-	defer os.RemoveAll(tmpdir)
+		path := d.remove(testConfig.RuntimeConfig)
+		err = os.RemoveAll(path)
+		assert.NoError(err)
 
-	testLoadConfiguration(t, tmpdir,
-		func(config testRuntimeConfig, configFile string, ignoreLogging bool) (bool, error) {
-			expectFail := true
+		// a missing file does not prevent loading the configuration
+		_, _, config, err := loadConfiguration(testConfig.ConfigPath, true)
+		assert.NoError(err, "test %d", i)
+		assert.Equal(testConfig.RuntimeConfig, config, "test %d", i)
 
-			shimConfig, ok := config.RuntimeConfig.ShimConfig.(vc.CCShimConfig)
-			if !ok {
-				return expectFail, fmt.Errorf("cannot determine shim config")
-			}
-			err = os.Remove(shimConfig.Path)
-			if err != nil {
-				return expectFail, err
-			}
+		// but the commands needing it fail
+		err = checkRuntimeFiles(config, true)
+		assert.Error(err, "test %d", i)
 
-			return expectFail, nil
-		})
+		err = checkRuntimeFiles(config, false)
+		if d.pod {
+			assert.NoError(err, "test %d", i)
+		} else {
+			assert.Error(err, "test %d", i)
+		}
+	}
 }
 
 func TestConfigLoadConfigurationFailUnreadableConfig(t *testing.T) {
@@ -562,6 +499,271 @@ func TestConfigLoadConfigurationFailTOMLConfigFileDuplicatedData(t *testing.T) {
 		})
 }
 
+func TestConfigLoadConfigurationLogLevel(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "runtime-config-")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	config, err := createAllRuntimeConfigFiles(tmpdir, "qemu")
+	assert.NoError(err)
+
+	configData, err := ioutil.ReadFile(config.ConfigPath)
+	assert.NoError(err)
+
+	savedLevel := ccLog.Logger.Level
+	defer func() {
+		ccLog.Logger.Level = savedLevel
+	}()
+
+	type testData struct {
+		logLevel      string
+		expectedLevel logrus.Level
+		expectFailure bool
+	}
+
+	data := []testData{
+		{"trace", logrus.DebugLevel, false},
+		{"debug", logrus.DebugLevel, false},
+		{"info", logrus.InfoLevel, false},
+		{"WARN", logrus.WarnLevel, false},
+		{"error", logrus.ErrorLevel, false},
+		{"loud", logrus.InfoLevel, true},
+	}
+
+	for _, d := range data {
+		fileData := string(configData) + "\nlog_level = \"" + d.logLevel + "\"\n"
+		err = createConfig(config.ConfigPath, fileData)
+		assert.NoError(err)
+
+		ccLog.Logger.Level = logrus.PanicLevel
+
+		_, _, _, err = loadConfiguration(config.ConfigPath, true)
+		if d.expectFailure {
+			assert.Error(err, "test data: %+v", d)
+			continue
+		}
+
+		assert.NoError(err, "test data: %+v", d)
+		assert.Equal(d.expectedLevel, ccLog.Logger.Level, "test data: %+v", d)
+	}
+}
+
+func TestConfigLoadConfigurationErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "runtime-config-")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	type testData struct {
+		// modify returns the modified config file contents
+		modify func(config testRuntimeConfig, data string) string
+
+		// expected lists strings the error must contain
+		expected []string
+	}
+
+	vcpus := "default_vcpus = " + strconv.FormatUint(uint64(defaultVCPUCount), 10)
+
+	data := []testData{
+		// syntax error
+		{
+			func(config testRuntimeConfig, data string) string {
+				return strings.Replace(data, "[proxy.cc]", "[proxy.cc", 1)
+			},
+			[]string{"runtime.toml", "line 14"},
+		},
+
+		// type errors
+		{
+			func(config testRuntimeConfig, data string) string {
+				return strings.Replace(data, vcpus, `default_vcpus = "lots"`, 1)
+			},
+			[]string{"runtime.toml:10:", "hypervisor.qemu.default_vcpus"},
+		},
+		{
+			func(config testRuntimeConfig, data string) string {
+				return data + "\nenable_debug = 1\n"
+			},
+			[]string{"runtime.toml:", "runtime.enable_debug"},
+		},
+		{
+			func(config testRuntimeConfig, data string) string {
+				return strings.Replace(data, vcpus, vcpus+"\nkernel_modules = [1, 2]", 1)
+			},
+			[]string{"runtime.toml:11:", "hypervisor.qemu.kernel_modules"},
+		},
+		{
+			func(config testRuntimeConfig, data string) string {
+				return strings.Replace(data, vcpus, vcpus+"\nkernel_modules = \"vfio\"", 1)
+			},
+			[]string{"runtime.toml:11:", "hypervisor.qemu.kernel_modules"},
+		},
+
+		// semantic errors
+		{
+			func(config testRuntimeConfig, data string) string {
+				// a symbolic link loop is not a missing file
+				shimConfig := config.RuntimeConfig.ShimConfig.(vc.CCShimConfig)
+				os.Remove(shimConfig.Path)
+				os.Symlink(shimConfig.Path, shimConfig.Path)
+				return data
+			},
+			[]string{"runtime.toml", "shim.cc.path"},
+		},
+		{
+			func(config testRuntimeConfig, data string) string {
+				return data + "\nlog_level = \"loud\"\n"
+			},
+			[]string{"runtime.toml", "runtime.log_level"},
+		},
+	}
+
+	for i, d := range data {
+		dir := filepath.Join(tmpdir, strconv.Itoa(i))
+		err = os.MkdirAll(dir, testDirMode)
+		assert.NoError(err)
+
+		config, err := createAllRuntimeConfigFiles(dir, "qemu")
+		assert.NoError(err)
+
+		configData, err := ioutil.ReadFile(config.ConfigPath)
+		assert.NoError(err)
+
+		err = createConfig(config.ConfigPath, d.modify(config, string(configData)))
+		assert.NoError(err)
+
+		_, _, _, err = loadConfiguration(config.ConfigPath, true)
+		assert.Error(err, "test %d", i)
+
+		if err == nil {
+			continue
+		}
+
+		for _, expected := range d.expected {
+			assert.Contains(err.Error(), expected, "test %d", i)
+		}
+	}
+}
+
+func TestDecodeConfigUnknownKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	configData := `
+[hypervisor.qemu]
+path = "/foo"
+kernal = "/bar"
+
+[runtime]
+enable_debug = true
+"global-log-path" = "/baz"
+`
+
+	tomlConf, unknownKeys, err := decodeConfig("runtime.toml", configData)
+	assert.NoError(err)
+	assert.Equal("/foo", tomlConf.Hypervisor[qemuHypervisorTableType].Path)
+	assert.True(tomlConf.Runtime.Debug)
+	assert.Equal([]string{"hypervisor.qemu.kernal", "runtime.global-log-path"}, unknownKeys)
+
+	assert.Equal(4, findConfigKeyLine(configData, "hypervisor.qemu.kernal"))
+	assert.Equal(8, findConfigKeyLine(configData, "runtime.global-log-path"))
+	assert.Equal(6, findConfigKeyLine(configData, "runtime"))
+	assert.Equal(0, findConfigKeyLine(configData, "runtime.log_level"))
+}
+
+func TestExpandPath(t *testing.T) {
+	assert := assert.New(t)
+
+	const prefixVar = "CC_RUNTIME_TEST_PREFIX"
+
+	savedPrefix, wasSet := os.LookupEnv(prefixVar)
+	defer func() {
+		if wasSet {
+			os.Setenv(prefixVar, savedPrefix)
+		} else {
+			os.Unsetenv(prefixVar)
+		}
+	}()
+
+	err := os.Setenv(prefixVar, "/opt/cc")
+	assert.NoError(err)
+
+	type testData struct {
+		path          string
+		expectedPath  string
+		expectFailure bool
+	}
+
+	data := []testData{
+		{"", "", false},
+		{"/usr/bin/qemu", "/usr/bin/qemu", false},
+
+		// defined
+		{"$" + prefixVar + "/bin/qemu", "/opt/cc/bin/qemu", false},
+		{"${" + prefixVar + "}/bin/qemu", "/opt/cc/bin/qemu", false},
+		{"${" + prefixVar + "}${" + prefixVar + "}", "/opt/cc/opt/cc", false},
+
+		// escaped
+		{"/foo/$$bar", "/foo/$bar", false},
+		{"/foo/$${" + prefixVar + "}", "/foo/${" + prefixVar + "}", false},
+
+		// undefined
+		{"${CC_RUNTIME_TEST_UNDEFINED}/bin/qemu", "", true},
+		{"$CC_RUNTIME_TEST_UNDEFINED", "", true},
+	}
+
+	for _, d := range data {
+		path, err := expandPath(d.path)
+		if d.expectFailure {
+			assert.Error(err, "test data: %+v", d)
+			continue
+		}
+
+		assert.NoError(err, "test data: %+v", d)
+		assert.Equal(d.expectedPath, path, "test data: %+v", d)
+	}
+}
+
+func TestConfigLoadConfigurationExpandPaths(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "runtime-config-")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	const dirVar = "CC_RUNTIME_TEST_DIR"
+
+	defer os.Unsetenv(dirVar)
+
+	config, err := createAllRuntimeConfigFiles(tmpdir, "qemu")
+	assert.NoError(err)
+
+	configData, err := ioutil.ReadFile(config.ConfigPath)
+	assert.NoError(err)
+
+	// reference all files relative to the variable
+	fileData := strings.Replace(string(configData), tmpdir, "${"+dirVar+"}", -1)
+
+	err = createConfig(config.ConfigPath, fileData)
+	assert.NoError(err)
+
+	_, _, _, err = loadConfiguration(config.ConfigPath, true)
+	assert.Error(err)
+	assert.Contains(err.Error(), dirVar)
+
+	err = os.Setenv(dirVar, tmpdir)
+	assert.NoError(err)
+
+	_, logfilePath, runtimeConfig, err := loadConfiguration(config.ConfigPath, true)
+	assert.NoError(err)
+	assert.Equal(config.LogPath, logfilePath)
+	assert.Equal(config.RuntimeConfig.HypervisorConfig.HypervisorPath, runtimeConfig.HypervisorConfig.HypervisorPath)
+	assert.Equal(config.RuntimeConfig.ShimConfig, runtimeConfig.ShimConfig)
+	assert.Equal(config.RuntimeConfig.AgentConfig, runtimeConfig.AgentConfig)
+}
+
 func TestMinimalRuntimeConfig(t *testing.T) {
 	dir, err := ioutil.TempDir(testDir, "minimal-runtime-config-")
 	if err != nil {
@@ -587,9 +789,14 @@ func TestMinimalRuntimeConfig(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	// the shim is only needed to create a container
 	_, _, config, err := loadConfiguration(configPath, false)
-	if err == nil {
-		t.Fatalf("Expected loadConfiguration to fail as shim path does not exist: %+v", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkRuntimeFiles(config, false); err == nil {
+		t.Fatalf("Expected checkRuntimeFiles to fail as shim path does not exist: %+v", config)
 	}
 
 	err = createEmptyFile(shimPath)
@@ -673,10 +880,15 @@ func TestNewQemuHypervisorConfig(t *testing.T) {
 	filesLen := len(files)
 
 	for i, file := range files {
-		_, err := newQemuHypervisorConfig(hypervisor)
-		if err == nil {
-			t.Fatalf("Expected newQemuHypervisorConfig to fail as not all paths exist (not created %v)",
-				strings.Join(files[i:filesLen], ","))
+		// missing paths are checked when creating a pod
+		config, err := newQemuHypervisorConfig(hypervisor)
+		if err != nil {
+			t.Fatalf("newQemuHypervisorConfig failed unexpectedly (not created %v): %v",
+				strings.Join(files[i:filesLen], ","), err)
+		}
+
+		if config.HypervisorPath != hypervisor.Path {
+			t.Errorf("Expected hypervisor path %v, got %v", hypervisor.Path, config.HypervisorPath)
 		}
 
 		// create the resource
@@ -710,6 +922,129 @@ func TestNewQemuHypervisorConfig(t *testing.T) {
 
 }
 
+func TestNewQemuHypervisorConfigKernelModules(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "hypervisor-config-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	hypervisor := hypervisor{
+		Path:          path.Join(dir, "hypervisor"),
+		Kernel:        path.Join(dir, "kernel"),
+		Image:         path.Join(dir, "image"),
+		KernelParams:  "quiet",
+		KernelModules: []string{"overlay", "nf_conntrack"},
+	}
+
+	for _, file := range []string{hypervisor.Path, hypervisor.Kernel, hypervisor.Image} {
+		err = createEmptyFile(file)
+		assert.NoError(err)
+	}
+
+	config, err := newQemuHypervisorConfig(hypervisor)
+	assert.NoError(err)
+	assert.Equal([]vc.Param{
+		{Key: "quiet", Value: ""},
+		{Key: modulesLoadParam, Value: "overlay,nf_conntrack"},
+	}, config.KernelParams)
+
+	hypervisor.KernelModules = []string{"overlay", "../foo.ko"}
+
+	_, err = newQemuHypervisorConfig(hypervisor)
+	assert.Error(err)
+	assert.Contains(err.Error(), "kernel_modules")
+}
+
+func TestNewQemuHypervisorConfigExtraArgs(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "hypervisor-config-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	hypervisor := hypervisor{
+		Path:      path.Join(dir, "hypervisor"),
+		Kernel:    path.Join(dir, "kernel"),
+		Image:     path.Join(dir, "image"),
+		ExtraArgs: []string{"-device", "virtio-rng-pci", "-no-hpet"},
+	}
+
+	for _, file := range []string{hypervisor.Path, hypervisor.Kernel, hypervisor.Image} {
+		err = createEmptyFile(file)
+		assert.NoError(err)
+	}
+
+	_, err = newQemuHypervisorConfig(hypervisor)
+	assert.Error(err)
+	assert.Contains(err.Error(), "extra_args")
+}
+
+func TestHypervisorCheckBootMethod(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		image         string
+		initrd        string
+		expectFailure bool
+	}
+
+	data := []testData{
+		{"", "", false},
+		{"/usr/share/clear-containers/clear-containers.img", "", false},
+
+		// mutually exclusive
+		{"/usr/share/clear-containers/clear-containers.img", "/usr/share/clear-containers/initrd.img", true},
+
+		// not supported
+		{"", "/usr/share/clear-containers/initrd.img", true},
+	}
+
+	for _, d := range data {
+		h := hypervisor{
+			Image:  d.image,
+			Initrd: d.initrd,
+		}
+
+		err := h.checkBootMethod()
+		if d.expectFailure {
+			assert.Error(err, "test data: %+v", d)
+		} else {
+			assert.NoError(err, "test data: %+v", d)
+		}
+	}
+}
+
+func TestNewQemuHypervisorConfigInitrd(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "hypervisor-config-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	hypervisor := hypervisor{
+		Path:   path.Join(dir, "hypervisor"),
+		Kernel: path.Join(dir, "kernel"),
+		Image:  path.Join(dir, "image"),
+		Initrd: path.Join(dir, "initrd"),
+	}
+
+	for _, file := range []string{hypervisor.Path, hypervisor.Kernel, hypervisor.Image, hypervisor.Initrd} {
+		err = createEmptyFile(file)
+		assert.NoError(err)
+	}
+
+	_, err = newQemuHypervisorConfig(hypervisor)
+	assert.Error(err)
+	assert.Contains(err.Error(), "mutually exclusive")
+
+	hypervisor.Image = ""
+
+	_, err = newQemuHypervisorConfig(hypervisor)
+	assert.Error(err)
+	assert.Contains(err.Error(), "initrd")
+}
+
 func TestNewHyperstartAgentConfig(t *testing.T) {
 	dir, err := ioutil.TempDir(testDir, "hyperstart-agent-config-")
 	if err != nil {
@@ -725,19 +1060,14 @@ func TestNewHyperstartAgentConfig(t *testing.T) {
 		PauseRootPath: agentPauseRootPath,
 	}
 
-	_, err = newHyperstartAgentConfig(agent)
-	if err == nil {
-		t.Fatalf("Expected newHyperstartAgentConfig to fail as no paths exist")
-	}
-
-	err = os.MkdirAll(agentPauseRootPath, testDirMode)
+	// a missing pause binary is checked when creating a pod
+	agentConfig, err := newHyperstartAgentConfig(agent)
 	if err != nil {
-		t.Fatal(err)
+		t.Fatalf("newHyperstartAgentConfig failed unexpectedly: %v", err)
 	}
 
-	_, err = newHyperstartAgentConfig(agent)
-	if err == nil {
-		t.Fatalf("Expected newHyperstartAgentConfig to fail as only pause root path exists")
+	if agentConfig.PauseBinPath != pauseBinPath {
+		t.Errorf("Expected pause bin path %v, got %v", pauseBinPath, agentConfig.PauseBinPath)
 	}
 
 	err = os.MkdirAll(agentPauseRootBin, testDirMode)
@@ -745,17 +1075,12 @@ func TestNewHyperstartAgentConfig(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	_, err = newHyperstartAgentConfig(agent)
-	if err == nil {
-		t.Fatalf("Expected newHyperstartAgentConfig to fail as only pause bin path exists")
-	}
-
 	err = createEmptyFile(pauseBinPath)
 	if err != nil {
 		t.Error(err)
 	}
 
-	agentConfig, err := newHyperstartAgentConfig(agent)
+	agentConfig, err = newHyperstartAgentConfig(agent)
 	if err != nil {
 		t.Fatalf("newHyperstartAgentConfig failed unexpectedly: %v", err)
 	}
@@ -778,9 +1103,14 @@ func TestNewCCShimConfig(t *testing.T) {
 		Path: shimPath,
 	}
 
-	_, err = newCCShimConfig(shim)
-	if err == nil {
-		t.Fatalf("Expected newCCShimConfig to fail as no paths exist")
+	// a missing shim is checked when creating a container
+	shConfig, err := newCCShimConfig(shim)
+	if err != nil {
+		t.Fatalf("newCCShimConfig failed unexpectedly: %v", err)
+	}
+
+	if shConfig.Path != shimPath {
+		t.Errorf("Expected shim path %v, got %v", shimPath, shConfig.Path)
 	}
 
 	err = createEmptyFile(shimPath)
@@ -788,7 +1118,7 @@ func TestNewCCShimConfig(t *testing.T) {
 		t.Error(err)
 	}
 
-	shConfig, err := newCCShimConfig(shim)
+	shConfig, err = newCCShimConfig(shim)
 	if err != nil {
 		t.Fatalf("newCCShimConfig failed unexpectedly: %v", err)
 	}
@@ -1092,3 +1422,227 @@ func TestGetDefaultConfigFile(t *testing.T) {
 	_, err = getDefaultConfigFile()
 	assert.Error(err)
 }
+
+func TestConfigLoadConfigurationNUMAPinning(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "runtime-config-")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	config, err := createAllRuntimeConfigFiles(tmpdir, "qemu")
+	assert.NoError(err)
+
+	configData, err := ioutil.ReadFile(config.ConfigPath)
+	assert.NoError(err)
+
+	savedNUMAPinning := numaPinning
+	defer func() {
+		numaPinning = savedNUMAPinning
+	}()
+
+	_, _, _, err = loadConfiguration(config.ConfigPath, true)
+	assert.NoError(err)
+	assert.False(numaPinning)
+
+	fileData := strings.Replace(string(configData), "[hypervisor.qemu]\n",
+		"[hypervisor.qemu]\nenable_numa_pinning = true\n", 1)
+	err = createConfig(config.ConfigPath, fileData)
+	assert.NoError(err)
+
+	_, _, _, err = loadConfiguration(config.ConfigPath, true)
+	assert.NoError(err)
+	assert.True(numaPinning)
+}
+
+func TestConfigLoadConfigurationTraceEndpoint(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "runtime-config-")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	config, err := createAllRuntimeConfigFiles(tmpdir, "qemu")
+	assert.NoError(err)
+
+	configData, err := ioutil.ReadFile(config.ConfigPath)
+	assert.NoError(err)
+
+	savedTraceEndpoint := traceEndpoint
+	defer func() {
+		traceEndpoint = savedTraceEndpoint
+	}()
+
+	_, _, _, err = loadConfiguration(config.ConfigPath, true)
+	assert.NoError(err)
+	assert.Empty(traceEndpoint)
+
+	endpoint := "http://localhost:9411/api/v2/spans"
+
+	fileData := strings.Replace(string(configData), "[runtime]\n",
+		"[runtime]\ntrace_endpoint = \""+endpoint+"\"\n", 1)
+	err = createConfig(config.ConfigPath, fileData)
+	assert.NoError(err)
+
+	_, _, _, err = loadConfiguration(config.ConfigPath, true)
+	assert.NoError(err)
+	assert.Equal(endpoint, traceEndpoint)
+}
+
+func TestConfigLoadConfigurationSyncGuestTime(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "runtime-config-")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	config, err := createAllRuntimeConfigFiles(tmpdir, "qemu")
+	assert.NoError(err)
+
+	configData, err := ioutil.ReadFile(config.ConfigPath)
+	assert.NoError(err)
+
+	savedSyncGuestTime := syncGuestTime
+	defer func() {
+		syncGuestTime = savedSyncGuestTime
+	}()
+
+	_, _, _, err = loadConfiguration(config.ConfigPath, true)
+	assert.NoError(err)
+	assert.False(syncGuestTime)
+
+	fileData := strings.Replace(string(configData), "[runtime]\n",
+		"[runtime]\nsync_guest_time = true\n", 1)
+	err = createConfig(config.ConfigPath, fileData)
+	assert.NoError(err)
+
+	_, _, _, err = loadConfiguration(config.ConfigPath, true)
+	assert.NoError(err)
+	assert.True(syncGuestTime)
+}
+
+func TestAgentSocketDir(t *testing.T) {
+	assert := assert.New(t)
+
+	savedHome := os.Getenv("HOME")
+	defer os.Setenv("HOME", savedHome)
+
+	err := os.Setenv("HOME", "/home/foo")
+	assert.NoError(err)
+
+	a := agent{}
+
+	dir, err := a.socketDir()
+	assert.NoError(err)
+	assert.Equal("", dir)
+
+	a.SocketDir = "/run/cc/pods/"
+	dir, err = a.socketDir()
+	assert.NoError(err)
+	assert.Equal("/run/cc/pods", dir)
+
+	a.SocketDir = "$HOME/pods"
+	dir, err = a.socketDir()
+	assert.NoError(err)
+	assert.Equal("/home/foo/pods", dir)
+
+	a.SocketDir = "pods"
+	_, err = a.socketDir()
+	assert.Error(err)
+}
+
+func TestConfigLoadConfigurationAgentSocketDir(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "runtime-config-")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	config, err := createAllRuntimeConfigFiles(tmpdir, "qemu")
+	assert.NoError(err)
+
+	configData, err := ioutil.ReadFile(config.ConfigPath)
+	assert.NoError(err)
+
+	savedAgentSocketDir := agentSocketDir
+	defer func() {
+		agentSocketDir = savedAgentSocketDir
+	}()
+
+	_, _, _, err = loadConfiguration(config.ConfigPath, true)
+	assert.NoError(err)
+	assert.Equal("", agentSocketDir)
+
+	socketDir := filepath.Join(tmpdir, "sockets")
+
+	fileData := strings.Replace(string(configData), "[agent.hyperstart]\n",
+		fmt.Sprintf("[agent.hyperstart]\nsocket_dir = %q\n", socketDir), 1)
+	err = createConfig(config.ConfigPath, fileData)
+	assert.NoError(err)
+
+	_, _, _, err = loadConfiguration(config.ConfigPath, true)
+	assert.NoError(err)
+	assert.Equal(socketDir, agentSocketDir)
+
+	fileData = strings.Replace(string(configData), "[agent.hyperstart]\n",
+		"[agent.hyperstart]\nsocket_dir = \"sockets\"\n", 1)
+	err = createConfig(config.ConfigPath, fileData)
+	assert.NoError(err)
+
+	_, _, _, err = loadConfiguration(config.ConfigPath, true)
+	assert.Error(err)
+}
+
+func TestRuntimeDefaultsAgentTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	r := runtime{}
+	assert.Equal(defaultAgentTimeout, r.agentTimeout(), "default agent timeout is wrong")
+
+	r.AgentTimeout = -1
+	assert.Equal(time.Duration(0), r.agentTimeout(), "default agent timeout is wrong")
+
+	r.AgentTimeout = 5
+	assert.Equal(5*time.Second, r.agentTimeout(), "default agent timeout is wrong")
+}
+
+func TestConfigLoadConfigurationImageChecksum(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "runtime-config-")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	config, err := createAllRuntimeConfigFiles(tmpdir, "qemu")
+	assert.NoError(err)
+
+	configData, err := ioutil.ReadFile(config.ConfigPath)
+	assert.NoError(err)
+
+	savedImageChecksum := imageChecksum
+	defer func() {
+		imageChecksum = savedImageChecksum
+	}()
+
+	_, _, _, err = loadConfiguration(config.ConfigPath, true)
+	assert.NoError(err)
+	assert.Empty(imageChecksum)
+
+	fileData := strings.Replace(string(configData), "[hypervisor.qemu]\n",
+		"[hypervisor.qemu]\nimage_checksum = \"sha256:"+strings.ToUpper(testImageChecksum)+"\"\n", 1)
+	err = createConfig(config.ConfigPath, fileData)
+	assert.NoError(err)
+
+	_, _, _, err = loadConfiguration(config.ConfigPath, true)
+	assert.NoError(err)
+	assert.Equal(testImageChecksum, imageChecksum)
+
+	fileData = strings.Replace(string(configData), "[hypervisor.qemu]\n",
+		"[hypervisor.qemu]\nimage_checksum = \"foo\"\n", 1)
+	err = createConfig(config.ConfigPath, fileData)
+	assert.NoError(err)
+
+	_, _, _, err = loadConfiguration(config.ConfigPath, true)
+	assert.Error(err)
+	assert.Contains(err.Error(), "image_checksum")
+}
@@ -0,0 +1,189 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// consoleLogMode is the mode used to create a console log file.
+const consoleLogMode = os.FileMode(0640)
+
+// consoleLogCommand is the name of the internal command that copies the
+// VM console to a log file.
+const consoleLogCommand = "console-log"
+
+// consoleLogGlobalFlags lists the global options passed on to the console
+// log process, so that it loads the same configuration and state and logs
+// to the same place as the runtime that started it.
+var consoleLogGlobalFlags = []string{"cc-config", "root", "log", "log-format", "log-level"}
+
+// consoleSocketName is the name of the VM console socket created by
+// virtcontainers in the runtime state directory of a pod.
+const consoleSocketName = "console.sock"
+
+// consoleSocketPollInterval is the delay between two attempts to connect
+// to the VM console socket before the VM has created it.
+const consoleSocketPollInterval = 10 * time.Millisecond
+
+// consoleSocketTimeout is the maximum amount of time to wait for the VM
+// console socket to be created. The console log process is started
+// before the pod is created, which may fail before the VM is started.
+var consoleSocketTimeout = 60 * time.Second
+
+// consoleLogConfig describes how "create --console-log" logs the VM
+// console.
+type consoleLogConfig struct {
+	// path is the path to the log file, or "" if the VM console is
+	// not logged.
+	path string
+
+	// globalArgs are the global options of the console log process.
+	globalArgs []string
+}
+
+// consoleLogCLICommand is started in the background by "create
+// --console-log". It is not intended to be run directly.
+var consoleLogCLICommand = cli.Command{
+	Name:      consoleLogCommand,
+	Usage:     "copy the VM console to a log file",
+	ArgsUsage: "<container-id> <pod-id> <path>",
+	Hidden:    true,
+	Action: func(context *cli.Context) error {
+		args := context.Args()
+		if len(args) != 3 {
+			return fmt.Errorf("Expecting a container ID, a pod ID and a path, got %d arguments: %v", len(args), []string(args))
+		}
+
+		return consoleLog(args[0], getConsoleSocketPath(args[1]), args[2])
+	},
+}
+
+// getConsoleSocketPath returns the path to the VM console socket of the
+// specified pod.
+func getConsoleSocketPath(podID string) string {
+	return getPodRunPath(podID, consoleSocketName)
+}
+
+// copyConsole copies the console output read from r to w a line at a
+// time, prefixing each line with the container ID.
+func copyConsole(r io.Reader, w io.Writer, containerID string) error {
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		if _, err := fmt.Fprintf(w, "%s: %s\n", containerID, scanner.Text()); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// dialConsole connects to the VM console socket at socketPath, waiting up
+// to timeout for the VM to create it.
+func dialConsole(socketPath string, timeout time.Duration) (net.Conn, error) {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		conn, err := net.Dial("unix", socketPath)
+		if err == nil || time.Now().After(deadline) {
+			return conn, err
+		}
+
+		time.Sleep(consoleSocketPollInterval)
+	}
+}
+
+// consoleLog appends the output of the VM console available on the
+// specified socket to the file at logPath until the VM shuts down. The
+// socket is waited for, so that the console is logged from the moment
+// the VM starts.
+func consoleLog(containerID, socketPath, logPath string) error {
+	conn, err := dialConsole(socketPath, consoleSocketTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	f, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, consoleLogMode)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return copyConsole(conn, f, containerID)
+}
+
+// getConsoleLogGlobalArgs returns the arguments setting the global options
+// of the console log process to the values used by the runtime.
+func getConsoleLogGlobalArgs(context *cli.Context) []string {
+	var args []string
+
+	for _, name := range consoleLogGlobalFlags {
+		if value := context.GlobalString(name); value != "" {
+			args = append(args, "--"+name, value)
+		}
+	}
+
+	return args
+}
+
+// startConsoleLogFunc is used to start the console log process, so that
+// tests can replace it.
+var startConsoleLogFunc = startConsoleLog
+
+// startConsoleLog starts a background process that copies the output of
+// the VM console of the specified pod to the file at logPath. globalArgs
+// are the global options of the process. It is started before the pod is
+// created, and waits for the VM console to be available.
+func startConsoleLog(globalArgs []string, containerID, podID, logPath string) error {
+	if logPath == "" {
+		return errors.New("Missing console log path")
+	}
+
+	logPath, err := filepath.Abs(logPath)
+	if err != nil {
+		return err
+	}
+
+	args := append(globalArgs, consoleLogCommand, containerID, podID, logPath)
+
+	cmd := exec.Command("/proc/self/exe", args...)
+
+	// Detach from the runtime so the console is still logged after it
+	// exits.
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setsid: true,
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	ccLog.WithField("path", logPath).Info("Logging VM console")
+
+	return cmd.Process.Release()
+}
@@ -0,0 +1,179 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+func TestCopyConsole(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		console  string
+		expected string
+	}
+
+	data := []testData{
+		{"", ""},
+		{"\n", testContainerID + ": \n"},
+		{"hello", testContainerID + ": hello\n"},
+		{
+			"[    0.000000] Linux version 4.9.47\nKernel panic - not syncing\n",
+			testContainerID + ": [    0.000000] Linux version 4.9.47\n" +
+				testContainerID + ": Kernel panic - not syncing\n",
+		},
+	}
+
+	for _, d := range data {
+		var buf bytes.Buffer
+
+		err := copyConsole(strings.NewReader(d.console), &buf, testContainerID)
+		assert.NoError(err, "test data: %+v", d)
+		assert.Equal(d.expected, buf.String(), "test data: %+v", d)
+	}
+}
+
+func TestConsoleLog(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	socketPath := filepath.Join(tmpdir, consoleSocketName)
+	logPath := filepath.Join(tmpdir, "console.log")
+
+	savedConsoleSocketTimeout := consoleSocketTimeout
+	consoleSocketTimeout = 50 * time.Millisecond
+
+	defer func() {
+		consoleSocketTimeout = savedConsoleSocketTimeout
+	}()
+
+	// no VM console
+	err = consoleLog(testContainerID, socketPath, logPath)
+	assert.Error(err)
+
+	// simulate the VM console
+	listener, err := net.Listen("unix", socketPath)
+	assert.NoError(err)
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		conn.Write([]byte("booting\nready\n"))
+		conn.Close()
+	}()
+
+	err = ioutil.WriteFile(logPath, []byte("existing\n"), testFileMode)
+	assert.NoError(err)
+
+	err = consoleLog(testContainerID, socketPath, logPath)
+	assert.NoError(err)
+
+	data, err := ioutil.ReadFile(logPath)
+	assert.NoError(err)
+	assert.Equal("existing\n"+testContainerID+": booting\n"+testContainerID+": ready\n", string(data))
+}
+
+func TestConsoleLogWaitForVM(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	socketPath := filepath.Join(tmpdir, consoleSocketName)
+	logPath := filepath.Join(tmpdir, "console.log")
+
+	result := make(chan error, 1)
+
+	// the console log process is started before the VM
+	go func() {
+		result <- consoleLog(testContainerID, socketPath, logPath)
+	}()
+
+	time.Sleep(5 * consoleSocketPollInterval)
+
+	listener, err := net.Listen("unix", socketPath)
+	assert.NoError(err)
+	defer listener.Close()
+
+	conn, err := listener.Accept()
+	assert.NoError(err)
+
+	conn.Write([]byte("Kernel panic - not syncing\n"))
+	conn.Close()
+
+	assert.NoError(<-result)
+
+	data, err := ioutil.ReadFile(logPath)
+	assert.NoError(err)
+	assert.Equal(testContainerID+": Kernel panic - not syncing\n", string(data))
+}
+
+func TestGetConsoleSocketPath(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(filepath.Join(podRunStatePath, testPodID, consoleSocketName),
+		getConsoleSocketPath(testPodID))
+}
+
+func TestStartConsoleLogMissingPath(t *testing.T) {
+	assert := assert.New(t)
+
+	err := startConsoleLog(nil, testContainerID, testPodID, "")
+	assert.Error(err)
+}
+
+func TestGetConsoleLogGlobalArgs(t *testing.T) {
+	assert := assert.New(t)
+
+	app := cli.NewApp()
+
+	set := flag.NewFlagSet("", 0)
+	set.String("cc-config", "/etc/cc.toml", "")
+	set.String("root", "/run/cc", "")
+	set.String("log", "/var/log/cc.log", "")
+	set.String("log-format", "json", "")
+	set.String("log-level", "", "")
+	set.Bool("debug", true, "")
+
+	globalCtx := cli.NewContext(app, set, nil)
+	ctx := cli.NewContext(app, flag.NewFlagSet("", 0), globalCtx)
+
+	assert.Equal([]string{
+		"--cc-config", "/etc/cc.toml",
+		"--root", "/run/cc",
+		"--log", "/var/log/cc.log",
+		"--log-format", "json",
+	}, getConsoleLogGlobalArgs(ctx))
+}
@@ -16,11 +16,13 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	vc "github.com/containers/virtcontainers"
@@ -43,12 +45,28 @@ var createCLICommand = cli.Command{
    The specification file includes an args parameter. The args parameter is
    used to specify command(s) that get run when the container is started.
    To change the command(s) that get executed on start, edit the args
-   parameter of the spec.`,
+   parameter of the spec.
+
+   If the bundle path is "-" (or "--config-json -" is specified), the
+   specification is read from standard input instead and no bundle
+   directory is used, so the root filesystem path in the specification
+   must be absolute. It is an error to specify both a bundle directory
+   and "--config-json -".
+
+   With --dry-run, the specification, annotations, resources, network
+   namespace and devices are checked as they would be for a real create,
+   and the container and VM that would be created are displayed, but no
+   VM is booted.`,
 	Flags: []cli.Flag{
 		cli.StringFlag{
 			Name:  "bundle, b",
 			Value: "",
-			Usage: `path to the root of the bundle directory, defaults to the current directory`,
+			Usage: `path to the root of the bundle directory, defaults to the current directory ("-" reads the specification from standard input)`,
+		},
+		cli.StringFlag{
+			Name:  "config-json",
+			Value: "",
+			Usage: `read the specification from standard input ("-") rather than from the bundle`,
 		},
 		cli.StringFlag{
 			Name:  "console",
@@ -60,11 +78,20 @@ var createCLICommand = cli.Command{
 			Value: "",
 			Usage: "path to an AF_UNIX socket which will receive a file descriptor referencing the master end of the console's pseudoterminal",
 		},
+		cli.StringFlag{
+			Name:  "console-log",
+			Value: "",
+			Usage: "append the output of the VM console to the specified file, prefixed with the container ID",
+		},
 		cli.StringFlag{
 			Name:  "pid-file",
 			Value: "",
 			Usage: "specify the file to write the process id to",
 		},
+		cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "check the container can be created and display what would be created, without creating it",
+		},
 	},
 	Action: func(context *cli.Context) error {
 		runtimeConfig, ok := context.App.Metadata["runtimeConfig"].(oci.RuntimeConfig)
@@ -72,34 +99,159 @@ var createCLICommand = cli.Command{
 			return errors.New("invalid runtime config")
 		}
 
+		if context.Bool("dry-run") {
+			bundlePath, err := createBundlePath(context.String("bundle"), context.String("config-json"))
+			if err != nil {
+				return err
+			}
+
+			return dryRunCreate(context.Args().First(), bundlePath, context.String("console"), runtimeConfig)
+		}
+
 		console, err := setupConsole(context.String("console"), context.String("console-socket"))
 		if err != nil {
 			return err
 		}
 
+		bundlePath, err := createBundlePath(context.String("bundle"), context.String("config-json"))
+		if err != nil {
+			return err
+		}
+
+		logConfig := consoleLogConfig{
+			path: context.String("console-log"),
+		}
+
+		if logConfig.path != "" {
+			logConfig.globalArgs = getConsoleLogGlobalArgs(context)
+		}
+
 		return create(context.Args().First(),
-			context.String("bundle"),
+			bundlePath,
 			console,
 			context.String("pid-file"),
 			true,
 			runtimeConfig,
+			logConfig,
 		)
 	},
 }
 
+// stdinBundle is the bundle path used to request that the OCI
+// specification be read from standard input.
+const stdinBundle = "-"
+
 // Use a variable to allow tests to modify its value
 var getKernelParamsFunc = getKernelParams
 
-func create(containerID, bundlePath, console, pidFilePath string, detach bool,
-	runtimeConfig oci.RuntimeConfig) error {
+// createBundlePath returns the bundle path to create the container from,
+// taking into account the --config-json option.
+func createBundlePath(bundlePath, configJSON string) (string, error) {
+	if configJSON == "" {
+		return bundlePath, nil
+	}
+
+	if configJSON != stdinBundle {
+		return "", fmt.Errorf("Invalid config-json %q: only %q (standard input) is supported", configJSON, stdinBundle)
+	}
+
+	if bundlePath != "" && bundlePath != stdinBundle {
+		return "", errors.New("Cannot specify both a bundle directory and config-json")
+	}
+
+	return stdinBundle, nil
+}
+
+// parseStdinConfigJSON reads the OCI specification from standard input.
+// There is no bundle directory to resolve a relative root filesystem
+// path against, so the path must be absolute.
+func parseStdinConfigJSON() (oci.CompatOCISpec, error) {
+	var ociSpec oci.CompatOCISpec
+
+	if err := json.NewDecoder(defaultInputFile).Decode(&ociSpec); err != nil {
+		return oci.CompatOCISpec{}, fmt.Errorf("Invalid %s read from standard input: %v", specConfig, err)
+	}
+
+	if !filepath.IsAbs(ociSpec.Root.Path) {
+		return oci.CompatOCISpec{}, fmt.Errorf("Root path must be absolute when %s is read from standard input", specConfig)
+	}
+
+	return ociSpec, nil
+}
+
+// getCreateSpec validates the create parameters and returns the OCI
+// specification of the container along with the resolved bundle path,
+// which is blank if the specification is read from standard input.
+func getCreateSpec(containerID, bundlePath string) (oci.CompatOCISpec, string, error) {
 	var err error
+	var ociSpec oci.CompatOCISpec
 
-	// Checks the MUST and MUST NOT from OCI runtime specification
-	if bundlePath, err = validCreateParams(containerID, bundlePath); err != nil {
-		return err
+	if bundlePath == stdinBundle {
+		if err = validCreateContainerID(containerID); err != nil {
+			return oci.CompatOCISpec{}, "", err
+		}
+
+		// There is no bundle directory.
+		bundlePath = ""
+
+		ociSpec, err = parseStdinConfigJSON()
+		if err != nil {
+			return oci.CompatOCISpec{}, "", err
+		}
+	} else {
+		// Checks the MUST and MUST NOT from OCI runtime specification
+		if bundlePath, err = validCreateParams(containerID, bundlePath); err != nil {
+			return oci.CompatOCISpec{}, "", err
+		}
+
+		ociSpec, err = oci.ParseConfigJSON(bundlePath)
+		if err != nil {
+			return oci.CompatOCISpec{}, "", err
+		}
+	}
+
+	if err := checkSpecVersion(containerID, ociSpec.Version); err != nil {
+		return oci.CompatOCISpec{}, "", err
+	}
+
+	filterDevices(&ociSpec)
+
+	if err := checkUnsupportedSettings(containerID, ociSpec); err != nil {
+		return oci.CompatOCISpec{}, "", err
 	}
 
-	ociSpec, err := oci.ParseConfigJSON(bundlePath)
+	if err := checkBlockIO(containerID, ociSpec); err != nil {
+		return oci.CompatOCISpec{}, "", err
+	}
+
+	if err := checkHostname(ociSpec.Hostname); err != nil {
+		return oci.CompatOCISpec{}, "", err
+	}
+
+	if ociSpec.Process != nil {
+		if err := validateUser(ociSpec.Process.User); err != nil {
+			return oci.CompatOCISpec{}, "", err
+		}
+	}
+
+	if systemdCgroup {
+		if _, _, err := getSystemdScope(ociSpec); err != nil {
+			return oci.CompatOCISpec{}, "", err
+		}
+	}
+
+	return ociSpec, bundlePath, nil
+}
+
+func create(containerID, bundlePath, console, pidFilePath string, detach bool,
+	runtimeConfig oci.RuntimeConfig, logConfig consoleLogConfig) error {
+	span := startSpan("create")
+	defer span.finish()
+
+	parseSpan := startSpan("parse-spec")
+	ociSpec, bundlePath, err := getCreateSpec(containerID, bundlePath)
+	parseSpan.finish()
+
 	if err != nil {
 		return err
 	}
@@ -109,8 +261,37 @@ func create(containerID, bundlePath, console, pidFilePath string, detach bool,
 		return err
 	}
 
+	if err := checkConsole(console, ociSpec.Process.Terminal); err != nil {
+		return err
+	}
+
+	if err := checkRuntimeFiles(runtimeConfig, containerType.IsPod()); err != nil {
+		return err
+	}
+
 	disableOutput := noNeedForOutput(detach, ociSpec.Process.Terminal)
 
+	ccLog.WithFields(logrus.Fields{
+		"container": containerID,
+		"type":      containerType,
+	}).Debug("Creating container")
+
+	if logConfig.path != "" {
+		// The VM console is shared by all the containers of a pod. It
+		// is logged from the start, including if the pod fails to be
+		// created.
+		podID := containerID
+		if !containerType.IsPod() {
+			if podID, err = ociSpec.PodID(); err != nil {
+				return err
+			}
+		}
+
+		if err := startConsoleLogFunc(logConfig.globalArgs, containerID, podID, logConfig.path); err != nil {
+			return err
+		}
+	}
+
 	var process vc.Process
 
 	switch containerType {
@@ -126,6 +307,29 @@ func create(containerID, bundlePath, console, pidFilePath string, detach bool,
 		}
 	}
 
+	cgroupsSpan := startSpan("cgroups")
+
+	if systemdCgroup {
+		err = createSystemdCgroup(containerID, ociSpec, process.Pid)
+	} else {
+		err = createCgroupfsCgroups(containerID, ociSpec, containerType, process.Pid)
+	}
+
+	cgroupsSpan.finish()
+
+	if err != nil {
+		return err
+	}
+
+	// Creation of PID file has to be the last thing done in the create
+	// because containerd considers the create complete after this file
+	// is created.
+	return createPIDFile(pidFilePath, process.Pid)
+}
+
+// createCgroupfsCgroups creates the host cgroups of a container below the
+// cgroupfs mount point and moves the specified process, its shim, there.
+func createCgroupfsCgroups(containerID string, ociSpec oci.CompatOCISpec, containerType vc.ContainerType, pid int) error {
 	// config.json provides a cgroups path that has to be used to create "tasks"
 	// and "cgroups.procs" files. Those files have to be filled with a PID, which
 	// is shim's in our case. This is mandatory to make sure there is no one
@@ -142,14 +346,7 @@ func create(containerID, bundlePath, console, pidFilePath string, detach bool,
 		cgroupsDirPath = ociSpec.Linux.CgroupsPath
 	}
 
-	if err := createCgroupsFiles(containerID, cgroupsDirPath, cgroupsPathList, process.Pid); err != nil {
-		return err
-	}
-
-	// Creation of PID file has to be the last thing done in the create
-	// because containerd considers the create complete after this file
-	// is created.
-	return createPIDFile(pidFilePath, process.Pid)
+	return createCgroupsFiles(containerID, cgroupsDirPath, cgroupsPathList, pid)
 }
 
 func getKernelParams(containerID string) []vc.Param {
@@ -177,23 +374,312 @@ func getKernelParams(containerID string) []vc.Param {
 	}
 }
 
-func createPod(ociSpec oci.CompatOCISpec, runtimeConfig oci.RuntimeConfig,
-	containerID, bundlePath, console string, disableOutput bool) (vc.Process, error) {
+// cpuQuotaToVCPUs returns the number of vCPUs required to honour the
+// specified CPU quota and period, rounded up to a whole vCPU. Zero is
+// returned if the quota does not limit CPU usage.
+func cpuQuotaToVCPUs(quota int64, period uint64) uint {
+	if quota <= 0 || period == 0 {
+		return 0
+	}
+
+	vcpus := (uint64(quota) + (period - 1)) / period
+
+	// qemu supports max 255
+	if vcpus > 255 {
+		return 255
+	}
+
+	return uint(vcpus)
+}
+
+// cpusetToVCPUs returns the number of vCPUs required to run on all the
+// CPUs of the specified cpuset, such as "0-3,6". Zero is returned if the
+// cpuset is empty.
+func cpusetToVCPUs(cpuset string) (uint, error) {
+	if cpuset == "" {
+		return 0, nil
+	}
+
+	cpus, err := parseCPUList(cpuset)
+	if err != nil {
+		return 0, err
+	}
+
+	// qemu supports max 255
+	if len(cpus) > 255 {
+		return 255, nil
+	}
+
+	return uint(len(cpus)), nil
+}
+
+// setPodVCPUs ensures the VM will be created with enough vCPUs to honour
+// the CPU quota and cpuset specified in the OCI configuration. When both
+// are specified, the container cannot use more CPUs than the cpuset
+// holds, so the smaller count is used. The number of vCPUs is only ever
+// increased: a VM that would already boot with enough of them is left as
+// it is.
+//
+// XXX: virtcontainers only takes the CPU quota into account when a memory
+// limit is also specified and it does not support hot plugging vCPUs, so
+// the VM has to be booted with the full count.
+func setPodVCPUs(ociSpec oci.CompatOCISpec, podConfig *vc.PodConfig) error {
+	if ociSpec.Linux == nil ||
+		ociSpec.Linux.Resources == nil ||
+		ociSpec.Linux.Resources.CPU == nil {
+		return nil
+	}
+
+	cpu := ociSpec.Linux.Resources.CPU
+
+	var vcpus uint
+
+	if cpu.Quota != nil && cpu.Period != nil {
+		vcpus = cpuQuotaToVCPUs(*cpu.Quota, *cpu.Period)
+	}
+
+	cpusetVCPUs, err := cpusetToVCPUs(cpu.Cpus)
+	if err != nil {
+		return fmt.Errorf("Invalid cpuset %q: %v", cpu.Cpus, err)
+	}
+
+	if cpusetVCPUs > 0 && (vcpus == 0 || cpusetVCPUs < vcpus) {
+		vcpus = cpusetVCPUs
+	}
+
+	// The VM is booted with the default number of vCPUs unless
+	// virtcontainers already computed a count from the resources.
+	booted := podConfig.VMConfig.VCPUs
+	if defaultVCPUs := uint(podConfig.HypervisorConfig.DefaultVCPUs); defaultVCPUs > booted {
+		booted = defaultVCPUs
+	}
+
+	if vcpus <= booted {
+		return nil
+	}
+
+	ccLog.WithFields(logrus.Fields{
+		"container": podConfig.ID,
+		"vcpus":     vcpus,
+	}).Info("Setting VM vCPUs from CPU resources")
+
+	podConfig.VMConfig.VCPUs = vcpus
+
+	return nil
+}
+
+// getPodConfig returns the virtcontainers configuration of the pod to
+// create for the specified sandbox container.
+func getPodConfig(ociSpec oci.CompatOCISpec, runtimeConfig oci.RuntimeConfig,
+	containerID, bundlePath, console string, disableOutput bool) (vc.PodConfig, error) {
+	if err := applyHypervisorAnnotations(ociSpec.Annotations, &runtimeConfig.HypervisorConfig); err != nil {
+		return vc.PodConfig{}, err
+	}
+
 	ccKernelParams := getKernelParamsFunc(containerID)
 
 	for _, p := range ccKernelParams {
 		if err := (&runtimeConfig).AddKernelParam(p); err != nil {
-			return vc.Process{}, err
+			return vc.PodConfig{}, err
 		}
 	}
 
 	podConfig, err := oci.PodConfig(ociSpec, runtimeConfig, bundlePath, containerID, console, disableOutput)
+	if err != nil {
+		return vc.PodConfig{}, err
+	}
+
+	if err := setPodVCPUs(ociSpec, &podConfig); err != nil {
+		return vc.PodConfig{}, err
+	}
+
+	// virtcontainers truncates the values containing "=".
+	for i := range podConfig.Containers {
+		podConfig.Containers[i].Cmd.Envs = getEnvVars(ociSpec.Process.Env)
+	}
+
+	// virtcontainers only needs to run the prestart hooks, the runtime
+	// runs the other hooks itself.
+	podConfig.Hooks.PostStartHooks = nil
+	podConfig.Hooks.PostStopHooks = nil
+
+	return podConfig, nil
+}
+
+// podSetup describes the host setup of a pod made by createPod besides
+// virtcontainers.
+type podSetup struct {
+	netnsPath  string
+	qos        *networkQoS
+	pinnedCPUs []int
+	node       *numaNode
+	pciDevices []string
+}
+
+// checkPod runs the checks made before creating the pod of the specified
+// sandbox container, without changing the host, and returns the setup the
+// pod needs.
+func checkPod(ociSpec oci.CompatOCISpec, runtimeConfig oci.RuntimeConfig) (podSetup, error) {
+	var setup podSetup
+	var err error
+
+	setup.qos, err = getNetworkQoS(ociSpec.Annotations)
+	if err != nil {
+		return podSetup{}, err
+	}
+
+	setup.netnsPath = getNetNSPath(ociSpec)
+	if setup.qos != nil && setup.netnsPath == "" {
+		return podSetup{}, errors.New("Limiting the network bandwidth requires a network namespace path")
+	}
+
+	if setup.netnsPath != "" && !fileExists(setup.netnsPath) {
+		return podSetup{}, fmt.Errorf("Network namespace %v does not exist", setup.netnsPath)
+	}
+
+	setup.pinnedCPUs, err = getVCPUPinning(ociSpec)
+	if err != nil {
+		return podSetup{}, err
+	}
+
+	// Explicitly pinned vCPUs take priority over the NUMA placement.
+	if setup.pinnedCPUs == nil {
+		setup.node, err = getNUMAPlacement(ociSpec)
+		if err != nil {
+			return podSetup{}, err
+		}
+	}
+
+	if err := verifyImage(runtimeConfig.HypervisorConfig.ImagePath); err != nil {
+		return podSetup{}, err
+	}
+
+	setup.pciDevices, err = getPCIDevices(ociSpec.Annotations)
+	if err != nil {
+		return podSetup{}, err
+	}
+
+	for _, bdf := range setup.pciDevices {
+		if _, _, err := checkPCIDevice(bdf); err != nil {
+			return podSetup{}, err
+		}
+	}
+
+	return setup, nil
+}
+
+// getCreatePodConfig returns the virtcontainers configuration createPod
+// creates the pod of the specified sandbox container with, given the setup
+// returned by checkPod().
+func getCreatePodConfig(ociSpec oci.CompatOCISpec, runtimeConfig oci.RuntimeConfig, setup podSetup,
+	containerID, bundlePath, console string, disableOutput bool) (vc.PodConfig, error) {
+	podConfig, err := getPodConfig(ociSpec, runtimeConfig, containerID, bundlePath, console, disableOutput)
+	if err != nil {
+		return vc.PodConfig{}, err
+	}
+
+	if err := setAgentSockets(&podConfig); err != nil {
+		return vc.PodConfig{}, err
+	}
+
+	if setup.node != nil {
+		podConfig.Annotations[numaNodeAnnotation] = strconv.Itoa(setup.node.ID)
+	}
+
+	return podConfig, nil
+}
+
+func createPod(ociSpec oci.CompatOCISpec, runtimeConfig oci.RuntimeConfig,
+	containerID, bundlePath, console string, disableOutput bool) (_ vc.Process, err error) {
+	// The sandbox container gives its ID to the pod.
+	log := containerLogEntry(containerID, containerID)
+
+	setup, err := checkPod(ociSpec, runtimeConfig)
 	if err != nil {
 		return vc.Process{}, err
 	}
 
-	pod, err := vci.CreatePod(podConfig)
+	if err := setupPCIDevices(&ociSpec); err != nil {
+		return vc.Process{}, err
+	}
+
+	// The PCI devices were added to the OCI configuration.
+	podConfig, err := getCreatePodConfig(ociSpec, runtimeConfig, setup, containerID, bundlePath, console, disableOutput)
 	if err != nil {
+		teardownPCIDevices(ociSpec)
+		return vc.Process{}, err
+	}
+
+	if err := createAgentSocketDir(podConfig); err != nil {
+		teardownPCIDevices(ociSpec)
+		return vc.Process{}, err
+	}
+
+	socketDir := podConfig.Annotations[agentSocketDirAnnotation]
+
+	log.Debug("Starting VM and connecting to agent")
+
+	// virtcontainers sets up the network, boots the VM and connects to
+	// the agent.
+	var pod vc.VCPod
+
+	span := startSpan("create-pod")
+	err = withAgentTimeout(podConfig.ID, func() (err error) {
+		pod, err = vci.CreatePod(podConfig)
+		return err
+	})
+	span.finish()
+
+	if err != nil {
+		// The VM was stopped, but virtcontainers left the state of the
+		// pod behind.
+		if _, ok := err.(agentTimeoutError); ok {
+			if err := forceDeletePod(podConfig.ID); err != nil {
+				log.WithError(err).Warn("Cannot delete pod after agent timeout")
+			}
+		}
+
+		teardownPodHostResources(podConfig.ID, socketDir, ociSpec)
+		return vc.Process{}, err
+	}
+
+	// The pod has to be deleted if any of the following steps fails.
+	defer func() {
+		if err != nil {
+			deleteFailedPod(pod.ID(), socketDir, ociSpec)
+		}
+	}()
+
+	if setup.qos != nil {
+		span := startSpan("network-qos")
+		err := applyNetworkQoS(setup.netnsPath, *setup.qos)
+		span.finish()
+
+		if err != nil {
+			return vc.Process{}, err
+		}
+	}
+
+	if setup.pinnedCPUs != nil {
+		if err := pinVCPUs(pod.ID(), setup.pinnedCPUs); err != nil {
+			return vc.Process{}, err
+		}
+	}
+
+	if setup.node != nil {
+		if err := placeOnNUMANode(pod.ID(), *setup.node); err != nil {
+			return vc.Process{}, err
+		}
+	}
+
+	// getCreateSpec() has already validated the score.
+	if score, _ := getOOMScoreAdj(ociSpec); score != nil {
+		if err := setVMOOMScoreAdj(pod.ID(), *score); err != nil {
+			return vc.Process{}, err
+		}
+	}
+
+	if err := applyBlockIOThrottle(pod.ID(), containerID, podConfig.Containers[0].RootFs, ociSpec); err != nil {
 		return vc.Process{}, err
 	}
 
@@ -205,10 +691,47 @@ func createPod(ociSpec oci.CompatOCISpec, runtimeConfig oci.RuntimeConfig,
 	return containers[0].Process(), nil
 }
 
+// teardownPodHostResources undoes the host setup made for the specified
+// pod besides virtcontainers: the network QoS, the PCI devices bound to
+// vfio-pci and the agent sockets in socketDir.
+func teardownPodHostResources(podID, socketDir string, ociSpec oci.CompatOCISpec) {
+	removeNetworkQoS(ociSpec)
+	teardownPCIDevices(ociSpec)
+
+	if err := removeAgentSockets(socketDir); err != nil {
+		ccLog.WithError(err).WithField("pod", podID).Warn("Cannot remove agent sockets")
+	}
+}
+
+// deleteFailedPod deletes the specified pod, whose creation failed after
+// its VM was started, and undoes its host setup.
+func deleteFailedPod(podID, socketDir string, ociSpec oci.CompatOCISpec) {
+	if _, err := vci.DeletePod(podID); err != nil {
+		ccLog.WithError(err).WithField("pod", podID).Warn("Cannot delete pod after failed creation")
+	}
+
+	teardownPodHostResources(podID, socketDir, ociSpec)
+}
+
+// getContainerConfig returns the virtcontainers configuration of the
+// container to create in an existing pod.
+func getContainerConfig(ociSpec oci.CompatOCISpec, containerID, bundlePath,
+	console string, disableOutput bool) (vc.ContainerConfig, error) {
+	contConfig, err := oci.ContainerConfig(ociSpec, bundlePath, containerID, console, disableOutput)
+	if err != nil {
+		return vc.ContainerConfig{}, err
+	}
+
+	// virtcontainers truncates the values containing "=".
+	contConfig.Cmd.Envs = getEnvVars(ociSpec.Process.Env)
+
+	return contConfig, nil
+}
+
 func createContainer(ociSpec oci.CompatOCISpec, containerID, bundlePath,
 	console string, disableOutput bool) (vc.Process, error) {
 
-	contConfig, err := oci.ContainerConfig(ociSpec, bundlePath, containerID, console, disableOutput)
+	contConfig, err := getContainerConfig(ociSpec, containerID, bundlePath, console, disableOutput)
 	if err != nil {
 		return vc.Process{}, err
 	}
@@ -218,11 +741,26 @@ func createContainer(ociSpec oci.CompatOCISpec, containerID, bundlePath,
 		return vc.Process{}, err
 	}
 
+	log := containerLogEntry(containerID, podID)
+
+	log.Debug("Creating container in pod")
+
+	span := startSpan("create-container")
 	_, c, err := vci.CreateContainer(podID, contConfig)
+	span.finish()
+
 	if err != nil {
 		return vc.Process{}, err
 	}
 
+	if err := applyBlockIOThrottle(podID, containerID, contConfig.RootFs, ociSpec); err != nil {
+		if _, err := vci.DeleteContainer(podID, containerID); err != nil {
+			log.WithError(err).Warn("Cannot delete container after failed creation")
+		}
+
+		return vc.Process{}, err
+	}
+
 	return c.Process(), nil
 }
 
@@ -241,17 +779,24 @@ func createCgroupsFiles(containerID string, cgroupsDirPath string, cgroupsPathLi
 			return err
 		}
 
-		if strings.Contains(cgroupsPath, "cpu") && cgroupsDirPath != "" {
+		// The cpuset of a cgroup v2 child is inherited from its parent.
+		if cgroupVersion != 2 && strings.Contains(cgroupsPath, "cpu") && cgroupsDirPath != "" {
 			parent := strings.TrimSuffix(cgroupsPath, cgroupsDirPath)
 			copyParentCPUSet(cgroupsPath, parent)
 		}
 
-		tasksFilePath := filepath.Join(cgroupsPath, cgroupsTasksFile)
-		procsFilePath := filepath.Join(cgroupsPath, cgroupsProcsFile)
+		files := []string{cgroupsProcsFile}
+
+		// The unified hierarchy has no "tasks" file.
+		if cgroupVersion != 2 {
+			files = append([]string{cgroupsTasksFile}, files...)
+		}
 
 		pidStr := fmt.Sprintf("%d", pid)
 
-		for _, path := range []string{tasksFilePath, procsFilePath} {
+		for _, file := range files {
+			path := filepath.Join(cgroupsPath, file)
+
 			f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, cgroupsFileMode)
 			if err != nil {
 				return err
@@ -273,34 +818,55 @@ func createCgroupsFiles(containerID string, cgroupsDirPath string, cgroupsPathLi
 	return nil
 }
 
+// pidFileMode is the mode of the file created by "--pid-file".
+const pidFileMode = os.FileMode(0644)
+
+// createPIDFile writes the specified PID to pidFilePath. The PID is written
+// to a temporary file which is then renamed so that a process monitoring
+// the PID file never reads a partially written one.
 func createPIDFile(pidFilePath string, pid int) error {
 	if pidFilePath == "" {
 		// runtime should not fail since pid file is optional
 		return nil
 	}
 
-	if err := os.RemoveAll(pidFilePath); err != nil {
-		return err
+	dir := filepath.Dir(pidFilePath)
+
+	if !fileExists(dir) {
+		return fmt.Errorf("Could not create pid file '%s': directory '%s' does not exist", pidFilePath, dir)
 	}
 
-	f, err := os.Create(pidFilePath)
+	f, err := ioutil.TempFile(dir, "."+filepath.Base(pidFilePath))
 	if err != nil {
 		return err
 	}
-	defer f.Close()
+
+	tmpPath := f.Name()
 
 	pidStr := fmt.Sprintf("%d", pid)
 
 	n, err := f.WriteString(pidStr)
-	if err != nil {
-		return err
+	if err == nil && n < len(pidStr) {
+		err = fmt.Errorf("Could not write pid to '%s': only %d bytes written out of %d", pidFilePath, n, len(pidStr))
 	}
 
-	if n < len(pidStr) {
-		return fmt.Errorf("Could not write pid to '%s': only %d bytes written out of %d", pidFilePath, n, len(pidStr))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
 	}
 
-	return nil
+	if err == nil {
+		err = os.Chmod(tmpPath, pidFileMode)
+	}
+
+	if err == nil {
+		err = os.Rename(tmpPath, pidFilePath)
+	}
+
+	if err != nil {
+		os.Remove(tmpPath)
+	}
+
+	return err
 }
 
 // copyParentCPUSet copies the cpuset.cpus and cpuset.mems from the parent
@@ -15,11 +15,14 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -86,6 +89,12 @@ func TestCreateCgroupsFilesFailToWriteFile(t *testing.T) {
 }
 
 func TestCgroupsFilesNonEmptyCgroupsPathSuccessful(t *testing.T) {
+	savedVersion := cgroupVersion
+	cgroupVersion = 1
+	defer func() {
+		cgroupVersion = savedVersion
+	}()
+
 	cgroupsPath, err := ioutil.TempDir(testDir, "cgroups-path-")
 	if err != nil {
 		t.Fatalf("Could not create temporary cgroups directory: %s", err)
@@ -114,6 +123,32 @@ func TestCgroupsFilesNonEmptyCgroupsPathSuccessful(t *testing.T) {
 	}
 }
 
+func TestCgroupsFilesCgroupV2(t *testing.T) {
+	assert := assert.New(t)
+
+	savedVersion := cgroupVersion
+	cgroupVersion = 2
+	defer func() {
+		cgroupVersion = savedVersion
+	}()
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	cgroupsPath := filepath.Join(tmpdir, "cgroups-path")
+
+	err = createCgroupsFiles("foo", tmpdir, []string{cgroupsPath}, testPID)
+	assert.NoError(err)
+
+	fileBytes, err := ioutil.ReadFile(filepath.Join(cgroupsPath, cgroupsProcsFile))
+	assert.NoError(err)
+	assert.Equal(testStrPID, string(fileBytes))
+
+	// the unified hierarchy has no tasks file
+	assert.False(fileExists(filepath.Join(cgroupsPath, cgroupsTasksFile)))
+}
+
 func TestCreatePIDFileSuccessful(t *testing.T) {
 	pidDirPath, err := ioutil.TempDir(testDir, "pid-path-")
 	if err != nil {
@@ -139,6 +174,35 @@ func TestCreatePIDFileSuccessful(t *testing.T) {
 	os.RemoveAll(pidFilePath)
 }
 
+func TestCreatePIDFileReplace(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	pidFilePath := filepath.Join(tmpdir, "pidfile")
+
+	err = ioutil.WriteFile(pidFilePath, []byte("123456789"), testFileMode)
+	assert.NoError(err)
+
+	err = createPIDFile(pidFilePath, testPID)
+	assert.NoError(err)
+
+	fileBytes, err := ioutil.ReadFile(pidFilePath)
+	assert.NoError(err)
+	assert.Equal(testStrPID, string(fileBytes))
+
+	st, err := os.Stat(pidFilePath)
+	assert.NoError(err)
+	assert.Equal(pidFileMode, st.Mode())
+
+	// no temporary file is left behind
+	files, err := ioutil.ReadDir(tmpdir)
+	assert.NoError(err)
+	assert.Len(files, 1)
+}
+
 func TestCreatePIDFileEmptyPathSuccessful(t *testing.T) {
 	file := ""
 	if err := createPIDFile(file, testPID); err != nil {
@@ -186,7 +250,8 @@ func TestCreatePIDFileUnableToCreate(t *testing.T) {
 
 	// subdir doesn't exist
 	assert.Error(err)
-	os.Chmod(subdir, testDirMode)
+	assert.Contains(err.Error(), "does not exist")
+	assert.False(fileExists(subdir))
 }
 
 func TestCreateCLIFunctionNoRuntimeConfig(t *testing.T) {
@@ -333,7 +398,7 @@ func TestCreateInvalidArgs(t *testing.T) {
 	}
 
 	for i, d := range data {
-		err := create(d.containerID, d.bundlePath, d.console, d.pidFilePath, d.detach, d.runtimeConfig)
+		err := create(d.containerID, d.bundlePath, d.console, d.pidFilePath, d.detach, d.runtimeConfig, consoleLogConfig{})
 		assert.Errorf(err, "test %d (%+v)", i, d)
 	}
 }
@@ -376,7 +441,7 @@ func TestCreateInvalidConfigJSON(t *testing.T) {
 	f.Close()
 
 	for detach := range []bool{true, false} {
-		err := create(testContainerID, bundlePath, testConsole, pidFilePath, true, runtimeConfig)
+		err := create(testContainerID, bundlePath, testConsole, pidFilePath, true, runtimeConfig, consoleLogConfig{})
 		assert.Errorf(err, "%+v", detach)
 		assert.False(vcMock.IsMockError(err))
 	}
@@ -423,12 +488,172 @@ func TestCreateInvalidContainerType(t *testing.T) {
 	assert.NoError(err)
 
 	for detach := range []bool{true, false} {
-		err := create(testContainerID, bundlePath, testConsole, pidFilePath, true, runtimeConfig)
+		err := create(testContainerID, bundlePath, testConsole, pidFilePath, true, runtimeConfig, consoleLogConfig{})
 		assert.Errorf(err, "%+v", detach)
 		assert.False(vcMock.IsMockError(err))
 	}
 }
 
+func TestCreateInvalidSeccomp(t *testing.T) {
+	assert := assert.New(t)
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		// No pre-existing pods
+		return []vc.PodStatus{}, nil
+	}
+
+	defer func() {
+		testingImpl.ListPodFunc = nil
+	}()
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	runtimeConfig, err := newTestRuntimeConfig(tmpdir, testConsole, true)
+	assert.NoError(err)
+
+	bundlePath := filepath.Join(tmpdir, "bundle")
+
+	err = makeOCIBundle(bundlePath)
+	assert.NoError(err)
+
+	pidFilePath := filepath.Join(tmpdir, "pidfile.txt")
+
+	ociConfigFile := filepath.Join(bundlePath, "config.json")
+
+	spec, err := readOCIConfigFile(ociConfigFile)
+	assert.NoError(err)
+
+	spec.Linux.Seccomp = &specs.LinuxSeccomp{
+		DefaultAction: specs.ActErrno,
+		Architectures: []specs.Arch{"SCMP_ARCH_FOO"},
+	}
+
+	err = writeOCIConfigFile(spec, ociConfigFile)
+	assert.NoError(err)
+
+	err = create(testContainerID, bundlePath, testConsole, pidFilePath, true, runtimeConfig, consoleLogConfig{})
+	assert.Error(err)
+	assert.False(vcMock.IsMockError(err))
+	assert.False(fileExists(pidFilePath))
+}
+
+func TestCreateConsoleLogBeforePod(t *testing.T) {
+	assert := assert.New(t)
+
+	podCreated := false
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		// No pre-existing pods
+		return []vc.PodStatus{}, nil
+	}
+
+	testingImpl.CreatePodFunc = func(podConfig vc.PodConfig) (vc.VCPod, error) {
+		podCreated = true
+		return &vcMock.Pod{}, nil
+	}
+
+	var logArgs []string
+
+	savedStartConsoleLogFunc := startConsoleLogFunc
+	startConsoleLogFunc = func(globalArgs []string, containerID, podID, logPath string) error {
+		// the console is logged before the pod is created
+		assert.False(podCreated)
+
+		logArgs = append(globalArgs, containerID, podID, logPath)
+		return errors.New("cannot start console log")
+	}
+
+	defer func() {
+		testingImpl.ListPodFunc = nil
+		testingImpl.CreatePodFunc = nil
+		startConsoleLogFunc = savedStartConsoleLogFunc
+	}()
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	runtimeConfig, err := newTestRuntimeConfig(tmpdir, testConsole, true)
+	assert.NoError(err)
+
+	bundlePath := filepath.Join(tmpdir, "bundle")
+
+	err = makeOCIBundle(bundlePath)
+	assert.NoError(err)
+
+	ociConfigFile := filepath.Join(bundlePath, "config.json")
+
+	spec, err := readOCIConfigFile(ociConfigFile)
+	assert.NoError(err)
+
+	spec.Annotations = map[string]string{
+		testContainerTypeAnnotation: testContainerTypePod,
+	}
+
+	err = writeOCIConfigFile(spec, ociConfigFile)
+	assert.NoError(err)
+
+	pidFilePath := filepath.Join(tmpdir, "pidfile.txt")
+
+	logConfig := consoleLogConfig{
+		path:       filepath.Join(tmpdir, "console.log"),
+		globalArgs: []string{"--log-level", "debug"},
+	}
+
+	// nothing is created if the console cannot be logged
+	err = create(testContainerID, bundlePath, testConsole, pidFilePath, true, runtimeConfig, logConfig)
+	assert.Error(err)
+	assert.False(podCreated)
+	assert.False(fileExists(pidFilePath))
+
+	assert.Equal([]string{"--log-level", "debug", testContainerID, testContainerID, logConfig.path}, logArgs)
+}
+
+func TestCreateConsoleWithoutTerminal(t *testing.T) {
+	assert := assert.New(t)
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		// No pre-existing pods
+		return []vc.PodStatus{}, nil
+	}
+
+	defer func() {
+		testingImpl.ListPodFunc = nil
+	}()
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	runtimeConfig, err := newTestRuntimeConfig(tmpdir, testConsole, true)
+	assert.NoError(err)
+
+	bundlePath := filepath.Join(tmpdir, "bundle")
+
+	err = makeOCIBundle(bundlePath)
+	assert.NoError(err)
+
+	pidFilePath := filepath.Join(tmpdir, "pidfile.txt")
+
+	ociConfigFile := filepath.Join(bundlePath, "config.json")
+
+	spec, err := readOCIConfigFile(ociConfigFile)
+	assert.NoError(err)
+
+	spec.Process.Terminal = false
+
+	err = writeOCIConfigFile(spec, ociConfigFile)
+	assert.NoError(err)
+
+	// stdout and stderr would both be sent to the console
+	err = create(testContainerID, bundlePath, testConsole, pidFilePath, true, runtimeConfig, consoleLogConfig{})
+	assert.Error(err)
+	assert.False(vcMock.IsMockError(err))
+	assert.False(fileExists(pidFilePath))
+}
+
 func TestCreateContainerInvalid(t *testing.T) {
 	assert := assert.New(t)
 
@@ -471,7 +696,7 @@ func TestCreateContainerInvalid(t *testing.T) {
 	assert.NoError(err)
 
 	for detach := range []bool{true, false} {
-		err := create(testContainerID, bundlePath, testConsole, pidFilePath, true, runtimeConfig)
+		err := create(testContainerID, bundlePath, testConsole, pidFilePath, true, runtimeConfig, consoleLogConfig{})
 		assert.Errorf(err, "%+v", detach)
 		assert.False(vcMock.IsMockError(err))
 	}
@@ -562,7 +787,7 @@ func TestCreateProcessCgroupsPathSuccessful(t *testing.T) {
 	assert.NoError(err)
 
 	for _, detach := range []bool{true, false} {
-		err := create(testContainerID, bundlePath, testConsole, pidFilePath, detach, runtimeConfig)
+		err := create(testContainerID, bundlePath, testConsole, pidFilePath, detach, runtimeConfig, consoleLogConfig{})
 		assert.NoError(err, "detached: %+v", detach)
 	}
 }
@@ -646,7 +871,7 @@ func TestCreateCreateCgroupsFilesFail(t *testing.T) {
 	assert.NoError(err)
 
 	for detach := range []bool{true, false} {
-		err := create(testContainerID, bundlePath, testConsole, pidFilePath, true, runtimeConfig)
+		err := create(testContainerID, bundlePath, testConsole, pidFilePath, true, runtimeConfig, consoleLogConfig{})
 		assert.Errorf(err, "%+v", detach)
 		assert.False(vcMock.IsMockError(err))
 	}
@@ -722,7 +947,7 @@ func TestCreateCreateCreatePidFileFail(t *testing.T) {
 	assert.NoError(err)
 
 	for detach := range []bool{true, false} {
-		err := create(testContainerID, bundlePath, testConsole, pidFilePath, true, runtimeConfig)
+		err := create(testContainerID, bundlePath, testConsole, pidFilePath, true, runtimeConfig, consoleLogConfig{})
 		assert.Errorf(err, "%+v", detach)
 		assert.False(vcMock.IsMockError(err))
 	}
@@ -734,7 +959,10 @@ func TestCreate(t *testing.T) {
 	pod := &vcMock.Pod{
 		MockID: testPodID,
 		MockContainers: []*vcMock.Container{
-			{MockID: testContainerID},
+			{
+				MockID:      testContainerID,
+				MockProcess: vc.Process{Pid: testPID},
+			},
 		},
 	}
 
@@ -788,9 +1016,140 @@ func TestCreate(t *testing.T) {
 	assert.NoError(err)
 
 	for detach := range []bool{true, false} {
-		err := create(testContainerID, bundlePath, testConsole, pidFilePath, true, runtimeConfig)
+		err := create(testContainerID, bundlePath, testConsole, pidFilePath, true, runtimeConfig, consoleLogConfig{})
 		assert.NoError(err, "%+v", detach)
+
+		fileBytes, err := ioutil.ReadFile(pidFilePath)
+		assert.NoError(err)
+
+		pid, err := strconv.Atoi(string(fileBytes))
+		assert.NoError(err)
+		assert.Equal(testPID, pid)
+	}
+}
+
+func TestCreateBundlePath(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		bundlePath    string
+		configJSON    string
+		expected      string
+		expectFailure bool
+	}
+
+	data := []testData{
+		{"", "", "", false},
+		{"/foo", "", "/foo", false},
+		{"-", "", "-", false},
+		{"", "-", "-", false},
+		{"-", "-", "-", false},
+		{"/foo", "-", "", true},
+		{"", "/foo/config.json", "", true},
 	}
+
+	for _, d := range data {
+		bundlePath, err := createBundlePath(d.bundlePath, d.configJSON)
+		if d.expectFailure {
+			assert.Error(err, "test data: %+v", d)
+			continue
+		}
+
+		assert.NoError(err, "test data: %+v", d)
+		assert.Equal(d.expected, bundlePath, "test data: %+v", d)
+	}
+}
+
+// testCreateStdin calls create() with the specified data available on
+// standard input.
+func testCreateStdin(t *testing.T, tmpdir, stdinData string, runtimeConfig oci.RuntimeConfig) error {
+	stdinFile := filepath.Join(tmpdir, "stdin")
+	err := ioutil.WriteFile(stdinFile, []byte(stdinData), testFileMode)
+	assert.NoError(t, err)
+
+	f, err := os.Open(stdinFile)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	savedInputFile := defaultInputFile
+	defaultInputFile = f
+
+	defer func() {
+		defaultInputFile = savedInputFile
+	}()
+
+	pidFilePath := filepath.Join(tmpdir, "pidfile.txt")
+
+	return create(testContainerID, stdinBundle, testConsole, pidFilePath, true, runtimeConfig, consoleLogConfig{})
+}
+
+func TestCreateStdin(t *testing.T) {
+	assert := assert.New(t)
+
+	pod := &vcMock.Pod{
+		MockID: testPodID,
+		MockContainers: []*vcMock.Container{
+			{MockID: testContainerID},
+		},
+	}
+
+	var rootfs string
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		// No pre-existing pods
+		return []vc.PodStatus{}, nil
+	}
+
+	testingImpl.CreatePodFunc = func(podConfig vc.PodConfig) (vc.VCPod, error) {
+		rootfs = podConfig.Containers[0].RootFs
+		return pod, nil
+	}
+
+	defer func() {
+		testingImpl.ListPodFunc = nil
+		testingImpl.CreatePodFunc = nil
+	}()
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	runtimeConfig, err := newTestRuntimeConfig(tmpdir, testConsole, true)
+	assert.NoError(err)
+
+	bundlePath := filepath.Join(tmpdir, "bundle")
+
+	err = makeOCIBundle(bundlePath)
+	assert.NoError(err)
+
+	spec, err := readOCIConfigFile(filepath.Join(bundlePath, "config.json"))
+	assert.NoError(err)
+
+	// Force pod-type container
+	spec.Annotations = make(map[string]string)
+	spec.Annotations[testContainerTypeAnnotation] = testContainerTypePod
+
+	// relative root paths cannot be used without a bundle
+	configJSON, err := json.Marshal(spec)
+	assert.NoError(err)
+
+	err = testCreateStdin(t, tmpdir, string(configJSON), runtimeConfig)
+	assert.Error(err)
+	assert.False(vcMock.IsMockError(err))
+
+	// invalid JSON
+	err = testCreateStdin(t, tmpdir, "{", runtimeConfig)
+	assert.Error(err)
+	assert.False(vcMock.IsMockError(err))
+
+	spec.Root.Path = filepath.Join(bundlePath, spec.Root.Path)
+
+	configJSON, err = json.Marshal(spec)
+	assert.NoError(err)
+
+	err = testCreateStdin(t, tmpdir, string(configJSON), runtimeConfig)
+	assert.NoError(err)
+	assert.Equal(spec.Root.Path, rootfs)
 }
 
 func TestCreateInvalidKernelParams(t *testing.T) {
@@ -848,7 +1207,7 @@ func TestCreateInvalidKernelParams(t *testing.T) {
 	}
 
 	for detach := range []bool{true, false} {
-		err := create(testContainerID, bundlePath, testConsole, pidFilePath, true, runtimeConfig)
+		err := create(testContainerID, bundlePath, testConsole, pidFilePath, true, runtimeConfig, consoleLogConfig{})
 		assert.Errorf(err, "%+v", detach)
 		assert.False(vcMock.IsMockError(err))
 	}
@@ -936,6 +1295,65 @@ func TestCreateCreatePodFail(t *testing.T) {
 	assert.True(vcMock.IsMockError(err))
 }
 
+func TestCreateCreatePodResources(t *testing.T) {
+	assert := assert.New(t)
+
+	var podConfig vc.PodConfig
+
+	testingImpl.CreatePodFunc = func(config vc.PodConfig) (vc.VCPod, error) {
+		podConfig = config
+		return &vcMock.Pod{
+			MockID: testPodID,
+			MockContainers: []*vcMock.Container{
+				{MockID: testContainerID},
+			},
+		}, nil
+	}
+
+	defer func() {
+		testingImpl.CreatePodFunc = nil
+	}()
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	runtimeConfig, err := newTestRuntimeConfig(tmpdir, testConsole, true)
+	assert.NoError(err)
+
+	bundlePath := filepath.Join(tmpdir, "bundle")
+
+	err = makeOCIBundle(bundlePath)
+	assert.NoError(err)
+
+	ociConfigFile := filepath.Join(bundlePath, "config.json")
+	assert.True(fileExists(ociConfigFile))
+
+	spec, err := readOCIConfigFile(ociConfigFile)
+	assert.NoError(err)
+
+	// 2GiB plus a byte
+	limit := uint64((2 * 1024 * 1024 * 1024) + 1)
+	quota := int64(150000)
+	period := uint64(100000)
+
+	spec.Linux.Resources.Memory = &specs.LinuxMemory{
+		Limit: &limit,
+	}
+
+	spec.Linux.Resources.CPU = &specs.LinuxCPU{
+		Quota:  &quota,
+		Period: &period,
+	}
+
+	_, err = createPod(spec, runtimeConfig, testContainerID, bundlePath, testConsole, true)
+	assert.NoError(err)
+
+	// VM memory is rounded up to the next MB
+	assert.Equal(uint(2049), podConfig.VMConfig.Memory)
+	assert.Equal(uint(2), podConfig.VMConfig.VCPUs)
+}
+
 func TestCreateCreateContainerContainerConfigFail(t *testing.T) {
 	assert := assert.New(t)
 
@@ -1070,6 +1488,87 @@ func TestCreateCreateContainer(t *testing.T) {
 	}
 }
 
+func TestCreateContainerEnvAndCwd(t *testing.T) {
+	assert := assert.New(t)
+
+	var cmd vc.Cmd
+
+	testingImpl.CreateContainerFunc = func(podID string, containerConfig vc.ContainerConfig) (vc.VCPod, vc.VCContainer, error) {
+		cmd = containerConfig.Cmd
+		return &vcMock.Pod{}, &vcMock.Container{}, nil
+	}
+
+	defer func() {
+		testingImpl.CreateContainerFunc = nil
+	}()
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	bundlePath := filepath.Join(tmpdir, "bundle")
+
+	err = makeOCIBundle(bundlePath)
+	assert.NoError(err)
+
+	spec, err := readOCIConfigFile(filepath.Join(bundlePath, "config.json"))
+	assert.NoError(err)
+
+	spec.Annotations = map[string]string{
+		testContainerTypeAnnotation: testContainerTypeContainer,
+		testSandboxIDAnnotation:     testPodID,
+	}
+
+	spec.Process.Env = []string{"PATH=/bin", "OPTS=a=b", "EMPTY=", "LAST=z"}
+	spec.Process.Cwd = "/srv/app"
+
+	_, err = createContainer(spec, testContainerID, bundlePath, testConsole, true)
+	assert.NoError(err)
+
+	assert.Equal([]vc.EnvVar{
+		{Var: "PATH", Value: "/bin"},
+		{Var: "OPTS", Value: "a=b"},
+		{Var: "EMPTY", Value: ""},
+		{Var: "LAST", Value: "z"},
+	}, cmd.Envs)
+	assert.Equal("/srv/app", cmd.WorkDir)
+}
+
+func TestGetPodConfigEnvAndCwd(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	runtimeConfig, err := newTestRuntimeConfig(tmpdir, testConsole, true)
+	assert.NoError(err)
+
+	bundlePath := filepath.Join(tmpdir, "bundle")
+
+	err = makeOCIBundle(bundlePath)
+	assert.NoError(err)
+
+	spec, err := readOCIConfigFile(filepath.Join(bundlePath, "config.json"))
+	assert.NoError(err)
+
+	spec.Process.Env = []string{"PATH=/bin", "OPTS=a=b", "EMPTY="}
+	spec.Process.Cwd = "/srv/app"
+
+	podConfig, err := getPodConfig(spec, runtimeConfig, testContainerID, bundlePath, testConsole, true)
+	assert.NoError(err)
+	assert.Len(podConfig.Containers, 1)
+
+	cmd := podConfig.Containers[0].Cmd
+
+	assert.Equal([]vc.EnvVar{
+		{Var: "PATH", Value: "/bin"},
+		{Var: "OPTS", Value: "a=b"},
+		{Var: "EMPTY", Value: ""},
+	}, cmd.Envs)
+	assert.Equal("/srv/app", cmd.WorkDir)
+}
+
 func TestCopyParentCPUSetFail(t *testing.T) {
 	assert := assert.New(t)
 
@@ -1119,3 +1618,283 @@ func TestCopyParentCPUSetSuccessful(t *testing.T) {
 	assert.False(isEmptyString(currentCpus))
 	assert.False(isEmptyString(currentMems))
 }
+
+func TestCPUQuotaToVCPUs(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		quota    int64
+		period   uint64
+		expected uint
+	}
+
+	data := []testData{
+		{0, 100000, 0},
+		{-1, 100000, 0},
+		{100000, 0, 0},
+		{1, 100000, 1},
+		{100000, 100000, 1},
+		{150000, 100000, 2},
+		{400000, 100000, 4},
+		{1000000000, 1000, 255},
+	}
+
+	for _, d := range data {
+		vcpus := cpuQuotaToVCPUs(d.quota, d.period)
+		assert.Equal(d.expected, vcpus, "test data: %+v", d)
+	}
+}
+
+func TestCPUSetToVCPUs(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		cpuset        string
+		expectFailure bool
+		expected      uint
+	}
+
+	data := []testData{
+		{"", false, 0},
+		{"0", false, 1},
+		{"0-3", false, 4},
+		{"0-2,6,8-9", false, 6},
+		{"1,1-2", false, 2},
+		{"0-511", false, 255},
+
+		{"a", true, 0},
+		{"3-1", true, 0},
+		{"1,", true, 0},
+	}
+
+	for _, d := range data {
+		vcpus, err := cpusetToVCPUs(d.cpuset)
+		if d.expectFailure {
+			assert.Error(err, "test data: %+v", d)
+			continue
+		}
+
+		assert.NoError(err, "test data: %+v", d)
+		assert.Equal(d.expected, vcpus, "test data: %+v", d)
+	}
+}
+
+func TestSetPodVCPUs(t *testing.T) {
+	assert := assert.New(t)
+
+	quota := int64(250000)
+	period := uint64(100000)
+
+	spec := oci.CompatOCISpec{}
+	podConfig := vc.PodConfig{}
+
+	// no linux section
+	err := setPodVCPUs(spec, &podConfig)
+	assert.NoError(err)
+	assert.Equal(uint(0), podConfig.VMConfig.VCPUs)
+
+	// no CPU resources
+	spec.Linux = &specs.Linux{Resources: &specs.LinuxResources{}}
+	err = setPodVCPUs(spec, &podConfig)
+	assert.NoError(err)
+	assert.Equal(uint(0), podConfig.VMConfig.VCPUs)
+
+	// quota without a memory limit
+	spec.Linux.Resources.CPU = &specs.LinuxCPU{
+		Quota:  &quota,
+		Period: &period,
+	}
+	err = setPodVCPUs(spec, &podConfig)
+	assert.NoError(err)
+	assert.Equal(uint(3), podConfig.VMConfig.VCPUs)
+
+	// a larger existing value is not reduced
+	podConfig.VMConfig.VCPUs = 8
+	err = setPodVCPUs(spec, &podConfig)
+	assert.NoError(err)
+	assert.Equal(uint(8), podConfig.VMConfig.VCPUs)
+
+	// the VM would boot with more vCPUs than the quota needs
+	podConfig = vc.PodConfig{
+		HypervisorConfig: vc.HypervisorConfig{DefaultVCPUs: 4},
+	}
+	err = setPodVCPUs(spec, &podConfig)
+	assert.NoError(err)
+	assert.Equal(uint(0), podConfig.VMConfig.VCPUs)
+
+	// the quota needs more vCPUs than the VM would boot with
+	podConfig.HypervisorConfig.DefaultVCPUs = 2
+	err = setPodVCPUs(spec, &podConfig)
+	assert.NoError(err)
+	assert.Equal(uint(3), podConfig.VMConfig.VCPUs)
+}
+
+func TestSetPodVCPUsCPUSet(t *testing.T) {
+	assert := assert.New(t)
+
+	quota := int64(250000)
+	period := uint64(100000)
+
+	type testData struct {
+		cpuset        string
+		withQuota     bool
+		expectFailure bool
+		expected      uint
+	}
+
+	data := []testData{
+		{"0-3", false, false, 4},
+		{"2,5", false, false, 2},
+
+		// the cpuset limits the CPUs the quota allows
+		{"0", true, false, 1},
+		{"0-1", true, false, 2},
+
+		// the quota limits the CPUs the cpuset allows
+		{"0-7", true, false, 3},
+
+		{"foo", false, true, 0},
+	}
+
+	for _, d := range data {
+		spec := oci.CompatOCISpec{
+			Spec: specs.Spec{
+				Linux: &specs.Linux{
+					Resources: &specs.LinuxResources{
+						CPU: &specs.LinuxCPU{
+							Cpus: d.cpuset,
+						},
+					},
+				},
+			},
+		}
+
+		if d.withQuota {
+			spec.Linux.Resources.CPU.Quota = &quota
+			spec.Linux.Resources.CPU.Period = &period
+		}
+
+		podConfig := vc.PodConfig{}
+
+		err := setPodVCPUs(spec, &podConfig)
+		if d.expectFailure {
+			assert.Error(err, "test data: %+v", d)
+			continue
+		}
+
+		assert.NoError(err, "test data: %+v", d)
+		assert.Equal(d.expected, podConfig.VMConfig.VCPUs, "test data: %+v", d)
+	}
+}
+
+func TestCreatePodRollback(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	savedAgentSocketDir := agentSocketDir
+	agentSocketDir = filepath.Join(tmpdir, "sockets")
+
+	savedPodRunStatePath := podRunStatePath
+	podRunStatePath = filepath.Join(tmpdir, "run")
+
+	defer func() {
+		agentSocketDir = savedAgentSocketDir
+		podRunStatePath = savedPodRunStatePath
+	}()
+
+	pod := &vcMock.Pod{
+		MockID: testContainerID,
+		MockContainers: []*vcMock.Container{
+			{MockID: testContainerID},
+		},
+	}
+
+	var deleted []string
+
+	testingImpl.CreatePodFunc = func(podConfig vc.PodConfig) (vc.VCPod, error) {
+		return pod, nil
+	}
+
+	testingImpl.DeletePodFunc = func(podID string) (vc.VCPod, error) {
+		deleted = append(deleted, podID)
+		return pod, nil
+	}
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		// No pre-existing pods
+		return []vc.PodStatus{}, nil
+	}
+
+	defer func() {
+		testingImpl.CreatePodFunc = nil
+		testingImpl.DeletePodFunc = nil
+		testingImpl.ListPodFunc = nil
+	}()
+
+	runtimeConfig, err := newTestRuntimeConfig(tmpdir, testConsole, true)
+	assert.NoError(err)
+
+	bundlePath := filepath.Join(tmpdir, "bundle")
+
+	err = makeOCIBundle(bundlePath)
+	assert.NoError(err)
+
+	ociConfigFile := filepath.Join(bundlePath, "config.json")
+
+	spec, err := readOCIConfigFile(ociConfigFile)
+	assert.NoError(err)
+
+	// pinning the vCPUs fails once the pod has been created since there
+	// is no hypervisor to ask for its vCPU threads
+	spec.Annotations = map[string]string{
+		testContainerTypeAnnotation: testContainerTypePod,
+		vcpuPinningAnnotation:       "0",
+	}
+
+	err = writeOCIConfigFile(spec, ociConfigFile)
+	assert.NoError(err)
+
+	err = create(testContainerID, bundlePath, testConsole, filepath.Join(tmpdir, "pidfile.txt"), true, runtimeConfig, consoleLogConfig{})
+	assert.Error(err)
+
+	assert.Equal([]string{testContainerID}, deleted)
+	assert.False(fileExists(filepath.Join(agentSocketDir, testContainerID)))
+}
+
+func TestCheckPodNetNS(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	netnsPath := filepath.Join(tmpdir, "netns")
+
+	ociSpec := oci.CompatOCISpec{
+		Spec: specs.Spec{
+			Linux: &specs.Linux{
+				Namespaces: []specs.LinuxNamespace{
+					{Type: specs.NetworkNamespace, Path: netnsPath},
+				},
+			},
+		},
+	}
+
+	// the network namespace does not exist
+	_, err = checkPod(ociSpec, oci.RuntimeConfig{})
+	assert.Error(err)
+
+	err = createEmptyFile(netnsPath)
+	assert.NoError(err)
+
+	setup, err := checkPod(ociSpec, oci.RuntimeConfig{})
+	assert.NoError(err)
+	assert.Equal(netnsPath, setup.netnsPath)
+	assert.Nil(setup.qos)
+	assert.Nil(setup.pinnedCPUs)
+	assert.Nil(setup.node)
+	assert.Empty(setup.pciDevices)
+}
@@ -16,14 +16,49 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	vc "github.com/containers/virtcontainers"
 	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
 )
 
+// podRunStatePath is the directory below which virtcontainers stores the
+// runtime state of each pod, such as the VM console socket.
+var podRunStatePath = "/run/virtcontainers/pods"
+
+// getPodRunPath returns the path to the specified file virtcontainers
+// creates in the runtime state directory of the specified pod. Unlike the
+// agent sockets, virtcontainers does not allow these files to be created
+// elsewhere, so they ignore the socket_dir option.
+func getPodRunPath(podID, name string) string {
+	return filepath.Join(podRunStatePath, podID, name)
+}
+
+// podStatePaths lists the directories below which virtcontainers stores
+// the state of each pod. Every pod has a sub-directory named after its ID
+// containing a sub-directory for each of its containers.
+var podStatePaths = []string{
+	"/var/lib/virtcontainers/pods",
+	podRunStatePath,
+	"/tmp/hyper/shared/pods",
+}
+
+// processExitPollInterval is how often the container process is checked
+// while waiting for it to exit.
+var processExitPollInterval = 100 * time.Millisecond
+
 var deleteCLICommand = cli.Command{
 	Name:  "delete",
 	Usage: "Delete any resources held by one or more containers",
@@ -36,11 +71,22 @@ EXAMPLE:
    status of "ubuntu01" as "stopped" the following will delete resources held
    for "ubuntu01" removing "ubuntu01" from the ` + name + ` list of containers:
 
-       # ` + name + ` delete ubuntu01`,
+       # ` + name + ` delete ubuntu01
+
+   If the container is still running or cannot be deleted cleanly (for
+   example because its VM did not shut down), --force stops it and removes
+   any state, mounts and files left behind. With --force, --timeout makes
+   a running container first be sent SIGTERM and given the specified
+   duration (for example "10s") to exit before being sent SIGKILL and
+   having its VM shut down.`,
 	Flags: []cli.Flag{
 		cli.BoolFlag{
 			Name:  "force, f",
-			Usage: "Forcibly deletes the container if it is still running (uses SIGKILL)",
+			Usage: "Forcibly deletes the container if it is still running or its resources cannot be released cleanly",
+		},
+		cli.DurationFlag{
+			Name:  "timeout, t",
+			Usage: "with --force, time to wait for a running container to exit after SIGTERM before killing it",
 		},
 	},
 	Action: func(context *cli.Context) error {
@@ -50,9 +96,32 @@ EXAMPLE:
 		}
 
 		force := context.Bool("force")
+		if context.IsSet("timeout") && !force {
+			return fmt.Errorf("--timeout requires --force")
+		}
+
+		timeout := context.Duration("timeout")
+		if timeout < 0 {
+			return fmt.Errorf("Invalid timeout %v: must not be negative", timeout)
+		}
+
 		for _, cID := range []string(args) {
+			if force && timeout > 0 {
+				if err := stopGracefully(cID, timeout); err != nil {
+					ccLog.WithError(err).WithField("container", cID).Warn("Failed to stop container gracefully")
+				}
+			}
+
 			if err := delete(cID, force); err != nil {
-				return err
+				if !force {
+					return err
+				}
+
+				ccLog.WithError(err).WithField("container", cID).Warn("Failed to delete container cleanly, removing leftover state")
+
+				if err := removeContainerState(cID); err != nil {
+					return err
+				}
 			}
 		}
 
@@ -69,6 +138,8 @@ func delete(containerID string, force bool) error {
 
 	containerID = status.ID
 
+	log := containerLogEntry(containerID, podID)
+
 	containerType, err := oci.GetContainerType(status.Annotations)
 	if err != nil {
 		return err
@@ -89,46 +160,156 @@ func delete(containerID string, force bool) error {
 		forceStop = true
 	}
 
+	// A stopped pod cannot be stopped again.
+	stopPod := status.State.State != vc.StateStopped
+
 	switch containerType {
 	case vc.PodSandbox:
-		if err := deletePod(podID); err != nil {
+		log.Debug("Deleting pod")
+
+		if err := deletePod(log, podID, stopPod, force); err != nil {
 			return err
 		}
+
+		removeNetworkQoS(ociSpec)
+		teardownPCIDevices(ociSpec)
 	case vc.PodContainer:
-		if err := deleteContainer(podID, containerID, forceStop); err != nil {
+		log.Debug("Deleting container")
+
+		if err := deleteContainer(log, podID, containerID, forceStop, force); err != nil {
 			return err
 		}
 	default:
 		return fmt.Errorf("Invalid container type found")
 	}
 
+	runPoststopHooks(ociSpec, status)
+
+	return removeContainerCgroups(log, containerID, ociSpec, containerType.IsPod())
+}
+
+// removeContainerCgroups removes the cgroups of the specified container,
+// logging with log.
+func removeContainerCgroups(log *logrus.Entry, containerID string, ociSpec oci.CompatOCISpec, isPod bool) error {
+	if systemdCgroup {
+		return removeSystemdCgroup(containerID, ociSpec)
+	}
+
 	// In order to prevent any file descriptor leak related to cgroups files
 	// that have been previously created, we have to remove them before this
 	// function returns.
-	cgroupsPathList, err := processCgroupsPath(ociSpec, containerType.IsPod())
+	cgroupsPathList, err := processCgroupsPath(ociSpec, isPod)
 	if err != nil {
 		return err
 	}
 
-	return removeCgroupsPath(containerID, cgroupsPathList)
+	return removeCgroupsPath(log, cgroupsPathList)
 }
 
-func deletePod(podID string) error {
-	if _, err := vci.StopPod(podID); err != nil {
+// processExited returns true if the specified process no longer exists
+// or is a zombie. The shim of a container is not a child of the runtime,
+// so it remains a zombie after exiting until its parent reaps it.
+func processExited(pid int) bool {
+	if syscall.Kill(pid, syscall.Signal(0)) == syscall.ESRCH {
+		return true
+	}
+
+	stat, err := ioutil.ReadFile(filepath.Join(procPath, strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return false
+	}
+
+	// The state follows the command name, which is in parentheses and
+	// may contain spaces and parentheses itself.
+	fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+
+	return len(fields) > 0 && fields[0] == "Z"
+}
+
+// waitForProcessExit waits up to timeout for the specified process to
+// exit and returns true if it did.
+func waitForProcessExit(pid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		// Without a PID, the container is given the whole timeout.
+		if pid > 0 && processExited(pid) {
+			return true
+		}
+
+		if time.Now().After(deadline) {
+			return false
+		}
+
+		time.Sleep(processExitPollInterval)
+	}
+}
+
+// stopGracefully sends SIGTERM to a running container and waits up to
+// timeout for it to exit, sending it SIGKILL if it does not. The container
+// process is the shim, which exits with the workload. The VM is left
+// running for delete to shut down.
+func stopGracefully(containerID string, timeout time.Duration) error {
+	status, podID, err := getExistingContainerInfo(containerID)
+	if err != nil {
+		return err
+	}
+
+	if oci.StateToOCIState(status.State) != oci.StateRunning {
+		return nil
+	}
+
+	if err := vci.KillContainer(podID, status.ID, syscall.SIGTERM, false); err != nil {
 		return err
 	}
 
+	if waitForProcessExit(status.PID, timeout) {
+		return nil
+	}
+
+	ccLog.WithFields(logrus.Fields{
+		"container": status.ID,
+		"timeout":   timeout,
+	}).Info("Container did not exit after SIGTERM, sending SIGKILL")
+
+	return vci.KillContainer(podID, status.ID, syscall.SIGKILL, false)
+}
+
+// deletePod deletes the specified pod, first stopping it if stop is set.
+// If force is set, failing to stop the pod is not fatal since deleting it
+// also shuts down its VM.
+func deletePod(log *logrus.Entry, podID string, stop, force bool) error {
+	// The pod annotations are only available until it is deleted.
+	socketDir := getPodAgentSocketDir(podID)
+
+	if stop {
+		if _, err := vci.StopPod(podID); err != nil {
+			if !force {
+				return err
+			}
+
+			log.WithError(err).Warn("Failed to stop pod, deleting it anyway")
+		}
+	}
+
 	if _, err := vci.DeletePod(podID); err != nil {
 		return err
 	}
 
-	return nil
+	return removeAgentSockets(socketDir)
 }
 
-func deleteContainer(podID, containerID string, forceStop bool) error {
+// deleteContainer deletes the specified container, first stopping it if
+// forceStop is set. If force is set, failing to stop the container is not
+// fatal.
+func deleteContainer(log *logrus.Entry, podID, containerID string, forceStop, force bool) error {
 	if forceStop {
 		if _, err := vci.StopContainer(podID, containerID); err != nil {
-			return err
+			if !force {
+				return err
+			}
+
+			log.WithError(err).Warn("Failed to stop container, deleting it anyway")
 		}
 	}
 
@@ -139,9 +320,9 @@ func deleteContainer(podID, containerID string, forceStop bool) error {
 	return nil
 }
 
-func removeCgroupsPath(containerID string, cgroupsPathList []string) error {
+func removeCgroupsPath(log *logrus.Entry, cgroupsPathList []string) error {
 	if len(cgroupsPathList) == 0 {
-		ccLog.WithField("container", containerID).Info("Cgroups files not removed because cgroupsPath was empty")
+		log.Info("Cgroups files not removed because cgroupsPath was empty")
 		return nil
 	}
 
@@ -153,3 +334,182 @@ func removeCgroupsPath(containerID string, cgroupsPathList []string) error {
 
 	return nil
 }
+
+// removeContainerState removes what is left behind by a container that
+// could not be deleted cleanly. If the container cannot be found,
+// containerID must be the ID of a pod which only has state left.
+func removeContainerState(containerID string) error {
+	status, podID, err := getExistingContainerInfo(containerID)
+	if err != nil {
+		podIDs, statErr := getStatePodIDs()
+		if statErr != nil {
+			return statErr
+		}
+
+		for _, id := range podIDs {
+			if id == containerID {
+				return forceDeletePod(id)
+			}
+		}
+
+		return err
+	}
+
+	containerType, err := oci.GetContainerType(status.Annotations)
+	if err != nil || containerType.IsPod() {
+		return forceDeletePod(podID)
+	}
+
+	if ociSpec, err := oci.GetOCIConfig(status); err == nil {
+		log := ccLog.WithField("container", status.ID)
+
+		if err := removeContainerCgroups(log, status.ID, ociSpec, false); err != nil {
+			log.WithError(err).Warn("Cannot remove cgroups")
+		}
+	}
+
+	return removePodState(podID, status.ID)
+}
+
+// forceDeletePod deletes a pod that could not be deleted cleanly. The pod
+// is stopped and deleted through virtcontainers if possible. Otherwise its
+// VM is killed, which also closes its connection to the proxy, and its
+// state is removed by hand. Either way, the host resources set up for the
+// pod are released.
+func forceDeletePod(podID string) error {
+	// The OCI configuration and the pod annotations are only available
+	// until the pod is deleted.
+	var ociSpec *oci.CompatOCISpec
+
+	// If virtcontainers cannot read the state of the pod, its agent
+	// sockets can only be found from the current configuration.
+	socketDir := getPodAgentSocketDir(podID)
+	if socketDir == "" && agentSocketDir != "" {
+		socketDir = filepath.Join(agentSocketDir, podID)
+	}
+
+	if status, _, err := getExistingContainerInfo(podID); err == nil {
+		if spec, err := oci.GetOCIConfig(status); err == nil {
+			ociSpec = &spec
+		}
+	}
+
+	if _, err := vci.StopPod(podID); err != nil {
+		ccLog.WithError(err).WithField("pod", podID).Info("Cannot stop pod")
+	}
+
+	if _, err := vci.DeletePod(podID); err != nil {
+		ccLog.WithError(err).WithField("pod", podID).Warn("Cannot delete pod, removing leftover state")
+
+		if err := killVM(podID); err != nil {
+			return err
+		}
+
+		if err := removePodState(podID, ""); err != nil {
+			return err
+		}
+	}
+
+	if ociSpec == nil {
+		return removeAgentSockets(socketDir)
+	}
+
+	teardownPodHostResources(podID, socketDir, *ociSpec)
+
+	return removeContainerCgroups(ccLog.WithField("container", podID), podID, *ociSpec, true)
+}
+
+// killVM kills the hypervisor process of the specified pod, if it is
+// still running.
+func killVM(podID string) error {
+	pids, err := getVMPIDs(podID)
+	if err != nil {
+		return err
+	}
+
+	for _, pid := range pids {
+		ccLog.WithFields(logrus.Fields{
+			"pod": podID,
+			"pid": pid,
+		}).Info("Killing leftover VM")
+
+		if err := syscall.Kill(pid, syscall.SIGKILL); err != nil && err != syscall.ESRCH {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getMountsBelow returns the mount points listed in the specified
+// mountinfo file that are at or below dir, deepest first.
+func getMountsBelow(mountInfoFile, dir string) ([]string, error) {
+	f, err := os.Open(mountInfoFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var mounts []string
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+
+		mountPoint := fields[4]
+		if mountPoint == dir || strings.HasPrefix(mountPoint, dir+"/") {
+			mounts = append(mounts, mountPoint)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// Unmount nested mounts before their parents.
+	sort.Sort(sort.Reverse(sort.StringSlice(mounts)))
+
+	return mounts, nil
+}
+
+// removePodState removes the state virtcontainers holds for the specified
+// container, or for the whole pod if containerID is blank, after
+// unmounting anything still mounted below it. The VM of the pod must have
+// been stopped.
+func removePodState(podID, containerID string) error {
+	for _, id := range []string{podID, containerID} {
+		if id != "" && (id != filepath.Base(id) || id == "." || id == "..") {
+			return fmt.Errorf("Invalid ID %q", id)
+		}
+	}
+
+	if podID == "" {
+		return fmt.Errorf("Missing pod ID")
+	}
+
+	for _, statePath := range podStatePaths {
+		dir := filepath.Join(statePath, podID, containerID)
+
+		mounts, err := getMountsBelow(procMountInfo, dir)
+		if err != nil {
+			return err
+		}
+
+		for _, mount := range mounts {
+			ccLog.WithField("mount", mount).Info("Unmounting leftover mount")
+
+			if err := syscall.Unmount(mount, syscall.MNT_DETACH); err != nil {
+				return err
+			}
+		}
+
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
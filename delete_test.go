@@ -15,21 +15,28 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"flag"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"syscall"
 	"testing"
+	"time"
 
 	vc "github.com/containers/virtcontainers"
 	"github.com/containers/virtcontainers/pkg/oci"
 	"github.com/containers/virtcontainers/pkg/vcMock"
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/urfave/cli"
 )
 
 func testRemoveCgroupsPathSuccessful(t *testing.T, cgroupsPathList []string) {
-	if err := removeCgroupsPath("foo", cgroupsPathList); err != nil {
+	if err := removeCgroupsPath(ccLog, cgroupsPathList); err != nil {
 		t.Fatalf("This test should succeed (cgroupsPathList = %v): %s", cgroupsPathList, err)
 	}
 }
@@ -477,6 +484,357 @@ func TestDeleteContainer(t *testing.T) {
 	assert.Nil(err)
 }
 
+func TestDeleteStoppedPod(t *testing.T) {
+	assert := assert.New(t)
+
+	pod := &vcMock.Pod{
+		MockID: testPodID,
+	}
+
+	configPath := testConfigSetup(t)
+	configJSON, err := readOCIConfigJSON(configPath)
+	assert.NoError(err)
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{
+			{
+				ID: pod.ID(),
+				ContainersStatus: []vc.ContainerStatus{
+					{
+						ID: pod.ID(),
+						Annotations: map[string]string{
+							oci.ContainerTypeKey: string(vc.PodSandbox),
+							oci.ConfigJSONKey:    configJSON,
+						},
+						State: vc.State{
+							State: vc.StateStopped,
+						},
+					},
+				},
+			},
+		}, nil
+	}
+
+	stopped := false
+
+	testingImpl.StopPodFunc = func(podID string) (vc.VCPod, error) {
+		stopped = true
+		return pod, nil
+	}
+
+	defer func() {
+		testingImpl.ListPodFunc = nil
+		testingImpl.StopPodFunc = nil
+	}()
+
+	// A stopped pod is deleted without being stopped again
+	err = delete(pod.ID(), false)
+	assert.Error(err)
+	assert.True(vcMock.IsMockError(err))
+	assert.False(stopped)
+
+	testingImpl.DeletePodFunc = func(podID string) (vc.VCPod, error) {
+		return pod, nil
+	}
+
+	defer func() {
+		testingImpl.DeletePodFunc = nil
+	}()
+
+	err = delete(pod.ID(), false)
+	assert.NoError(err)
+	assert.False(stopped)
+}
+
+func TestDeleteForceStopFail(t *testing.T) {
+	assert := assert.New(t)
+
+	pod := &vcMock.Pod{
+		MockID: testPodID,
+	}
+
+	configPath := testConfigSetup(t)
+	configJSON, err := readOCIConfigJSON(configPath)
+	assert.NoError(err)
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{
+			{
+				ID: pod.ID(),
+				ContainersStatus: []vc.ContainerStatus{
+					{
+						ID: pod.ID(),
+						Annotations: map[string]string{
+							oci.ContainerTypeKey: string(vc.PodSandbox),
+							oci.ConfigJSONKey:    configJSON,
+						},
+						State: vc.State{
+							State: vc.StateRunning,
+						},
+					},
+				},
+			},
+		}, nil
+	}
+
+	testingImpl.DeletePodFunc = func(podID string) (vc.VCPod, error) {
+		return pod, nil
+	}
+
+	defer func() {
+		testingImpl.ListPodFunc = nil
+		testingImpl.DeletePodFunc = nil
+	}()
+
+	// StopPod() fails, but the pod is still deleted
+	err = delete(pod.ID(), true)
+	assert.NoError(err)
+}
+
+// testDeleteCLIForce runs the delete command for the specified container
+// with the --force option.
+func testDeleteCLIForce(containerID string) error {
+	app := cli.NewApp()
+
+	flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+	flagSet.Bool("force", true, "")
+	flagSet.Parse([]string{containerID})
+
+	ctx := cli.NewContext(app, flagSet, nil)
+
+	fn, ok := deleteCLICommand.Action.(func(context *cli.Context) error)
+	if !ok {
+		return errors.New("invalid delete action")
+	}
+
+	return fn(ctx)
+}
+
+func TestDeleteCLIFunctionForceMissingState(t *testing.T) {
+	assert := assert.New(t)
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{}, nil
+	}
+
+	defer func() {
+		testingImpl.ListPodFunc = nil
+	}()
+
+	stateDir := filepath.Join(podStatePaths[0], testPodID)
+	err := os.MkdirAll(stateDir, testDirMode)
+	assert.NoError(err)
+	defer os.RemoveAll(stateDir)
+
+	// without force, the missing container is an error
+	err = delete(testPodID, false)
+	assert.Error(err)
+	assert.True(fileExists(stateDir))
+
+	// with force, anything left behind is removed
+	err = testDeleteCLIForce(testPodID)
+	assert.NoError(err)
+	assert.False(fileExists(stateDir))
+
+	// neither a container nor a pod
+	err = testDeleteCLIForce(testPodID)
+	assert.Error(err)
+}
+
+func TestDeleteCLIFunctionForceStuckContainer(t *testing.T) {
+	assert := assert.New(t)
+
+	pod := &vcMock.Pod{
+		MockID: testPodID,
+	}
+
+	configPath := testConfigSetup(t)
+	configJSON, err := readOCIConfigJSON(configPath)
+	assert.NoError(err)
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{
+			{
+				ID: pod.ID(),
+				ContainersStatus: []vc.ContainerStatus{
+					{
+						ID: testContainerID,
+						Annotations: map[string]string{
+							oci.ContainerTypeKey: string(vc.PodContainer),
+							oci.ConfigJSONKey:    configJSON,
+						},
+						State: vc.State{
+							State: vc.StateStopped,
+						},
+					},
+				},
+			},
+		}, nil
+	}
+
+	defer func() {
+		testingImpl.ListPodFunc = nil
+	}()
+
+	podStateDir := filepath.Join(podStatePaths[0], pod.ID())
+	stateDir := filepath.Join(podStateDir, testContainerID)
+	err = os.MkdirAll(stateDir, testDirMode)
+	assert.NoError(err)
+	defer os.RemoveAll(podStateDir)
+
+	// DeleteContainer() fails so only the state of the container is
+	// removed.
+	err = testDeleteCLIForce(testContainerID)
+	assert.NoError(err)
+	assert.False(fileExists(stateDir))
+	assert.True(fileExists(podStateDir))
+}
+
+func TestForceDeletePod(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	savedAgentSocketDir := agentSocketDir
+	agentSocketDir = tmpdir
+
+	defer func() {
+		agentSocketDir = savedAgentSocketDir
+	}()
+
+	socketDir := filepath.Join(agentSocketDir, testPodID)
+	err = os.MkdirAll(socketDir, testDirMode)
+	assert.NoError(err)
+
+	stateDir := filepath.Join(podStatePaths[0], testPodID)
+	err = os.MkdirAll(stateDir, testDirMode)
+	assert.NoError(err)
+	defer os.RemoveAll(stateDir)
+
+	stopped := false
+	deleted := false
+
+	testingImpl.StopPodFunc = func(podID string) (vc.VCPod, error) {
+		stopped = true
+		return &vcMock.Pod{MockID: podID}, nil
+	}
+
+	testingImpl.DeletePodFunc = func(podID string) (vc.VCPod, error) {
+		deleted = true
+		return &vcMock.Pod{MockID: podID}, nil
+	}
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{}, nil
+	}
+
+	defer func() {
+		testingImpl.StopPodFunc = nil
+		testingImpl.DeletePodFunc = nil
+		testingImpl.ListPodFunc = nil
+	}()
+
+	// virtcontainers deletes the pod, so its state is left alone.
+	err = forceDeletePod(testPodID)
+	assert.NoError(err)
+	assert.True(stopped)
+	assert.True(deleted)
+	assert.True(fileExists(stateDir))
+	assert.False(fileExists(socketDir))
+}
+
+func TestForceDeletePodKillVM(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	savedProcPath := procPath
+	procPath = filepath.Join(tmpdir, "proc")
+
+	defer func() {
+		procPath = savedProcPath
+	}()
+
+	// A process standing for the VM of the pod.
+	cmd := exec.Command("sleep", "60")
+	err = cmd.Start()
+	assert.NoError(err)
+
+	createFakeProcess(assert, cmd.Process.Pid, "/usr/bin/qemu-lite-system-x86_64", "-name", vmNamePrefix+testPodID)
+
+	stateDir := filepath.Join(podStatePaths[0], testPodID)
+	err = os.MkdirAll(filepath.Join(stateDir, testContainerID), testDirMode)
+	assert.NoError(err)
+	defer os.RemoveAll(stateDir)
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{}, nil
+	}
+
+	defer func() {
+		testingImpl.ListPodFunc = nil
+	}()
+
+	// StopPod() and DeletePod() fail, so the VM is killed and the state
+	// removed.
+	err = forceDeletePod(testPodID)
+	assert.NoError(err)
+	assert.False(fileExists(stateDir))
+
+	err = cmd.Wait()
+	assert.Error(err)
+}
+
+func TestRemovePodStateInvalidID(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, id := range []string{"", ".", "..", "../foo", "foo/bar"} {
+		err := removePodState(id, "")
+		assert.Error(err, "pod ID: %q", id)
+
+		if id != "" {
+			err = removePodState(testPodID, id)
+			assert.Error(err, "container ID: %q", id)
+		}
+	}
+}
+
+func TestGetMountsBelow(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	mountInfo := `22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw
+30 22 0:25 / /run/virtcontainers/pods/foo rw shared:2 - tmpfs tmpfs rw
+31 30 0:26 / /run/virtcontainers/pods/foo/bar/rootfs rw shared:3 - overlay overlay rw
+32 22 0:27 / /run/virtcontainers/pods/foobar rw shared:4 - tmpfs tmpfs rw
+`
+
+	file := filepath.Join(tmpdir, "mountinfo")
+	err = ioutil.WriteFile(file, []byte(mountInfo), testFileMode)
+	assert.NoError(err)
+
+	mounts, err := getMountsBelow(file, "/run/virtcontainers/pods/foo")
+	assert.NoError(err)
+	assert.Equal([]string{
+		"/run/virtcontainers/pods/foo/bar/rootfs",
+		"/run/virtcontainers/pods/foo",
+	}, mounts)
+
+	mounts, err = getMountsBelow(file, "/run/virtcontainers/pods/baz")
+	assert.NoError(err)
+	assert.Empty(mounts)
+
+	_, err = getMountsBelow(filepath.Join(tmpdir, "missing"), "/")
+	assert.Error(err)
+}
+
 func TestDeleteCLIFunction(t *testing.T) {
 	assert := assert.New(t)
 
@@ -501,3 +859,239 @@ func TestDeleteCLIFunction(t *testing.T) {
 	assert.Error(err)
 	assert.True(vcMock.IsMockError(err))
 }
+
+// testStopGracefullySetup starts a fake container workload and makes it
+// the running container listed by virtcontainers.
+func testStopGracefullySetup(t *testing.T) *exec.Cmd {
+	assert := assert.New(t)
+
+	cmd := exec.Command("/bin/sleep", "10")
+	err := cmd.Start()
+	assert.NoError(err)
+
+	configPath := testConfigSetup(t)
+	configJSON, err := readOCIConfigJSON(configPath)
+	assert.NoError(err)
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{
+			{
+				ID: testPodID,
+				ContainersStatus: []vc.ContainerStatus{
+					{
+						ID:  testContainerID,
+						PID: cmd.Process.Pid,
+						Annotations: map[string]string{
+							oci.ContainerTypeKey: string(vc.PodContainer),
+							oci.ConfigJSONKey:    configJSON,
+						},
+						State: vc.State{
+							State: vc.StateRunning,
+						},
+					},
+				},
+			},
+		}, nil
+	}
+
+	return cmd
+}
+
+func TestStopGracefullyEarlyExit(t *testing.T) {
+	assert := assert.New(t)
+
+	cmd := testStopGracefullySetup(t)
+
+	var signals []syscall.Signal
+
+	testingImpl.KillContainerFunc = func(podID, containerID string, signal syscall.Signal, all bool) error {
+		signals = append(signals, signal)
+
+		// the workload exits as soon as it is asked to
+		if err := cmd.Process.Signal(signal); err != nil {
+			return err
+		}
+
+		cmd.Wait()
+		return nil
+	}
+
+	defer func() {
+		testingImpl.ListPodFunc = nil
+		testingImpl.KillContainerFunc = nil
+	}()
+
+	start := time.Now()
+
+	err := stopGracefully(testContainerID, time.Minute)
+	assert.NoError(err)
+	assert.True(time.Since(start) < time.Minute)
+	assert.Equal([]syscall.Signal{syscall.SIGTERM}, signals)
+}
+
+func TestStopGracefullyTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	cmd := testStopGracefullySetup(t)
+
+	var signals []syscall.Signal
+
+	testingImpl.KillContainerFunc = func(podID, containerID string, signal syscall.Signal, all bool) error {
+		signals = append(signals, signal)
+
+		// the workload ignores SIGTERM
+		if signal != syscall.SIGKILL {
+			return nil
+		}
+
+		if err := cmd.Process.Kill(); err != nil {
+			return err
+		}
+
+		cmd.Wait()
+		return nil
+	}
+
+	savedInterval := processExitPollInterval
+	processExitPollInterval = time.Millisecond
+
+	defer func() {
+		processExitPollInterval = savedInterval
+		testingImpl.ListPodFunc = nil
+		testingImpl.KillContainerFunc = nil
+	}()
+
+	const timeout = 50 * time.Millisecond
+
+	start := time.Now()
+
+	err := stopGracefully(testContainerID, timeout)
+	assert.NoError(err)
+	assert.True(time.Since(start) >= timeout)
+	assert.Equal([]syscall.Signal{syscall.SIGTERM, syscall.SIGKILL}, signals)
+	assert.True(processExited(cmd.Process.Pid))
+}
+
+func TestStopGracefullyNotRunning(t *testing.T) {
+	assert := assert.New(t)
+
+	configPath := testConfigSetup(t)
+	configJSON, err := readOCIConfigJSON(configPath)
+	assert.NoError(err)
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{
+			{
+				ID: testPodID,
+				ContainersStatus: []vc.ContainerStatus{
+					{
+						ID: testContainerID,
+						Annotations: map[string]string{
+							oci.ContainerTypeKey: string(vc.PodContainer),
+							oci.ConfigJSONKey:    configJSON,
+						},
+						State: vc.State{
+							State: vc.StateStopped,
+						},
+					},
+				},
+			},
+		}, nil
+	}
+
+	defer func() {
+		testingImpl.ListPodFunc = nil
+	}()
+
+	// KillContainer() is not mocked, so calling it would fail
+	err = stopGracefully(testContainerID, time.Minute)
+	assert.NoError(err)
+}
+
+func TestDeleteCLIFunctionInvalidTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	fn, ok := deleteCLICommand.Action.(func(context *cli.Context) error)
+	assert.True(ok)
+
+	for _, args := range [][]string{
+		{"--timeout", "-1s", "--force", "xyz"},
+		// --timeout requires --force
+		{"--timeout", "10s", "xyz"},
+	} {
+		flagSet := flag.NewFlagSet("container-id", flag.ContinueOnError)
+		flagSet.Duration("timeout", 0, "")
+		flagSet.Bool("force", false, "")
+		flagSet.Parse(args)
+
+		ctx := cli.NewContext(cli.NewApp(), flagSet, nil)
+
+		err := fn(ctx)
+		assert.Error(err, "args: %v", args)
+		assert.False(vcMock.IsMockError(err), "args: %v", args)
+	}
+}
+
+func TestProcessExitedZombie(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.False(processExited(os.Getpid()))
+
+	// The process is not reaped until Wait() is called, so it remains
+	// a zombie once it exits.
+	cmd := exec.Command("true")
+	err := cmd.Start()
+	assert.NoError(err)
+
+	exited := false
+	for i := 0; i < 100 && !exited; i++ {
+		exited = processExited(cmd.Process.Pid)
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assert.True(exited)
+
+	err = cmd.Wait()
+	assert.NoError(err)
+	assert.True(processExited(cmd.Process.Pid))
+}
+
+func TestDeleteContainerLogEntry(t *testing.T) {
+	assert := assert.New(t)
+
+	testingImpl.StopContainerFunc = func(podID, containerID string) (vc.VCContainer, error) {
+		return nil, errors.New("stop failed")
+	}
+
+	testingImpl.DeleteContainerFunc = func(podID, containerID string) (vc.VCContainer, error) {
+		return &vcMock.Container{}, nil
+	}
+
+	defer func() {
+		testingImpl.StopContainerFunc = nil
+		testingImpl.DeleteContainerFunc = nil
+	}()
+
+	buf := &bytes.Buffer{}
+
+	logger := logrus.New()
+	logger.Out = buf
+	logger.Formatter = new(logrus.JSONFormatter)
+
+	log := logger.WithFields(logrus.Fields{
+		"container": testContainerID,
+		"pod":       testPodID,
+	})
+
+	err := deleteContainer(log, testPodID, testContainerID, true, true)
+	assert.NoError(err)
+
+	var fields map[string]interface{}
+	err = json.Unmarshal(buf.Bytes(), &fields)
+	assert.NoError(err)
+
+	// the warning is logged with the IDs
+	assert.Equal("Failed to stop container, deleting it anyway", fields["msg"])
+	assert.Equal(testContainerID, fields["container"])
+	assert.Equal(testPodID, fields["pod"])
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/containers/virtcontainers/pkg/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sirupsen/logrus"
+)
+
+// deviceRuleMatches returns true if the specified device cgroup rule
+// applies to the device.
+func deviceRuleMatches(rule specs.LinuxDeviceCgroup, d specs.LinuxDevice) bool {
+	if rule.Type != "" && rule.Type != "a" {
+		devType := d.Type
+		if devType == "u" {
+			// unbuffered character devices are character devices
+			devType = "c"
+		}
+
+		if rule.Type != devType {
+			return false
+		}
+	}
+
+	if rule.Major != nil && *rule.Major != d.Major {
+		return false
+	}
+
+	if rule.Minor != nil && *rule.Minor != d.Minor {
+		return false
+	}
+
+	return true
+}
+
+// deviceAccess returns the access the device cgroup rules give to the
+// specified device, as a set of "r", "w" and "m" flags. As with the device
+// cgroup, the rules are applied in order: a matching rule allows or denies
+// the access it lists, or all access if it lists none. All access is
+// allowed if no rule matches.
+func deviceAccess(d specs.LinuxDevice, rules []specs.LinuxDeviceCgroup) map[rune]bool {
+	access := map[rune]bool{'r': true, 'w': true, 'm': true}
+
+	for _, rule := range rules {
+		if !deviceRuleMatches(rule, d) {
+			continue
+		}
+
+		flags := rule.Access
+		if flags == "" {
+			flags = "rwm"
+		}
+
+		for _, f := range flags {
+			access[f] = rule.Allow
+		}
+	}
+
+	return access
+}
+
+// deviceAllowed returns true if the device cgroup rules allow the
+// specified device to be read or written. A device that can only be
+// created with mknod cannot be used by the container.
+func deviceAllowed(d specs.LinuxDevice, rules []specs.LinuxDeviceCgroup) bool {
+	access := deviceAccess(d, rules)
+
+	return access['r'] || access['w']
+}
+
+// filterDevices removes the devices the device cgroup rules of the OCI
+// specification deny access to, so that only the allowed devices are
+// passed to the VM by virtcontainers.
+func filterDevices(ociSpec *oci.CompatOCISpec) {
+	if ociSpec.Linux == nil || ociSpec.Linux.Resources == nil {
+		return
+	}
+
+	rules := ociSpec.Linux.Resources.Devices
+
+	var devices []specs.LinuxDevice
+
+	for _, d := range ociSpec.Linux.Devices {
+		if !deviceAllowed(d, rules) {
+			ccLog.WithFields(logrus.Fields{
+				"device": d.Path,
+				"type":   d.Type,
+				"major":  d.Major,
+				"minor":  d.Minor,
+			}).Warn("Ignoring device denied by the device cgroup rules")
+			continue
+		}
+
+		devices = append(devices, d)
+	}
+
+	ociSpec.Linux.Devices = devices
+}
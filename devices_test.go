@@ -0,0 +1,167 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testFuseDevice = specs.LinuxDevice{Path: "/dev/fuse", Type: "c", Major: 10, Minor: 229}
+	testVFIODevice = specs.LinuxDevice{Path: "/dev/vfio/1", Type: "c", Major: 246, Minor: 1}
+	testDiskDevice = specs.LinuxDevice{Path: "/dev/xvda", Type: "b", Major: 202, Minor: 0}
+)
+
+func int64Ptr(i int64) *int64 {
+	return &i
+}
+
+func TestDeviceAllowed(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		device   specs.LinuxDevice
+		rules    []specs.LinuxDeviceCgroup
+		expected bool
+	}
+
+	denyAll := specs.LinuxDeviceCgroup{Allow: false, Access: "rwm"}
+	allowFuse := specs.LinuxDeviceCgroup{Allow: true, Type: "c", Major: int64Ptr(10), Minor: int64Ptr(229), Access: "rwm"}
+	allowBlock := specs.LinuxDeviceCgroup{Allow: true, Type: "b", Access: "rwm"}
+	allowMajor := specs.LinuxDeviceCgroup{Allow: true, Type: "c", Major: int64Ptr(246), Access: "rwm"}
+
+	data := []testData{
+		// no rules
+		{testFuseDevice, nil, true},
+
+		{testFuseDevice, []specs.LinuxDeviceCgroup{denyAll}, false},
+		{testFuseDevice, []specs.LinuxDeviceCgroup{denyAll, allowFuse}, true},
+		{testFuseDevice, []specs.LinuxDeviceCgroup{allowFuse, denyAll}, false},
+		{testFuseDevice, []specs.LinuxDeviceCgroup{denyAll, allowBlock}, false},
+		{testFuseDevice, []specs.LinuxDeviceCgroup{denyAll, allowMajor}, false},
+
+		{testVFIODevice, []specs.LinuxDeviceCgroup{denyAll, allowMajor}, true},
+		{testVFIODevice, []specs.LinuxDeviceCgroup{denyAll, allowFuse}, false},
+
+		{testDiskDevice, []specs.LinuxDeviceCgroup{denyAll, allowBlock}, true},
+		{testDiskDevice, []specs.LinuxDeviceCgroup{denyAll, allowMajor}, false},
+
+		// the access flags of the rules are honoured
+		{testFuseDevice, []specs.LinuxDeviceCgroup{denyAll, {Allow: true, Type: "c", Major: int64Ptr(10), Minor: int64Ptr(229), Access: "m"}}, false},
+		{testFuseDevice, []specs.LinuxDeviceCgroup{denyAll, {Allow: true, Type: "c", Major: int64Ptr(10), Minor: int64Ptr(229), Access: "r"}}, true},
+		{testFuseDevice, []specs.LinuxDeviceCgroup{{Allow: false, Access: "w"}}, true},
+		{testFuseDevice, []specs.LinuxDeviceCgroup{{Allow: false, Access: "rw"}}, false},
+		{testFuseDevice, []specs.LinuxDeviceCgroup{allowFuse, {Allow: false, Type: "c", Access: "r"}}, true},
+		{testFuseDevice, []specs.LinuxDeviceCgroup{allowFuse, {Allow: false, Type: "c", Access: "rw"}}, false},
+
+		// a rule without access flags applies to all access
+		{testFuseDevice, []specs.LinuxDeviceCgroup{{Allow: false}}, false},
+		{testFuseDevice, []specs.LinuxDeviceCgroup{{Allow: false}, {Allow: true, Type: "c"}}, true},
+
+		// unbuffered character devices match character device rules
+		{specs.LinuxDevice{Path: "/dev/fuse", Type: "u", Major: 10, Minor: 229}, []specs.LinuxDeviceCgroup{denyAll, allowFuse}, true},
+	}
+
+	for _, d := range data {
+		assert.Equal(d.expected, deviceAllowed(d.device, d.rules), "test data: %+v", d)
+	}
+}
+
+func TestDeviceAccess(t *testing.T) {
+	assert := assert.New(t)
+
+	rules := []specs.LinuxDeviceCgroup{
+		{Allow: false, Access: "rwm"},
+		{Allow: true, Type: "c", Major: int64Ptr(10), Access: "rw"},
+		{Allow: false, Type: "c", Major: int64Ptr(10), Minor: int64Ptr(229), Access: "w"},
+	}
+
+	assert.Equal(map[rune]bool{'r': true, 'w': false, 'm': false}, deviceAccess(testFuseDevice, rules))
+	assert.Equal(map[rune]bool{'r': false, 'w': false, 'm': false}, deviceAccess(testDiskDevice, rules))
+	assert.Equal(map[rune]bool{'r': true, 'w': true, 'm': true}, deviceAccess(testDiskDevice, nil))
+}
+
+func TestFilterDevices(t *testing.T) {
+	assert := assert.New(t)
+
+	// no linux section
+	var ociSpec oci.CompatOCISpec
+	filterDevices(&ociSpec)
+
+	// no device cgroup rules
+	ociSpec.Linux = &specs.Linux{
+		Devices: []specs.LinuxDevice{testFuseDevice, testVFIODevice},
+	}
+	filterDevices(&ociSpec)
+	assert.Equal([]specs.LinuxDevice{testFuseDevice, testVFIODevice}, ociSpec.Linux.Devices)
+
+	ociSpec.Linux.Devices = []specs.LinuxDevice{testFuseDevice, testVFIODevice, testDiskDevice}
+	ociSpec.Linux.Resources = &specs.LinuxResources{
+		Devices: []specs.LinuxDeviceCgroup{
+			{Allow: false, Access: "rwm"},
+			{Allow: true, Type: "c", Major: int64Ptr(246), Minor: int64Ptr(1), Access: "rwm"},
+			{Allow: true, Type: "b", Major: int64Ptr(202), Access: "rw"},
+		},
+	}
+	filterDevices(&ociSpec)
+	assert.Equal([]specs.LinuxDevice{testVFIODevice, testDiskDevice}, ociSpec.Linux.Devices)
+}
+
+func TestFilterDevicesContainerConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	bundlePath := filepath.Join(tmpdir, "bundle")
+
+	err = makeOCIBundle(bundlePath)
+	assert.NoError(err)
+
+	ociSpec, err := readOCIConfigFile(filepath.Join(bundlePath, "config.json"))
+	assert.NoError(err)
+
+	ociSpec.Linux.Devices = []specs.LinuxDevice{testFuseDevice, testVFIODevice}
+	ociSpec.Linux.Resources = &specs.LinuxResources{
+		Devices: []specs.LinuxDeviceCgroup{
+			{Allow: false, Access: "rwm"},
+			{Allow: true, Type: "c", Major: int64Ptr(246), Access: "rwm"},
+		},
+	}
+
+	filterDevices(&ociSpec)
+
+	config, err := oci.ContainerConfig(ociSpec, bundlePath, testContainerID, "", true)
+	assert.NoError(err)
+
+	// only the allowed device is passed to virtcontainers
+	assert.Equal([]vc.DeviceInfo{
+		{
+			ContainerPath: testVFIODevice.Path,
+			DevType:       testVFIODevice.Type,
+			Major:         testVFIODevice.Major,
+			Minor:         testVFIODevice.Minor,
+		},
+	}, config.DeviceInfos)
+}
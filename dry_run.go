@@ -0,0 +1,206 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+)
+
+// dryRunVMInfo describes the VM "create --dry-run" would boot.
+type dryRunVMInfo struct {
+	VCPUs        uint
+	MemoryMB     uint
+	Kernel       string
+	Image        string
+	KernelParams string
+	NetNS        string   `toml:",omitempty"`
+	NetworkRate  string   `toml:",omitempty"`
+	NetworkCeil  string   `toml:",omitempty"`
+	NetworkBurst string   `toml:",omitempty"`
+	PCIDevices   []string `toml:",omitempty"`
+	VCPUPinning  []int    `toml:",omitempty"`
+	NUMANode     *int     `toml:",omitempty"`
+	OOMScoreAdj  *int     `toml:",omitempty"`
+}
+
+// dryRunInfo describes what "create --dry-run" would do.
+type dryRunInfo struct {
+	ContainerID   string
+	ContainerType string
+	PodID         string
+	Bundle        string
+	Rootfs        string
+	Args          []string
+	Devices       []string      `toml:",omitempty"`
+	CgroupsPaths  []string      `toml:",omitempty"`
+	SystemdScope  string        `toml:",omitempty"`
+	VM            *dryRunVMInfo `toml:",omitempty"`
+}
+
+// dryRunPod runs the checks createPod runs before creating a pod and
+// returns the VM that would be booted.
+func dryRunPod(ociSpec oci.CompatOCISpec, runtimeConfig oci.RuntimeConfig,
+	containerID, bundlePath, console string, disableOutput bool) (dryRunVMInfo, error) {
+	setup, err := checkPod(ociSpec, runtimeConfig)
+	if err != nil {
+		return dryRunVMInfo{}, err
+	}
+
+	// The PCI devices are only checked: binding them to vfio-pci would
+	// take them away from the host.
+	podConfig, err := getCreatePodConfig(ociSpec, runtimeConfig, setup, containerID, bundlePath, console, disableOutput)
+	if err != nil {
+		return dryRunVMInfo{}, err
+	}
+
+	hypervisorConfig := podConfig.HypervisorConfig
+
+	vm := dryRunVMInfo{
+		VCPUs:        podConfig.VMConfig.VCPUs,
+		MemoryMB:     podConfig.VMConfig.Memory,
+		Kernel:       hypervisorConfig.KernelPath,
+		Image:        hypervisorConfig.ImagePath,
+		KernelParams: strings.Join(vc.SerializeParams(hypervisorConfig.KernelParams, "="), " "),
+		NetNS:        setup.netnsPath,
+		PCIDevices:   setup.pciDevices,
+	}
+
+	// virtcontainers uses the defaults unless the resources are
+	// specified.
+	if vm.VCPUs == 0 {
+		vm.VCPUs = uint(hypervisorConfig.DefaultVCPUs)
+	}
+
+	if vm.MemoryMB == 0 {
+		vm.MemoryMB = uint(hypervisorConfig.DefaultMemSz)
+	}
+
+	pinnedCPUs := setup.pinnedCPUs
+
+	if setup.node != nil {
+		vm.NUMANode = &setup.node.ID
+		pinnedCPUs = setup.node.CPUs
+	}
+
+	vm.VCPUPinning = vcpuPinning(pinnedCPUs, int(vm.VCPUs))
+
+	vm.OOMScoreAdj, err = getOOMScoreAdj(ociSpec)
+	if err != nil {
+		return dryRunVMInfo{}, err
+	}
+
+	if setup.qos != nil {
+		vm.NetworkRate = setup.qos.rate
+		vm.NetworkCeil = setup.qos.ceil
+		vm.NetworkBurst = setup.qos.burst
+	}
+
+	return vm, nil
+}
+
+// dryRunContainer checks that the pod a container would be created in
+// exists and returns its ID.
+func dryRunContainer(ociSpec oci.CompatOCISpec) (string, error) {
+	podID, err := ociSpec.PodID()
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := vci.StatusPod(podID); err != nil {
+		return "", fmt.Errorf("Cannot create container in pod %v: %v", podID, err)
+	}
+
+	return podID, nil
+}
+
+// dryRunCreate runs the same checks as create but, rather than creating
+// the container, displays what would be created.
+func dryRunCreate(containerID, bundlePath, console string, runtimeConfig oci.RuntimeConfig) error {
+	ociSpec, bundlePath, err := getCreateSpec(containerID, bundlePath)
+	if err != nil {
+		return err
+	}
+
+	containerType, err := ociSpec.ContainerType()
+	if err != nil {
+		return err
+	}
+
+	if err := checkConsole(console, ociSpec.Process.Terminal); err != nil {
+		return err
+	}
+
+	if err := checkRuntimeFiles(runtimeConfig, containerType.IsPod()); err != nil {
+		return err
+	}
+
+	disableOutput := noNeedForOutput(true, ociSpec.Process.Terminal)
+
+	contConfig, err := oci.ContainerConfig(ociSpec, bundlePath, containerID, console, disableOutput)
+	if err != nil {
+		return err
+	}
+
+	info := dryRunInfo{
+		ContainerID:   containerID,
+		ContainerType: string(containerType),
+		Bundle:        bundlePath,
+		Rootfs:        contConfig.RootFs,
+		Args:          ociSpec.Process.Args,
+	}
+
+	for _, d := range contConfig.DeviceInfos {
+		info.Devices = append(info.Devices, d.ContainerPath)
+	}
+
+	switch containerType {
+	case vc.PodSandbox:
+		vm, err := dryRunPod(ociSpec, runtimeConfig, containerID, bundlePath, console, disableOutput)
+		if err != nil {
+			return err
+		}
+
+		info.PodID = containerID
+		info.VM = &vm
+	case vc.PodContainer:
+		info.PodID, err = dryRunContainer(ociSpec)
+		if err != nil {
+			return err
+		}
+	}
+
+	if systemdCgroup {
+		slice, unit, err := getSystemdScope(ociSpec)
+		if err != nil {
+			return err
+		}
+
+		if unit != "" {
+			info.SystemdScope = slice + "/" + unit
+		}
+	} else {
+		info.CgroupsPaths, err = processCgroupsPath(ociSpec, containerType.IsPod())
+		if err != nil {
+			return err
+		}
+	}
+
+	return toml.NewEncoder(defaultOutputFile).Encode(info)
+}
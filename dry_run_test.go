@@ -0,0 +1,327 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// testDryRunCreate runs "create --dry-run" for the bundle and returns
+// the details displayed.
+func testDryRunCreate(assert *assert.Assertions, tmpdir, bundlePath string, runtimeConfig oci.RuntimeConfig) (dryRunInfo, error) {
+	outputFile := filepath.Join(tmpdir, "output")
+
+	f, err := os.Create(outputFile)
+	assert.NoError(err)
+
+	savedOutputFile := defaultOutputFile
+	defaultOutputFile = f
+
+	defer func() {
+		defaultOutputFile = savedOutputFile
+	}()
+
+	err = dryRunCreate(testContainerID, bundlePath, testConsole, runtimeConfig)
+	f.Close()
+
+	if err != nil {
+		return dryRunInfo{}, err
+	}
+
+	var info dryRunInfo
+
+	_, err = toml.DecodeFile(outputFile, &info)
+	assert.NoError(err)
+
+	return info, nil
+}
+
+func TestDryRunCreatePod(t *testing.T) {
+	assert := assert.New(t)
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		// No pre-existing pods
+		return []vc.PodStatus{}, nil
+	}
+
+	testingImpl.CreatePodFunc = func(podConfig vc.PodConfig) (vc.VCPod, error) {
+		return nil, errors.New("dry-run must not create a pod")
+	}
+
+	defer func() {
+		testingImpl.ListPodFunc = nil
+		testingImpl.CreatePodFunc = nil
+	}()
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	defer setTestHostMemory(assert, tmpdir)()
+
+	runtimeConfig, err := newTestRuntimeConfig(tmpdir, testConsole, true)
+	assert.NoError(err)
+
+	bundlePath := filepath.Join(tmpdir, "bundle")
+
+	err = makeOCIBundle(bundlePath)
+	assert.NoError(err)
+
+	ociConfigFile := filepath.Join(bundlePath, "config.json")
+
+	spec, err := readOCIConfigFile(ociConfigFile)
+	assert.NoError(err)
+
+	spec.Annotations = map[string]string{
+		memoryAnnotation:      "512",
+		vcpuPinningAnnotation: "0",
+	}
+
+	err = writeOCIConfigFile(spec, ociConfigFile)
+	assert.NoError(err)
+
+	info, err := testDryRunCreate(assert, tmpdir, bundlePath, runtimeConfig)
+	assert.NoError(err)
+
+	assert.Equal(testContainerID, info.ContainerID)
+	assert.Equal(string(vc.PodSandbox), info.ContainerType)
+	assert.Equal(testContainerID, info.PodID)
+	assert.Equal(bundlePath, info.Bundle)
+	assert.Equal(filepath.Join(bundlePath, spec.Root.Path), info.Rootfs)
+	assert.Equal(spec.Process.Args, info.Args)
+
+	assert.NotNil(info.VM)
+	assert.Equal(uint(512), info.VM.MemoryMB)
+	assert.Equal(runtimeConfig.HypervisorConfig.KernelPath, info.VM.Kernel)
+	assert.Equal(runtimeConfig.HypervisorConfig.ImagePath, info.VM.Image)
+	assert.Contains(info.VM.KernelParams, "init=/usr/lib/systemd/systemd")
+	assert.Len(info.VM.VCPUPinning, int(info.VM.VCPUs))
+}
+
+func TestDryRunCreatePodFail(t *testing.T) {
+	assert := assert.New(t)
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		// No pre-existing pods
+		return []vc.PodStatus{}, nil
+	}
+
+	defer func() {
+		testingImpl.ListPodFunc = nil
+	}()
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	runtimeConfig, err := newTestRuntimeConfig(tmpdir, testConsole, true)
+	assert.NoError(err)
+
+	bundlePath := filepath.Join(tmpdir, "bundle")
+
+	err = makeOCIBundle(bundlePath)
+	assert.NoError(err)
+
+	ociConfigFile := filepath.Join(bundlePath, "config.json")
+
+	spec, err := readOCIConfigFile(ociConfigFile)
+	assert.NoError(err)
+
+	// invalid annotation
+	spec.Annotations = map[string]string{
+		vcpusAnnotation: "0",
+	}
+
+	err = writeOCIConfigFile(spec, ociConfigFile)
+	assert.NoError(err)
+
+	_, err = testDryRunCreate(assert, tmpdir, bundlePath, runtimeConfig)
+	assert.Error(err)
+
+	// missing network namespace
+	spec.Annotations = nil
+
+	for i, n := range spec.Linux.Namespaces {
+		if n.Type == specs.NetworkNamespace {
+			spec.Linux.Namespaces[i].Path = filepath.Join(tmpdir, "netns")
+		}
+	}
+
+	err = writeOCIConfigFile(spec, ociConfigFile)
+	assert.NoError(err)
+
+	_, err = testDryRunCreate(assert, tmpdir, bundlePath, runtimeConfig)
+	assert.Error(err)
+
+	// missing PCI device
+	savedDevicesPath := sysBusPCIDevicesPath
+	sysBusPCIDevicesPath = filepath.Join(tmpdir, "devices")
+
+	defer func() {
+		sysBusPCIDevicesPath = savedDevicesPath
+	}()
+
+	err = createEmptyFile(filepath.Join(tmpdir, "netns"))
+	assert.NoError(err)
+
+	spec.Annotations = map[string]string{
+		pciDeviceAnnotation: testBDF,
+	}
+
+	err = writeOCIConfigFile(spec, ociConfigFile)
+	assert.NoError(err)
+
+	_, err = testDryRunCreate(assert, tmpdir, bundlePath, runtimeConfig)
+	assert.Error(err)
+
+	// all good
+	spec.Annotations = nil
+
+	err = writeOCIConfigFile(spec, ociConfigFile)
+	assert.NoError(err)
+
+	info, err := testDryRunCreate(assert, tmpdir, bundlePath, runtimeConfig)
+	assert.NoError(err)
+	assert.Equal(filepath.Join(tmpdir, "netns"), info.VM.NetNS)
+}
+
+func TestDryRunCreateContainer(t *testing.T) {
+	assert := assert.New(t)
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		// No pre-existing pods
+		return []vc.PodStatus{}, nil
+	}
+
+	testingImpl.StatusPodFunc = func(podID string) (vc.PodStatus, error) {
+		return vc.PodStatus{}, errors.New("pod does not exist")
+	}
+
+	defer func() {
+		testingImpl.ListPodFunc = nil
+		testingImpl.StatusPodFunc = nil
+	}()
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	runtimeConfig, err := newTestRuntimeConfig(tmpdir, testConsole, true)
+	assert.NoError(err)
+
+	bundlePath := filepath.Join(tmpdir, "bundle")
+
+	err = makeOCIBundle(bundlePath)
+	assert.NoError(err)
+
+	ociConfigFile := filepath.Join(bundlePath, "config.json")
+
+	spec, err := readOCIConfigFile(ociConfigFile)
+	assert.NoError(err)
+
+	spec.Annotations = map[string]string{
+		testContainerTypeAnnotation: testContainerTypeContainer,
+		testSandboxIDAnnotation:     testPodID,
+	}
+
+	err = writeOCIConfigFile(spec, ociConfigFile)
+	assert.NoError(err)
+
+	// the pod does not exist
+	_, err = testDryRunCreate(assert, tmpdir, bundlePath, runtimeConfig)
+	assert.Error(err)
+
+	testingImpl.StatusPodFunc = func(podID string) (vc.PodStatus, error) {
+		return vc.PodStatus{ID: podID}, nil
+	}
+
+	info, err := testDryRunCreate(assert, tmpdir, bundlePath, runtimeConfig)
+	assert.NoError(err)
+	assert.Equal(string(vc.PodContainer), info.ContainerType)
+	assert.Equal(testPodID, info.PodID)
+	assert.Nil(info.VM)
+}
+
+func TestDryRunCreateSystemdCgroup(t *testing.T) {
+	assert := assert.New(t)
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		// No pre-existing pods
+		return []vc.PodStatus{}, nil
+	}
+
+	defer func() {
+		testingImpl.ListPodFunc = nil
+	}()
+
+	savedSystemdCgroup := systemdCgroup
+	systemdCgroup = true
+
+	defer func() {
+		systemdCgroup = savedSystemdCgroup
+	}()
+
+	calls, restore := setTestSystemdCall(nil)
+	defer restore()
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	runtimeConfig, err := newTestRuntimeConfig(tmpdir, testConsole, true)
+	assert.NoError(err)
+
+	bundlePath := filepath.Join(tmpdir, "bundle")
+
+	err = makeOCIBundle(bundlePath)
+	assert.NoError(err)
+
+	ociConfigFile := filepath.Join(bundlePath, "config.json")
+
+	spec, err := readOCIConfigFile(ociConfigFile)
+	assert.NoError(err)
+
+	// a cgroupfs path
+	spec.Linux.CgroupsPath = "/foo/bar"
+
+	err = writeOCIConfigFile(spec, ociConfigFile)
+	assert.NoError(err)
+
+	_, err = testDryRunCreate(assert, tmpdir, bundlePath, runtimeConfig)
+	assert.Error(err)
+
+	spec.Linux.CgroupsPath = "system.slice:cc:" + testContainerID
+
+	err = writeOCIConfigFile(spec, ociConfigFile)
+	assert.NoError(err)
+
+	info, err := testDryRunCreate(assert, tmpdir, bundlePath, runtimeConfig)
+	assert.NoError(err)
+	assert.Equal("system.slice/cc-"+testContainerID+".scope", info.SystemdScope)
+	assert.Empty(info.CgroupsPaths)
+
+	// nothing is created
+	assert.Empty(*calls)
+}
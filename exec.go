@@ -24,7 +24,6 @@ import (
 
 	vc "github.com/containers/virtcontainers"
 	"github.com/containers/virtcontainers/pkg/oci"
-	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/urfave/cli"
 )
 
@@ -156,9 +155,12 @@ func generateExecParams(context *cli.Context, specProcess *oci.CompatOCIProcess)
 
 		// Override user
 		if context.String("user") != "" {
-			params.ociProcess.User = specs.User{
-				Username: context.String("user"),
+			user, err := parseUserOption(context.String("user"))
+			if err != nil {
+				return execParams{}, err
 			}
+
+			params.ociProcess.User = user
 		}
 
 		// Override env
@@ -192,6 +194,8 @@ func execute(context *cli.Context) error {
 		return err
 	}
 
+	log := containerLogEntry(status.ID, podID)
+
 	// Retrieve OCI spec configuration.
 	ociSpec, err := oci.GetOCIConfig(status)
 	if err != nil {
@@ -210,31 +214,39 @@ func execute(context *cli.Context) error {
 		return fmt.Errorf("Container %s is not running", params.cID)
 	}
 
-	envVars, err := oci.EnvVars(params.ociProcess.Env)
+	consolePath, err := setupConsole(params.console, params.consoleSock)
 	if err != nil {
 		return err
 	}
 
-	consolePath, err := setupConsole(params.console, params.consoleSock)
-	if err != nil {
+	if err := checkConsole(consolePath, params.ociProcess.Terminal); err != nil {
+		return err
+	}
+
+	if err := validateUser(params.ociProcess.User); err != nil {
 		return err
 	}
 
 	cmd := vc.Cmd{
 		Args:        params.ociProcess.Args,
-		Envs:        envVars,
+		Envs:        getEnvVars(params.ociProcess.Env),
 		WorkDir:     params.ociProcess.Cwd,
-		User:        params.ociProcess.User.Username,
 		Interactive: params.ociProcess.Terminal,
 		Console:     consolePath,
 		Detach:      noNeedForOutput(params.detach, params.ociProcess.Terminal),
 	}
 
+	setCmdUser(&cmd, params.ociProcess.User)
+
+	log.WithField("args", cmd.Args).Debug("Executing process in container")
+
 	_, _, process, err := vci.EnterContainer(podID, params.cID, cmd)
 	if err != nil {
 		return err
 	}
 
+	log.WithField("pid", process.Pid).Debug("Process started in container")
+
 	// Creation of PID file has to be the last thing done in the exec
 	// because containerd considers the exec to have finished starting
 	// after this file is created.
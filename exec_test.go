@@ -15,6 +15,7 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"io/ioutil"
 	"os"
@@ -515,7 +516,7 @@ func TestExecuteWithValidProcessJson(t *testing.T) {
 	assert.Equal(exitErr.ExitCode(), 0, "Exit code should have been 0 for fake workload %s", workload)
 }
 
-func TestExecuteWithInvalidEnvironment(t *testing.T) {
+func TestExecuteEnvAndCwd(t *testing.T) {
 	assert := assert.New(t)
 
 	tmpdir, err := ioutil.TempDir("", "")
@@ -552,8 +553,12 @@ func TestExecuteWithInvalidEnvironment(t *testing.T) {
 
 	processJSON := `{
 				"env": [
-					"TERM="
-				]
+					"PATH=/bin:/usr/bin",
+					"TERM=",
+					"OPTS=--foo=bar --baz",
+					"NAME=' quoted '"
+				],
+				"cwd": "/srv/app"
 			}`
 
 	f, err := os.OpenFile(processPath, os.O_RDWR|os.O_CREATE, testFileMode)
@@ -568,10 +573,30 @@ func TestExecuteWithInvalidEnvironment(t *testing.T) {
 	fn, ok := execCLICommand.Action.(func(context *cli.Context) error)
 	assert.True(ok)
 
-	// oci.EnvVars error due to incorrect environment
+	var envs []vc.EnvVar
+	var workDir string
+
+	testingImpl.EnterContainerFunc = func(podID, containerID string, cmd vc.Cmd) (vc.VCPod, vc.VCContainer, *vc.Process, error) {
+		envs = cmd.Envs
+		workDir = cmd.WorkDir
+		return nil, nil, nil, errors.New("enter failure")
+	}
+
+	defer func() {
+		testingImpl.EnterContainerFunc = nil
+	}()
+
 	err = fn(ctx)
 	assert.Error(err)
-	assert.False(vcMock.IsMockError(err))
+
+	// the environment is passed in order and unmodified
+	assert.Equal([]vc.EnvVar{
+		{Var: "PATH", Value: "/bin:/usr/bin"},
+		{Var: "TERM", Value: ""},
+		{Var: "OPTS", Value: "--foo=bar --baz"},
+		{Var: "NAME", Value: "' quoted '"},
+	}, envs)
+	assert.Equal("/srv/app", workDir)
 }
 
 func TestGenerateExecParams(t *testing.T) {
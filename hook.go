@@ -0,0 +1,142 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"time"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sirupsen/logrus"
+)
+
+// OCI hooks are run with the state of the container, as returned by the
+// "state" command, on their standard input. The PID in the state is the
+// PID of the container's shim since the container process itself runs
+// inside the VM.
+//
+// The prestart hooks of the pod sandbox are run by virtcontainers when the
+// pod is created since they need to run inside the pod network namespace
+// before the network is added to the VM. No VM or shim is running yet, and
+// virtcontainers only passes them the PID of the runtime (see
+// docs/limitations.md). All other hooks are run by the runtime.
+
+// runHook runs the specified OCI hook, passing it the container state.
+func runHook(hook specs.Hook, state specs.State) error {
+	stateJSON, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := &exec.Cmd{
+		Path:   hook.Path,
+		Args:   hook.Args,
+		Env:    hook.Env,
+		Stdin:  bytes.NewReader(stateJSON),
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+
+	go func() { done <- cmd.Wait() }()
+
+	var timeout <-chan time.Time
+	if hook.Timeout != nil && *hook.Timeout > 0 {
+		timeout = time.After(time.Duration(*hook.Timeout) * time.Second)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("hook %v failed: %v: stdout: %s, stderr: %s",
+				hook.Path, err, stdout.String(), stderr.String())
+		}
+	case <-timeout:
+		_ = cmd.Process.Kill()
+		return fmt.Errorf("hook %v timed out after %d seconds", hook.Path, *hook.Timeout)
+	}
+
+	return nil
+}
+
+// runHooks runs the specified hooks in order, stopping at the first
+// failure.
+func runHooks(hooks []specs.Hook, state specs.State, hookType string) error {
+	for _, hook := range hooks {
+		ccLog.WithFields(logrus.Fields{
+			"hook": hookType,
+			"path": hook.Path,
+		}).Debug("Running hook")
+
+		if err := runHook(hook, state); err != nil {
+			ccLog.WithField("hook", hookType).Error(err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// runPrestartHooks runs the prestart hooks of a container that is part of
+// a pod. A failure prevents the container from being started.
+func runPrestartHooks(ociSpec oci.CompatOCISpec, status vc.ContainerStatus) error {
+	if ociSpec.Hooks == nil {
+		return nil
+	}
+
+	return runHooks(ociSpec.Hooks.Prestart, statusToOCIState(status), "prestart")
+}
+
+// runPoststartHooks runs the poststart hooks of a container once it has
+// been started. Failures are logged but are not fatal.
+func runPoststartHooks(ociSpec oci.CompatOCISpec, status vc.ContainerStatus) {
+	if ociSpec.Hooks == nil {
+		return
+	}
+
+	state := statusToOCIState(status)
+	state.Status = oci.StateRunning
+
+	for _, hook := range ociSpec.Hooks.Poststart {
+		_ = runHooks([]specs.Hook{hook}, state, "poststart")
+	}
+}
+
+// runPoststopHooks runs the poststop hooks of a container once it has been
+// deleted. Failures are logged but are not fatal.
+func runPoststopHooks(ociSpec oci.CompatOCISpec, status vc.ContainerStatus) {
+	if ociSpec.Hooks == nil {
+		return
+	}
+
+	state := statusToOCIState(status)
+	state.Status = oci.StateStopped
+
+	for _, hook := range ociSpec.Hooks.Poststop {
+		_ = runHooks([]specs.Hook{hook}, state, "poststop")
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/containers/virtcontainers/pkg/vcMock"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+const testHookMode = os.FileMode(0750)
+
+// createTestHook creates an executable shell script hook in the specified
+// directory.
+func createTestHook(dir, name, script string) (specs.Hook, error) {
+	path := filepath.Join(dir, name)
+
+	err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), testHookMode)
+	if err != nil {
+		return specs.Hook{}, err
+	}
+
+	return specs.Hook{
+		Path: path,
+		Args: []string{name},
+	}, nil
+}
+
+func TestRunHook(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	stateFile := filepath.Join(tmpdir, "state.json")
+
+	hook, err := createTestHook(tmpdir, "hook", "cat > "+stateFile)
+	assert.NoError(err)
+
+	state := specs.State{
+		Version: specs.Version,
+		ID:      testContainerID,
+		Status:  oci.StateCreated,
+		Pid:     testPID,
+		Bundle:  tmpdir,
+	}
+
+	err = runHook(hook, state)
+	assert.NoError(err)
+
+	data, err := ioutil.ReadFile(stateFile)
+	assert.NoError(err)
+
+	var hookState specs.State
+	err = json.Unmarshal(data, &hookState)
+	assert.NoError(err)
+	assert.Equal(state, hookState)
+}
+
+func TestRunHookFail(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	// hook does not exist
+	err = runHook(specs.Hook{Path: filepath.Join(tmpdir, "hook")}, specs.State{})
+	assert.Error(err)
+
+	hook, err := createTestHook(tmpdir, "hook", "exit 1")
+	assert.NoError(err)
+
+	err = runHook(hook, specs.State{})
+	assert.Error(err)
+}
+
+func TestRunHookTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	hook, err := createTestHook(tmpdir, "hook", "sleep 5")
+	assert.NoError(err)
+
+	timeout := 1
+	hook.Timeout = &timeout
+
+	err = runHook(hook, specs.State{})
+	assert.Error(err)
+}
+
+func TestStartPrestartHookFail(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	pod := &vcMock.Pod{
+		MockID: testPodID,
+	}
+
+	pod.MockContainers = []*vcMock.Container{
+		{
+			MockID:  testContainerID,
+			MockPod: pod,
+		},
+	}
+
+	configPath := testConfigSetup(t)
+	spec, err := readOCIConfigFile(configPath)
+	assert.NoError(err)
+
+	hook, err := createTestHook(tmpdir, "prestart", "exit 1")
+	assert.NoError(err)
+
+	spec.Hooks = &specs.Hooks{
+		Prestart: []specs.Hook{hook},
+	}
+
+	err = writeOCIConfigFile(spec, configPath)
+	assert.NoError(err)
+
+	configJSON, err := readOCIConfigJSON(configPath)
+	assert.NoError(err)
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{
+			{
+				ID: pod.ID(),
+				ContainersStatus: []vc.ContainerStatus{
+					{
+						ID: testContainerID,
+						Annotations: map[string]string{
+							oci.ContainerTypeKey: string(vc.PodContainer),
+							oci.ConfigJSONKey:    configJSON,
+						},
+					},
+				},
+			},
+		}, nil
+	}
+
+	started := false
+
+	testingImpl.StartContainerFunc = func(podID, containerID string) (vc.VCContainer, error) {
+		started = true
+		return pod.MockContainers[0], nil
+	}
+
+	defer func() {
+		testingImpl.ListPodFunc = nil
+		testingImpl.StartContainerFunc = nil
+	}()
+
+	_, err = start(testContainerID)
+	assert.Error(err)
+	assert.False(vcMock.IsMockError(err))
+	assert.False(started)
+
+	// A failing poststart hook does not cause start to fail
+	spec.Hooks = &specs.Hooks{
+		Poststart: []specs.Hook{hook},
+	}
+
+	err = writeOCIConfigFile(spec, configPath)
+	assert.NoError(err)
+
+	configJSON, err = readOCIConfigJSON(configPath)
+	assert.NoError(err)
+
+	_, err = start(testContainerID)
+	assert.NoError(err)
+	assert.True(started)
+}
@@ -0,0 +1,37 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+)
+
+// maxHostnameLen is the maximum length of a Linux hostname
+// (HOST_NAME_MAX).
+const maxHostnameLen = 64
+
+// checkHostname validates the hostname of the specified OCI
+// configuration, which the agent sets in the VM when the pod starts. An
+// empty hostname leaves the default hostname of the guest image.
+//
+// XXX: virtcontainers silently truncates hostnames that are too long,
+// so they are rejected instead.
+func checkHostname(hostname string) error {
+	if len(hostname) > maxHostnameLen {
+		return fmt.Errorf("Invalid hostname %q: longer than %d characters", hostname, maxHostnameLen)
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/vcMock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckHostname(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(checkHostname(""))
+	assert.NoError(checkHostname("foo"))
+	assert.NoError(checkHostname(strings.Repeat("a", maxHostnameLen)))
+	assert.Error(checkHostname(strings.Repeat("a", maxHostnameLen+1)))
+}
+
+func TestCreateHostname(t *testing.T) {
+	assert := assert.New(t)
+
+	pod := &vcMock.Pod{
+		MockID: testPodID,
+		MockContainers: []*vcMock.Container{
+			{MockID: testContainerID},
+		},
+	}
+
+	var hostnames []string
+
+	testingImpl.CreatePodFunc = func(podConfig vc.PodConfig) (vc.VCPod, error) {
+		hostnames = append(hostnames, podConfig.Hostname)
+		return pod, nil
+	}
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		// No pre-existing pods
+		return []vc.PodStatus{}, nil
+	}
+
+	defer func() {
+		testingImpl.CreatePodFunc = nil
+		testingImpl.ListPodFunc = nil
+	}()
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	runtimeConfig, err := newTestRuntimeConfig(tmpdir, testConsole, true)
+	assert.NoError(err)
+
+	bundlePath := filepath.Join(tmpdir, "bundle")
+
+	err = makeOCIBundle(bundlePath)
+	assert.NoError(err)
+
+	ociConfigFile := filepath.Join(bundlePath, "config.json")
+
+	spec, err := readOCIConfigFile(ociConfigFile)
+	assert.NoError(err)
+
+	spec.Annotations = map[string]string{
+		testContainerTypeAnnotation: testContainerTypePod,
+	}
+
+	pidFilePath := filepath.Join(tmpdir, "pidfile.txt")
+
+	for _, hostname := range []string{"myhost", ""} {
+		spec.Hostname = hostname
+
+		err = writeOCIConfigFile(spec, ociConfigFile)
+		assert.NoError(err)
+
+		err = create(testContainerID, bundlePath, testConsole, pidFilePath, true, runtimeConfig, consoleLogConfig{})
+		assert.NoError(err, "hostname: %q", hostname)
+
+		os.Remove(pidFilePath)
+	}
+
+	assert.Equal([]string{"myhost", ""}, hostnames)
+
+	// too long
+	spec.Hostname = strings.Repeat("a", maxHostnameLen+1)
+
+	err = writeOCIConfigFile(spec, ociConfigFile)
+	assert.NoError(err)
+
+	err = create(testContainerID, bundlePath, testConsole, pidFilePath, true, runtimeConfig, consoleLogConfig{})
+	assert.Error(err)
+	assert.Len(hostnames, 2)
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// imageChecksumPrefix is the optional prefix of the image_checksum option.
+const imageChecksumPrefix = "sha256:"
+
+// imageChecksum is the SHA-256 digest of the guest image, in hexadecimal,
+// set by the image_checksum option of the hypervisor configuration. If it
+// is set, the image is verified before booting a VM.
+var imageChecksum = ""
+
+// parseImageChecksum returns the hexadecimal SHA-256 digest specified by
+// value, which may be prefixed with "sha256:".
+func parseImageChecksum(value string) (string, error) {
+	checksum := strings.ToLower(strings.TrimPrefix(value, imageChecksumPrefix))
+
+	if len(checksum) != 2*sha256.Size {
+		return "", fmt.Errorf("Invalid SHA-256 checksum %q: expected %d hexadecimal digits", value, 2*sha256.Size)
+	}
+
+	if _, err := hex.DecodeString(checksum); err != nil {
+		return "", fmt.Errorf("Invalid SHA-256 checksum %q: %v", value, err)
+	}
+
+	return checksum, nil
+}
+
+// getFileChecksum returns the hexadecimal SHA-256 digest of the
+// specified file.
+func getFileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// verifyImage checks the guest image at the specified path matches
+// imageChecksum, if it is set.
+func verifyImage(path string) error {
+	if imageChecksum == "" {
+		return nil
+	}
+
+	checksum, err := getFileChecksum(path)
+	if err != nil {
+		return fmt.Errorf("Cannot verify image %v: %v", path, err)
+	}
+
+	if checksum != imageChecksum {
+		return fmt.Errorf("Image %v does not match image_checksum: expected %s%s, got %s%s",
+			path, imageChecksumPrefix, imageChecksum, imageChecksumPrefix, checksum)
+	}
+
+	ccLog.WithField("image", path).Debug("Verified image checksum")
+
+	return nil
+}
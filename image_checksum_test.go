@@ -0,0 +1,167 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/vcMock"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	// testImageData is the content of the test image.
+	testImageData = "abc"
+
+	// testImageChecksum is the SHA-256 digest of testImageData.
+	testImageChecksum = "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+
+	// testOtherChecksum is the SHA-256 digest of an empty file.
+	testOtherChecksum = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+func TestParseImageChecksum(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		value         string
+		expectFailure bool
+		expected      string
+	}
+
+	data := []testData{
+		{testImageChecksum, false, testImageChecksum},
+		{imageChecksumPrefix + testImageChecksum, false, testImageChecksum},
+		{strings.ToUpper(testImageChecksum), false, testImageChecksum},
+
+		{"", true, ""},
+		{imageChecksumPrefix, true, ""},
+		{testImageChecksum[1:], true, ""},
+		{testImageChecksum + "0", true, ""},
+		{"g" + testImageChecksum[1:], true, ""},
+		{"md5:" + testImageChecksum, true, ""},
+	}
+
+	for i, d := range data {
+		checksum, err := parseImageChecksum(d.value)
+		if d.expectFailure {
+			assert.Error(err, "test %d (%+v)", i, d)
+			continue
+		}
+
+		assert.NoError(err, "test %d (%+v)", i, d)
+		assert.Equal(d.expected, checksum, "test %d (%+v)", i, d)
+	}
+}
+
+func TestVerifyImage(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	image := filepath.Join(tmpdir, "image")
+
+	err = ioutil.WriteFile(image, []byte(testImageData), testFileMode)
+	assert.NoError(err)
+
+	checksum, err := getFileChecksum(image)
+	assert.NoError(err)
+	assert.Equal(testImageChecksum, checksum)
+
+	savedImageChecksum := imageChecksum
+	defer func() {
+		imageChecksum = savedImageChecksum
+	}()
+
+	// verification disabled
+	imageChecksum = ""
+	assert.NoError(verifyImage(image))
+	assert.NoError(verifyImage(filepath.Join(tmpdir, "missing")))
+
+	// match
+	imageChecksum = testImageChecksum
+	assert.NoError(verifyImage(image))
+
+	// mismatch
+	imageChecksum = testOtherChecksum
+	err = verifyImage(image)
+	assert.Error(err)
+	assert.Contains(err.Error(), "does not match image_checksum")
+
+	// missing image
+	imageChecksum = testImageChecksum
+	assert.Error(verifyImage(filepath.Join(tmpdir, "missing")))
+}
+
+func TestCreatePodImageChecksum(t *testing.T) {
+	assert := assert.New(t)
+
+	testingImpl.CreatePodFunc = func(config vc.PodConfig) (vc.VCPod, error) {
+		return &vcMock.Pod{
+			MockID: testPodID,
+			MockContainers: []*vcMock.Container{
+				{MockID: testContainerID},
+			},
+		}, nil
+	}
+
+	savedImageChecksum := imageChecksum
+
+	defer func() {
+		testingImpl.CreatePodFunc = nil
+		imageChecksum = savedImageChecksum
+	}()
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	runtimeConfig, err := newTestRuntimeConfig(tmpdir, testConsole, true)
+	assert.NoError(err)
+
+	// the fixture image
+	err = ioutil.WriteFile(runtimeConfig.HypervisorConfig.ImagePath, []byte(testImageData), testFileMode)
+	assert.NoError(err)
+
+	bundlePath := filepath.Join(tmpdir, "bundle")
+
+	err = makeOCIBundle(bundlePath)
+	assert.NoError(err)
+
+	spec, err := readOCIConfigFile(filepath.Join(bundlePath, "config.json"))
+	assert.NoError(err)
+
+	imageChecksum = testImageChecksum
+
+	_, err = createPod(spec, runtimeConfig, testContainerID, bundlePath, testConsole, true)
+	assert.NoError(err)
+
+	// the VM is not booted
+	testingImpl.CreatePodFunc = nil
+
+	imageChecksum = testOtherChecksum
+
+	_, err = createPod(spec, runtimeConfig, testContainerID, bundlePath, testConsole, true)
+	assert.Error(err)
+	assert.False(vcMock.IsMockError(err))
+	assert.Contains(err.Error(), "does not match image_checksum")
+}
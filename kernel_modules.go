@@ -0,0 +1,58 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	vc "github.com/containers/virtcontainers"
+)
+
+// modulesLoadParam is the guest kernel parameter systemd reads the list of
+// kernel modules to load at boot from. It can be specified several times.
+const modulesLoadParam = "modules-load"
+
+// kernelModuleRegex matches the name of a kernel module. Paths are not
+// allowed since the modules are loaded from the guest image.
+var kernelModuleRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// parseKernelModules validates the specified kernel module names and
+// returns them without any surrounding whitespace.
+func parseKernelModules(modules []string) ([]string, error) {
+	var names []string
+
+	for _, module := range modules {
+		name := strings.TrimSpace(module)
+
+		if !kernelModuleRegex.MatchString(name) {
+			return nil, fmt.Errorf("Invalid kernel module %q: expected the name of a module in the guest image", module)
+		}
+
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+// kernelModulesParam returns the guest kernel parameter that loads the
+// specified kernel modules when the VM boots.
+func kernelModulesParam(modules []string) vc.Param {
+	return vc.Param{
+		Key:   modulesLoadParam,
+		Value: strings.Join(modules, ","),
+	}
+}
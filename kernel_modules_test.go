@@ -0,0 +1,65 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseKernelModules(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		modules       []string
+		expectFailure bool
+		expected      []string
+	}
+
+	data := []testData{
+		{nil, false, nil},
+		{[]string{"overlay"}, false, []string{"overlay"}},
+		{[]string{"overlay", "nf_conntrack", "br-netfilter"}, false, []string{"overlay", "nf_conntrack", "br-netfilter"}},
+		{[]string{" overlay ", "\tnf_conntrack"}, false, []string{"overlay", "nf_conntrack"}},
+
+		{[]string{""}, true, nil},
+		{[]string{"overlay", " "}, true, nil},
+		{[]string{"/lib/modules/foo.ko"}, true, nil},
+		{[]string{"foo.ko"}, true, nil},
+		{[]string{"foo bar"}, true, nil},
+		{[]string{"foo,bar"}, true, nil},
+	}
+
+	for _, d := range data {
+		modules, err := parseKernelModules(d.modules)
+		if d.expectFailure {
+			assert.Error(err, "test data: %+v", d)
+			continue
+		}
+
+		assert.NoError(err, "test data: %+v", d)
+		assert.Equal(d.expected, modules, "test data: %+v", d)
+	}
+}
+
+func TestKernelModulesParam(t *testing.T) {
+	assert := assert.New(t)
+
+	p := kernelModulesParam([]string{"overlay", "nf_conntrack"})
+	assert.Equal(vc.Param{Key: "modules-load", Value: "overlay,nf_conntrack"}, p)
+	assert.Equal([]string{"modules-load=overlay,nf_conntrack"}, vc.SerializeParams([]vc.Param{p}, "="))
+}
@@ -18,9 +18,11 @@ package main
 import (
 	"fmt"
 	"strconv"
+	"strings"
 	"syscall"
 
 	vc "github.com/containers/virtcontainers"
+	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
 )
 
@@ -106,6 +108,8 @@ func kill(containerID, signal string, all bool) error {
 
 	containerID = status.ID
 
+	log := containerLogEntry(containerID, podID)
+
 	signum, err := processSignal(signal)
 	if err != nil {
 		return err
@@ -116,17 +120,29 @@ func kill(containerID, signal string, all bool) error {
 		return fmt.Errorf("Container %s not ready or running, cannot send a signal", containerID)
 	}
 
-	return vci.KillContainer(podID, containerID, signum, all)
+	log.WithFields(logrus.Fields{
+		"signal": signum,
+		"all":    all,
+	}).Debug("Sending signal to container")
+
+	// Sending the signal again is harmless if the connection to the
+	// agent was lost.
+	return withAgentReconnect(log, podID, nil, func() error {
+		return vci.KillContainer(podID, containerID, signum, all)
+	})
 }
 
 func processSignal(signal string) (syscall.Signal, error) {
-	signum, signalOk := signals[signal]
+	// Signal names are not case sensitive
+	name := strings.ToUpper(signal)
+
+	signum, signalOk := signals[name]
 	if signalOk {
 		return signum, nil
 	}
 
 	// Support for short name signals (INT)
-	signum, signalOk = signals["SIG"+signal]
+	signum, signalOk = signals["SIG"+name]
 	if signalOk {
 		return signum, nil
 	}
@@ -134,7 +150,7 @@ func processSignal(signal string) (syscall.Signal, error) {
 	// Support for numeric signals
 	s, err := strconv.Atoi(signal)
 	if err != nil {
-		return 0, fmt.Errorf("Failed to convert signal %s to int", signal)
+		return 0, fmt.Errorf("Unknown signal name %q", signal)
 	}
 
 	signum = syscall.Signal(s)
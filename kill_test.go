@@ -42,6 +42,16 @@ func TestProcessSignal(t *testing.T) {
 		{"SIGTERM", true, syscall.SIGTERM},
 		{"TERM", true, syscall.SIGTERM},
 		{"15", true, syscall.SIGTERM},
+		{"sigterm", true, syscall.SIGTERM},
+		{"term", true, syscall.SIGTERM},
+		{"SigKill", true, syscall.SIGKILL},
+		{"Kill", true, syscall.SIGKILL},
+		{"9", true, syscall.SIGKILL},
+		{"usr1", true, syscall.SIGUSR1},
+		{"SIGUSR2", true, syscall.SIGUSR2},
+		{"", false, 0},
+		{"SIG", false, 0},
+		{"-1", false, 0},
 	}
 
 	for _, test := range tests {
@@ -58,6 +68,15 @@ func TestProcessSignal(t *testing.T) {
 	}
 }
 
+func TestProcessSignalUnknownName(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := processSignal("foo")
+	assert.Error(err)
+	assert.Contains(err.Error(), `"foo"`)
+	assert.NotContains(err.Error(), "int")
+}
+
 func TestKillCLIFunctionSuccessful(t *testing.T) {
 	assert := assert.New(t)
 
@@ -67,9 +67,11 @@ type hypervisorDetails struct {
 // details
 type fullContainerState struct {
 	containerState
+	PodID                    string            `json:"podID"`
 	CurrentHypervisorDetails hypervisorDetails `json:"currentHypervisor"`
 	LatestHypervisorDetails  hypervisorDetails `json:"latestHypervisor"`
 	StaleAssets              []string
+	NUMANode                 string `json:"numaNode,omitempty"`
 }
 
 type formatState interface {
@@ -82,19 +84,15 @@ type formatTabular struct{}
 
 var listCLICommand = cli.Command{
 	Name:  "list",
-	Usage: "lists containers started by " + name + " with the given root",
+	Usage: "lists containers started by " + name,
 	ArgsUsage: `
 
-Where the given root is specified via the global option "--root"
-(default: "` + defaultRootDirectory + `").
+All the containers are listed: the global option "--root" is accepted for
+compatibility with runc but ignored.
 
-EXAMPLE 1:
-To list containers created via the default "--root":
-       # ` + name + ` list
-
-EXAMPLE 2:
-To list containers created using a non-default value for "--root":
-       # ` + name + ` --root value list`,
+EXAMPLE:
+To list the containers:
+       # ` + name + ` list`,
 	Flags: []cli.Flag{
 		cli.StringFlag{
 			Name:  "format, f",
@@ -185,7 +183,7 @@ func (f *formatTabular) Write(state []fullContainerState, showAll bool, file *os
 	fmt.Fprint(w, "ID\tPID\tSTATUS\tBUNDLE\tCREATED\tOWNER")
 
 	if showAll {
-		fmt.Fprint(w, "\tHYPERVISOR\tKERNEL\tIMAGE\tLATEST-KERNEL\tLATEST-IMAGE\tSTALE\n")
+		fmt.Fprint(w, "\tPOD\tHYPERVISOR\tKERNEL\tIMAGE\tLATEST-KERNEL\tLATEST-IMAGE\tSTALE\n")
 	} else {
 		fmt.Fprintf(w, "\n")
 	}
@@ -208,7 +206,8 @@ func (f *formatTabular) Write(state []fullContainerState, showAll bool, file *os
 			current := item.CurrentHypervisorDetails
 			latest := item.LatestHypervisorDetails
 
-			fmt.Fprintf(w, "\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			fmt.Fprintf(w, "\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				item.PodID,
 				current.HypervisorPath,
 				current.KernelPath,
 				current.ImagePath,
@@ -277,7 +276,7 @@ func getContainers(context *cli.Context) ([]fullContainerState, error) {
 		}
 
 		for _, container := range pod.ContainersStatus {
-			ociState := oci.StatusToOCIState(container)
+			ociState := statusToOCIState(container)
 			staleAssets := getStaleAssets(currentHypervisorDetails, latestHypervisorDetails)
 
 			uid, err := getDirOwner(container.RootFs)
@@ -299,9 +298,11 @@ func getContainers(context *cli.Context) ([]fullContainerState, error) {
 					Annotations:    ociState.Annotations,
 					Owner:          owner,
 				},
+				PodID:                    pod.ID,
 				CurrentHypervisorDetails: currentHypervisorDetails,
 				LatestHypervisorDetails:  latestHypervisorDetails,
 				StaleAssets:              staleAssets,
+				NUMANode:                 pod.Annotations[numaNodeAnnotation],
 			})
 		}
 	}
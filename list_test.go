@@ -69,6 +69,7 @@ var testStatuses = []fullContainerState{
 			Owner:          "#0",
 		},
 
+		PodID:                    "pod1",
 		CurrentHypervisorDetails: hypervisorDetails1,
 		LatestHypervisorDetails:  hypervisorDetails1,
 		StaleAssets:              []string{},
@@ -85,6 +86,7 @@ var testStatuses = []fullContainerState{
 			Owner:          "#0",
 		},
 
+		PodID:                    "pod2",
 		CurrentHypervisorDetails: hypervisorDetails2,
 		LatestHypervisorDetails:  hypervisorDetails2,
 		StaleAssets:              []string{},
@@ -101,6 +103,7 @@ var testStatuses = []fullContainerState{
 			Owner:          "#0",
 		},
 
+		PodID:                    "pod2",
 		CurrentHypervisorDetails: hypervisorDetails3,
 		LatestHypervisorDetails:  hypervisorDetails3,
 		StaleAssets:              []string{},
@@ -180,7 +183,7 @@ func TestStateToTabular(t *testing.T) {
 	expectedLength := len(testStatuses) + 1
 
 	expectedDefaultHeaderPattern := `\AID\s+PID\s+STATUS\s+BUNDLE\s+CREATED\s+OWNER`
-	expectedExtendedHeaderPattern := `HYPERVISOR\s+KERNEL\s+IMAGE\s+LATEST-KERNEL\s+LATEST-IMAGE\s+STALE`
+	expectedExtendedHeaderPattern := `POD\s+HYPERVISOR\s+KERNEL\s+IMAGE\s+LATEST-KERNEL\s+LATEST-IMAGE\s+STALE`
 	endingPattern := `\s*\z`
 
 	lines, err := formatListDataAsString(&formatTabular{}, testStatuses, false)
@@ -262,13 +265,14 @@ func TestStateToTabular(t *testing.T) {
 		lineIndex := i + 1
 		line := lines[lineIndex]
 
-		expectedLinePattern := fmt.Sprintf(`\A%s\s+%d\s+%s\s+%s\s+%s\s+%s\s+%s\s+%s\s+%s\s+%s\s+%s\s+%s\s*\z`,
+		expectedLinePattern := fmt.Sprintf(`\A%s\s+%d\s+%s\s+%s\s+%s\s+%s\s+%s\s+%s\s+%s\s+%s\s+%s\s+%s\s+%s\s*\z`,
 			regexp.QuoteMeta(status.ID),
 			status.InitProcessPid,
 			regexp.QuoteMeta(status.Status),
 			regexp.QuoteMeta(status.Bundle),
 			regexp.QuoteMeta(status.Created.Format(time.RFC3339Nano)),
 			regexp.QuoteMeta(status.Owner),
+			regexp.QuoteMeta(status.PodID),
 			regexp.QuoteMeta(status.CurrentHypervisorDetails.HypervisorPath),
 			regexp.QuoteMeta(status.CurrentHypervisorDetails.KernelPath),
 			regexp.QuoteMeta(status.CurrentHypervisorDetails.ImagePath),
@@ -497,8 +501,11 @@ func TestListGetContainersPodWithContainer(t *testing.T) {
 		"runtimeConfig": runtimeConfig,
 	}
 
-	_, err = getContainers(ctx)
+	state, err := getContainers(ctx)
 	assert.NoError(err)
+	assert.Len(state, 1)
+	assert.Equal(pod.ID(), state[0].ID)
+	assert.Equal(pod.ID(), state[0].PodID)
 }
 
 func TestListCLIFunctionFormatFail(t *testing.T) {
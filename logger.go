@@ -50,6 +50,28 @@ var (
 	errNeedGlobalLogPath = errors.New("Global log path cannot be empty")
 )
 
+// logLevels maps the log level names accepted by the runtime to the
+// corresponding logrus levels. logrus has no trace level so "trace" is
+// treated as "debug", the most verbose level available.
+var logLevels = map[string]logrus.Level{
+	"trace": logrus.DebugLevel,
+	"debug": logrus.DebugLevel,
+	"info":  logrus.InfoLevel,
+	"warn":  logrus.WarnLevel,
+	"error": logrus.ErrorLevel,
+}
+
+// parseLogLevel returns the logrus level corresponding to the specified
+// log level name.
+func parseLogLevel(name string) (logrus.Level, error) {
+	level, ok := logLevels[strings.ToLower(name)]
+	if !ok {
+		return logrus.InfoLevel, fmt.Errorf("Invalid log level %q (valid levels: trace, debug, info, warn, error)", name)
+	}
+
+	return level, nil
+}
+
 // GlobalLogHook represents a "global logfile" that is appended to by all
 // runtimes.
 //
@@ -59,9 +81,14 @@ var (
 // global log can be specified in a location distinct from such
 // container-specific paths to provide a persistent log of all runtime
 // activity, including debugging failures.
+//
+// By default, entries are written to the global log in a fixed text
+// format. If the runtime has been asked to log in JSON format, the
+// global log uses JSON too.
 type GlobalLogHook struct {
-	path string
-	file *os.File
+	path      string
+	file      *os.File
+	formatter logrus.Formatter
 }
 
 // handleGlobalLog sets up the global logger.
@@ -98,11 +125,35 @@ func handleGlobalLog(logfilePath string) error {
 		return err
 	}
 
+	if formatter, ok := ccLog.Logger.Formatter.(*logrus.JSONFormatter); ok {
+		hook.formatter = formatter
+	}
+
 	ccLog.Logger.Hooks.Add(hook)
 
 	return nil
 }
 
+// containerLogEntry returns a log entry holding the container and pod IDs,
+// for the command operating on that container to log with. virtcontainers
+// is made to log with it as well, and the IDs are added to the trace.
+//
+// The sandbox ID is logged as "pod", the name virtcontainers and the
+// other log entries of the runtime use for it.
+func containerLogEntry(containerID, podID string) *logrus.Entry {
+	log := ccLog.WithFields(logrus.Fields{
+		"container": containerID,
+		"pod":       podID,
+	})
+
+	vci.SetLogger(log)
+
+	setTraceTag("container", containerID)
+	setTraceTag("pod", podID)
+
+	return log
+}
+
 // newGlobalLogHook creates a new hook that can be used by a logrus
 // logger.
 func newGlobalLogHook(logfilePath string) (*GlobalLogHook, error) {
@@ -151,6 +202,10 @@ func formatFields(fields map[string]interface{}) string {
 // Fire is called by the logrus logger when data is available for the
 // hook.
 func (hook *GlobalLogHook) Fire(entry *logrus.Entry) error {
+	if hook.formatter != nil {
+		return hook.fireJSON(entry)
+	}
+
 	// Ignore any formatter that has been used and log in a custom format
 	// to the global log.
 
@@ -179,3 +234,27 @@ func (hook *GlobalLogHook) Fire(entry *logrus.Entry) error {
 
 	return nil
 }
+
+// fireJSON writes the entry to the global log using the hook's JSON
+// formatter, adding the same "pid" and "name" fields as the text format.
+func (hook *GlobalLogHook) fireJSON(entry *logrus.Entry) error {
+	fields := logrus.Fields{
+		"pid":  os.Getpid(),
+		"name": name,
+	}
+
+	for k, v := range entry.Data {
+		fields[k] = v
+	}
+
+	jsonEntry := *entry
+	jsonEntry.Data = fields
+
+	bytes, err := hook.formatter.Format(&jsonEntry)
+	if err != nil {
+		return err
+	}
+
+	_, err = hook.file.Write(bytes)
+	return err
+}
@@ -15,12 +15,15 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 
@@ -243,3 +246,123 @@ func TestLoggerFire(t *testing.T) {
 	err = ccLog.Logger.Hooks.Fire(logrus.InfoLevel, entry)
 	assert.Error(t, err)
 }
+
+func TestHandleGlobalLogJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	savedLog := ccLog
+	defer func() {
+		ccLog = savedLog
+	}()
+
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.Formatter = new(logrus.JSONFormatter)
+	ccLog = logger.WithField("source", "runtime")
+
+	logFile := path.Join(tmpdir, "global.log")
+	err = handleGlobalLog(logFile)
+	assert.NoError(err)
+
+	str := "hello. foo bar baz!"
+	ccLog.WithField("container", testContainerID).Info(str)
+
+	data, err := ioutil.ReadFile(logFile)
+	assert.NoError(err)
+
+	var fields map[string]interface{}
+	err = json.Unmarshal(data, &fields)
+	assert.NoError(err)
+
+	for _, key := range []string{"time", "level", "msg", "source", "container", "pid", "name"} {
+		assert.Contains(fields, key)
+	}
+
+	assert.Equal("info", fields["level"])
+	assert.Equal(str, fields["msg"])
+	assert.Equal("runtime", fields["source"])
+	assert.Equal(testContainerID, fields["container"])
+	assert.Equal(name, fields["name"])
+}
+
+func TestContainerLogEntry(t *testing.T) {
+	assert := assert.New(t)
+
+	savedLog := ccLog
+	defer func() {
+		ccLog = savedLog
+		vci.SetLogger(ccLog)
+	}()
+
+	buf := &bytes.Buffer{}
+
+	logger := logrus.New()
+	logger.Out = buf
+	logger.Formatter = new(logrus.JSONFormatter)
+	ccLog = logger.WithField("source", "runtime")
+
+	log := containerLogEntry(testContainerID, testPodID)
+
+	ccLog.Info("global")
+	log.Info("container")
+	log.WithField("foo", "bar").Info("container with fields")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(lines, 3)
+
+	for i, line := range lines {
+		var fields map[string]interface{}
+		err := json.Unmarshal([]byte(line), &fields)
+		assert.NoError(err)
+
+		assert.Equal("runtime", fields["source"])
+
+		// ccLog itself is not modified
+		if i == 0 {
+			assert.NotContains(fields, "container")
+			assert.NotContains(fields, "pod")
+			continue
+		}
+
+		assert.Equal(testContainerID, fields["container"])
+		assert.Equal(testPodID, fields["pod"])
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		name          string
+		expectedLevel logrus.Level
+		expectFailure bool
+	}
+
+	data := []testData{
+		{"", logrus.InfoLevel, true},
+		{"foo", logrus.InfoLevel, true},
+		{"panic", logrus.InfoLevel, true},
+		{"trace", logrus.DebugLevel, false},
+		{"debug", logrus.DebugLevel, false},
+		{"Debug", logrus.DebugLevel, false},
+		{"info", logrus.InfoLevel, false},
+		{"warn", logrus.WarnLevel, false},
+		{"error", logrus.ErrorLevel, false},
+		{"ERROR", logrus.ErrorLevel, false},
+	}
+
+	for _, d := range data {
+		level, err := parseLogLevel(d.name)
+		if d.expectFailure {
+			assert.Error(err, "test data: %+v", d)
+			continue
+		}
+
+		assert.NoError(err, "test data: %+v", d)
+		assert.Equal(d.expectedLevel, level, "test data: %+v", d)
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"strings"
 
 	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
@@ -73,6 +74,9 @@ var defaultOutputFile = os.Stdout
 // messages to.
 var defaultErrorFile = os.Stderr
 
+// defaultInputFile is the default file to read input from.
+var defaultInputFile = os.Stdin
+
 // runtimeFlags is the list of supported global command-line flags
 var runtimeFlags = []cli.Flag{
 	cli.StringFlag{
@@ -89,10 +93,30 @@ var runtimeFlags = []cli.Flag{
 		Value: "text",
 		Usage: "set the format used by logs ('text' (default), or 'json')",
 	},
+	cli.StringFlag{
+		Name:  "log-level",
+		Usage: "set the log level ('trace', 'debug', 'info', 'warn' or 'error'), overriding the config file",
+	},
 	cli.StringFlag{
 		Name:  "root",
 		Value: defaultRootDirectory,
-		Usage: "root directory for storage of container state (this should be located in tmpfs)",
+		Usage: "ignored, accepted for compatibility with runc (the container state is always stored by virtcontainers)",
+	},
+	cli.DurationFlag{
+		Name:  "timeout",
+		Usage: "maximum time to wait for the agent to respond when creating or starting a pod (e.g. \"30s\", or 0 to wait forever), overriding the config file",
+	},
+	cli.BoolFlag{
+		Name:  "trace",
+		Usage: "trace the phases of the command, sending the spans to the trace_endpoint of the config file or logging them",
+	},
+	cli.BoolFlag{
+		Name:  "systemd-cgroup",
+		Usage: "enable systemd cgroup support, expects cgroupsPath to be of form \"slice:prefix:name\" for e.g. \"system.slice:cc:434234\"",
+	},
+	cli.BoolFlag{
+		Name:  "ignore-spec-version",
+		Usage: "create containers whatever the OCI version (ociVersion) of their bundle",
 	},
 	cli.BoolFlag{
 		Name:  "cc-show-default-config-paths",
@@ -117,7 +141,13 @@ var runtimeCommands = []cli.Command{
 
 	// Clear Containers specific extensions
 	ccCheckCLICommand,
+	ccConfigCLICommand,
 	ccEnvCLICommand,
+	ccInspectCLICommand,
+	ccPruneCLICommand,
+
+	// Internal commands
+	consoleLogCLICommand,
 }
 
 // runtimeBeforeSubcommands is the function to run before command-line
@@ -165,11 +195,13 @@ func beforeSubcommands(context *cli.Context) error {
 		exit(0)
 	}
 
-	if userWantsUsage(context) || (context.NArg() == 1 && (context.Args()[0] == "cc-check")) {
+	if userWantsUsage(context) || context.Args().First() == "cc-check" ||
+		context.Args().First() == "cc-config" {
 		// No setup required if the user just
 		// wants to see the usage statement or are
 		// running a command that does not manipulate
-		// containers.
+		// containers. "cc-config" in particular must
+		// work when no config file exists yet.
 		return nil
 	}
 
@@ -190,18 +222,59 @@ func beforeSubcommands(context *cli.Context) error {
 		return fmt.Errorf("unknown log-format %q", context.GlobalString("log-format"))
 	}
 
+	var logLevel *logrus.Level
+	if levelName := context.GlobalString("log-level"); levelName != "" {
+		level, err := parseLogLevel(levelName)
+		if err != nil {
+			return err
+		}
+		logLevel = &level
+	}
+
+	systemdCgroup = context.GlobalBool("systemd-cgroup")
+	ignoreSpecVersion = context.GlobalBool("ignore-spec-version")
+
 	// Set virtcontainers logger.
 	vci.SetLogger(ccLog)
 
 	ignoreLogging := false
-	if context.NArg() == 1 && context.Args()[0] == "cc-env" {
+	if context.Args().First() == "cc-env" {
 		// "cc-env" should simply report the logging setup
 		ignoreLogging = true
 	}
 
-	configFile, logfilePath, runtimeConfig, err := loadConfiguration(context.GlobalString("cc-config"), ignoreLogging)
-	if err != nil {
-		fatal(err)
+	// "cc-env --config" loads the specified config file itself, which
+	// must work even if the default one is missing or invalid.
+	loadConfig := !(ignoreLogging && ccEnvConfigSpecified(context.Args().Tail()))
+
+	var configFile, logfilePath string
+	var runtimeConfig oci.RuntimeConfig
+
+	if loadConfig {
+		var err error
+
+		configFile, logfilePath, runtimeConfig, err = loadConfiguration(context.GlobalString("cc-config"), ignoreLogging)
+		if err != nil {
+			fatal(err)
+		}
+	}
+
+	if logLevel != nil {
+		// The command-line takes priority over the config file.
+		ccLog.Logger.Level = *logLevel
+	}
+
+	if context.GlobalIsSet("timeout") {
+		timeout := context.GlobalDuration("timeout")
+		if timeout < 0 {
+			return fmt.Errorf("Invalid agent timeout %v", timeout)
+		}
+
+		agentTimeout = timeout
+	}
+
+	if context.GlobalBool("trace") {
+		startTracing(newSpanExporter(traceEndpoint))
 	}
 
 	args := strings.Join(context.Args(), " ")
@@ -215,6 +288,10 @@ func beforeSubcommands(context *cli.Context) error {
 
 	ccLog.WithFields(fields).Info()
 
+	if !loadConfig {
+		return nil
+	}
+
 	// make the data accessible to the sub-commands.
 	context.App.Metadata = map[string]interface{}{
 		"runtimeConfig": runtimeConfig,
@@ -225,6 +302,34 @@ func beforeSubcommands(context *cli.Context) error {
 	return nil
 }
 
+// ccEnvConfigSpecified returns true if the specified arguments of the
+// "cc-env" command set its --config option to a file. The command options
+// are only parsed after beforeSubcommands() has run.
+func ccEnvConfigSpecified(args []string) bool {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+
+		fields := strings.SplitN(strings.TrimLeft(arg, "-"), "=", 2)
+		if fields[0] != "config" {
+			continue
+		}
+
+		if len(fields) == 2 {
+			return fields[1] != ""
+		}
+
+		return i+1 < len(args) && args[i+1] != ""
+	}
+
+	return false
+}
+
 // function called when an invalid command is specified which causes the
 // runtime to error.
 func commandNotFound(c *cli.Context, command string) {
@@ -100,6 +100,12 @@ func init() {
 
 	fmt.Printf("INFO: test directory is %v\n", testDir)
 
+	// Ensure forced deletes cannot remove real pod state.
+	podStatePaths = []string{filepath.Join(testDir, "pods")}
+
+	// Ensure cc-env does not use the real cache.
+	envCachePath = filepath.Join(testDir, "cc-env.cache")
+
 	// Do this now to avoid hitting the test timeout value due to
 	// slow network response.
 	fmt.Printf("INFO: ensuring required docker image (%v) is available\n", testDockerImage)
@@ -644,6 +650,8 @@ func TestMainBeforeSubCommands(t *testing.T) {
 		{[]string{"sub-command", "-h"}, false},
 		{[]string{"sub-command", "--help"}, false},
 		{[]string{"cc-check"}, false},
+		{[]string{"cc-check", "--verbose"}, false},
+		{[]string{"cc-config"}, false},
 	}
 
 	for i, d := range data {
@@ -717,6 +725,29 @@ func TestMainBeforeSubCommandsInvalidLogFormat(t *testing.T) {
 	assert.NotNil(ccLog.Logger.Out)
 }
 
+func TestMainBeforeSubCommandsInvalidLogLevel(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	logFile := filepath.Join(tmpdir, "log")
+
+	app := cli.NewApp()
+
+	set := flag.NewFlagSet("", 0)
+	set.String("log", logFile, "")
+	set.String("log-format", "text", "")
+	set.String("log-level", "deafening", "")
+	set.Parse([]string{"create"})
+
+	ctx := cli.NewContext(app, set, nil)
+
+	err = beforeSubcommands(ctx)
+	assert.Error(err)
+}
+
 func TestMainBeforeSubCommandsLoadConfigurationFail(t *testing.T) {
 	assert := assert.New(t)
 
@@ -754,6 +785,64 @@ func TestMainBeforeSubCommandsLoadConfigurationFail(t *testing.T) {
 	}
 }
 
+func TestMainBeforeSubCommandsCCEnvConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	// the default config file does not exist
+	set := flag.NewFlagSet("", 0)
+	set.String("log-format", "text", "")
+	set.String("cc-config", filepath.Join(tmpdir, "config"), "")
+	set.Parse([]string{"cc-env", "--config", filepath.Join(tmpdir, "other")})
+
+	app := cli.NewApp()
+	ctx := cli.NewContext(app, set, nil)
+
+	savedExitFunc := exitFunc
+
+	exitStatus := 0
+	exitFunc = func(status int) { exitStatus = status }
+
+	defer func() {
+		exitFunc = savedExitFunc
+	}()
+
+	err = beforeSubcommands(ctx)
+	assert.NoError(err)
+	assert.Equal(0, exitStatus)
+	assert.Nil(ctx.App.Metadata)
+}
+
+func TestMainCCEnvConfigSpecified(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		args     []string
+		expected bool
+	}
+
+	data := []testData{
+		{[]string{}, false},
+		{[]string{"--validate"}, false},
+		{[]string{"--config", "/foo"}, true},
+		{[]string{"-config", "/foo"}, true},
+		{[]string{"--config=/foo"}, true},
+		{[]string{"--validate", "--config=/foo"}, true},
+		{[]string{"--config"}, false},
+		{[]string{"--config="}, false},
+		{[]string{"--config", ""}, false},
+		{[]string{"--configuration=/foo"}, false},
+		{[]string{"--", "--config=/foo"}, false},
+	}
+
+	for _, d := range data {
+		assert.Equal(d.expected, ccEnvConfigSpecified(d.args), "test data: %+v", d)
+	}
+}
+
 func TestMainBeforeSubCommandsShowCCConfigPaths(t *testing.T) {
 	assert := assert.New(t)
 
@@ -0,0 +1,34 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// validateGuestPaths checks the specified list of container paths, named
+// after its OCI configuration field, only holds absolute paths. Whether
+// the paths exist is not checked since they refer to the container
+// rootfs inside the VM.
+func validateGuestPaths(field string, paths []string) error {
+	for _, p := range paths {
+		if !filepath.IsAbs(p) {
+			return fmt.Errorf("Invalid %s entry %q: path must be absolute", field, p)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateGuestPaths(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		paths         []string
+		expectFailure bool
+	}
+
+	data := []testData{
+		{nil, false},
+		{[]string{}, false},
+		{[]string{"/proc/kcore", "/sys/firmware"}, false},
+
+		// paths that may not exist in the container are fine
+		{[]string{"/does/not/exist"}, false},
+
+		{[]string{""}, true},
+		{[]string{"proc/kcore"}, true},
+		{[]string{"/proc/kcore", "../sys"}, true},
+	}
+
+	for _, d := range data {
+		err := validateGuestPaths("maskedPaths", d.paths)
+		if d.expectFailure {
+			assert.Error(err, "test data: %+v", d)
+		} else {
+			assert.NoError(err, "test data: %+v", d)
+		}
+	}
+}
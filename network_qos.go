@@ -0,0 +1,236 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/containers/virtcontainers/pkg/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sirupsen/logrus"
+)
+
+// OCI annotations that limit the network bandwidth of a pod. The values
+// use the tc(8) syntax, for example "10mbit" for a rate and "15k" for a
+// burst size.
+const (
+	networkAnnotationPrefix = hypervisorAnnotationPrefix + "network."
+
+	// networkRateAnnotation specifies the guaranteed bandwidth.
+	networkRateAnnotation = networkAnnotationPrefix + "rate"
+
+	// networkCeilAnnotation specifies the maximum bandwidth. It defaults
+	// to the rate.
+	networkCeilAnnotation = networkAnnotationPrefix + "ceil"
+
+	// networkBurstAnnotation specifies the amount of data that can be
+	// sent at the ceil rate.
+	networkBurstAnnotation = networkAnnotationPrefix + "burst"
+)
+
+var (
+	tcRateRegex = regexp.MustCompile(`(?i)^[0-9]+(\.[0-9]+)?([kmgt]?(bit|bps))?$`)
+	tcSizeRegex = regexp.MustCompile(`(?i)^[0-9]+([kmg]?b?)?$`)
+)
+
+// networkQoS describes the bandwidth limits applied to every network
+// interface of a pod.
+type networkQoS struct {
+	rate  string
+	ceil  string
+	burst string
+}
+
+// getNetworkQoS returns the bandwidth limits requested by the specified
+// annotations, or nil if no limits were requested.
+func getNetworkQoS(annotations map[string]string) (*networkQoS, error) {
+	rate, hasRate := annotations[networkRateAnnotation]
+	ceil, hasCeil := annotations[networkCeilAnnotation]
+	burst, hasBurst := annotations[networkBurstAnnotation]
+
+	if !hasRate && !hasCeil && !hasBurst {
+		return nil, nil
+	}
+
+	if !hasRate {
+		return nil, fmt.Errorf("Annotation %s must be specified to limit the network bandwidth",
+			networkRateAnnotation)
+	}
+
+	if !tcRateRegex.MatchString(rate) {
+		return nil, fmt.Errorf("Invalid annotation %s=%q: expected a rate such as \"10mbit\"",
+			networkRateAnnotation, rate)
+	}
+
+	if hasCeil && !tcRateRegex.MatchString(ceil) {
+		return nil, fmt.Errorf("Invalid annotation %s=%q: expected a rate such as \"20mbit\"",
+			networkCeilAnnotation, ceil)
+	}
+
+	if hasBurst && !tcSizeRegex.MatchString(burst) {
+		return nil, fmt.Errorf("Invalid annotation %s=%q: expected a size such as \"15k\"",
+			networkBurstAnnotation, burst)
+	}
+
+	return &networkQoS{
+		rate:  rate,
+		ceil:  ceil,
+		burst: burst,
+	}, nil
+}
+
+// getNetNSPath returns the path to the network namespace specified by the
+// OCI specification, or "" if none is specified.
+func getNetNSPath(ociSpec oci.CompatOCISpec) string {
+	if ociSpec.Linux == nil {
+		return ""
+	}
+
+	for _, n := range ociSpec.Linux.Namespaces {
+		if n.Type == specs.NetworkNamespace {
+			return n.Path
+		}
+	}
+
+	return ""
+}
+
+// netnsCommand returns the command to run the specified command in the
+// network namespace netnsPath.
+func netnsCommand(netnsPath string, args ...string) []string {
+	return append([]string{"nsenter", "--net=" + netnsPath}, args...)
+}
+
+// tcSetupCommands returns the tc commands that limit the bandwidth of the
+// specified interface.
+func tcSetupCommands(iface string, qos networkQoS) [][]string {
+	class := []string{"tc", "class", "add", "dev", iface, "parent", "1:", "classid", "1:1", "htb", "rate", qos.rate}
+
+	if qos.ceil != "" {
+		class = append(class, "ceil", qos.ceil)
+	}
+
+	if qos.burst != "" {
+		class = append(class, "burst", qos.burst)
+	}
+
+	return [][]string{
+		{"tc", "qdisc", "add", "dev", iface, "root", "handle", "1:", "htb", "default", "1"},
+		class,
+	}
+}
+
+// tcTeardownCommand returns the tc command that removes the bandwidth
+// limits of the specified interface.
+func tcTeardownCommand(iface string) []string {
+	return []string{"tc", "qdisc", "del", "dev", iface, "root"}
+}
+
+// parseLinkNames returns the names of the network interfaces listed in
+// the output of "ip -o link show", ignoring the loopback interface.
+func parseLinkNames(output string) []string {
+	var names []string
+
+	for _, line := range strings.Split(output, "\n") {
+		// Lines look like "2: eth0@if5: <BROADCAST,...> ..."
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) < 3 {
+			continue
+		}
+
+		name := strings.TrimSpace(fields[1])
+		if i := strings.Index(name, "@"); i >= 0 {
+			name = name[:i]
+		}
+
+		if name == "" || name == "lo" {
+			continue
+		}
+
+		names = append(names, name)
+	}
+
+	return names
+}
+
+// getNetNSInterfaces returns the names of the network interfaces in the
+// specified network namespace.
+func getNetNSInterfaces(netnsPath string) ([]string, error) {
+	output, err := runCommandFull(netnsCommand(netnsPath, "ip", "-o", "link", "show"), true)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot list network interfaces in %v: %v", netnsPath, err)
+	}
+
+	return parseLinkNames(output), nil
+}
+
+// applyNetworkQoS limits the bandwidth of every network interface in the
+// specified network namespace. This includes both the veth connecting the
+// namespace to the host and the tap device connecting it to the VM, so
+// traffic is limited in both directions.
+func applyNetworkQoS(netnsPath string, qos networkQoS) error {
+	ifaces, err := getNetNSInterfaces(netnsPath)
+	if err != nil {
+		return err
+	}
+
+	for _, iface := range ifaces {
+		ccLog.WithFields(logrus.Fields{
+			"interface": iface,
+			"rate":      qos.rate,
+			"ceil":      qos.ceil,
+			"burst":     qos.burst,
+		}).Info("Limiting network bandwidth")
+
+		for _, args := range tcSetupCommands(iface, qos) {
+			args = netnsCommand(netnsPath, args...)
+			if _, err := runCommandFull(args, true); err != nil {
+				return fmt.Errorf("Cannot limit bandwidth of interface %v: %v", iface, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// removeNetworkQoS removes any bandwidth limits requested by the OCI
+// specification of a pod. Errors are only logged since the limits
+// disappear along with the network namespace anyway.
+func removeNetworkQoS(ociSpec oci.CompatOCISpec) {
+	qos, err := getNetworkQoS(ociSpec.Annotations)
+	if err != nil || qos == nil {
+		return
+	}
+
+	netnsPath := getNetNSPath(ociSpec)
+	if netnsPath == "" || !fileExists(netnsPath) {
+		return
+	}
+
+	ifaces, err := getNetNSInterfaces(netnsPath)
+	if err != nil {
+		ccLog.WithError(err).Warn("Cannot remove network bandwidth limits")
+		return
+	}
+
+	for _, iface := range ifaces {
+		args := netnsCommand(netnsPath, tcTeardownCommand(iface)...)
+		if _, err := runCommandFull(args, true); err != nil {
+			ccLog.WithError(err).WithField("interface", iface).Warn("Cannot remove network bandwidth limit")
+		}
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/containers/virtcontainers/pkg/vcMock"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetNetworkQoS(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		annotations   map[string]string
+		expectFailure bool
+		expectedQoS   *networkQoS
+	}
+
+	data := []testData{
+		{nil, false, nil},
+		{map[string]string{"foo": "bar"}, false, nil},
+
+		{map[string]string{networkRateAnnotation: "10mbit"}, false, &networkQoS{rate: "10mbit"}},
+		{map[string]string{networkRateAnnotation: "1.5Gbit"}, false, &networkQoS{rate: "1.5Gbit"}},
+		{map[string]string{networkRateAnnotation: "100kbps"}, false, &networkQoS{rate: "100kbps"}},
+		{map[string]string{networkRateAnnotation: "1000"}, false, &networkQoS{rate: "1000"}},
+		{
+			map[string]string{
+				networkRateAnnotation:  "10mbit",
+				networkCeilAnnotation:  "20mbit",
+				networkBurstAnnotation: "15k",
+			},
+			false,
+			&networkQoS{rate: "10mbit", ceil: "20mbit", burst: "15k"},
+		},
+
+		// rate is required
+		{map[string]string{networkCeilAnnotation: "20mbit"}, true, nil},
+		{map[string]string{networkBurstAnnotation: "15k"}, true, nil},
+
+		// invalid values
+		{map[string]string{networkRateAnnotation: ""}, true, nil},
+		{map[string]string{networkRateAnnotation: "fast"}, true, nil},
+		{map[string]string{networkRateAnnotation: "10mbit; reboot"}, true, nil},
+		{map[string]string{networkRateAnnotation: "10mbit", networkCeilAnnotation: "-1"}, true, nil},
+		{map[string]string{networkRateAnnotation: "10mbit", networkBurstAnnotation: "15mbit"}, true, nil},
+	}
+
+	for _, d := range data {
+		qos, err := getNetworkQoS(d.annotations)
+		if d.expectFailure {
+			assert.Error(err, "test data: %+v", d)
+			continue
+		}
+
+		assert.NoError(err, "test data: %+v", d)
+		assert.Equal(d.expectedQoS, qos, "test data: %+v", d)
+	}
+}
+
+func TestTCCommands(t *testing.T) {
+	assert := assert.New(t)
+
+	qdisc := []string{"tc", "qdisc", "add", "dev", "eth0", "root", "handle", "1:", "htb", "default", "1"}
+	class := []string{"tc", "class", "add", "dev", "eth0", "parent", "1:", "classid", "1:1", "htb", "rate", "10mbit"}
+
+	commands := tcSetupCommands("eth0", networkQoS{rate: "10mbit"})
+	assert.Equal([][]string{qdisc, class}, commands)
+
+	commands = tcSetupCommands("eth0", networkQoS{rate: "10mbit", ceil: "20mbit", burst: "15k"})
+	assert.Equal([][]string{
+		qdisc,
+		append(class, "ceil", "20mbit", "burst", "15k"),
+	}, commands)
+
+	assert.Equal([]string{"tc", "qdisc", "del", "dev", "tap0", "root"}, tcTeardownCommand("tap0"))
+
+	assert.Equal([]string{"nsenter", "--net=/var/run/netns/foo", "tc", "qdisc", "del", "dev", "tap0", "root"},
+		netnsCommand("/var/run/netns/foo", tcTeardownCommand("tap0")...))
+}
+
+func TestParseLinkNames(t *testing.T) {
+	assert := assert.New(t)
+
+	output := `1: lo: <LOOPBACK,UP,LOWER_UP> mtu 65536 qdisc noqueue state UNKNOWN mode DEFAULT group default qlen 1\    link/loopback 00:00:00:00:00:00 brd 00:00:00:00:00:00
+4: eth0@if5: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 1500 qdisc noqueue master br0 state UP mode DEFAULT group default \    link/ether 02:42:ac:11:00:02 brd ff:ff:ff:ff:ff:ff link-netnsid 0
+6: br0: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 1500 qdisc noqueue state UP mode DEFAULT group default qlen 1000\    link/ether 02:42:ac:11:00:02 brd ff:ff:ff:ff:ff:ff
+7: tap0: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 1500 qdisc pfifo_fast master br0 state UP mode DEFAULT group default qlen 1000\    link/ether 0a:1b:2c:3d:4e:5f brd ff:ff:ff:ff:ff:ff
+`
+
+	assert.Equal([]string{"eth0", "br0", "tap0"}, parseLinkNames(output))
+	assert.Empty(parseLinkNames(""))
+}
+
+func TestGetNetNSPath(t *testing.T) {
+	assert := assert.New(t)
+
+	var ociSpec oci.CompatOCISpec
+	assert.Equal("", getNetNSPath(ociSpec))
+
+	ociSpec.Linux = &specs.Linux{
+		Namespaces: []specs.LinuxNamespace{
+			{Type: specs.PIDNamespace, Path: "/proc/1/ns/pid"},
+		},
+	}
+	assert.Equal("", getNetNSPath(ociSpec))
+
+	ociSpec.Linux.Namespaces = append(ociSpec.Linux.Namespaces,
+		specs.LinuxNamespace{Type: specs.NetworkNamespace, Path: "/var/run/netns/foo"})
+	assert.Equal("/var/run/netns/foo", getNetNSPath(ociSpec))
+}
+
+func TestCreatePodNetworkQoSFail(t *testing.T) {
+	assert := assert.New(t)
+
+	created := false
+
+	testingImpl.CreatePodFunc = func(config vc.PodConfig) (vc.VCPod, error) {
+		created = true
+		return &vcMock.Pod{}, nil
+	}
+
+	defer func() {
+		testingImpl.CreatePodFunc = nil
+	}()
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	runtimeConfig, err := newTestRuntimeConfig(tmpdir, testConsole, true)
+	assert.NoError(err)
+
+	bundlePath := filepath.Join(tmpdir, "bundle")
+
+	err = makeOCIBundle(bundlePath)
+	assert.NoError(err)
+
+	spec, err := readOCIConfigFile(filepath.Join(bundlePath, "config.json"))
+	assert.NoError(err)
+
+	// invalid limit
+	spec.Annotations = map[string]string{
+		networkRateAnnotation: "fast",
+	}
+
+	_, err = createPod(spec, runtimeConfig, testContainerID, bundlePath, testConsole, true)
+	assert.Error(err)
+	assert.False(created)
+
+	// no network namespace to apply the limit to
+	spec.Annotations[networkRateAnnotation] = "10mbit"
+
+	for i, n := range spec.Linux.Namespaces {
+		if n.Type == specs.NetworkNamespace {
+			spec.Linux.Namespaces[i].Path = ""
+		}
+	}
+
+	_, err = createPod(spec, runtimeConfig, testContainerID, bundlePath, testConsole, true)
+	assert.Error(err)
+	assert.False(created)
+}
@@ -0,0 +1,224 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/sirupsen/logrus"
+)
+
+// numaNodeAnnotation is the pod annotation recording the host NUMA node
+// the VM of a pod has been placed on.
+const numaNodeAnnotation = hypervisorAnnotationPrefix + "numa_node"
+
+// maxNUMANodes is the number of NUMA nodes the node masks passed to
+// migrate_pages(2) can describe.
+const maxNUMANodes = 1024
+
+// sysNodePath is the directory the kernel describes the NUMA nodes of the
+// host in. It is a variable to allow tests to modify it.
+var sysNodePath = "/sys/devices/system/node"
+
+// numaPinning is set by the enable_numa_pinning option of the hypervisor
+// configuration.
+var numaPinning = false
+
+// migrateMemoryFunc is used to move the memory of a process to a NUMA
+// node. It is a variable to allow tests to mock it.
+var migrateMemoryFunc = migrateMemory
+
+// numaNode describes a NUMA node of the host.
+type numaNode struct {
+	ID   int
+	CPUs []int
+}
+
+// getNUMANodes returns the NUMA nodes of the host, sorted by ID. Nodes
+// without any CPU, which only provide memory, are not returned unless
+// allNodes is set.
+func getNUMANodes(allNodes bool) ([]numaNode, error) {
+	paths, err := filepath.Glob(filepath.Join(sysNodePath, "node[0-9]*"))
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes []numaNode
+
+	for _, path := range paths {
+		id, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(path), "node"))
+		if err != nil {
+			continue
+		}
+
+		bytes, err := ioutil.ReadFile(filepath.Join(path, "cpulist"))
+		if err != nil {
+			return nil, err
+		}
+
+		node := numaNode{ID: id}
+
+		if list := strings.TrimSpace(string(bytes)); list != "" {
+			node.CPUs, err = parseCPUList(list)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid CPU list for NUMA node %d: %v", id, err)
+			}
+		}
+
+		if len(node.CPUs) == 0 && !allNodes {
+			continue
+		}
+
+		nodes = append(nodes, node)
+	}
+
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].ID < nodes[j].ID
+	})
+
+	return nodes, nil
+}
+
+// selectNUMANode returns the node a VM should be placed on. If mems, in
+// the cpuset format, is not empty, the first of its nodes that has CPUs
+// is used. Otherwise, the nodes are used in turn based on the number of
+// pods already running.
+func selectNUMANode(nodes []numaNode, mems string, podCount int) (numaNode, error) {
+	if len(nodes) == 0 {
+		return numaNode{}, fmt.Errorf("No NUMA node with CPUs found")
+	}
+
+	if mems == "" {
+		return nodes[podCount%len(nodes)], nil
+	}
+
+	ids, err := parseCPUList(mems)
+	if err != nil {
+		return numaNode{}, fmt.Errorf("Invalid memory nodes %q: %v", mems, err)
+	}
+
+	for _, id := range ids {
+		for _, node := range nodes {
+			if node.ID == id {
+				return node, nil
+			}
+		}
+	}
+
+	return numaNode{}, fmt.Errorf("None of the memory nodes %q is a NUMA node with CPUs", mems)
+}
+
+// getNUMAPlacement returns the node the VM of the pod of the specified
+// OCI configuration should be placed on, or nil if NUMA pinning is not
+// enabled or the host only has a single node.
+func getNUMAPlacement(ociSpec oci.CompatOCISpec) (*numaNode, error) {
+	if !numaPinning {
+		return nil, nil
+	}
+
+	nodes, err := getNUMANodes(false)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(nodes) < 2 {
+		return nil, nil
+	}
+
+	var mems string
+
+	if ociSpec.Linux != nil && ociSpec.Linux.Resources != nil && ociSpec.Linux.Resources.CPU != nil {
+		mems = ociSpec.Linux.Resources.CPU.Mems
+	}
+
+	pods, err := vci.ListPod()
+	if err != nil {
+		return nil, err
+	}
+
+	node, err := selectNUMANode(nodes, mems, len(pods))
+	if err != nil {
+		return nil, err
+	}
+
+	return &node, nil
+}
+
+// migrateMemory moves all the memory of the specified process to a NUMA
+// node.
+func migrateMemory(pid, node int) error {
+	nodes, err := getNUMANodes(true)
+	if err != nil {
+		return err
+	}
+
+	var oldNodes, newNodes [maxNUMANodes / 64]uint64
+
+	for _, n := range nodes {
+		if n.ID < maxNUMANodes {
+			oldNodes[n.ID/64] |= 1 << (uint(n.ID) % 64)
+		}
+	}
+
+	newNodes[node/64] |= 1 << (uint(node) % 64)
+
+	// The kernel ignores the last bit of the node masks.
+	_, _, errno := syscall.Syscall6(syscall.SYS_MIGRATE_PAGES, uintptr(pid),
+		uintptr(maxNUMANodes+1), uintptr(unsafe.Pointer(&oldNodes[0])),
+		uintptr(unsafe.Pointer(&newNodes[0])), 0, 0)
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+// placeOnNUMANode pins the vCPUs of the VM of the specified pod, which
+// must be running, to the CPUs of a NUMA node and moves its memory to
+// that node. Memory the VM allocates later is allocated on the node too
+// since the kernel allocates memory on the node of the CPU that first
+// uses it.
+func placeOnNUMANode(podID string, node numaNode) error {
+	threadIDs, err := getVCPUThreadIDs(podID)
+	if err != nil {
+		return fmt.Errorf("Cannot get the vCPU threads of pod %v: %v", podID, err)
+	}
+
+	if err := pinVCPUThreads(threadIDs, node.CPUs); err != nil {
+		return err
+	}
+
+	if len(threadIDs) > 0 {
+		// The vCPU threads share the memory of the hypervisor.
+		if err := migrateMemoryFunc(threadIDs[0], node.ID); err != nil {
+			return fmt.Errorf("Cannot move the memory of pod %v to NUMA node %d: %v", podID, node.ID, err)
+		}
+	}
+
+	ccLog.WithFields(logrus.Fields{
+		"pod":       podID,
+		"numa-node": node.ID,
+	}).Info("Placed VM on NUMA node")
+
+	return nil
+}
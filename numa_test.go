@@ -0,0 +1,322 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// testNUMATopology maps the NUMA nodes of the test host to their CPUs.
+// Node 2 only provides memory.
+var testNUMATopology = map[string]string{
+	"node0": "0-3\n",
+	"node1": "4-7\n",
+	"node2": "\n",
+}
+
+// setTestNUMATopology creates the specified NUMA topology below dir and
+// makes the runtime use it.
+func setTestNUMATopology(assert *assert.Assertions, dir string, topology map[string]string) func() {
+	savedPath := sysNodePath
+	sysNodePath = filepath.Join(dir, "node")
+
+	for node, cpus := range topology {
+		nodeDir := filepath.Join(sysNodePath, node)
+
+		err := os.MkdirAll(nodeDir, testDirMode)
+		assert.NoError(err)
+
+		err = ioutil.WriteFile(filepath.Join(nodeDir, "cpulist"), []byte(cpus), testFileMode)
+		assert.NoError(err)
+	}
+
+	// not a node
+	err := os.MkdirAll(filepath.Join(sysNodePath, "power"), testDirMode)
+	assert.NoError(err)
+
+	return func() {
+		sysNodePath = savedPath
+	}
+}
+
+func TestGetNUMANodes(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	restore := setTestNUMATopology(assert, tmpdir, testNUMATopology)
+	defer restore()
+
+	nodes, err := getNUMANodes(false)
+	assert.NoError(err)
+	assert.Equal([]numaNode{
+		{ID: 0, CPUs: []int{0, 1, 2, 3}},
+		{ID: 1, CPUs: []int{4, 5, 6, 7}},
+	}, nodes)
+
+	nodes, err = getNUMANodes(true)
+	assert.NoError(err)
+	assert.Len(nodes, 3)
+	assert.Equal(2, nodes[2].ID)
+	assert.Empty(nodes[2].CPUs)
+}
+
+func TestGetNUMANodesInvalidCPUList(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	restore := setTestNUMATopology(assert, tmpdir, map[string]string{"node0": "foo\n"})
+	defer restore()
+
+	_, err = getNUMANodes(false)
+	assert.Error(err)
+}
+
+func TestSelectNUMANode(t *testing.T) {
+	assert := assert.New(t)
+
+	nodes := []numaNode{
+		{ID: 0, CPUs: []int{0, 1}},
+		{ID: 1, CPUs: []int{2, 3}},
+		{ID: 3, CPUs: []int{4, 5}},
+	}
+
+	type testData struct {
+		mems          string
+		podCount      int
+		expectFailure bool
+		expectedNode  int
+	}
+
+	data := []testData{
+		// round-robin
+		{"", 0, false, 0},
+		{"", 1, false, 1},
+		{"", 2, false, 3},
+		{"", 3, false, 0},
+		{"", 7, false, 1},
+
+		// from the memory nodes
+		{"1", 0, false, 1},
+		{"3", 1, false, 3},
+		{"1,3", 2, false, 1},
+
+		// the first existing node is used
+		{"2-3", 0, false, 3},
+
+		// no such node
+		{"2", 0, true, 0},
+		{"4-8", 0, true, 0},
+
+		// invalid memory nodes
+		{"foo", 0, true, 0},
+	}
+
+	for _, d := range data {
+		node, err := selectNUMANode(nodes, d.mems, d.podCount)
+		if d.expectFailure {
+			assert.Error(err, "test data: %+v", d)
+			continue
+		}
+
+		assert.NoError(err, "test data: %+v", d)
+		assert.Equal(d.expectedNode, node.ID, "test data: %+v", d)
+	}
+
+	_, err := selectNUMANode(nil, "", 0)
+	assert.Error(err)
+}
+
+func TestGetNUMAPlacement(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	restore := setTestNUMATopology(assert, tmpdir, testNUMATopology)
+	defer restore()
+
+	savedNUMAPinning := numaPinning
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return []vc.PodStatus{{ID: testPodID}}, nil
+	}
+
+	defer func() {
+		numaPinning = savedNUMAPinning
+		testingImpl.ListPodFunc = nil
+	}()
+
+	ociSpec := oci.CompatOCISpec{}
+
+	// disabled
+	numaPinning = false
+
+	node, err := getNUMAPlacement(ociSpec)
+	assert.NoError(err)
+	assert.Nil(node)
+
+	numaPinning = true
+
+	// one pod already running
+	node, err = getNUMAPlacement(ociSpec)
+	assert.NoError(err)
+	assert.NotNil(node)
+	assert.Equal(1, node.ID)
+	assert.Equal([]int{4, 5, 6, 7}, node.CPUs)
+
+	// from the memory nodes
+	ociSpec.Linux = &specs.Linux{
+		Resources: &specs.LinuxResources{
+			CPU: &specs.LinuxCPU{
+				Mems: "0",
+			},
+		},
+	}
+
+	node, err = getNUMAPlacement(ociSpec)
+	assert.NoError(err)
+	assert.NotNil(node)
+	assert.Equal(0, node.ID)
+
+	// only the memory-only node
+	ociSpec.Linux.Resources.CPU.Mems = "2"
+
+	_, err = getNUMAPlacement(ociSpec)
+	assert.Error(err)
+
+	// cannot list the pods
+	ociSpec.Linux = nil
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return nil, errors.New("list failure")
+	}
+
+	_, err = getNUMAPlacement(ociSpec)
+	assert.Error(err)
+}
+
+func TestGetNUMAPlacementSingleNode(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	restore := setTestNUMATopology(assert, tmpdir, map[string]string{"node0": "0-7\n"})
+	defer restore()
+
+	savedNUMAPinning := numaPinning
+	numaPinning = true
+
+	defer func() {
+		numaPinning = savedNUMAPinning
+	}()
+
+	node, err := getNUMAPlacement(oci.CompatOCISpec{})
+	assert.NoError(err)
+	assert.Nil(node)
+}
+
+func TestPlaceOnNUMANode(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	_, restore := setTestQMPServer(assert, tmpdir, testPodID, []int{100, 101})
+	defer restore()
+
+	pinned := make(map[int]int)
+	migrated := make(map[int]int)
+
+	savedSetThreadAffinity := setThreadAffinityFunc
+	setThreadAffinityFunc = func(tid, cpu int) error {
+		pinned[tid] = cpu
+		return nil
+	}
+
+	savedMigrateMemory := migrateMemoryFunc
+	migrateMemoryFunc = func(pid, node int) error {
+		migrated[pid] = node
+		return nil
+	}
+
+	defer func() {
+		setThreadAffinityFunc = savedSetThreadAffinity
+		migrateMemoryFunc = savedMigrateMemory
+	}()
+
+	err = placeOnNUMANode(testPodID, numaNode{ID: 1, CPUs: []int{4, 5, 6, 7}})
+	assert.NoError(err)
+	assert.Equal(map[int]int{100: 4, 101: 5}, pinned)
+	assert.Equal(map[int]int{100: 1}, migrated)
+}
+
+func TestPlaceOnNUMANodeFail(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	savedPath := podRunStatePath
+	podRunStatePath = tmpdir
+
+	savedSetThreadAffinity := setThreadAffinityFunc
+	setThreadAffinityFunc = func(tid, cpu int) error {
+		return nil
+	}
+
+	savedMigrateMemory := migrateMemoryFunc
+	migrateMemoryFunc = func(pid, node int) error {
+		return errors.New("migration failure")
+	}
+
+	defer func() {
+		podRunStatePath = savedPath
+		setThreadAffinityFunc = savedSetThreadAffinity
+		migrateMemoryFunc = savedMigrateMemory
+	}()
+
+	node := numaNode{ID: 1, CPUs: []int{4, 5}}
+
+	// no hypervisor
+	err = placeOnNUMANode(testPodID, node)
+	assert.Error(err)
+
+	_, restore := setTestQMPServer(assert, tmpdir, testPodID, []int{100})
+	defer restore()
+
+	// cannot move the memory
+	err = placeOnNUMANode(testPodID, node)
+	assert.Error(err)
+}
@@ -38,16 +38,33 @@ const (
 	cgroupsDirMode   = os.FileMode(0750)
 	cgroupsFileMode  = os.FileMode(0640)
 	cgroupsMountType = "cgroup"
+	cgroup2MountType = "cgroup2"
 
 	// Filesystem type corresponding to CGROUP_SUPER_MAGIC as listed
 	// here: http://man7.org/linux/man-pages/man2/statfs.2.html
 	cgroupFsType = 0x27e0eb
+
+	// Filesystem type corresponding to CGROUP2_SUPER_MAGIC.
+	cgroup2FsType = 0x63677270
 )
 
+// ociStatePaused is the status reported for a paused container. The OCI
+// specification does not define a paused state so this matches the value
+// used by runc.
+const ociStatePaused = "paused"
+
+// ociStateCreating is the status reported for a container whose creation
+// has not completed yet.
+const ociStateCreating = "creating"
+
 var errNeedLinuxResource = errors.New("Linux resource cannot be empty")
 
 var cgroupsDirPath string
 
+// cgroupVersion is the version of the host cgroup hierarchy (1 or 2), or 0
+// until it has been determined.
+var cgroupVersion int
+
 var procMountInfo = "/proc/self/mountinfo"
 
 // getContainerInfo returns the container status and its pod ID.
@@ -77,6 +94,23 @@ func getContainerInfo(containerID string) (vc.ContainerStatus, string, error) {
 	return vc.ContainerStatus{}, "", nil
 }
 
+// statusToOCIState converts the specified container status into an OCI
+// state. Unlike oci.StatusToOCIState(), paused containers and containers
+// that are still being created are reported as such rather than with an
+// empty status.
+func statusToOCIState(status vc.ContainerStatus) specs.State {
+	state := oci.StatusToOCIState(status)
+
+	switch status.State.State {
+	case vc.StatePaused:
+		state.Status = ociStatePaused
+	case "":
+		state.Status = ociStateCreating
+	}
+
+	return state
+}
+
 func getExistingContainerInfo(containerID string) (vc.ContainerStatus, string, error) {
 	cStatus, podID, err := getContainerInfo(containerID)
 	if err != nil {
@@ -91,20 +125,28 @@ func getExistingContainerInfo(containerID string) (vc.ContainerStatus, string, e
 	return cStatus, podID, nil
 }
 
-func validCreateParams(containerID, bundlePath string) (string, error) {
+func validCreateContainerID(containerID string) error {
 	// container ID MUST be provided.
 	if containerID == "" {
-		return "", fmt.Errorf("Missing container ID")
+		return fmt.Errorf("Missing container ID")
 	}
 
 	// container ID MUST be unique.
 	cStatus, _, err := getContainerInfo(containerID)
 	if err != nil {
-		return "", err
+		return err
 	}
 
 	if cStatus.ID != "" {
-		return "", fmt.Errorf("ID already in use, unique ID should be provided")
+		return fmt.Errorf("ID already in use, unique ID should be provided")
+	}
+
+	return nil
+}
+
+func validCreateParams(containerID, bundlePath string) (string, error) {
+	if err := validCreateContainerID(containerID); err != nil {
+		return "", err
 	}
 
 	// bundle path MUST be provided.
@@ -149,9 +191,7 @@ func processCgroupsPath(ociSpec oci.CompatOCISpec, isPod bool) ([]string, error)
 			return []string{}, err
 		}
 
-		if memCgroupsPath != "" {
-			cgroupsPathList = append(cgroupsPathList, memCgroupsPath)
-		}
+		cgroupsPathList = appendCgroupsPath(cgroupsPathList, memCgroupsPath)
 	}
 
 	if ociSpec.Linux.Resources.CPU != nil {
@@ -160,9 +200,7 @@ func processCgroupsPath(ociSpec oci.CompatOCISpec, isPod bool) ([]string, error)
 			return []string{}, err
 		}
 
-		if cpuCgroupsPath != "" {
-			cgroupsPathList = append(cgroupsPathList, cpuCgroupsPath)
-		}
+		cgroupsPathList = appendCgroupsPath(cgroupsPathList, cpuCgroupsPath)
 	}
 
 	if ociSpec.Linux.Resources.Pids != nil {
@@ -171,9 +209,7 @@ func processCgroupsPath(ociSpec oci.CompatOCISpec, isPod bool) ([]string, error)
 			return []string{}, err
 		}
 
-		if pidsCgroupsPath != "" {
-			cgroupsPathList = append(cgroupsPathList, pidsCgroupsPath)
-		}
+		cgroupsPathList = appendCgroupsPath(cgroupsPathList, pidsCgroupsPath)
 	}
 
 	if ociSpec.Linux.Resources.BlockIO != nil {
@@ -182,14 +218,28 @@ func processCgroupsPath(ociSpec oci.CompatOCISpec, isPod bool) ([]string, error)
 			return []string{}, err
 		}
 
-		if blkIOCgroupsPath != "" {
-			cgroupsPathList = append(cgroupsPathList, blkIOCgroupsPath)
-		}
+		cgroupsPathList = appendCgroupsPath(cgroupsPathList, blkIOCgroupsPath)
 	}
 
 	return cgroupsPathList, nil
 }
 
+// appendCgroupsPath appends cgroupsPath to the list unless it is empty or
+// already listed. With cgroup v2, all the resources share the same path.
+func appendCgroupsPath(cgroupsPathList []string, cgroupsPath string) []string {
+	if cgroupsPath == "" {
+		return cgroupsPathList
+	}
+
+	for _, p := range cgroupsPathList {
+		if p == cgroupsPath {
+			return cgroupsPathList
+		}
+	}
+
+	return append(cgroupsPathList, cgroupsPath)
+}
+
 func processCgroupsPathForResource(ociSpec oci.CompatOCISpec, resource string, isPod bool) (string, error) {
 	if resource == "" {
 		return "", errNeedLinuxResource
@@ -201,6 +251,18 @@ func processCgroupsPathForResource(ociSpec oci.CompatOCISpec, resource string, i
 		return "", fmt.Errorf("get CgroupsDirPath error: %s", err)
 	}
 
+	if cgroupVersion == 0 {
+		cgroupVersion, err = getCgroupVersion(procMountInfo)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// The unified hierarchy has no directory per resource.
+	if cgroupVersion == 2 {
+		resource = ""
+	}
+
 	// Relative cgroups path provided.
 	if filepath.IsAbs(ociSpec.Linux.CgroupsPath) == false {
 		return filepath.Join(cgroupsDirPath, resource, ociSpec.Linux.CgroupsPath), nil
@@ -255,7 +317,7 @@ func isCgroupMounted(cgroupPath string) bool {
 		return false
 	}
 
-	if statFs.Type != int64(cgroupFsType) {
+	if statFs.Type != int64(cgroupFsType) && statFs.Type != int64(cgroup2FsType) {
 		return false
 	}
 
@@ -282,6 +344,7 @@ func setupConsole(consolePath, consoleSockPath string) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	defer conn.Close()
 
 	uConn, ok := conn.(*net.UnixConn)
 	if !ok {
@@ -292,6 +355,7 @@ func setupConsole(consolePath, consoleSockPath string) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	defer socket.Close()
 
 	// Send the parent fd through the provided socket
 	if err := utils.SendFd(socket, console.master); err != nil {
@@ -301,6 +365,19 @@ func setupConsole(consolePath, consoleSockPath string) (string, error) {
 	return console.slavePath, nil
 }
 
+// checkConsole checks a console is only specified for a process that
+// requests a terminal. Without a terminal, the shim forwards the stdout and
+// stderr of the process separately to its own stdout and stderr, which are
+// inherited from the runtime. These can be FIFOs, as used by containerd
+// for detached containers. A console would merge both streams.
+func checkConsole(console string, terminal bool) error {
+	if console != "" && !terminal {
+		return fmt.Errorf("Console %v specified but the process does not request a terminal (process.terminal)", console)
+	}
+
+	return nil
+}
+
 func noNeedForOutput(detach bool, tty bool) bool {
 	if !detach {
 		return false
@@ -313,18 +390,17 @@ func noNeedForOutput(detach bool, tty bool) bool {
 	return true
 }
 
-func getCgroupsDirPath(mountInfoFile string) (string, error) {
-	if cgroupsDirPath != "" {
-		return cgroupsDirPath, nil
-	}
-
+// getCgroupMounts returns the directory below which the cgroup v1
+// hierarchies are mounted and the mount point of the cgroup v2 unified
+// hierarchy, as listed in the specified mountinfo file. Either is empty
+// if not mounted.
+func getCgroupMounts(mountInfoFile string) (v1Root, v2Mount string, err error) {
 	f, err := os.Open(mountInfoFile)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 	defer f.Close()
 
-	var cgroupRootPath string
 	scanner := bufio.NewScanner(f)
 	for scanner.Scan() {
 		text := scanner.Text()
@@ -336,12 +412,61 @@ func getCgroupsDirPath(mountInfoFile string) (string, error) {
 		postSeparatorFields := strings.Fields(text[index+3:])
 		numPostFields := len(postSeparatorFields)
 
-		if len(fields) < 5 || postSeparatorFields[0] != "cgroup" || numPostFields < 3 {
+		if len(fields) < 5 || numPostFields < 3 {
 			continue
 		}
 
-		cgroupRootPath = filepath.Dir(fields[4])
-		break
+		switch postSeparatorFields[0] {
+		case cgroupsMountType:
+			if v1Root == "" {
+				v1Root = filepath.Dir(fields[4])
+			}
+		case cgroup2MountType:
+			if v2Mount == "" {
+				v2Mount = fields[4]
+			}
+		}
+	}
+
+	return v1Root, v2Mount, scanner.Err()
+}
+
+// getCgroupMount returns the version of the cgroup hierarchy the host
+// uses for its resource controllers and the directory it is mounted on. A
+// host with both hierarchies mounted (a "hybrid" setup) uses cgroup v1 for
+// its controllers.
+func getCgroupMount(mountInfoFile string) (int, string, error) {
+	v1Root, v2Mount, err := getCgroupMounts(mountInfoFile)
+	if err != nil {
+		return 0, "", err
+	}
+
+	if v1Root != "" {
+		return 1, v1Root, nil
+	}
+
+	if v2Mount != "" {
+		return 2, v2Mount, nil
+	}
+
+	return 0, "", fmt.Errorf("No cgroup filesystem mounted")
+}
+
+// getCgroupVersion returns the version of the cgroup hierarchy the host
+// uses for its resource controllers.
+func getCgroupVersion(mountInfoFile string) (int, error) {
+	version, _, err := getCgroupMount(mountInfoFile)
+	return version, err
+}
+
+func getCgroupsDirPath(mountInfoFile string) (string, error) {
+	if cgroupsDirPath != "" {
+		return cgroupsDirPath, nil
+	}
+
+	_, cgroupRootPath, err := getCgroupMount(mountInfoFile)
+	if err != nil {
+		return "", err
 	}
 
 	if _, err = os.Stat(cgroupRootPath); err != nil {
@@ -350,3 +475,26 @@ func getCgroupsDirPath(mountInfoFile string) (string, error) {
 
 	return cgroupRootPath, nil
 }
+
+// getEnvVars converts the environment of an OCI process to the
+// environment of a virtcontainers command, preserving its order. Unlike
+// oci.EnvVars(), values are not trimmed and can be empty or contain "=".
+// Entries that do not specify a value are ignored.
+func getEnvVars(env []string) []vc.EnvVar {
+	var envVars []vc.EnvVar
+
+	for _, e := range env {
+		kv := strings.SplitN(e, "=", 2)
+		if len(kv) < 2 || kv[0] == "" {
+			ccLog.WithField("env", e).Warn("Ignoring invalid environment variable")
+			continue
+		}
+
+		envVars = append(envVars, vc.EnvVar{
+			Var:   kv[0],
+			Value: kv[1],
+		})
+	}
+
+	return envVars
+}
@@ -22,6 +22,7 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"syscall"
 	"testing"
 	"time"
@@ -148,6 +149,33 @@ func TestGetContainerInfoMismatch(t *testing.T) {
 	assert.Equal(podID, "")
 }
 
+func TestStatusToOCIState(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		state          vc.State
+		expectedStatus string
+	}
+
+	data := []testData{
+		{vc.State{State: vc.StateReady}, oci.StateCreated},
+		{vc.State{State: vc.StateRunning}, oci.StateRunning},
+		{vc.State{State: vc.StatePaused}, ociStatePaused},
+		{vc.State{State: vc.StateStopped}, oci.StateStopped},
+	}
+
+	for _, d := range data {
+		status := vc.ContainerStatus{
+			ID:    testContainerID,
+			State: d.state,
+		}
+
+		state := statusToOCIState(status)
+		assert.Equal(testContainerID, state.ID)
+		assert.Equal(d.expectedStatus, state.Status, "%+v", d)
+	}
+}
+
 func TestValidCreateParamsContainerIDEmptyFailure(t *testing.T) {
 	assert := assert.New(t)
 	_, err := validCreateParams("", "")
@@ -322,6 +350,7 @@ func TestProcessCgroupsPathEmptyResources(t *testing.T) {
 func TestProcessCgroupsPathRelativePathSuccessful(t *testing.T) {
 	relativeCgroupsPath := "relative/cgroups/path"
 	cgroupsDirPath = "/foo/runtime/base"
+	cgroupVersion = 1
 
 	ociSpec := oci.CompatOCISpec{}
 
@@ -341,6 +370,7 @@ func TestProcessCgroupsPathRelativePathSuccessful(t *testing.T) {
 func TestProcessCgroupsPathAbsoluteNoCgroupMountSuccessful(t *testing.T) {
 	absoluteCgroupsPath := "/absolute/cgroups/path"
 	cgroupsDirPath = "/foo/runtime/base"
+	cgroupVersion = 1
 
 	ociSpec := oci.CompatOCISpec{}
 
@@ -357,6 +387,116 @@ func TestProcessCgroupsPathAbsoluteNoCgroupMountSuccessful(t *testing.T) {
 	}
 }
 
+func TestProcessCgroupsPathCgroupV2(t *testing.T) {
+	assert := assert.New(t)
+
+	savedVersion := cgroupVersion
+	cgroupsDirPath = "/foo/runtime/base"
+	cgroupVersion = 2
+
+	defer func() {
+		cgroupVersion = savedVersion
+	}()
+
+	ociSpec := oci.CompatOCISpec{}
+
+	ociSpec.Linux = &specs.Linux{
+		CgroupsPath: "relative/cgroups/path",
+	}
+
+	for _, d := range cgroupTestData {
+		ociSpec.Linux.Resources = d.linuxSpec
+
+		testProcessCgroupsPath(t, ociSpec, []string{"/foo/runtime/base/relative/cgroups/path"})
+	}
+
+	// all the resources share the same cgroup
+	limit := uint64(1024)
+
+	ociSpec.Linux.CgroupsPath = "/absolute/cgroups/path"
+	ociSpec.Linux.Resources = &specs.LinuxResources{
+		Memory: &specs.LinuxMemory{Limit: &limit},
+		CPU:    &specs.LinuxCPU{Shares: &limit},
+		Pids:   &specs.LinuxPids{Limit: int64(limit)},
+	}
+
+	paths, err := processCgroupsPath(ociSpec, true)
+	assert.NoError(err)
+	assert.Equal([]string{"/foo/runtime/base/absolute/cgroups/path"}, paths)
+}
+
+func TestGetCgroupVersion(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		contents        string
+		expectedVersion int
+		expectedDirPath string
+		expectError     bool
+	}
+
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	cgroupRoot := filepath.Join(dir, "cgroup")
+	err = os.MkdirAll(filepath.Join(cgroupRoot, "unified"), testDirMode)
+	assert.NoError(err)
+
+	v1Mounts := fmt.Sprintf(`32 24 0:28 / %s rw,relatime - tmpfs tmpfs rw,mode=755
+33 32 0:29 / %s/cpu rw,relatime - cgroup cgroup rw,cpu
+36 32 0:32 / %s/memory rw,relatime - cgroup cgroup rw,memory
+`, cgroupRoot, cgroupRoot, cgroupRoot)
+
+	v2Mount := fmt.Sprintf("42 32 0:38 / %s rw,relatime - cgroup2 cgroup2 rw\n", cgroupRoot)
+	hybridV2Mount := fmt.Sprintf("42 32 0:38 / %s/unified rw,relatime - cgroup2 cgroup2 rw\n", cgroupRoot)
+
+	data := []testData{
+		// cgroup v1 only
+		{v1Mounts, 1, cgroupRoot, false},
+
+		// hybrid: the controllers use cgroup v1, whichever comes first
+		{v1Mounts + hybridV2Mount, 1, cgroupRoot, false},
+		{hybridV2Mount + v1Mounts, 1, cgroupRoot, false},
+
+		// unified hierarchy only
+		{v2Mount, 2, cgroupRoot, false},
+
+		// no cgroup
+		{"32 24 0:28 / /sys/fs/cgroup rw,relatime - tmpfs tmpfs rw,mode=755\n", 0, "", true},
+		{"", 0, "", true},
+	}
+
+	file := filepath.Join(dir, "mountinfo")
+
+	// file does not exist
+	_, err = getCgroupVersion(file)
+	assert.Error(err)
+
+	savedDirPath := cgroupsDirPath
+	defer func() {
+		cgroupsDirPath = savedDirPath
+	}()
+
+	for _, d := range data {
+		err := ioutil.WriteFile(file, []byte(d.contents), testFileMode)
+		assert.NoError(err)
+
+		version, err := getCgroupVersion(file)
+		if d.expectError {
+			assert.Error(err, "test data: %+v", d)
+		} else {
+			assert.NoError(err, "test data: %+v", d)
+		}
+
+		assert.Equal(d.expectedVersion, version, "test data: %+v", d)
+
+		cgroupsDirPath = ""
+		path, _ := getCgroupsDirPath(file)
+		assert.Equal(d.expectedDirPath, path, "test data: %+v", d)
+	}
+}
+
 func TestProcessCgroupsPathAbsoluteNoCgroupMountDestinationFailure(t *testing.T) {
 	assert := assert.New(t)
 	absoluteCgroupsPath := "/absolute/cgroups/path"
@@ -497,6 +637,104 @@ func TestSetupConsoleNotExistingSocketPathFailure(t *testing.T) {
 	assert.Empty(console, "This test should fail because the console socket path does not exist")
 }
 
+func TestSetupConsoleSocketHandshake(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "test-socket")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	sockName := filepath.Join(dir, "console.sock")
+
+	l, err := net.Listen("unix", sockName)
+	assert.NoError(err)
+	defer l.Close()
+
+	masterCh := make(chan *os.File, 1)
+	errCh := make(chan error, 1)
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			errCh <- err
+			return
+		}
+		defer conn.Close()
+
+		f, err := conn.(*net.UnixConn).File()
+		if err != nil {
+			errCh <- err
+			return
+		}
+		defer f.Close()
+
+		master, err := utils.RecvFd(f)
+		if err != nil {
+			errCh <- err
+			return
+		}
+
+		masterCh <- master
+	}()
+
+	console, err := setupConsole("", sockName)
+	assert.NoError(err)
+
+	var master *os.File
+
+	select {
+	case master = <-masterCh:
+	case err := <-errCh:
+		t.Fatalf("Cannot receive the console file descriptor: %v", err)
+	}
+	defer master.Close()
+
+	// the file descriptor received is the master of the returned console
+	assert.True(isTerminal(master.Fd()))
+
+	slavePath, err := ptsname(master)
+	assert.NoError(err)
+	assert.Equal(console, slavePath)
+
+	slave, err := os.OpenFile(console, os.O_RDWR|syscall.O_NOCTTY, 0)
+	assert.NoError(err)
+	defer slave.Close()
+
+	_, err = slave.Write([]byte("foo\n"))
+	assert.NoError(err)
+
+	buf := make([]byte, 16)
+	n, err := master.Read(buf)
+	assert.NoError(err)
+	assert.Equal("foo", strings.TrimSpace(string(buf[:n])))
+}
+
+func TestCheckConsole(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		console       string
+		terminal      bool
+		expectFailure bool
+	}
+
+	data := []testData{
+		{"", false, false},
+		{"", true, false},
+		{testConsole, true, false},
+		{testConsole, false, true},
+	}
+
+	for i, d := range data {
+		err := checkConsole(d.console, d.terminal)
+		if d.expectFailure {
+			assert.Error(err, "test %d (%+v)", i, d)
+		} else {
+			assert.NoError(err, "test %d (%+v)", i, d)
+		}
+	}
+}
+
 func testNoNeedForOutput(t *testing.T, detach bool, tty bool, expected bool) {
 	assert := assert.New(t)
 	result := noNeedForOutput(detach, tty)
@@ -620,3 +858,34 @@ func TestGetCgroupsDirPath(t *testing.T) {
 		assert.Equal(d.expectedResult, path)
 	}
 }
+
+func TestGetEnvVars(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		env      []string
+		expected []vc.EnvVar
+	}
+
+	data := []testData{
+		{nil, nil},
+		{[]string{}, nil},
+		{[]string{"A=1", "B=2"}, []vc.EnvVar{{Var: "A", Value: "1"}, {Var: "B", Value: "2"}}},
+
+		// order is preserved
+		{[]string{"B=2", "A=1"}, []vc.EnvVar{{Var: "B", Value: "2"}, {Var: "A", Value: "1"}}},
+
+		// values can be empty, contain "=" or spaces
+		{[]string{"A="}, []vc.EnvVar{{Var: "A", Value: ""}}},
+		{[]string{"A=b=c"}, []vc.EnvVar{{Var: "A", Value: "b=c"}}},
+		{[]string{"A= b "}, []vc.EnvVar{{Var: "A", Value: " b "}}},
+
+		// invalid entries are ignored
+		{[]string{"A", "=b", "C=d"}, []vc.EnvVar{{Var: "C", Value: "d"}}},
+	}
+
+	for _, d := range data {
+		envVars := getEnvVars(d.env)
+		assert.Equal(d.expected, envVars, "test data: %+v", d)
+	}
+}
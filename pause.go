@@ -16,6 +16,9 @@
 package main
 
 import (
+	"fmt"
+
+	vc "github.com/containers/virtcontainers"
 	"github.com/urfave/cli"
 )
 
@@ -51,16 +54,33 @@ Where "<container-id>" is the container name to be resumed.`,
 
 func toggleContainerPause(containerID string, pause bool) (err error) {
 	// Checks the MUST and MUST NOT from OCI runtime specification
-	_, podID, err := getExistingContainerInfo(containerID)
+	status, podID, err := getExistingContainerInfo(containerID)
 	if err != nil {
 		return err
 	}
 
+	log := containerLogEntry(status.ID, podID)
+
+	if pause && status.State.State == vc.StatePaused {
+		return fmt.Errorf("Container %s is already paused", status.ID)
+	}
+
 	if pause {
 		_, err = vci.PausePod(podID)
-	} else {
-		_, err = vci.ResumePod(podID)
+		return err
+	}
+
+	if _, err = vci.ResumePod(podID); err != nil {
+		return err
+	}
+
+	// The guest clock stopped while the VM was paused. Failing to
+	// set it does not prevent the container from running.
+	if syncGuestTime {
+		if err := syncTime(podID, status.ID); err != nil {
+			log.WithError(err).Warn("Guest time not synchronized")
+		}
 	}
 
-	return err
+	return nil
 }
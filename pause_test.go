@@ -15,7 +15,9 @@
 package main
 
 import (
+	"errors"
 	"flag"
+	"os/exec"
 	"testing"
 
 	vc "github.com/containers/virtcontainers"
@@ -93,6 +95,31 @@ func TestPauseCLIFunctionPausePodFailure(t *testing.T) {
 	execCLICommandFunc(assert, pauseCLICommand, set, true)
 }
 
+func TestPauseCLIFunctionAlreadyPausedFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	state := vc.State{
+		State: vc.StatePaused,
+	}
+
+	testingImpl.PausePodFunc = func(podID string) (vc.VCPod, error) {
+		assert.Fail("PausePod should not be called for a paused container")
+		return &vcMock.Pod{}, nil
+	}
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return newSingleContainerPodStatusList(testPodID, testContainerID, state, state, map[string]string{}), nil
+	}
+	defer func() {
+		testingImpl.PausePodFunc = nil
+		testingImpl.ListPodFunc = nil
+	}()
+
+	set := flag.NewFlagSet("", 0)
+	set.Parse([]string{testContainerID})
+
+	execCLICommandFunc(assert, pauseCLICommand, set, true)
+}
+
 func TestResumeCLIFunctionSuccessful(t *testing.T) {
 	assert := assert.New(t)
 
@@ -152,3 +179,58 @@ func TestResumeCLIFunctionPausePodFailure(t *testing.T) {
 
 	execCLICommandFunc(assert, resumeCLICommand, set, true)
 }
+
+func TestResumeCLIFunctionSyncGuestTime(t *testing.T) {
+	assert := assert.New(t)
+
+	state := vc.State{
+		State: vc.StatePaused,
+	}
+
+	savedSyncGuestTime := syncGuestTime
+	defer func() {
+		syncGuestTime = savedSyncGuestTime
+	}()
+
+	entered := 0
+
+	testingImpl.ResumePodFunc = testResumePodFuncReturnNil
+	testingImpl.EnterContainerFunc = func(podID, containerID string, cmd vc.Cmd) (vc.VCPod, vc.VCContainer, *vc.Process, error) {
+		entered++
+		assert.Equal("date", cmd.Args[0])
+
+		shim := exec.Command("true")
+		if err := shim.Start(); err != nil {
+			return nil, nil, nil, err
+		}
+
+		return &vcMock.Pod{}, &vcMock.Container{}, &vc.Process{Pid: shim.Process.Pid}, nil
+	}
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return newSingleContainerPodStatusList(testPodID, testContainerID, state, state, map[string]string{}), nil
+	}
+	defer func() {
+		testingImpl.ResumePodFunc = nil
+		testingImpl.EnterContainerFunc = nil
+		testingImpl.ListPodFunc = nil
+	}()
+
+	set := flag.NewFlagSet("", 0)
+	set.Parse([]string{testContainerID})
+
+	syncGuestTime = false
+	execCLICommandFunc(assert, resumeCLICommand, set, false)
+	assert.Equal(0, entered)
+
+	syncGuestTime = true
+	execCLICommandFunc(assert, resumeCLICommand, set, false)
+	assert.Equal(1, entered)
+
+	// failing to set the guest time does not fail the command
+	testingImpl.EnterContainerFunc = func(podID, containerID string, cmd vc.Cmd) (vc.VCPod, vc.VCContainer, *vc.Process, error) {
+		entered++
+		return nil, nil, nil, errors.New("no date command")
+	}
+	execCLICommandFunc(assert, resumeCLICommand, set, false)
+	assert.Equal(2, entered)
+}
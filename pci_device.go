@@ -0,0 +1,426 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+
+	"github.com/containers/virtcontainers/pkg/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sirupsen/logrus"
+)
+
+// pciDeviceAnnotation specifies a comma-separated list of host PCI
+// devices, given by their BDF (for example "0000:03:00.0"), to pass
+// through to the VM of a pod using VFIO.
+const pciDeviceAnnotation = hypervisorAnnotationPrefix + "pci_device"
+
+// pciDriverAnnotation records the PCI devices the runtime rebound to
+// vfio-pci and the host driver each one was bound to before, as a
+// comma-separated list of <bdf>=<driver>, so that they can be given back
+// to that driver when the pod is deleted. It is set by the runtime and
+// any value from the bundle is overwritten.
+const pciDriverAnnotation = hypervisorAnnotationPrefix + "pci_driver"
+
+// vfioPCIDriver is the name of the host driver a PCI device must be bound
+// to in order to be passed through to a VM.
+const vfioPCIDriver = "vfio-pci"
+
+// sysfsFileMode is the mode used to write sysfs files.
+const sysfsFileMode = os.FileMode(0200)
+
+// Variables to allow tests to modify the paths of the host PCI devices.
+var (
+	sysBusPCIDevicesPath = "/sys/bus/pci/devices"
+	sysBusPCIProbePath   = "/sys/bus/pci/drivers_probe"
+	sysBusPCIDriversPath = "/sys/bus/pci/drivers"
+	vfioDevPath          = "/dev/vfio"
+)
+
+// vfioGroupInUseFunc is used to check whether a VFIO group is in use. It
+// is a variable to allow tests to mock it.
+var vfioGroupInUseFunc = vfioGroupInUse
+
+// bdfRegex matches a PCI address with an optional domain, such as
+// "0000:03:00.0" or "03:00.0".
+var bdfRegex = regexp.MustCompile(`^([0-9a-f]{4}:)?[0-9a-f]{2}:[0-9a-f]{2}\.[0-7]$`)
+
+// parseBDF validates the specified PCI address and returns it in its
+// canonical form, including the domain.
+func parseBDF(bdf string) (string, error) {
+	bdf = strings.ToLower(strings.TrimSpace(bdf))
+
+	if !bdfRegex.MatchString(bdf) {
+		return "", fmt.Errorf("Invalid PCI address %q: expected [domain:]bus:slot.function, for example \"0000:03:00.0\"", bdf)
+	}
+
+	if strings.Count(bdf, ":") == 1 {
+		bdf = "0000:" + bdf
+	}
+
+	return bdf, nil
+}
+
+// getPCIDevices returns the PCI addresses listed by pciDeviceAnnotation,
+// or nil if the annotation is not specified.
+func getPCIDevices(annotations map[string]string) ([]string, error) {
+	value, ok := annotations[pciDeviceAnnotation]
+	if !ok {
+		return nil, nil
+	}
+
+	var devices []string
+
+	for _, field := range strings.Split(value, ",") {
+		bdf, err := parseBDF(field)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid annotation %s=%q: %v", pciDeviceAnnotation, value, err)
+		}
+
+		devices = append(devices, bdf)
+	}
+
+	return devices, nil
+}
+
+// readLinkBase returns the last element of the target of the specified
+// symbolic link, or "" if the link does not exist.
+func readLinkBase(path string) (string, error) {
+	target, err := os.Readlink(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	return filepath.Base(target), nil
+}
+
+// getPCIDeviceDriver returns the name of the host driver the specified
+// PCI device is bound to, or "" if it is not bound to any driver.
+func getPCIDeviceDriver(bdf string) (string, error) {
+	return readLinkBase(filepath.Join(sysBusPCIDevicesPath, bdf, "driver"))
+}
+
+// getPCIDeviceIOMMUGroup returns the IOMMU group of the specified PCI
+// device.
+func getPCIDeviceIOMMUGroup(bdf string) (string, error) {
+	group, err := readLinkBase(filepath.Join(sysBusPCIDevicesPath, bdf, "iommu_group"))
+	if err != nil {
+		return "", err
+	}
+
+	if group == "" {
+		return "", fmt.Errorf("PCI device %v has no IOMMU group (is the IOMMU enabled?)", bdf)
+	}
+
+	return group, nil
+}
+
+// vfioGroupInUse returns true if the specified VFIO group device is
+// already opened, for example by the hypervisor of another pod. A VFIO
+// group can only be opened once.
+func vfioGroupInUse(path string) (bool, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err == nil {
+		f.Close()
+		return false, nil
+	}
+
+	if pathErr, ok := err.(*os.PathError); ok && pathErr.Err == syscall.EBUSY {
+		return true, nil
+	}
+
+	return false, err
+}
+
+// getVFIODevice returns the OCI device describing the VFIO group device
+// of the specified IOMMU group.
+func getVFIODevice(group string) (specs.LinuxDevice, error) {
+	path := filepath.Join(vfioDevPath, group)
+
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return specs.LinuxDevice{}, err
+	}
+
+	if st.Mode&syscall.S_IFMT != syscall.S_IFCHR {
+		return specs.LinuxDevice{}, fmt.Errorf("%v is not a character device", path)
+	}
+
+	rdev := uint64(st.Rdev)
+
+	return specs.LinuxDevice{
+		Path:  path,
+		Type:  "c",
+		Major: int64((rdev >> 8) & 0xfff),
+		Minor: int64((rdev & 0xff) | ((rdev >> 12) & 0xfff00)),
+	}, nil
+}
+
+// checkPCIDevice checks that the specified PCI device can be passed
+// through to a VM and returns its IOMMU group and current host driver.
+func checkPCIDevice(bdf string) (group, driver string, err error) {
+	if !fileExists(filepath.Join(sysBusPCIDevicesPath, bdf)) {
+		return "", "", fmt.Errorf("PCI device %v does not exist", bdf)
+	}
+
+	group, err = getPCIDeviceIOMMUGroup(bdf)
+	if err != nil {
+		return "", "", err
+	}
+
+	driver, err = getPCIDeviceDriver(bdf)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Only a device already bound to vfio-pci can be in use by a VM.
+	if driver != vfioPCIDriver {
+		return group, driver, nil
+	}
+
+	device, err := getVFIODevice(group)
+	if err != nil {
+		return "", "", err
+	}
+
+	inUse, err := vfioGroupInUseFunc(device.Path)
+	if err != nil {
+		return "", "", err
+	}
+
+	if inUse {
+		return "", "", fmt.Errorf("PCI device %v is already in use (IOMMU group %v)", bdf, group)
+	}
+
+	return group, driver, nil
+}
+
+// bindPCIDevice binds the specified PCI device to the vfio-pci driver,
+// unbinding it from its current driver first. It returns the OCI device
+// of its VFIO group and the driver the device was bound to before.
+func bindPCIDevice(bdf string) (specs.LinuxDevice, string, error) {
+	group, driver, err := checkPCIDevice(bdf)
+	if err != nil {
+		return specs.LinuxDevice{}, "", err
+	}
+
+	devicePath := filepath.Join(sysBusPCIDevicesPath, bdf)
+
+	if driver != vfioPCIDriver {
+		if driver != "" {
+			if err := writeFile(filepath.Join(devicePath, "driver", "unbind"), bdf, sysfsFileMode); err != nil {
+				return specs.LinuxDevice{}, "", err
+			}
+		}
+
+		if err := writeFile(filepath.Join(devicePath, "driver_override"), vfioPCIDriver, sysfsFileMode); err != nil {
+			return specs.LinuxDevice{}, "", err
+		}
+
+		if err := writeFile(sysBusPCIProbePath, bdf, sysfsFileMode); err != nil {
+			return specs.LinuxDevice{}, "", err
+		}
+
+		newDriver, err := getPCIDeviceDriver(bdf)
+		if err != nil {
+			return specs.LinuxDevice{}, "", err
+		}
+
+		if newDriver != vfioPCIDriver {
+			return specs.LinuxDevice{}, "", fmt.Errorf("Cannot bind PCI device %v to %v (is the %v module loaded?)",
+				bdf, vfioPCIDriver, vfioPCIDriver)
+		}
+
+		ccLog.WithFields(logrus.Fields{
+			"device":      bdf,
+			"iommu-group": group,
+			"driver":      driver,
+		}).Info("Bound PCI device to " + vfioPCIDriver)
+	}
+
+	device, err := getVFIODevice(group)
+	if err != nil {
+		return specs.LinuxDevice{}, "", err
+	}
+
+	return device, driver, nil
+}
+
+// restorePCIDevice unbinds the specified PCI device from the vfio-pci
+// driver and binds it to the specified driver again. A device that was
+// not bound to any driver is left unbound.
+func restorePCIDevice(bdf, driver string) error {
+	devicePath := filepath.Join(sysBusPCIDevicesPath, bdf)
+
+	current, err := getPCIDeviceDriver(bdf)
+	if err != nil {
+		return err
+	}
+
+	if current == vfioPCIDriver {
+		if err := writeFile(filepath.Join(devicePath, "driver", "unbind"), bdf, sysfsFileMode); err != nil {
+			return err
+		}
+	}
+
+	// An empty line clears the override.
+	if err := writeFile(filepath.Join(devicePath, "driver_override"), "\n", sysfsFileMode); err != nil {
+		return err
+	}
+
+	if driver == "" {
+		return nil
+	}
+
+	return writeFile(filepath.Join(sysBusPCIDriversPath, driver, "bind"), bdf, sysfsFileMode)
+}
+
+// reboundPCIDevice is a PCI device the runtime bound to vfio-pci.
+type reboundPCIDevice struct {
+	bdf    string
+	driver string
+}
+
+// formatPCIDrivers returns the value of pciDriverAnnotation describing
+// the specified devices.
+func formatPCIDrivers(devices []reboundPCIDevice) string {
+	var fields []string
+
+	for _, d := range devices {
+		fields = append(fields, d.bdf+"="+d.driver)
+	}
+
+	return strings.Join(fields, ",")
+}
+
+// getPCIDeviceDrivers returns the devices recorded by pciDriverAnnotation.
+func getPCIDeviceDrivers(annotations map[string]string) ([]reboundPCIDevice, error) {
+	value := annotations[pciDriverAnnotation]
+	if value == "" {
+		return nil, nil
+	}
+
+	var devices []reboundPCIDevice
+
+	for _, field := range strings.Split(value, ",") {
+		fields := strings.SplitN(field, "=", 2)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("Invalid annotation %s=%q", pciDriverAnnotation, value)
+		}
+
+		bdf, err := parseBDF(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid annotation %s=%q: %v", pciDriverAnnotation, value, err)
+		}
+
+		driver := fields[1]
+		if driver != "" && (driver != filepath.Base(driver) || driver == "." || driver == "..") {
+			return nil, fmt.Errorf("Invalid annotation %s=%q: invalid driver %q", pciDriverAnnotation, value, driver)
+		}
+
+		devices = append(devices, reboundPCIDevice{bdf: bdf, driver: driver})
+	}
+
+	return devices, nil
+}
+
+// restorePCIDevices gives the specified devices back to their driver.
+// Errors are only logged so that the other devices are still restored.
+func restorePCIDevices(devices []reboundPCIDevice) {
+	for _, d := range devices {
+		if err := restorePCIDevice(d.bdf, d.driver); err != nil {
+			ccLog.WithError(err).WithFields(logrus.Fields{
+				"device": d.bdf,
+				"driver": d.driver,
+			}).Warn("Cannot restore PCI device driver")
+		}
+	}
+}
+
+// setupPCIDevices binds the PCI devices requested by pciDeviceAnnotation
+// to vfio-pci and adds their VFIO group to the devices of the OCI
+// specification so that virtcontainers passes them through to the VM.
+// The devices it rebinds are recorded by pciDriverAnnotation.
+func setupPCIDevices(ociSpec *oci.CompatOCISpec) (err error) {
+	bdfs, err := getPCIDevices(ociSpec.Annotations)
+	if err != nil || len(bdfs) == 0 {
+		return err
+	}
+
+	if ociSpec.Linux == nil {
+		ociSpec.Linux = &specs.Linux{}
+	}
+
+	var rebound []reboundPCIDevice
+
+	defer func() {
+		if err != nil {
+			restorePCIDevices(rebound)
+		}
+	}()
+
+	groups := make(map[string]bool)
+
+	for _, bdf := range bdfs {
+		device, driver, err := bindPCIDevice(bdf)
+		if err != nil {
+			return err
+		}
+
+		// A device already bound to vfio-pci is left as it is.
+		if driver != vfioPCIDriver {
+			rebound = append(rebound, reboundPCIDevice{bdf: bdf, driver: driver})
+		}
+
+		// All the devices of an IOMMU group are passed through together.
+		if groups[device.Path] {
+			continue
+		}
+
+		groups[device.Path] = true
+		ociSpec.Linux.Devices = append(ociSpec.Linux.Devices, device)
+	}
+
+	ociSpec.Annotations[pciDriverAnnotation] = formatPCIDrivers(rebound)
+
+	return nil
+}
+
+// teardownPCIDevices gives the PCI devices recorded by pciDriverAnnotation
+// back to the driver they were bound to before the pod was created.
+// Errors are only logged so that the rest of the pod can still be
+// deleted.
+func teardownPCIDevices(ociSpec oci.CompatOCISpec) {
+	// pciDriverAnnotation is only set by setupPCIDevices() if devices
+	// were requested.
+	if bdfs, err := getPCIDevices(ociSpec.Annotations); err != nil || len(bdfs) == 0 {
+		return
+	}
+
+	devices, err := getPCIDeviceDrivers(ociSpec.Annotations)
+	if err != nil {
+		ccLog.WithError(err).Warn("Cannot restore PCI device drivers")
+		return
+	}
+
+	restorePCIDevices(devices)
+}
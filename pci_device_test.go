@@ -0,0 +1,451 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/virtcontainers/pkg/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+const testBDF = "0000:03:00.0"
+
+func TestParseBDF(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		bdf           string
+		expectFailure bool
+		expected      string
+	}
+
+	data := []testData{
+		{"0000:03:00.0", false, "0000:03:00.0"},
+		{"03:00.0", false, "0000:03:00.0"},
+		{"0000:0A:1f.7", false, "0000:0a:1f.7"},
+		{" 0001:03:00.1 ", false, "0001:03:00.1"},
+
+		{"", true, ""},
+		{"03:00", true, ""},
+		{"0000:03:00.8", true, ""},
+		{"0000:3:00.0", true, ""},
+		{"0000:03:00.0.0", true, ""},
+		{"00000:03:00.0", true, ""},
+		{"../03:00.0", true, ""},
+		{"0000:0g:00.0", true, ""},
+	}
+
+	for _, d := range data {
+		bdf, err := parseBDF(d.bdf)
+		if d.expectFailure {
+			assert.Error(err, "test data: %+v", d)
+			continue
+		}
+
+		assert.NoError(err, "test data: %+v", d)
+		assert.Equal(d.expected, bdf, "test data: %+v", d)
+	}
+}
+
+func TestGetPCIDevices(t *testing.T) {
+	assert := assert.New(t)
+
+	devices, err := getPCIDevices(nil)
+	assert.NoError(err)
+	assert.Nil(devices)
+
+	devices, err = getPCIDevices(map[string]string{pciDeviceAnnotation: "03:00.0,0000:04:00.1"})
+	assert.NoError(err)
+	assert.Equal([]string{"0000:03:00.0", "0000:04:00.1"}, devices)
+
+	_, err = getPCIDevices(map[string]string{pciDeviceAnnotation: "03:00.0,foo"})
+	assert.Error(err)
+
+	_, err = getPCIDevices(map[string]string{pciDeviceAnnotation: ""})
+	assert.Error(err)
+}
+
+// makeTestPCIDevice creates the sysfs entries of a PCI device bound to
+// the specified driver below dir and returns the path to the device.
+func makeTestPCIDevice(dir, bdf, driver, group string) (string, error) {
+	devicePath := filepath.Join(dir, "devices", bdf)
+	if err := os.MkdirAll(devicePath, testDirMode); err != nil {
+		return "", err
+	}
+
+	if driver != "" {
+		driverPath := filepath.Join(dir, "drivers", driver)
+		if err := os.MkdirAll(driverPath, testDirMode); err != nil {
+			return "", err
+		}
+
+		if err := os.Symlink(driverPath, filepath.Join(devicePath, "driver")); err != nil {
+			return "", err
+		}
+	}
+
+	if group != "" {
+		groupPath := filepath.Join(dir, "iommu_groups", group)
+		if err := os.MkdirAll(groupPath, testDirMode); err != nil {
+			return "", err
+		}
+
+		if err := os.Symlink(groupPath, filepath.Join(devicePath, "iommu_group")); err != nil {
+			return "", err
+		}
+	}
+
+	return devicePath, nil
+}
+
+func setTestPCIPaths(dir string) func() {
+	savedDevicesPath := sysBusPCIDevicesPath
+	savedProbePath := sysBusPCIProbePath
+	savedDriversPath := sysBusPCIDriversPath
+	savedVFIODevPath := vfioDevPath
+	savedInUseFunc := vfioGroupInUseFunc
+
+	sysBusPCIDevicesPath = filepath.Join(dir, "devices")
+	sysBusPCIProbePath = filepath.Join(dir, "drivers_probe")
+	sysBusPCIDriversPath = filepath.Join(dir, "drivers")
+	vfioDevPath = filepath.Join(dir, "vfio")
+
+	return func() {
+		sysBusPCIDevicesPath = savedDevicesPath
+		sysBusPCIProbePath = savedProbePath
+		sysBusPCIDriversPath = savedDriversPath
+		vfioDevPath = savedVFIODevPath
+		vfioGroupInUseFunc = savedInUseFunc
+	}
+}
+
+func TestGetPCIDeviceDriverAndGroup(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	defer setTestPCIPaths(tmpdir)()
+
+	_, err = makeTestPCIDevice(tmpdir, testBDF, "e1000e", "12")
+	assert.NoError(err)
+
+	_, err = makeTestPCIDevice(tmpdir, "0000:04:00.0", "", "")
+	assert.NoError(err)
+
+	driver, err := getPCIDeviceDriver(testBDF)
+	assert.NoError(err)
+	assert.Equal("e1000e", driver)
+
+	group, err := getPCIDeviceIOMMUGroup(testBDF)
+	assert.NoError(err)
+	assert.Equal("12", group)
+
+	driver, err = getPCIDeviceDriver("0000:04:00.0")
+	assert.NoError(err)
+	assert.Equal("", driver)
+
+	_, err = getPCIDeviceIOMMUGroup("0000:04:00.0")
+	assert.Error(err)
+}
+
+func TestBindPCIDevice(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	defer setTestPCIPaths(tmpdir)()
+
+	err = os.MkdirAll(vfioDevPath, testDirMode)
+	assert.NoError(err)
+
+	// /dev/null stands in for the VFIO group device
+	err = os.Symlink("/dev/null", filepath.Join(vfioDevPath, "12"))
+	assert.NoError(err)
+
+	vfioGroupInUseFunc = func(path string) (bool, error) {
+		return false, nil
+	}
+
+	// device does not exist
+	_, _, err = bindPCIDevice(testBDF)
+	assert.Error(err)
+
+	_, err = makeTestPCIDevice(tmpdir, testBDF, vfioPCIDriver, "12")
+	assert.NoError(err)
+
+	device, driver, err := bindPCIDevice(testBDF)
+	assert.NoError(err)
+	assert.Equal(vfioPCIDriver, driver)
+	assert.Equal(filepath.Join(vfioDevPath, "12"), device.Path)
+	assert.Equal("c", device.Type)
+
+	// /dev/null is 1:3
+	assert.Equal(int64(1), device.Major)
+	assert.Equal(int64(3), device.Minor)
+}
+
+func TestBindPCIDeviceInUse(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	defer setTestPCIPaths(tmpdir)()
+
+	err = os.MkdirAll(vfioDevPath, testDirMode)
+	assert.NoError(err)
+
+	// /dev/null stands in for the VFIO group device
+	err = os.Symlink("/dev/null", filepath.Join(vfioDevPath, "12"))
+	assert.NoError(err)
+
+	_, err = makeTestPCIDevice(tmpdir, testBDF, vfioPCIDriver, "12")
+	assert.NoError(err)
+
+	vfioGroupInUseFunc = func(path string) (bool, error) {
+		return true, nil
+	}
+
+	_, _, err = bindPCIDevice(testBDF)
+	assert.Error(err)
+	assert.Contains(err.Error(), "already in use")
+
+	// the device is not added to the specification
+	ociSpec := oci.CompatOCISpec{
+		Spec: specs.Spec{
+			Annotations: map[string]string{pciDeviceAnnotation: testBDF},
+		},
+	}
+
+	err = setupPCIDevices(&ociSpec)
+	assert.Error(err)
+	assert.Empty(ociSpec.Linux.Devices)
+}
+
+func TestBindPCIDeviceNoVFIODriver(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	defer setTestPCIPaths(tmpdir)()
+
+	devicePath, err := makeTestPCIDevice(tmpdir, testBDF, "e1000e", "12")
+	assert.NoError(err)
+
+	// the fake device is not rebound when probed
+	_, _, err = bindPCIDevice(testBDF)
+	assert.Error(err)
+
+	data, err := ioutil.ReadFile(filepath.Join(devicePath, "driver", "unbind"))
+	assert.NoError(err)
+	assert.Equal(testBDF, string(data))
+
+	data, err = ioutil.ReadFile(filepath.Join(devicePath, "driver_override"))
+	assert.NoError(err)
+	assert.Equal(vfioPCIDriver, string(data))
+
+	data, err = ioutil.ReadFile(sysBusPCIProbePath)
+	assert.NoError(err)
+	assert.Equal(testBDF, string(data))
+}
+
+func TestRestorePCIDevice(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	defer setTestPCIPaths(tmpdir)()
+
+	devicePath, err := makeTestPCIDevice(tmpdir, testBDF, vfioPCIDriver, "12")
+	assert.NoError(err)
+
+	err = os.MkdirAll(filepath.Join(sysBusPCIDriversPath, "e1000e"), testDirMode)
+	assert.NoError(err)
+
+	err = restorePCIDevice(testBDF, "e1000e")
+	assert.NoError(err)
+
+	data, err := ioutil.ReadFile(filepath.Join(devicePath, "driver", "unbind"))
+	assert.NoError(err)
+	assert.Equal(testBDF, string(data))
+
+	data, err = ioutil.ReadFile(filepath.Join(devicePath, "driver_override"))
+	assert.NoError(err)
+	assert.Equal("\n", string(data))
+
+	data, err = ioutil.ReadFile(filepath.Join(sysBusPCIDriversPath, "e1000e", "bind"))
+	assert.NoError(err)
+	assert.Equal(testBDF, string(data))
+
+	// the kernel is not asked to pick a driver
+	assert.False(fileExists(sysBusPCIProbePath))
+}
+
+func TestGetPCIDeviceDrivers(t *testing.T) {
+	assert := assert.New(t)
+
+	devices := []reboundPCIDevice{
+		{bdf: testBDF, driver: "e1000e"},
+		{bdf: "0000:04:00.0", driver: ""},
+	}
+
+	value := formatPCIDrivers(devices)
+	assert.Equal(testBDF+"=e1000e,0000:04:00.0=", value)
+
+	result, err := getPCIDeviceDrivers(map[string]string{pciDriverAnnotation: value})
+	assert.NoError(err)
+	assert.Equal(devices, result)
+
+	result, err = getPCIDeviceDrivers(map[string]string{})
+	assert.NoError(err)
+	assert.Empty(result)
+
+	for _, value := range []string{testBDF, "foo=e1000e", testBDF + "=../e1000e", testBDF + "=.."} {
+		_, err = getPCIDeviceDrivers(map[string]string{pciDriverAnnotation: value})
+		assert.Error(err, "value: %q", value)
+	}
+}
+
+func TestTeardownPCIDevicesOnlyRebound(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	defer setTestPCIPaths(tmpdir)()
+
+	const otherBDF = "0000:04:00.0"
+
+	reboundPath, err := makeTestPCIDevice(tmpdir, testBDF, vfioPCIDriver, "12")
+	assert.NoError(err)
+
+	// already bound to vfio-pci before the pod was created
+	otherPath, err := makeTestPCIDevice(tmpdir, otherBDF, vfioPCIDriver, "12")
+	assert.NoError(err)
+
+	err = os.MkdirAll(filepath.Join(sysBusPCIDriversPath, "e1000e"), testDirMode)
+	assert.NoError(err)
+
+	ociSpec := oci.CompatOCISpec{
+		Spec: specs.Spec{
+			Annotations: map[string]string{
+				pciDeviceAnnotation: testBDF + "," + otherBDF,
+				pciDriverAnnotation: testBDF + "=e1000e",
+			},
+		},
+	}
+
+	teardownPCIDevices(ociSpec)
+
+	assert.True(fileExists(filepath.Join(reboundPath, "driver_override")))
+	assert.False(fileExists(filepath.Join(otherPath, "driver_override")))
+
+	data, err := ioutil.ReadFile(filepath.Join(sysBusPCIDriversPath, "e1000e", "bind"))
+	assert.NoError(err)
+	assert.Equal(testBDF, string(data))
+
+	// the driver annotation is ignored without devices
+	err = os.Remove(filepath.Join(reboundPath, "driver_override"))
+	assert.NoError(err)
+
+	ociSpec.Annotations = map[string]string{
+		pciDriverAnnotation: testBDF + "=e1000e",
+	}
+
+	teardownPCIDevices(ociSpec)
+
+	assert.False(fileExists(filepath.Join(reboundPath, "driver_override")))
+}
+
+func TestSetupPCIDevicesRecordsDrivers(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	defer setTestPCIPaths(tmpdir)()
+
+	err = os.MkdirAll(vfioDevPath, testDirMode)
+	assert.NoError(err)
+
+	// /dev/null stands in for the VFIO group device
+	err = os.Symlink("/dev/null", filepath.Join(vfioDevPath, "12"))
+	assert.NoError(err)
+
+	vfioGroupInUseFunc = func(path string) (bool, error) {
+		return false, nil
+	}
+
+	_, err = makeTestPCIDevice(tmpdir, testBDF, vfioPCIDriver, "12")
+	assert.NoError(err)
+
+	// a value from the bundle is overwritten
+	ociSpec := oci.CompatOCISpec{
+		Spec: specs.Spec{
+			Annotations: map[string]string{
+				pciDeviceAnnotation: testBDF,
+				pciDriverAnnotation: testBDF + "=e1000e",
+			},
+		},
+	}
+
+	err = setupPCIDevices(&ociSpec)
+	assert.NoError(err)
+	assert.Len(ociSpec.Linux.Devices, 1)
+	assert.Equal("", ociSpec.Annotations[pciDriverAnnotation])
+}
+
+func TestRestorePCIDeviceNoDriver(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	defer setTestPCIPaths(tmpdir)()
+
+	devicePath, err := makeTestPCIDevice(tmpdir, testBDF, vfioPCIDriver, "12")
+	assert.NoError(err)
+
+	err = restorePCIDevice(testBDF, "")
+	assert.NoError(err)
+
+	data, err := ioutil.ReadFile(filepath.Join(devicePath, "driver", "unbind"))
+	assert.NoError(err)
+	assert.Equal(testBDF, string(data))
+
+	data, err = ioutil.ReadFile(filepath.Join(devicePath, "driver_override"))
+	assert.NoError(err)
+	assert.Equal("\n", string(data))
+
+	// the device is left unbound
+	assert.False(fileExists(sysBusPCIProbePath))
+}
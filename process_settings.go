@@ -0,0 +1,110 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// minOOMScoreAdj and maxOOMScoreAdj are the bounds of the value of
+	// /proc/<pid>/oom_score_adj.
+	minOOMScoreAdj = -1000
+	maxOOMScoreAdj = 1000
+
+	oomScoreAdjFileMode = 0644
+)
+
+// procPath is the directory the host processes are described in. It is a
+// variable to allow tests to modify it.
+var procPath = "/proc"
+
+// getOOMScoreAdj returns the OOM score adjustment of the specified OCI
+// configuration, or nil if it does not specify one.
+func getOOMScoreAdj(ociSpec oci.CompatOCISpec) (*int, error) {
+	if ociSpec.Linux == nil || ociSpec.Linux.Resources == nil || ociSpec.Linux.Resources.OOMScoreAdj == nil {
+		return nil, nil
+	}
+
+	score := *ociSpec.Linux.Resources.OOMScoreAdj
+
+	if score < minOOMScoreAdj || score > maxOOMScoreAdj {
+		return nil, fmt.Errorf("Invalid OOM score adjustment %d: expected a value between %d and %d",
+			score, minOOMScoreAdj, maxOOMScoreAdj)
+	}
+
+	return &score, nil
+}
+
+// getPidsLimit returns the maximum number of processes of the specified
+// OCI configuration, or 0 if it does not specify one. A negative limit
+// other than -1 is an error.
+func getPidsLimit(ociSpec oci.CompatOCISpec) (int64, error) {
+	if ociSpec.Linux == nil || ociSpec.Linux.Resources == nil || ociSpec.Linux.Resources.Pids == nil {
+		return 0, nil
+	}
+
+	limit := ociSpec.Linux.Resources.Pids.Limit
+
+	if limit < -1 {
+		return 0, fmt.Errorf("Invalid pids limit %d: expected -1 or 0 for no limit, or a positive value", limit)
+	}
+
+	if limit < 0 {
+		return 0, nil
+	}
+
+	return limit, nil
+}
+
+// setOOMScoreAdj sets the OOM score adjustment of the specified host
+// process.
+func setOOMScoreAdj(pid, score int) error {
+	path := filepath.Join(procPath, strconv.Itoa(pid), "oom_score_adj")
+
+	return ioutil.WriteFile(path, []byte(strconv.Itoa(score)), oomScoreAdjFileMode)
+}
+
+// setVMOOMScoreAdj sets the OOM score adjustment of the hypervisor of the
+// specified pod, which must be running, so that the host OOM killer
+// honours the score of its sandbox container.
+func setVMOOMScoreAdj(podID string, score int) error {
+	threadIDs, err := getVCPUThreadIDs(podID)
+	if err != nil {
+		return fmt.Errorf("Cannot get the vCPU threads of pod %v: %v", podID, err)
+	}
+
+	if len(threadIDs) == 0 {
+		return fmt.Errorf("Cannot find the hypervisor of pod %v", podID)
+	}
+
+	// The score is shared by all the threads of the hypervisor.
+	if err := setOOMScoreAdj(threadIDs[0], score); err != nil {
+		return fmt.Errorf("Cannot set the OOM score adjustment of pod %v: %v", podID, err)
+	}
+
+	ccLog.WithFields(logrus.Fields{
+		"pod":           podID,
+		"oom-score-adj": score,
+	}).Debug("Set VM OOM score adjustment")
+
+	return nil
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/virtcontainers/pkg/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetOOMScoreAdj(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		score         *int
+		expectFailure bool
+	}
+
+	intPtr := func(i int) *int {
+		return &i
+	}
+
+	data := []testData{
+		{nil, false},
+		{intPtr(0), false},
+		{intPtr(-1000), false},
+		{intPtr(1000), false},
+		{intPtr(-999), false},
+
+		{intPtr(-1001), true},
+		{intPtr(1001), true},
+	}
+
+	for _, d := range data {
+		ociSpec := oci.CompatOCISpec{
+			Spec: specs.Spec{
+				Linux: &specs.Linux{
+					Resources: &specs.LinuxResources{
+						OOMScoreAdj: d.score,
+					},
+				},
+			},
+		}
+
+		score, err := getOOMScoreAdj(ociSpec)
+		if d.expectFailure {
+			assert.Error(err, "test data: %+v", d)
+			continue
+		}
+
+		assert.NoError(err, "test data: %+v", d)
+		assert.Equal(d.score, score, "test data: %+v", d)
+	}
+
+	// no resources
+	score, err := getOOMScoreAdj(oci.CompatOCISpec{})
+	assert.NoError(err)
+	assert.Nil(score)
+}
+
+func TestGetPidsLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		pids          *specs.LinuxPids
+		expectedLimit int64
+		expectFailure bool
+	}
+
+	data := []testData{
+		{nil, 0, false},
+		{&specs.LinuxPids{Limit: 0}, 0, false},
+		{&specs.LinuxPids{Limit: -1}, 0, false},
+		{&specs.LinuxPids{Limit: 1}, 1, false},
+		{&specs.LinuxPids{Limit: 1024}, 1024, false},
+		{&specs.LinuxPids{Limit: -2}, 0, true},
+	}
+
+	for _, d := range data {
+		ociSpec := oci.CompatOCISpec{
+			Spec: specs.Spec{
+				Linux: &specs.Linux{
+					Resources: &specs.LinuxResources{
+						Pids: d.pids,
+					},
+				},
+			},
+		}
+
+		limit, err := getPidsLimit(ociSpec)
+		if d.expectFailure {
+			assert.Error(err, "test data: %+v", d)
+			continue
+		}
+
+		assert.NoError(err, "test data: %+v", d)
+		assert.Equal(d.expectedLimit, limit, "test data: %+v", d)
+	}
+
+	// no linux section
+	limit, err := getPidsLimit(oci.CompatOCISpec{})
+	assert.NoError(err)
+	assert.Equal(int64(0), limit)
+}
+
+func TestSetVMOOMScoreAdj(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	savedProcPath := procPath
+	procPath = filepath.Join(tmpdir, "proc")
+
+	defer func() {
+		procPath = savedProcPath
+	}()
+
+	// no hypervisor
+	err = setVMOOMScoreAdj(testPodID, 500)
+	assert.Error(err)
+
+	_, restore := setTestQMPServer(assert, tmpdir, testPodID, []int{100, 101})
+
+	// no such process
+	err = setVMOOMScoreAdj(testPodID, 500)
+	assert.Error(err)
+
+	restore()
+
+	err = os.MkdirAll(filepath.Join(procPath, "100"), testDirMode)
+	assert.NoError(err)
+
+	_, restore = setTestQMPServer(assert, tmpdir, testPodID, []int{100, 101})
+	defer restore()
+
+	err = setVMOOMScoreAdj(testPodID, -500)
+	assert.NoError(err)
+
+	contents, err := ioutil.ReadFile(filepath.Join(procPath, "100", "oom_score_adj"))
+	assert.NoError(err)
+	assert.Equal("-500", string(contents))
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+)
+
+// The runtime talks to the hypervisor of a pod over QMP directly: the QMP
+// client of github.com/01org/ciao/qemu only provides the commands
+// virtcontainers needs and cannot return the result of a command, such as
+// the vCPU threads returned by query-cpus.
+
+// qmpControlSocket is the name of the QMP socket virtcontainers creates
+// for each VM in the pod runtime directory. virtcontainers only connects
+// to it while running a command, so the runtime can use it too.
+const qmpControlSocket = "ctrl.sock"
+
+// qmpTimeout is the maximum amount of time to wait for the hypervisor to
+// answer a QMP command.
+var qmpTimeout = 10 * time.Second
+
+// qmpResponse is a message sent by the hypervisor on its QMP socket.
+type qmpResponse struct {
+	Return json.RawMessage `json:"return"`
+	Error  *struct {
+		Class string `json:"class"`
+		Desc  string `json:"desc"`
+	} `json:"error"`
+}
+
+// qmpExecute runs the specified QMP command with the specified arguments,
+// if any, and stores its result in result, ignoring any event received in
+// the meantime.
+func qmpExecute(encoder *json.Encoder, decoder *json.Decoder, command string, arguments, result interface{}) error {
+	request := map[string]interface{}{"execute": command}
+	if arguments != nil {
+		request["arguments"] = arguments
+	}
+
+	if err := encoder.Encode(request); err != nil {
+		return err
+	}
+
+	for {
+		var response qmpResponse
+
+		if err := decoder.Decode(&response); err != nil {
+			return err
+		}
+
+		if response.Error != nil {
+			return fmt.Errorf("QMP command %s failed: %s: %s", command, response.Error.Class, response.Error.Desc)
+		}
+
+		// Events have no return value.
+		if response.Return == nil {
+			continue
+		}
+
+		if result == nil {
+			return nil
+		}
+
+		return json.Unmarshal(response.Return, result)
+	}
+}
+
+// qmpRun runs the specified QMP command on the hypervisor of the specified
+// pod and stores its result in result.
+func qmpRun(podID, command string, result interface{}) error {
+	return qmpRunWithArgs(podID, command, nil, result)
+}
+
+// qmpRunWithArgs runs the specified QMP command with the specified
+// arguments on the hypervisor of the specified pod and stores its result
+// in result.
+func qmpRunWithArgs(podID, command string, arguments, result interface{}) error {
+	path := getPodRunPath(podID, qmpControlSocket)
+
+	conn, err := net.DialTimeout("unix", path, qmpTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(qmpTimeout)); err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(conn)
+	decoder := json.NewDecoder(conn)
+
+	// Skip the greeting.
+	var greeting map[string]interface{}
+	if err := decoder.Decode(&greeting); err != nil {
+		return err
+	}
+
+	if err := qmpExecute(encoder, decoder, "qmp_capabilities", nil, nil); err != nil {
+		return err
+	}
+
+	return qmpExecute(encoder, decoder, command, arguments, result)
+}
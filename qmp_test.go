@@ -0,0 +1,182 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testQMPServer emulates the QMP socket of a hypervisor whose vCPUs run
+// in the specified threads. It returns the commands received.
+func testQMPServer(l net.Listener, threadIDs []int, commands chan<- string) {
+	defer close(commands)
+
+	conn, err := l.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	encoder := json.NewEncoder(conn)
+	encoder.Encode(map[string]interface{}{"QMP": map[string]interface{}{}})
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var command struct {
+			Execute   string          `json:"execute"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+
+		if err := json.Unmarshal(scanner.Bytes(), &command); err != nil {
+			return
+		}
+
+		commands <- command.Execute
+
+		switch command.Execute {
+		case "qmp_capabilities":
+			// an event can be received at any time
+			encoder.Encode(map[string]interface{}{"event": "RESUME"})
+			encoder.Encode(map[string]interface{}{"return": map[string]interface{}{}})
+		case "query-cpus":
+			var cpus []map[string]interface{}
+
+			// in reverse order to check they are sorted
+			for i := len(threadIDs) - 1; i >= 0; i-- {
+				cpus = append(cpus, map[string]interface{}{"CPU": i, "thread_id": threadIDs[i]})
+			}
+
+			encoder.Encode(map[string]interface{}{"return": cpus})
+		case "block_set_io_throttle":
+			encoder.Encode(map[string]interface{}{"return": map[string]interface{}{}})
+		case "echo":
+			encoder.Encode(map[string]interface{}{"return": command.Arguments})
+		case "quit":
+			encoder.Encode(map[string]interface{}{"return": map[string]interface{}{}})
+			return
+		default:
+			encoder.Encode(map[string]interface{}{
+				"error": map[string]string{"class": "CommandNotFound", "desc": "unknown command"},
+			})
+		}
+	}
+}
+
+// setTestQMPServer starts a QMP server for the specified pod below dir
+// and returns the channel receiving the commands run.
+func setTestQMPServer(assert *assert.Assertions, dir, podID string, threadIDs []int) (chan string, func()) {
+	savedPath := podRunStatePath
+	podRunStatePath = dir
+
+	path := filepath.Join(podRunStatePath, podID, qmpControlSocket)
+
+	err := os.MkdirAll(filepath.Dir(path), testDirMode)
+	assert.NoError(err)
+
+	l, err := net.Listen("unix", path)
+	assert.NoError(err)
+
+	commands := make(chan string, 8)
+	go testQMPServer(l, threadIDs, commands)
+
+	return commands, func() {
+		l.Close()
+		podRunStatePath = savedPath
+	}
+}
+
+func TestQMPRunWithArgs(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	commands, restore := setTestQMPServer(assert, tmpdir, testPodID, nil)
+	defer restore()
+
+	arguments := map[string]interface{}{"device": "drive-0", "bps": 1024}
+
+	var result struct {
+		Device string `json:"device"`
+		Bps    int    `json:"bps"`
+	}
+
+	// the RESUME event sent by the server must be skipped
+	err = qmpRunWithArgs(testPodID, "echo", arguments, &result)
+	assert.NoError(err)
+	assert.Equal("drive-0", result.Device)
+	assert.Equal(1024, result.Bps)
+
+	assert.Equal("qmp_capabilities", <-commands)
+	assert.Equal("echo", <-commands)
+}
+
+func TestQMPRunNoResult(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	commands, restore := setTestQMPServer(assert, tmpdir, testPodID, nil)
+	defer restore()
+
+	err = qmpRun(testPodID, "quit", nil)
+	assert.NoError(err)
+
+	assert.Equal("qmp_capabilities", <-commands)
+	assert.Equal("quit", <-commands)
+}
+
+func TestQMPRunCommandError(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	_, restore := setTestQMPServer(assert, tmpdir, testPodID, nil)
+	defer restore()
+
+	err = qmpRun(testPodID, "unknown-command", nil)
+	assert.Error(err)
+	assert.Contains(err.Error(), "CommandNotFound")
+}
+
+func TestQMPRunNoServer(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	savedPath := podRunStatePath
+	podRunStatePath = tmpdir
+	defer func() {
+		podRunStatePath = savedPath
+	}()
+
+	err = qmpRun(testPodID, "query-cpus", nil)
+	assert.Error(err)
+}
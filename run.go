@@ -19,6 +19,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	"syscall"
 
 	"github.com/containers/virtcontainers/pkg/oci"
@@ -35,7 +36,11 @@ var runCLICommand = cli.Command{
    on your host.`,
 	Description: `The run command creates an instance of a container for a bundle. The bundle
    is a directory with a specification file named "config.json" and a root
-   filesystem.`,
+   filesystem.
+
+   Unless --detach is specified, run waits for the container to exit and
+   exits with the same exit code. The signals received in the meantime are
+   forwarded to the container.`,
 	Flags: []cli.Flag{
 		cli.StringFlag{
 			Name:  "bundle, b",
@@ -86,7 +91,7 @@ func run(containerID, bundle, console, consoleSocket, pidFile string, detach boo
 		return err
 	}
 
-	if err := create(containerID, bundle, consolePath, pidFile, detach, runtimeConfig); err != nil {
+	if err := create(containerID, bundle, consolePath, pidFile, detach, runtimeConfig, consoleLogConfig{}); err != nil {
 		return err
 	}
 
@@ -104,12 +109,17 @@ func run(containerID, bundle, console, consoleSocket, pidFile string, detach boo
 		return fmt.Errorf("There are no containers running in the pod: %s", pod.ID())
 	}
 
-	p, err := os.FindProcess(containers[0].GetPid())
+	pid := containers[0].GetPid()
+
+	p, err := os.FindProcess(pid)
 	if err != nil {
 		return err
 	}
 
+	stopForwarding := forwardSignals(pid)
 	ps, err := p.Wait()
+	stopForwarding()
+
 	if err != nil {
 		return fmt.Errorf("Process state %s: %s", ps.String(), err)
 	}
@@ -120,5 +130,59 @@ func run(containerID, bundle, console, consoleSocket, pidFile string, detach boo
 	}
 
 	//runtime should forward container exit code to the system
-	return cli.NewExitError("", ps.Sys().(syscall.WaitStatus).ExitStatus())
+	return cli.NewExitError("", exitCode(ps))
+}
+
+// unforwardedSignals lists the signals that concern the runtime itself
+// rather than the container.
+var unforwardedSignals = map[os.Signal]bool{
+	syscall.SIGCHLD:  true,
+	syscall.SIGPIPE:  true,
+	syscall.SIGURG:   true,
+	syscall.SIGWINCH: true,
+}
+
+// forwardSignals forwards the signals received by the runtime to the
+// specified process until the returned function is called. The process is
+// the shim, which passes them on to the container workload.
+func forwardSignals(pid int) func() {
+	sigCh := make(chan os.Signal, 32)
+	done := make(chan struct{})
+
+	signal.Notify(sigCh)
+
+	go func() {
+		for {
+			select {
+			case sig := <-sigCh:
+				if unforwardedSignals[sig] {
+					continue
+				}
+
+				if err := syscall.Kill(pid, sig.(syscall.Signal)); err != nil {
+					ccLog.WithError(err).WithField("signal", sig).Warn("Cannot forward signal")
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigCh)
+		close(done)
+	}
+}
+
+// exitCode returns the exit code of the specified process, following the
+// shell convention of 128 plus the signal number for a process killed by
+// a signal.
+func exitCode(ps *os.ProcessState) int {
+	status := ps.Sys().(syscall.WaitStatus)
+
+	if status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+
+	return status.ExitStatus()
 }
@@ -21,6 +21,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"syscall"
 	"testing"
 
 	vc "github.com/containers/virtcontainers"
@@ -167,10 +168,13 @@ type runContainerData struct {
 }
 
 func testRunContainerSetup(t *testing.T) runContainerData {
+	return testRunContainerSetupWorkload(t, []string{"/bin/sleep", "10"})
+}
+
+func testRunContainerSetupWorkload(t *testing.T, workload []string) runContainerData {
 	assert := assert.New(t)
 
 	// create a fake container workload
-	workload := []string{"/bin/sleep", "10"}
 	cmd := exec.Command(workload[0], workload[1:]...)
 	err := cmd.Start()
 	assert.NoError(err, "unable to start fake container workload %+v: %s", workload, err)
@@ -589,3 +593,100 @@ func TestRunContainerStartFail(t *testing.T) {
 	err, ok := err.(*cli.ExitError)
 	assert.False(ok, "error should not be a cli.ExitError: %s", err)
 }
+
+func TestRunContainerExitCode(t *testing.T) {
+	assert := assert.New(t)
+
+	const expectedExitCode = 3
+
+	d := testRunContainerSetupWorkload(t, []string{"/bin/sh", "-c", fmt.Sprintf("exit %d", expectedExitCode)})
+	defer os.RemoveAll(d.tmpDir)
+
+	// this flags is used to detect if createPodFunc was called
+	flagCreate := false
+
+	testingImpl.CreatePodFunc = func(podConfig vc.PodConfig) (vc.VCPod, error) {
+		flagCreate = true
+		return d.pod, nil
+	}
+
+	testingImpl.StartPodFunc = func(podID string) (vc.VCPod, error) {
+		return d.pod, nil
+	}
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		// return an empty list on create
+		if !flagCreate {
+			return []vc.PodStatus{}, nil
+		}
+
+		// return a podStatus with the container status
+		return []vc.PodStatus{
+			{
+				ID: d.pod.ID(),
+				ContainersStatus: []vc.ContainerStatus{
+					{
+						ID: d.pod.ID(),
+						Annotations: map[string]string{
+							oci.ContainerTypeKey: string(vc.PodContainer),
+							oci.ConfigJSONKey:    d.configJSON,
+						},
+					},
+				},
+			},
+		}, nil
+	}
+
+	testingImpl.StartContainerFunc = func(podID, containerID string) (vc.VCContainer, error) {
+		return d.pod.MockContainers[0], nil
+	}
+
+	testingImpl.DeletePodFunc = func(podID string) (vc.VCPod, error) {
+		return d.pod, nil
+	}
+
+	testingImpl.DeleteContainerFunc = func(podID, containerID string) (vc.VCContainer, error) {
+		return d.pod.MockContainers[0], nil
+	}
+
+	defer func() {
+		testingImpl.CreatePodFunc = nil
+		testingImpl.StartPodFunc = nil
+		testingImpl.ListPodFunc = nil
+		testingImpl.StartContainerFunc = nil
+		testingImpl.DeletePodFunc = nil
+		testingImpl.DeleteContainerFunc = nil
+	}()
+
+	err := run(d.pod.ID(), d.bundlePath, d.consolePath, "", d.pidFilePath, false, d.runtimeConfig)
+
+	e, ok := err.(*cli.ExitError)
+	assert.True(ok, "error should be a cli.ExitError: %s", err)
+	assert.Equal(expectedExitCode, e.ExitCode())
+}
+
+func TestRunForwardSignals(t *testing.T) {
+	assert := assert.New(t)
+
+	cmd := exec.Command("/bin/sleep", "10")
+	err := cmd.Start()
+	assert.NoError(err)
+
+	stopForwarding := forwardSignals(cmd.Process.Pid)
+
+	// ignored signals are not forwarded
+	err = syscall.Kill(os.Getpid(), syscall.SIGWINCH)
+	assert.NoError(err)
+
+	err = syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+	assert.NoError(err)
+
+	ps, err := cmd.Process.Wait()
+	stopForwarding()
+	assert.NoError(err)
+
+	status := ps.Sys().(syscall.WaitStatus)
+	assert.True(status.Signaled())
+	assert.Equal(syscall.SIGUSR1, status.Signal())
+	assert.Equal(128+int(syscall.SIGUSR1), exitCode(ps))
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// seccompActions lists the valid seccomp actions.
+var seccompActions = map[specs.LinuxSeccompAction]bool{
+	specs.ActKill:  true,
+	specs.ActTrap:  true,
+	specs.ActErrno: true,
+	specs.ActTrace: true,
+	specs.ActAllow: true,
+}
+
+// seccompArchitectures lists the valid seccomp architectures.
+var seccompArchitectures = map[specs.Arch]bool{
+	specs.ArchX86:         true,
+	specs.ArchX86_64:      true,
+	specs.ArchX32:         true,
+	specs.ArchARM:         true,
+	specs.ArchAARCH64:     true,
+	specs.ArchMIPS:        true,
+	specs.ArchMIPS64:      true,
+	specs.ArchMIPS64N32:   true,
+	specs.ArchMIPSEL:      true,
+	specs.ArchMIPSEL64:    true,
+	specs.ArchMIPSEL64N32: true,
+	specs.ArchPPC:         true,
+	specs.ArchPPC64:       true,
+	specs.ArchPPC64LE:     true,
+	specs.ArchS390:        true,
+	specs.ArchS390X:       true,
+	specs.ArchPARISC:      true,
+	specs.ArchPARISC64:    true,
+}
+
+// seccompOperators lists the valid seccomp argument operators.
+var seccompOperators = map[specs.LinuxSeccompOperator]bool{
+	specs.OpNotEqual:     true,
+	specs.OpLessThan:     true,
+	specs.OpLessEqual:    true,
+	specs.OpEqualTo:      true,
+	specs.OpGreaterEqual: true,
+	specs.OpGreaterThan:  true,
+	specs.OpMaskedEqual:  true,
+}
+
+// validateSeccomp checks the specified seccomp profile is valid.
+func validateSeccomp(seccomp specs.LinuxSeccomp) error {
+	if !seccompActions[seccomp.DefaultAction] {
+		return fmt.Errorf("Invalid seccomp default action %q", seccomp.DefaultAction)
+	}
+
+	for _, arch := range seccomp.Architectures {
+		if !seccompArchitectures[arch] {
+			return fmt.Errorf("Invalid seccomp architecture %q", arch)
+		}
+	}
+
+	for _, syscall := range seccomp.Syscalls {
+		if len(syscall.Names) == 0 {
+			return fmt.Errorf("Invalid seccomp rule: no syscall specified")
+		}
+
+		for _, name := range syscall.Names {
+			if name == "" {
+				return fmt.Errorf("Invalid seccomp rule for %v: empty syscall name", syscall.Names)
+			}
+		}
+
+		if !seccompActions[syscall.Action] {
+			return fmt.Errorf("Invalid seccomp action %q for %v", syscall.Action, syscall.Names)
+		}
+
+		for _, arg := range syscall.Args {
+			if !seccompOperators[arg.Op] {
+				return fmt.Errorf("Invalid seccomp operator %q for %v", arg.Op, syscall.Names)
+			}
+		}
+	}
+
+	return nil
+}
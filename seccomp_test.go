@@ -0,0 +1,89 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateSeccomp(t *testing.T) {
+	assert := assert.New(t)
+
+	rule := specs.LinuxSyscall{
+		Names:  []string{"personality"},
+		Action: specs.ActAllow,
+		Args: []specs.LinuxSeccompArg{
+			{Index: 0, Value: 0x0, Op: specs.OpEqualTo},
+		},
+	}
+
+	type testData struct {
+		seccomp       specs.LinuxSeccomp
+		expectFailure bool
+	}
+
+	data := []testData{
+		{specs.LinuxSeccomp{DefaultAction: specs.ActAllow}, false},
+		{specs.LinuxSeccomp{
+			DefaultAction: specs.ActErrno,
+			Architectures: []specs.Arch{specs.ArchX86_64, specs.ArchX86, specs.ArchX32},
+			Syscalls:      []specs.LinuxSyscall{rule},
+		}, false},
+
+		// invalid default action
+		{specs.LinuxSeccomp{}, true},
+		{specs.LinuxSeccomp{DefaultAction: "SCMP_ACT_FOO"}, true},
+
+		// invalid architecture
+		{specs.LinuxSeccomp{
+			DefaultAction: specs.ActErrno,
+			Architectures: []specs.Arch{specs.ArchX86_64, "SCMP_ARCH_FOO"},
+		}, true},
+
+		// invalid rules
+		{specs.LinuxSeccomp{
+			DefaultAction: specs.ActErrno,
+			Syscalls:      []specs.LinuxSyscall{{Action: specs.ActAllow}},
+		}, true},
+		{specs.LinuxSeccomp{
+			DefaultAction: specs.ActErrno,
+			Syscalls:      []specs.LinuxSyscall{{Names: []string{""}, Action: specs.ActAllow}},
+		}, true},
+		{specs.LinuxSeccomp{
+			DefaultAction: specs.ActErrno,
+			Syscalls:      []specs.LinuxSyscall{{Names: []string{"read"}, Action: "allow"}},
+		}, true},
+		{specs.LinuxSeccomp{
+			DefaultAction: specs.ActErrno,
+			Syscalls: []specs.LinuxSyscall{{
+				Names:  []string{"personality"},
+				Action: specs.ActAllow,
+				Args:   []specs.LinuxSeccompArg{{Op: "SCMP_CMP_FOO"}},
+			}},
+		}, true},
+	}
+
+	for _, d := range data {
+		err := validateSeccomp(d.seccomp)
+		if d.expectFailure {
+			assert.Error(err, "test data: %+v", d)
+		} else {
+			assert.NoError(err, "test data: %+v", d)
+		}
+	}
+}
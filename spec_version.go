@@ -0,0 +1,179 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sirupsen/logrus"
+)
+
+// minSpecVersion is the oldest version of the OCI runtime specification
+// supported, which is the oldest one handled by oci.CompatOCISpec.
+const minSpecVersion = "1.0.0-rc4"
+
+// ignoreSpecVersion is set by the --ignore-spec-version global option.
+// When set, a bundle is used whatever the version of the OCI runtime
+// specification it declares.
+var ignoreSpecVersion = false
+
+// specVersion is a parsed OCI runtime specification version, of the
+// form "major.minor.patch[-prerelease]".
+type specVersion struct {
+	major, minor, patch int
+	prerelease          string
+}
+
+// parseSpecVersion parses the specified OCI runtime specification
+// version.
+func parseSpecVersion(version string) (specVersion, error) {
+	var v specVersion
+
+	numbers := version
+	if i := strings.Index(version, "-"); i >= 0 {
+		numbers, v.prerelease = version[:i], version[i+1:]
+	}
+
+	fields := strings.Split(numbers, ".")
+	if len(fields) != 3 {
+		return v, fmt.Errorf("Invalid OCI version %q: expected \"major.minor.patch\"", version)
+	}
+
+	values := []*int{&v.major, &v.minor, &v.patch}
+
+	for i, field := range fields {
+		value, err := strconv.ParseUint(field, 10, 32)
+		if err != nil {
+			return v, fmt.Errorf("Invalid OCI version %q: %v", version, err)
+		}
+
+		*values[i] = int(value)
+	}
+
+	return v, nil
+}
+
+// comparePrerelease compares two pre-release versions, such as "rc4" and
+// "rc10", returning -1, 0 or 1. A release, which has no pre-release
+// version, is newer than any pre-release.
+func comparePrerelease(a, b string) int {
+	if a == b {
+		return 0
+	}
+
+	if a == "" {
+		return 1
+	}
+
+	if b == "" {
+		return -1
+	}
+
+	prefixA := strings.TrimRight(a, "0123456789")
+	prefixB := strings.TrimRight(b, "0123456789")
+
+	if prefixA == prefixB {
+		numberA, errA := strconv.Atoi(a[len(prefixA):])
+		numberB, errB := strconv.Atoi(b[len(prefixB):])
+
+		if errA == nil && errB == nil && numberA != numberB {
+			if numberA < numberB {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	if a < b {
+		return -1
+	}
+
+	return 1
+}
+
+// compare returns -1, 0 or 1 depending on whether v is older than, the
+// same as or newer than other.
+func (v specVersion) compare(other specVersion) int {
+	for _, d := range []int{v.major - other.major, v.minor - other.minor, v.patch - other.patch} {
+		if d < 0 {
+			return -1
+		}
+		if d > 0 {
+			return 1
+		}
+	}
+
+	return comparePrerelease(v.prerelease, other.prerelease)
+}
+
+// validateSpecVersion checks the specified OCI runtime specification
+// version is supported: it must not be older than minSpecVersion and must
+// have the same major version as the specification the runtime is built
+// with.
+func validateSpecVersion(version string) error {
+	if version == "" {
+		return fmt.Errorf("No OCI version specified (ociVersion), expected %v or later", minSpecVersion)
+	}
+
+	v, err := parseSpecVersion(version)
+	if err != nil {
+		return err
+	}
+
+	min, err := parseSpecVersion(minSpecVersion)
+	if err != nil {
+		return err
+	}
+
+	if v.compare(min) < 0 {
+		return fmt.Errorf("Unsupported OCI version %v: expected %v or later", version, minSpecVersion)
+	}
+
+	if v.major != specs.VersionMajor {
+		return fmt.Errorf("Unsupported OCI version %v: expected a %d.x version", version, specs.VersionMajor)
+	}
+
+	return nil
+}
+
+// checkSpecVersion validates the OCI runtime specification version of a
+// bundle, unless --ignore-spec-version was specified.
+func checkSpecVersion(containerID, version string) error {
+	fields := logrus.Fields{
+		"container":    containerID,
+		"oci-version":  version,
+		"spec-version": specs.Version,
+	}
+
+	if err := validateSpecVersion(version); err != nil {
+		if !ignoreSpecVersion {
+			return err
+		}
+
+		ccLog.WithFields(fields).WithError(err).Warn("Ignoring OCI version")
+		return nil
+	}
+
+	// Newer minor versions are backward compatible but can add settings
+	// the runtime does not know about.
+	if v, _ := parseSpecVersion(version); v.minor > specs.VersionMinor {
+		ccLog.WithFields(fields).Warn("OCI version is newer than supported, new settings are ignored")
+	}
+
+	return nil
+}
@@ -0,0 +1,227 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSpecVersion(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		version       string
+		expectFailure bool
+		expected      specVersion
+	}
+
+	data := []testData{
+		{"1.0.0", false, specVersion{1, 0, 0, ""}},
+		{"1.0.0-rc5", false, specVersion{1, 0, 0, "rc5"}},
+		{"1.0.2-dev", false, specVersion{1, 0, 2, "dev"}},
+		{"10.20.30", false, specVersion{10, 20, 30, ""}},
+
+		{"", true, specVersion{}},
+		{"1", true, specVersion{}},
+		{"1.0", true, specVersion{}},
+		{"1.0.0.0", true, specVersion{}},
+		{"1.a.0", true, specVersion{}},
+		{"1.-1.0", true, specVersion{}},
+		{"v1.0.0", true, specVersion{}},
+	}
+
+	for i, d := range data {
+		v, err := parseSpecVersion(d.version)
+		if d.expectFailure {
+			assert.Error(err, "test %d (%+v)", i, d)
+			continue
+		}
+
+		assert.NoError(err, "test %d (%+v)", i, d)
+		assert.Equal(d.expected, v, "test %d (%+v)", i, d)
+	}
+}
+
+func TestSpecVersionCompare(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		a, b     string
+		expected int
+	}
+
+	data := []testData{
+		{"1.0.0", "1.0.0", 0},
+		{"1.0.0-rc5", "1.0.0-rc5", 0},
+		{"1.0.0", "1.0.1", -1},
+		{"1.1.0", "1.0.9", 1},
+		{"2.0.0", "1.9.9", 1},
+		{"1.0.0-rc5", "1.0.0", -1},
+		{"1.0.0", "1.0.0-rc5", 1},
+		{"1.0.0-rc4", "1.0.0-rc5", -1},
+		{"1.0.0-rc10", "1.0.0-rc4", 1},
+		{"1.0.0-alpha", "1.0.0-beta", -1},
+	}
+
+	for i, d := range data {
+		a, err := parseSpecVersion(d.a)
+		assert.NoError(err)
+
+		b, err := parseSpecVersion(d.b)
+		assert.NoError(err)
+
+		assert.Equal(d.expected, a.compare(b), "test %d (%+v)", i, d)
+	}
+}
+
+func TestValidateSpecVersion(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		version       string
+		expectFailure bool
+	}
+
+	data := []testData{
+		{specs.Version, false},
+		{minSpecVersion, false},
+		{"1.0.0-rc5", false},
+		{"1.0.0", false},
+		{"1.0.2-dev", false},
+		{"1.2.0", false},
+
+		// too old
+		{"0.6.0", true},
+		{"1.0.0-rc2", true},
+		{"1.0.0-rc3", true},
+
+		// newer major version
+		{"2.0.0", true},
+		{"2.0.0-rc1", true},
+
+		// invalid
+		{"", true},
+		{"foo", true},
+	}
+
+	for i, d := range data {
+		err := validateSpecVersion(d.version)
+		if d.expectFailure {
+			assert.Error(err, "test %d (%+v)", i, d)
+		} else {
+			assert.NoError(err, "test %d (%+v)", i, d)
+		}
+	}
+}
+
+func TestCheckSpecVersionIgnore(t *testing.T) {
+	assert := assert.New(t)
+
+	savedIgnoreSpecVersion := ignoreSpecVersion
+	defer func() {
+		ignoreSpecVersion = savedIgnoreSpecVersion
+	}()
+
+	ignoreSpecVersion = false
+
+	assert.NoError(checkSpecVersion(testContainerID, "1.0.0"))
+	assert.NoError(checkSpecVersion(testContainerID, "1.1.0"))
+	assert.Error(checkSpecVersion(testContainerID, "0.6.0"))
+	assert.Error(checkSpecVersion(testContainerID, "2.0.0"))
+
+	ignoreSpecVersion = true
+
+	assert.NoError(checkSpecVersion(testContainerID, "0.6.0"))
+	assert.NoError(checkSpecVersion(testContainerID, "2.0.0"))
+	assert.NoError(checkSpecVersion(testContainerID, "foo"))
+}
+
+func TestGetCreateSpecVersion(t *testing.T) {
+	assert := assert.New(t)
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		// No pre-existing pods
+		return []vc.PodStatus{}, nil
+	}
+
+	savedIgnoreSpecVersion := ignoreSpecVersion
+
+	defer func() {
+		testingImpl.ListPodFunc = nil
+		ignoreSpecVersion = savedIgnoreSpecVersion
+	}()
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	bundlePath := filepath.Join(tmpdir, "bundle")
+
+	err = makeOCIBundle(bundlePath)
+	assert.NoError(err)
+
+	ociConfigFile := filepath.Join(bundlePath, "config.json")
+
+	spec, err := readOCIConfigFile(ociConfigFile)
+	assert.NoError(err)
+
+	type testData struct {
+		version       string
+		expectFailure bool
+	}
+
+	data := []testData{
+		{"1.0.0", false},
+		{"1.0.0-rc5", false},
+
+		// an old version
+		{"1.0.0-rc2", true},
+
+		// a newer version
+		{"2.0.0", true},
+	}
+
+	for i, d := range data {
+		spec.Version = d.version
+
+		err = writeOCIConfigFile(spec, ociConfigFile)
+		assert.NoError(err)
+
+		ignoreSpecVersion = false
+
+		ociSpec, _, err := getCreateSpec(testContainerID, bundlePath)
+		if d.expectFailure {
+			assert.Error(err, "test %d (%+v)", i, d)
+			assert.Contains(err.Error(), "Unsupported OCI version", "test %d (%+v)", i, d)
+		} else {
+			assert.NoError(err, "test %d (%+v)", i, d)
+			assert.Equal(d.version, ociSpec.Version, "test %d (%+v)", i, d)
+		}
+
+		// --ignore-spec-version
+		ignoreSpecVersion = true
+
+		ociSpec, _, err = getCreateSpec(testContainerID, bundlePath)
+		assert.NoError(err, "test %d (%+v)", i, d)
+		assert.Equal(d.version, ociSpec.Version, "test %d (%+v)", i, d)
+	}
+}
@@ -49,6 +49,9 @@ var startCLICommand = cli.Command{
 }
 
 func start(containerID string) (vc.VCPod, error) {
+	span := startSpan("start")
+	defer span.finish()
+
 	// Checks the MUST and MUST NOT from OCI runtime specification
 	status, podID, err := getExistingContainerInfo(containerID)
 	if err != nil {
@@ -57,19 +60,100 @@ func start(containerID string) (vc.VCPod, error) {
 
 	containerID = status.ID
 
+	log := containerLogEntry(containerID, podID)
+
 	containerType, err := oci.GetContainerType(status.Annotations)
 	if err != nil {
 		return nil, err
 	}
 
+	// Retrieve OCI spec configuration.
+	ociSpec, err := oci.GetOCIConfig(status)
+	if err != nil {
+		return nil, err
+	}
+
 	if containerType.IsPod() {
-		return vci.StartPod(podID)
+		log.Debug("Starting pod")
+
+		var pod vc.VCPod
+
+		podSpan := startSpan("start-pod")
+		// The connection to the proxy is retried as it may be
+		// restarting.
+		err := withAgentTimeout(podID, func() error {
+			return withProxyRetry(log, podID, func() error {
+				return checkPodReady(podID)
+			}, func() (err error) {
+				pod, err = vci.StartPod(podID)
+				return err
+			})
+		})
+		podSpan.finish()
+
+		if err != nil {
+			return nil, err
+		}
+
+		runPoststartHooks(ociSpec, status)
+
+		return pod, nil
 	}
 
-	c, err := vci.StartContainer(podID, containerID)
+	// The prestart hooks of the pod sandbox are run by virtcontainers
+	// when the pod is created.
+	if err := runPrestartHooks(ociSpec, status); err != nil {
+		return nil, err
+	}
+
+	log.Debug("Starting container")
+
+	var c vc.VCContainer
+
+	containerSpan := startSpan("start-container")
+	err = withAgentReconnect(log, podID, func() error {
+		return checkContainerReady(podID, containerID)
+	}, func() (err error) {
+		c, err = vci.StartContainer(podID, containerID)
+		return err
+	})
+	containerSpan.finish()
+
 	if err != nil {
 		return nil, err
 	}
 
+	runPoststartHooks(ociSpec, status)
+
 	return c.Pod(), nil
 }
+
+// checkPodReady returns an error if the specified pod is no longer ready
+// to be started, which StartPod() requires.
+func checkPodReady(podID string) error {
+	status, err := vci.StatusPod(podID)
+	if err != nil {
+		return err
+	}
+
+	if status.State.State != vc.StateReady {
+		return fmt.Errorf("Pod %v is %v, not %v", podID, status.State.State, vc.StateReady)
+	}
+
+	return nil
+}
+
+// checkContainerReady returns an error if the specified container is no
+// longer ready to be started, which StartContainer() requires.
+func checkContainerReady(podID, containerID string) error {
+	status, err := vci.StatusContainer(podID, containerID)
+	if err != nil {
+		return err
+	}
+
+	if status.State.State != vc.StateReady {
+		return fmt.Errorf("Container %v is %v, not %v", containerID, status.State.State, vc.StateReady)
+	}
+
+	return nil
+}
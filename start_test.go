@@ -59,6 +59,10 @@ func TestStartPod(t *testing.T) {
 		MockID: testPodID,
 	}
 
+	configPath := testConfigSetup(t)
+	configJSON, err := readOCIConfigJSON(configPath)
+	assert.NoError(err)
+
 	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
 		return []vc.PodStatus{
 			{
@@ -68,6 +72,7 @@ func TestStartPod(t *testing.T) {
 						ID: pod.ID(),
 						Annotations: map[string]string{
 							oci.ContainerTypeKey: string(vc.PodSandbox),
+							oci.ConfigJSONKey:    configJSON,
 						},
 					},
 				},
@@ -79,7 +84,7 @@ func TestStartPod(t *testing.T) {
 		testingImpl.ListPodFunc = nil
 	}()
 
-	_, err := start(pod.ID())
+	_, err = start(pod.ID())
 	assert.Error(err)
 	assert.True(vcMock.IsMockError(err))
 
@@ -139,6 +144,10 @@ func TestStartContainerSucessFailure(t *testing.T) {
 		},
 	}
 
+	configPath := testConfigSetup(t)
+	configJSON, err := readOCIConfigJSON(configPath)
+	assert.NoError(err)
+
 	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
 		return []vc.PodStatus{
 			{
@@ -148,6 +157,7 @@ func TestStartContainerSucessFailure(t *testing.T) {
 						ID: testContainerID,
 						Annotations: map[string]string{
 							oci.ContainerTypeKey: string(vc.PodContainer),
+							oci.ConfigJSONKey:    configJSON,
 						},
 					},
 				},
@@ -159,7 +169,7 @@ func TestStartContainerSucessFailure(t *testing.T) {
 		testingImpl.ListPodFunc = nil
 	}()
 
-	_, err := start(testContainerID)
+	_, err = start(testContainerID)
 	assert.Error(err)
 	assert.True(vcMock.IsMockError(err))
 
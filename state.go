@@ -18,9 +18,7 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"os"
 
-	"github.com/containers/virtcontainers/pkg/oci"
 	"github.com/urfave/cli"
 )
 
@@ -31,7 +29,10 @@ var stateCLICommand = cli.Command{
 
    <container-id> is your name for the instance of the container`,
 	Description: `The state command outputs current state information for the
-instance of a container.`,
+instance of a container as specified by the OCI runtime specification.
+
+The status is one of "creating", "created", "running", "paused" or
+"stopped" and the pid is the host PID of the container's shim process.`,
 	Action: func(context *cli.Context) error {
 		args := context.Args()
 		if len(args) != 1 {
@@ -50,7 +51,7 @@ func state(containerID string) error {
 	}
 
 	// Convert the status to the expected State structure
-	state := oci.StatusToOCIState(status)
+	state := statusToOCIState(status)
 
 	stateJSON, err := json.MarshalIndent(state, "", "  ")
 	if err != nil {
@@ -58,7 +59,7 @@ func state(containerID string) error {
 	}
 
 	// Print stateJSON to stdout
-	fmt.Fprintf(os.Stdout, "%s", stateJSON)
+	fmt.Fprintf(defaultOutputFile, "%s", stateJSON)
 
 	return nil
 }
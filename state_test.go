@@ -15,12 +15,17 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	vc "github.com/containers/virtcontainers"
 	"github.com/containers/virtcontainers/pkg/oci"
 	"github.com/containers/virtcontainers/pkg/vcMock"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/stretchr/testify/assert"
 	"github.com/urfave/cli"
 )
@@ -88,3 +93,88 @@ func TestStateSuccessful(t *testing.T) {
 	err = state(pod.ID())
 	assert.NoError(err)
 }
+
+func TestStateOCIFormat(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	savedOutputFile := defaultOutputFile
+	defer func() {
+		defaultOutputFile = savedOutputFile
+	}()
+
+	type testData struct {
+		state          vc.State
+		expectedStatus string
+	}
+
+	data := []testData{
+		{vc.State{}, ociStateCreating},
+		{vc.State{State: vc.StateReady}, oci.StateCreated},
+		{vc.State{State: vc.StateRunning}, oci.StateRunning},
+		{vc.State{State: vc.StatePaused}, ociStatePaused},
+		{vc.State{State: vc.StateStopped}, oci.StateStopped},
+	}
+
+	for _, d := range data {
+		annotations := map[string]string{
+			oci.ContainerTypeKey: string(vc.PodSandbox),
+			oci.BundlePathKey:    tmpdir,
+		}
+
+		testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+			return []vc.PodStatus{
+				{
+					ID: testPodID,
+					ContainersStatus: []vc.ContainerStatus{
+						{
+							ID:          testContainerID,
+							PID:         testPID,
+							State:       d.state,
+							Annotations: annotations,
+						},
+					},
+				},
+			}, nil
+		}
+
+		outputFile := filepath.Join(tmpdir, "state.json")
+		f, err := os.Create(outputFile)
+		assert.NoError(err)
+
+		defaultOutputFile = f
+
+		err = state(testContainerID)
+		f.Close()
+		assert.NoError(err, "test data: %+v", d)
+
+		output, err := ioutil.ReadFile(outputFile)
+		assert.NoError(err)
+
+		// check the output contains all the fields required by the
+		// OCI state schema.
+		var fields map[string]interface{}
+		err = json.Unmarshal(output, &fields)
+		assert.NoError(err)
+
+		for _, field := range []string{"ociVersion", "id", "status", "pid", "bundle"} {
+			assert.Contains(fields, field, "test data: %+v", d)
+		}
+
+		var ociState specs.State
+		err = json.Unmarshal(output, &ociState)
+		assert.NoError(err)
+
+		assert.Equal(specs.Version, ociState.Version)
+		assert.Equal(testContainerID, ociState.ID)
+		assert.Equal(d.expectedStatus, ociState.Status, "test data: %+v", d)
+		assert.Equal(testPID, ociState.Pid)
+		assert.Equal(tmpdir, ociState.Bundle)
+		assert.Equal(annotations, ociState.Annotations)
+	}
+
+	testingImpl.ListPodFunc = nil
+}
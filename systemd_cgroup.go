@@ -0,0 +1,149 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultSystemdSlice is the slice the scope of a container is created
+// in if its cgroups path does not specify one.
+const defaultSystemdSlice = "system.slice"
+
+// systemdCgroup is set by the --systemd-cgroup global option. When set,
+// the host cgroup of a container is a transient systemd scope rather
+// than a cgroupfs directory.
+var systemdCgroup = false
+
+// systemdCallFunc is used to call a method of the systemd manager. It is
+// a variable to allow tests to mock it.
+var systemdCallFunc = systemdCall
+
+// systemdCall calls a method of the systemd manager over D-Bus with the
+// specified signature and arguments, as described in busctl(1).
+func systemdCall(method string, args ...string) error {
+	cmdArgs := append([]string{"call", "org.freedesktop.systemd1", "/org/freedesktop/systemd1",
+		"org.freedesktop.systemd1.Manager", method}, args...)
+
+	output, err := exec.Command("busctl", cmdArgs...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemd %s call failed: %v: %s", method, err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// parseSystemdCgroupsPath returns the slice and the name of the scope
+// described by a cgroups path of the form "slice:prefix:name", such as
+// "system.slice:cc:<id>" which gives the "cc-<id>.scope" scope in the
+// "system.slice" slice. If the slice is empty, defaultSystemdSlice is
+// used.
+func parseSystemdCgroupsPath(path string) (slice, unit string, err error) {
+	parts := strings.Split(path, ":")
+	if len(parts) != 3 {
+		return "", "", fmt.Errorf("Invalid systemd cgroups path %q: expected \"slice:prefix:name\"", path)
+	}
+
+	slice, prefix, name := parts[0], parts[1], parts[2]
+
+	if strings.Contains(path, "/") {
+		return "", "", fmt.Errorf("Invalid systemd cgroups path %q: unexpected \"/\"", path)
+	}
+
+	if slice == "" {
+		slice = defaultSystemdSlice
+	}
+
+	if !strings.HasSuffix(slice, ".slice") {
+		return "", "", fmt.Errorf("Invalid systemd cgroups path %q: %q is not a slice", path, slice)
+	}
+
+	if name == "" {
+		return "", "", fmt.Errorf("Invalid systemd cgroups path %q: no name specified", path)
+	}
+
+	unit = name + ".scope"
+	if prefix != "" {
+		unit = prefix + "-" + unit
+	}
+
+	return slice, unit, nil
+}
+
+// getSystemdScope returns the slice and the scope of the container of
+// the specified OCI configuration, or empty strings if it does not
+// specify a cgroups path.
+func getSystemdScope(ociSpec oci.CompatOCISpec) (slice, unit string, err error) {
+	if ociSpec.Linux == nil || ociSpec.Linux.CgroupsPath == "" {
+		return "", "", nil
+	}
+
+	return parseSystemdCgroupsPath(ociSpec.Linux.CgroupsPath)
+}
+
+// createSystemdCgroup moves the specified process, the shim of a
+// container, to a new transient systemd scope.
+func createSystemdCgroup(containerID string, ociSpec oci.CompatOCISpec, pid int) error {
+	slice, unit, err := getSystemdScope(ociSpec)
+	if err != nil {
+		return err
+	}
+
+	if unit == "" {
+		ccLog.WithField("container", containerID).Info("Systemd scope not created because cgroupsPath was empty")
+		return nil
+	}
+
+	// StartTransientUnit(name, mode, properties, auxiliary units)
+	if err := systemdCallFunc("StartTransientUnit", "ssa(sv)a(sa(sv))", unit, "replace",
+		"2", "Slice", "s", slice, "PIDs", "au", "1", strconv.Itoa(pid), "0"); err != nil {
+		return fmt.Errorf("Cannot create systemd scope %s for container %v: %v", unit, containerID, err)
+	}
+
+	ccLog.WithFields(logrus.Fields{
+		"container": containerID,
+		"slice":     slice,
+		"scope":     unit,
+		"pid":       pid,
+	}).Debug("Created systemd scope")
+
+	return nil
+}
+
+// removeSystemdCgroup stops the systemd scope of a container. systemd
+// removes the scope by itself once its processes have exited, so failing
+// to stop it is not an error.
+func removeSystemdCgroup(containerID string, ociSpec oci.CompatOCISpec) error {
+	_, unit, err := getSystemdScope(ociSpec)
+	if err != nil || unit == "" {
+		return err
+	}
+
+	if err := systemdCallFunc("StopUnit", "ss", unit, "replace"); err != nil {
+		ccLog.WithFields(logrus.Fields{
+			"container": containerID,
+			"scope":     unit,
+			"error":     err,
+		}).Info("Cannot stop systemd scope")
+	}
+
+	return nil
+}
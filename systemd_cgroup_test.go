@@ -0,0 +1,170 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/containers/virtcontainers/pkg/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// testSystemdCall records a call to a method of the systemd manager.
+type testSystemdCall struct {
+	method string
+	args   []string
+}
+
+// setTestSystemdCall makes the runtime record the systemd calls rather
+// than running them, failing with the specified error.
+func setTestSystemdCall(callErr error) (*[]testSystemdCall, func()) {
+	var calls []testSystemdCall
+
+	savedSystemdCall := systemdCallFunc
+	systemdCallFunc = func(method string, args ...string) error {
+		calls = append(calls, testSystemdCall{method, args})
+		return callErr
+	}
+
+	return &calls, func() {
+		systemdCallFunc = savedSystemdCall
+	}
+}
+
+func testSystemdSpec(cgroupsPath string) oci.CompatOCISpec {
+	return oci.CompatOCISpec{
+		Spec: specs.Spec{
+			Linux: &specs.Linux{
+				CgroupsPath: cgroupsPath,
+			},
+		},
+	}
+}
+
+func TestParseSystemdCgroupsPath(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		path          string
+		expectFailure bool
+		expectedSlice string
+		expectedUnit  string
+	}
+
+	data := []testData{
+		{"system.slice:cc:1234", false, "system.slice", "cc-1234.scope"},
+		{"machine.slice:docker:abcd", false, "machine.slice", "docker-abcd.scope"},
+		{"user-1000.slice:cc:abcd", false, "user-1000.slice", "cc-abcd.scope"},
+
+		// default slice
+		{":cc:1234", false, "system.slice", "cc-1234.scope"},
+
+		// no prefix
+		{"system.slice::1234", false, "system.slice", "1234.scope"},
+
+		// not of the form slice:prefix:name
+		{"", true, "", ""},
+		{"/foo/bar", true, "", ""},
+		{"system.slice:1234", true, "", ""},
+		{"system.slice:cc:1234:5678", true, "", ""},
+
+		// invalid slice
+		{"system:cc:1234", true, "", ""},
+		{"/system.slice:cc:1234", true, "", ""},
+
+		// no name
+		{"system.slice:cc:", true, "", ""},
+
+		// not a cgroup name
+		{"system.slice:cc:12/34", true, "", ""},
+	}
+
+	for _, d := range data {
+		slice, unit, err := parseSystemdCgroupsPath(d.path)
+		if d.expectFailure {
+			assert.Error(err, "test data: %+v", d)
+			continue
+		}
+
+		assert.NoError(err, "test data: %+v", d)
+		assert.Equal(d.expectedSlice, slice, "test data: %+v", d)
+		assert.Equal(d.expectedUnit, unit, "test data: %+v", d)
+	}
+}
+
+func TestCreateSystemdCgroup(t *testing.T) {
+	assert := assert.New(t)
+
+	calls, restore := setTestSystemdCall(nil)
+	defer restore()
+
+	// no cgroups path
+	err := createSystemdCgroup(testContainerID, oci.CompatOCISpec{}, testPID)
+	assert.NoError(err)
+	assert.Empty(*calls)
+
+	err = createSystemdCgroup(testContainerID, testSystemdSpec("system.slice:cc:"+testContainerID), testPID)
+	assert.NoError(err)
+
+	assert.Equal([]testSystemdCall{
+		{
+			method: "StartTransientUnit",
+			args: []string{"ssa(sv)a(sa(sv))", "cc-" + testContainerID + ".scope", "replace",
+				"2", "Slice", "s", "system.slice", "PIDs", "au", "1", "100", "0"},
+		},
+	}, *calls)
+
+	// invalid cgroups path
+	err = createSystemdCgroup(testContainerID, testSystemdSpec("/foo"), testPID)
+	assert.Error(err)
+}
+
+func TestCreateSystemdCgroupFail(t *testing.T) {
+	assert := assert.New(t)
+
+	_, restore := setTestSystemdCall(errors.New("call failure"))
+	defer restore()
+
+	err := createSystemdCgroup(testContainerID, testSystemdSpec("system.slice:cc:"+testContainerID), testPID)
+	assert.Error(err)
+}
+
+func TestRemoveSystemdCgroup(t *testing.T) {
+	assert := assert.New(t)
+
+	calls, restore := setTestSystemdCall(errors.New("unit not loaded"))
+	defer restore()
+
+	// no cgroups path
+	err := removeSystemdCgroup(testContainerID, oci.CompatOCISpec{})
+	assert.NoError(err)
+	assert.Empty(*calls)
+
+	// the scope may already be gone
+	err = removeSystemdCgroup(testContainerID, testSystemdSpec(":cc:"+testContainerID))
+	assert.NoError(err)
+
+	assert.Equal([]testSystemdCall{
+		{
+			method: "StopUnit",
+			args:   []string{"ss", "cc-" + testContainerID + ".scope", "replace"},
+		},
+	}, *calls)
+
+	err = removeSystemdCgroup(testContainerID, testSystemdSpec("foo"))
+	assert.Error(err)
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/sirupsen/logrus"
+)
+
+// syncGuestTime is set by the sync_guest_time option of the runtime
+// configuration. When set, the guest clock is set to the host time once
+// a pod has been resumed.
+var syncGuestTime = false
+
+// timeNowFunc returns the host time. It is a variable to allow tests to
+// mock it.
+var timeNowFunc = time.Now
+
+// getTimeSyncCmd returns the command setting the guest clock to the
+// specified time. It runs as root, which setting the clock requires.
+func getTimeSyncCmd(now time.Time) vc.Cmd {
+	return vc.Cmd{
+		Args:         []string{"date", "-u", "-s", fmt.Sprintf("@%d", now.Unix())},
+		WorkDir:      "/",
+		User:         "0",
+		PrimaryGroup: "0",
+		Detach:       true,
+	}
+}
+
+// syncTime sets the guest clock of the specified pod, whose VM does not
+// keep track of the time spent paused, to the host time.
+//
+// XXX: the agent has no request to set the guest clock, so date(1) is
+// run in the specified workload container, as "exec" would. Its rootfs
+// must provide date(1), it must have the CAP_SYS_TIME capability and the
+// process is visible to the workload. The shim of the process exits with
+// its exit code.
+func syncTime(podID, containerID string) error {
+	cmd := getTimeSyncCmd(timeNowFunc())
+
+	_, _, process, err := vci.EnterContainer(podID, containerID, cmd)
+	if err != nil {
+		return fmt.Errorf("Cannot set the guest time of pod %v: %v", podID, err)
+	}
+
+	p, err := os.FindProcess(process.Pid)
+	if err != nil {
+		return err
+	}
+
+	ps, err := p.Wait()
+	if err != nil {
+		return fmt.Errorf("Cannot set the guest time of pod %v: %v", podID, err)
+	}
+
+	if status := ps.Sys().(syscall.WaitStatus).ExitStatus(); status != 0 {
+		return fmt.Errorf("Cannot set the guest time of pod %v: date exited with status %d", podID, status)
+	}
+
+	ccLog.WithFields(logrus.Fields{
+		"pod":       podID,
+		"container": containerID,
+	}).Debug("Set guest time")
+
+	return nil
+}
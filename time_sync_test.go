@@ -0,0 +1,86 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/vcMock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetTimeSyncCmd(t *testing.T) {
+	assert := assert.New(t)
+
+	cmd := getTimeSyncCmd(time.Unix(1500000000, 0))
+	assert.Equal([]string{"date", "-u", "-s", "@1500000000"}, cmd.Args)
+	assert.Equal("0", cmd.User)
+	assert.True(cmd.Detach)
+}
+
+func TestSyncTime(t *testing.T) {
+	assert := assert.New(t)
+
+	savedTimeNowFunc := timeNowFunc
+	timeNowFunc = func() time.Time {
+		return time.Unix(1500000000, 0)
+	}
+	defer func() {
+		timeNowFunc = savedTimeNowFunc
+	}()
+
+	var cmds []vc.Cmd
+
+	// shim is the command standing for the shim of the process.
+	shim := "true"
+
+	testingImpl.EnterContainerFunc = func(podID, containerID string, cmd vc.Cmd) (vc.VCPod, vc.VCContainer, *vc.Process, error) {
+		assert.Equal(testPodID, podID)
+		assert.Equal(testContainerID, containerID)
+		cmds = append(cmds, cmd)
+
+		c := exec.Command(shim)
+		if err := c.Start(); err != nil {
+			return nil, nil, nil, err
+		}
+
+		return &vcMock.Pod{}, &vcMock.Container{}, &vc.Process{Pid: c.Process.Pid}, nil
+	}
+	defer func() {
+		testingImpl.EnterContainerFunc = nil
+	}()
+
+	err := syncTime(testPodID, testContainerID)
+	assert.NoError(err)
+	assert.Equal([]vc.Cmd{getTimeSyncCmd(time.Unix(1500000000, 0))}, cmds)
+
+	// date failed, for example without CAP_SYS_TIME
+	shim = "false"
+
+	err = syncTime(testPodID, testContainerID)
+	assert.Error(err)
+	assert.Contains(err.Error(), "exited with status 1")
+
+	testingImpl.EnterContainerFunc = func(podID, containerID string, cmd vc.Cmd) (vc.VCPod, vc.VCContainer, *vc.Process, error) {
+		return nil, nil, nil, errors.New("no date command")
+	}
+
+	err = syncTime(testPodID, testContainerID)
+	assert.Error(err)
+}
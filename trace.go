@@ -0,0 +1,264 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// traceExportTimeout is the maximum amount of time to wait for the trace
+// collector to accept the spans.
+var traceExportTimeout = 5 * time.Second
+
+// traceEndpoint is the URL of the collector the spans are sent to, set by
+// the trace_endpoint option of the runtime configuration. The spans are
+// logged if it is empty.
+var traceEndpoint string
+
+// tracer records the spans of the runtime command. It is nil unless
+// tracing has been enabled with the --trace global option, in which case
+// starting a span does nothing.
+var tracer *spanTracer
+
+// traceSpan describes a phase of a runtime command.
+type traceSpan struct {
+	TraceID  string
+	ID       string
+	ParentID string
+	Name     string
+	Start    time.Time
+	Duration time.Duration
+	Tags     map[string]string
+
+	parent *traceSpan
+}
+
+// spanExporter sends finished spans to their destination.
+type spanExporter interface {
+	export(spans []traceSpan) error
+}
+
+// spanTracer records the spans of a trace, which covers a single runtime
+// command.
+type spanTracer struct {
+	traceID  string
+	exporter spanExporter
+	tags     map[string]string
+	current  *traceSpan
+	finished []traceSpan
+}
+
+// newTraceID returns a random ID of the specified size, in bytes, encoded
+// in hexadecimal.
+func newTraceID(size int) string {
+	id := make([]byte, size)
+
+	// An all-zero ID is invalid but is still better than no span.
+	_, _ = rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
+
+// startTracing enables tracing, using the specified exporter to send the
+// spans.
+func startTracing(exporter spanExporter) {
+	tracer = &spanTracer{
+		traceID:  newTraceID(16),
+		exporter: exporter,
+		tags:     make(map[string]string),
+	}
+}
+
+// stopTracing disables tracing.
+func stopTracing() {
+	tracer = nil
+}
+
+// setTraceTag adds a tag to all the spans of the trace.
+func setTraceTag(key, value string) {
+	if tracer == nil {
+		return
+	}
+
+	tracer.tags[key] = value
+}
+
+// startSpan starts a new span, which is a child of the current span if
+// any. The span must be finished by calling its finish() method.
+func startSpan(name string) *traceSpan {
+	if tracer == nil {
+		return nil
+	}
+
+	span := &traceSpan{
+		TraceID: tracer.traceID,
+		ID:      newTraceID(8),
+		Name:    name,
+		Start:   time.Now(),
+		Tags:    make(map[string]string),
+		parent:  tracer.current,
+	}
+
+	if span.parent != nil {
+		span.ParentID = span.parent.ID
+	}
+
+	tracer.current = span
+
+	return span
+}
+
+// setTag adds a tag to the span.
+func (s *traceSpan) setTag(key, value string) {
+	if s == nil {
+		return
+	}
+
+	s.Tags[key] = value
+}
+
+// finish ends the span. Once the root span of the trace is finished, all
+// the spans are tagged with the trace tags and exported.
+func (s *traceSpan) finish() {
+	if s == nil || tracer == nil {
+		return
+	}
+
+	s.Duration = time.Since(s.Start)
+
+	tracer.current = s.parent
+	tracer.finished = append(tracer.finished, *s)
+
+	if s.parent != nil {
+		return
+	}
+
+	spans := tracer.finished
+	tracer.finished = nil
+
+	// The trace tags, such as the container ID, are often only known
+	// once the first spans have finished.
+	for _, span := range spans {
+		for k, v := range tracer.tags {
+			if _, ok := span.Tags[k]; !ok {
+				span.Tags[k] = v
+			}
+		}
+	}
+
+	if err := tracer.exporter.export(spans); err != nil {
+		ccLog.WithError(err).Warn("Cannot export trace")
+	}
+}
+
+// logSpanExporter logs the spans.
+type logSpanExporter struct{}
+
+func (e logSpanExporter) export(spans []traceSpan) error {
+	for _, s := range spans {
+		fields := logrus.Fields{
+			"trace-id": s.TraceID,
+			"span-id":  s.ID,
+			"span":     s.Name,
+			"duration": s.Duration.String(),
+		}
+
+		if s.ParentID != "" {
+			fields["parent-id"] = s.ParentID
+		}
+
+		ccLog.WithFields(fields).Info("Trace span")
+	}
+
+	return nil
+}
+
+// zipkinEndpoint describes the service spans sent to a Zipkin collector
+// come from.
+type zipkinEndpoint struct {
+	ServiceName string `json:"serviceName"`
+}
+
+// zipkinSpan is the Zipkin v2 JSON representation of a span.
+type zipkinSpan struct {
+	TraceID       string            `json:"traceId"`
+	ID            string            `json:"id"`
+	ParentID      string            `json:"parentId,omitempty"`
+	Name          string            `json:"name"`
+	Timestamp     int64             `json:"timestamp"`
+	Duration      int64             `json:"duration"`
+	LocalEndpoint zipkinEndpoint    `json:"localEndpoint"`
+	Tags          map[string]string `json:"tags,omitempty"`
+}
+
+// zipkinSpanExporter sends the spans to a collector accepting the Zipkin
+// v2 JSON format, such as Zipkin, Jaeger or the OpenTelemetry collector.
+type zipkinSpanExporter struct {
+	url string
+}
+
+func (e zipkinSpanExporter) export(spans []traceSpan) error {
+	var zipkinSpans []zipkinSpan
+
+	for _, s := range spans {
+		zipkinSpans = append(zipkinSpans, zipkinSpan{
+			TraceID:       s.TraceID,
+			ID:            s.ID,
+			ParentID:      s.ParentID,
+			Name:          s.Name,
+			Timestamp:     s.Start.UnixNano() / int64(time.Microsecond),
+			Duration:      int64(s.Duration / time.Microsecond),
+			LocalEndpoint: zipkinEndpoint{ServiceName: name},
+			Tags:          s.Tags,
+		})
+	}
+
+	data, err := json.Marshal(zipkinSpans)
+	if err != nil {
+		return err
+	}
+
+	client := http.Client{Timeout: traceExportTimeout}
+
+	resp, err := client.Post(e.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("Trace collector %v returned %v", e.url, resp.Status)
+	}
+
+	return nil
+}
+
+// newSpanExporter returns the exporter sending spans to the specified
+// collector URL, or logging them if the URL is empty.
+func newSpanExporter(url string) spanExporter {
+	if url == "" {
+		return logSpanExporter{}
+	}
+
+	return zipkinSpanExporter{url: url}
+}
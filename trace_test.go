@@ -0,0 +1,242 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/vcMock"
+	"github.com/stretchr/testify/assert"
+)
+
+// memorySpanExporter keeps the exported spans in memory.
+type memorySpanExporter struct {
+	spans []traceSpan
+}
+
+func (e *memorySpanExporter) export(spans []traceSpan) error {
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *memorySpanExporter) names() []string {
+	var names []string
+
+	for _, s := range e.spans {
+		names = append(names, s.Name)
+	}
+
+	return names
+}
+
+func TestTraceDisabled(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil(tracer)
+
+	span := startSpan("foo")
+	assert.Nil(span)
+
+	// no-ops
+	setTraceTag("foo", "bar")
+	span.setTag("foo", "bar")
+	span.finish()
+}
+
+func TestTraceSpans(t *testing.T) {
+	assert := assert.New(t)
+
+	exporter := &memorySpanExporter{}
+
+	startTracing(exporter)
+	defer stopTracing()
+
+	root := startSpan("root")
+	assert.NotNil(root)
+
+	child := startSpan("child")
+	child.setTag("foo", "bar")
+
+	grandchild := startSpan("grandchild")
+	grandchild.finish()
+
+	child.finish()
+
+	sibling := startSpan("sibling")
+	sibling.finish()
+
+	setTraceTag("container", testContainerID)
+
+	// nothing is exported until the root span is finished
+	assert.Empty(exporter.spans)
+
+	root.finish()
+
+	assert.Equal([]string{"grandchild", "child", "sibling", "root"}, exporter.names())
+
+	spans := exporter.spans
+
+	assert.Equal(child.ID, spans[0].ParentID)
+	assert.Equal(root.ID, spans[1].ParentID)
+	assert.Equal(root.ID, spans[2].ParentID)
+	assert.Empty(spans[3].ParentID)
+
+	for _, s := range spans {
+		assert.Equal(root.TraceID, s.TraceID)
+		assert.Len(s.TraceID, 32)
+		assert.Len(s.ID, 16)
+		assert.Equal(testContainerID, s.Tags["container"])
+	}
+
+	assert.Equal("bar", spans[1].Tags["foo"])
+	assert.True(spans[3].Duration >= spans[1].Duration)
+
+	// a new root span starts a new batch
+	exporter.spans = nil
+
+	other := startSpan("other")
+	other.finish()
+
+	assert.Equal([]string{"other"}, exporter.names())
+}
+
+func TestTraceCreate(t *testing.T) {
+	assert := assert.New(t)
+
+	pod := &vcMock.Pod{
+		MockID: testPodID,
+		MockContainers: []*vcMock.Container{
+			{
+				MockID:      testContainerID,
+				MockProcess: vc.Process{Pid: testPID},
+			},
+		},
+	}
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		// No pre-existing pods
+		return []vc.PodStatus{}, nil
+	}
+
+	testingImpl.CreatePodFunc = func(podConfig vc.PodConfig) (vc.VCPod, error) {
+		return pod, nil
+	}
+
+	savedLog := ccLog
+
+	defer func() {
+		testingImpl.ListPodFunc = nil
+		testingImpl.CreatePodFunc = nil
+		ccLog = savedLog
+	}()
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	runtimeConfig, err := newTestRuntimeConfig(tmpdir, testConsole, true)
+	assert.NoError(err)
+
+	bundlePath := filepath.Join(tmpdir, "bundle")
+
+	err = makeOCIBundle(bundlePath)
+	assert.NoError(err)
+
+	ociConfigFile := filepath.Join(bundlePath, "config.json")
+
+	spec, err := readOCIConfigFile(ociConfigFile)
+	assert.NoError(err)
+
+	spec.Annotations = map[string]string{
+		testContainerTypeAnnotation: testContainerTypePod,
+	}
+
+	err = writeOCIConfigFile(spec, ociConfigFile)
+	assert.NoError(err)
+
+	exporter := &memorySpanExporter{}
+
+	startTracing(exporter)
+	defer stopTracing()
+
+	err = create(testContainerID, bundlePath, testConsole, filepath.Join(tmpdir, "pidfile"), true, runtimeConfig, consoleLogConfig{})
+	assert.NoError(err)
+
+	assert.Equal([]string{"parse-spec", "create-pod", "cgroups", "create"}, exporter.names())
+
+	for _, s := range exporter.spans {
+		assert.Equal(testContainerID, s.Tags["container"], "span: %+v", s)
+	}
+}
+
+func TestZipkinSpanExporter(t *testing.T) {
+	assert := assert.New(t)
+
+	var received []zipkinSpan
+	status := http.StatusAccepted
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("POST", r.Method)
+		assert.Equal("application/json", r.Header.Get("Content-Type"))
+
+		err := json.NewDecoder(r.Body).Decode(&received)
+		assert.NoError(err)
+
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	exporter := newSpanExporter(server.URL)
+
+	exporter.export([]traceSpan{
+		{TraceID: "1234", ID: "ab", Name: "root", Duration: 2000000},
+		{TraceID: "1234", ID: "cd", ParentID: "ab", Name: "child", Tags: map[string]string{"foo": "bar"}},
+	})
+
+	assert.Len(received, 2)
+	assert.Equal("root", received[0].Name)
+	assert.Equal(int64(2000), received[0].Duration)
+	assert.Equal(name, received[0].LocalEndpoint.ServiceName)
+	assert.Equal("ab", received[1].ParentID)
+	assert.Equal("bar", received[1].Tags["foo"])
+
+	status = http.StatusBadRequest
+
+	err := exporter.export([]traceSpan{{TraceID: "1234", ID: "ab", Name: "root"}})
+	assert.Error(err)
+
+	// no collector
+	server.Close()
+
+	err = exporter.export([]traceSpan{{TraceID: "1234", ID: "ab", Name: "root"}})
+	assert.Error(err)
+}
+
+func TestNewSpanExporter(t *testing.T) {
+	assert := assert.New(t)
+
+	exporter := newSpanExporter("")
+	assert.IsType(logSpanExporter{}, exporter)
+
+	err := exporter.export([]traceSpan{{TraceID: "1234", ID: "ab", ParentID: "cd", Name: "root"}})
+	assert.NoError(err)
+}
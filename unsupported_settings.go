@@ -0,0 +1,136 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/sirupsen/logrus"
+)
+
+// unsupportedSetting describes an OCI setting that cannot be applied
+// inside the VM.
+type unsupportedSetting struct {
+	// field is the OCI configuration field holding the setting.
+	field string
+
+	// check returns whether the setting is specified by an OCI
+	// configuration, and an error if it is malformed.
+	check func(ociSpec oci.CompatOCISpec) (bool, error)
+}
+
+// unsupportedSettings lists the OCI settings that are validated but not
+// applied inside the VM.
+//
+// XXX: neither virtcontainers nor the hyperstart agent protocol can
+// describe these settings, so they cannot be forwarded to the agent.
+var unsupportedSettings = []unsupportedSetting{
+	{"linux.seccomp", checkSeccompSetting},
+	{"process.capabilities", checkCapabilitiesSetting},
+	{"process.noNewPrivileges", checkNoNewPrivilegesSetting},
+	{"linux.resources.oomScoreAdj", checkOOMScoreAdjSetting},
+	{"linux.resources.pids", checkPidsLimitSetting},
+	{"linux.maskedPaths", checkMaskedPathsSetting},
+	{"linux.readonlyPaths", checkReadonlyPathsSetting},
+}
+
+func checkSeccompSetting(ociSpec oci.CompatOCISpec) (bool, error) {
+	if ociSpec.Linux == nil || ociSpec.Linux.Seccomp == nil {
+		return false, nil
+	}
+
+	return true, validateSeccomp(*ociSpec.Linux.Seccomp)
+}
+
+func checkCapabilitiesSetting(ociSpec oci.CompatOCISpec) (bool, error) {
+	if ociSpec.Process == nil || ociSpec.Process.Capabilities == nil {
+		return false, nil
+	}
+
+	caps, err := parseCapabilities(ociSpec.Process.Capabilities)
+	if err != nil {
+		return true, err
+	}
+
+	return true, validateCapabilities(caps)
+}
+
+func checkNoNewPrivilegesSetting(ociSpec oci.CompatOCISpec) (bool, error) {
+	return ociSpec.Process != nil && ociSpec.Process.NoNewPrivileges, nil
+}
+
+func checkOOMScoreAdjSetting(ociSpec oci.CompatOCISpec) (bool, error) {
+	score, err := getOOMScoreAdj(ociSpec)
+
+	return score != nil, err
+}
+
+func checkPidsLimitSetting(ociSpec oci.CompatOCISpec) (bool, error) {
+	limit, err := getPidsLimit(ociSpec)
+
+	return limit > 0, err
+}
+
+func checkMaskedPathsSetting(ociSpec oci.CompatOCISpec) (bool, error) {
+	if ociSpec.Linux == nil {
+		return false, nil
+	}
+
+	return len(ociSpec.Linux.MaskedPaths) > 0, validateGuestPaths("maskedPaths", ociSpec.Linux.MaskedPaths)
+}
+
+func checkReadonlyPathsSetting(ociSpec oci.CompatOCISpec) (bool, error) {
+	if ociSpec.Linux == nil {
+		return false, nil
+	}
+
+	return len(ociSpec.Linux.ReadonlyPaths) > 0, validateGuestPaths("readonlyPaths", ociSpec.Linux.ReadonlyPaths)
+}
+
+// getUnsupportedSettings returns the fields of the unsupported settings
+// specified by an OCI configuration. It fails if one of them is malformed.
+func getUnsupportedSettings(ociSpec oci.CompatOCISpec) ([]string, error) {
+	var fields []string
+
+	for _, s := range unsupportedSettings {
+		set, err := s.check(ociSpec)
+		if err != nil {
+			return nil, err
+		}
+
+		if set {
+			fields = append(fields, s.field)
+		}
+	}
+
+	return fields, nil
+}
+
+// checkUnsupportedSettings validates the unsupported settings of the
+// specified OCI configuration and warns about each one that is ignored.
+func checkUnsupportedSettings(containerID string, ociSpec oci.CompatOCISpec) error {
+	fields, err := getUnsupportedSettings(ociSpec)
+	if err != nil {
+		return err
+	}
+
+	for _, field := range fields {
+		ccLog.WithFields(logrus.Fields{
+			"container": containerID,
+			"field":     field,
+		}).Warn("OCI setting is not applied inside the VM")
+	}
+
+	return nil
+}
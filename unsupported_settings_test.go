@@ -0,0 +1,98 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/containers/virtcontainers/pkg/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetUnsupportedSettings(t *testing.T) {
+	assert := assert.New(t)
+
+	validScore := 100
+	invalidScore := 2000
+
+	type testData struct {
+		ociSpec        oci.CompatOCISpec
+		expectedFields []string
+		expectFailure  bool
+	}
+
+	data := []testData{
+		{oci.CompatOCISpec{}, nil, false},
+		{oci.CompatOCISpec{Process: &oci.CompatOCIProcess{}, Linux: &specs.Linux{}}, nil, false},
+
+		{oci.CompatOCISpec{Linux: &specs.Linux{Seccomp: &specs.LinuxSeccomp{DefaultAction: specs.ActErrno}}}, []string{"linux.seccomp"}, false},
+		{oci.CompatOCISpec{Linux: &specs.Linux{Seccomp: &specs.LinuxSeccomp{}}}, nil, true},
+
+		{oci.CompatOCISpec{Process: &oci.CompatOCIProcess{Capabilities: []interface{}{"CAP_CHOWN"}}}, []string{"process.capabilities"}, false},
+		{oci.CompatOCISpec{Process: &oci.CompatOCIProcess{Capabilities: map[string]interface{}{
+			"bounding": []interface{}{"CAP_CHOWN", "CAP_FOO"},
+		}}}, nil, true},
+
+		{oci.CompatOCISpec{Process: &oci.CompatOCIProcess{NoNewPrivileges: true}}, []string{"process.noNewPrivileges"}, false},
+
+		{oci.CompatOCISpec{Linux: &specs.Linux{Resources: &specs.LinuxResources{OOMScoreAdj: &validScore}}}, []string{"linux.resources.oomScoreAdj"}, false},
+		{oci.CompatOCISpec{Linux: &specs.Linux{Resources: &specs.LinuxResources{OOMScoreAdj: &invalidScore}}}, nil, true},
+
+		{oci.CompatOCISpec{Linux: &specs.Linux{Resources: &specs.LinuxResources{Pids: &specs.LinuxPids{Limit: 1024}}}}, []string{"linux.resources.pids"}, false},
+		{oci.CompatOCISpec{Linux: &specs.Linux{Resources: &specs.LinuxResources{Pids: &specs.LinuxPids{Limit: -1}}}}, nil, false},
+		{oci.CompatOCISpec{Linux: &specs.Linux{Resources: &specs.LinuxResources{Pids: &specs.LinuxPids{Limit: -2}}}}, nil, true},
+
+		{oci.CompatOCISpec{Linux: &specs.Linux{MaskedPaths: []string{"/proc/kcore"}}}, []string{"linux.maskedPaths"}, false},
+		{oci.CompatOCISpec{Linux: &specs.Linux{MaskedPaths: []string{"proc/kcore"}}}, nil, true},
+		{oci.CompatOCISpec{Linux: &specs.Linux{ReadonlyPaths: []string{"/proc/sys"}}}, []string{"linux.readonlyPaths"}, false},
+		{oci.CompatOCISpec{Linux: &specs.Linux{ReadonlyPaths: []string{"proc/sys"}}}, nil, true},
+
+		{oci.CompatOCISpec{
+			Process: &oci.CompatOCIProcess{NoNewPrivileges: true},
+			Linux: &specs.Linux{
+				Seccomp:     &specs.LinuxSeccomp{DefaultAction: specs.ActAllow},
+				MaskedPaths: []string{"/proc/kcore"},
+			},
+		}, []string{"linux.seccomp", "process.noNewPrivileges", "linux.maskedPaths"}, false},
+	}
+
+	for _, d := range data {
+		fields, err := getUnsupportedSettings(d.ociSpec)
+		if d.expectFailure {
+			assert.Error(err, "test data: %+v", d)
+			continue
+		}
+
+		assert.NoError(err, "test data: %+v", d)
+		assert.Equal(d.expectedFields, fields, "test data: %+v", d)
+	}
+}
+
+func TestCheckUnsupportedSettings(t *testing.T) {
+	assert := assert.New(t)
+
+	ociSpec := oci.CompatOCISpec{
+		Process: &oci.CompatOCIProcess{NoNewPrivileges: true},
+	}
+
+	err := checkUnsupportedSettings(testContainerID, ociSpec)
+	assert.NoError(err)
+
+	ociSpec.Linux = &specs.Linux{MaskedPaths: []string{"proc/kcore"}}
+
+	err = checkUnsupportedSettings(testContainerID, ociSpec)
+	assert.Error(err)
+}
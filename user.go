@@ -0,0 +1,105 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	vc "github.com/containers/virtcontainers"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// invalidID is the value of (uid_t)-1 and (gid_t)-1, which the kernel
+// interprets as "unchanged" rather than as an ID.
+const invalidID = math.MaxUint32
+
+// parseID returns the user or group ID described by the specified
+// decimal string.
+func parseID(s string) (uint32, error) {
+	id, err := strconv.ParseUint(s, 10, 32)
+	if err != nil || id == invalidID {
+		return 0, fmt.Errorf("Invalid ID %q: expected a value between 0 and %d", s, uint32(invalidID-1))
+	}
+
+	return uint32(id), nil
+}
+
+// parseUserOption returns the user described by the --user option of the
+// exec command, which is either "<uid>[:<gid>]" or a user name the agent
+// resolves inside the container.
+func parseUserOption(option string) (specs.User, error) {
+	fields := strings.SplitN(option, ":", 2)
+
+	if _, err := strconv.ParseUint(fields[0], 10, 64); err != nil {
+		return specs.User{Username: option}, nil
+	}
+
+	uid, err := parseID(fields[0])
+	if err != nil {
+		return specs.User{}, fmt.Errorf("Invalid user %q: %v", option, err)
+	}
+
+	user := specs.User{UID: uid}
+
+	if len(fields) == 2 {
+		if user.GID, err = parseID(fields[1]); err != nil {
+			return specs.User{}, fmt.Errorf("Invalid user %q: %v", option, err)
+		}
+	}
+
+	return user, nil
+}
+
+// validateUser checks the IDs of the specified OCI process user.
+func validateUser(user specs.User) error {
+	if user.UID == invalidID {
+		return fmt.Errorf("Invalid user ID %d", user.UID)
+	}
+
+	if user.GID == invalidID {
+		return fmt.Errorf("Invalid group ID %d", user.GID)
+	}
+
+	for _, gid := range user.AdditionalGids {
+		if gid == invalidID {
+			return fmt.Errorf("Invalid additional group ID %d", gid)
+		}
+	}
+
+	return nil
+}
+
+// setCmdUser sets the credentials the agent starts the specified command
+// with. A user name takes priority over the user and group IDs, in which
+// case the agent uses the primary group of the user.
+//
+// XXX: the OCI specification the runtime is built with has no umask, so
+// the command runs with the umask of the agent.
+func setCmdUser(cmd *vc.Cmd, user specs.User) {
+	if user.Username != "" {
+		cmd.User = user.Username
+	} else {
+		cmd.User = strconv.FormatUint(uint64(user.UID), 10)
+		cmd.PrimaryGroup = strconv.FormatUint(uint64(user.GID), 10)
+	}
+
+	cmd.SupplementaryGroups = []string{}
+	for _, gid := range user.AdditionalGids {
+		cmd.SupplementaryGroups = append(cmd.SupplementaryGroups, strconv.FormatUint(uint64(gid), 10))
+	}
+}
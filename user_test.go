@@ -0,0 +1,187 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/containers/virtcontainers/pkg/vcMock"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+func TestParseUserOption(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		option        string
+		expectedUser  specs.User
+		expectFailure bool
+	}
+
+	data := []testData{
+		{"root", specs.User{Username: "root"}, false},
+		{"daemon:daemon", specs.User{Username: "daemon:daemon"}, false},
+		{"0", specs.User{}, false},
+		{"1000", specs.User{UID: 1000}, false},
+		{"1000:100", specs.User{UID: 1000, GID: 100}, false},
+		{"4294967294:4294967294", specs.User{UID: 4294967294, GID: 4294967294}, false},
+
+		// out of range
+		{"4294967295", specs.User{}, true},
+		{"4294967296", specs.User{}, true},
+		{"1000:4294967295", specs.User{}, true},
+
+		// invalid group
+		{"1000:", specs.User{}, true},
+		{"1000:users", specs.User{}, true},
+		{"1000:-1", specs.User{}, true},
+	}
+
+	for _, d := range data {
+		user, err := parseUserOption(d.option)
+		if d.expectFailure {
+			assert.Error(err, "test data: %+v", d)
+			continue
+		}
+
+		assert.NoError(err, "test data: %+v", d)
+		assert.Equal(d.expectedUser, user, "test data: %+v", d)
+	}
+}
+
+func TestValidateUser(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(validateUser(specs.User{}))
+	assert.NoError(validateUser(specs.User{UID: 1000, GID: 100, AdditionalGids: []uint32{10, 20}}))
+
+	assert.Error(validateUser(specs.User{UID: invalidID}))
+	assert.Error(validateUser(specs.User{GID: invalidID}))
+	assert.Error(validateUser(specs.User{AdditionalGids: []uint32{10, invalidID}}))
+}
+
+func TestSetCmdUser(t *testing.T) {
+	assert := assert.New(t)
+
+	var cmd vc.Cmd
+
+	setCmdUser(&cmd, specs.User{UID: 1000, GID: 100, AdditionalGids: []uint32{10, 20}})
+	assert.Equal("1000", cmd.User)
+	assert.Equal("100", cmd.PrimaryGroup)
+	assert.Equal([]string{"10", "20"}, cmd.SupplementaryGroups)
+
+	cmd = vc.Cmd{}
+
+	setCmdUser(&cmd, specs.User{Username: "daemon", UID: 1000, GID: 100})
+	assert.Equal("daemon", cmd.User)
+	assert.Empty(cmd.PrimaryGroup)
+	assert.Empty(cmd.SupplementaryGroups)
+}
+
+func TestExecuteUser(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	pidFilePath := filepath.Join(tmpdir, "pid")
+
+	flagSet := testExecParamsSetup(t, pidFilePath, "", true)
+
+	processPath := filepath.Join(tmpdir, "process.json")
+	flagSet.String("process", processPath, "")
+
+	flagSet.Parse([]string{testContainerID})
+	ctx := cli.NewContext(cli.NewApp(), flagSet, nil)
+
+	configPath := testConfigSetup(t)
+	configJSON, err := readOCIConfigJSON(configPath)
+	assert.NoError(err)
+
+	annotations := map[string]string{
+		oci.ContainerTypeKey: string(vc.PodContainer),
+		oci.ConfigJSONKey:    configJSON,
+	}
+
+	state := vc.State{
+		State: vc.StateRunning,
+	}
+
+	testingImpl.ListPodFunc = func() ([]vc.PodStatus, error) {
+		return newSingleContainerPodStatusList(testPodID, testContainerID, state, state, annotations), nil
+	}
+
+	var cmds []vc.Cmd
+
+	testingImpl.EnterContainerFunc = func(podID, containerID string, cmd vc.Cmd) (vc.VCPod, vc.VCContainer, *vc.Process, error) {
+		cmds = append(cmds, cmd)
+		return &vcMock.Pod{}, &vcMock.Container{}, &vc.Process{Pid: os.Getpid()}, nil
+	}
+
+	defer func() {
+		testingImpl.ListPodFunc = nil
+		testingImpl.EnterContainerFunc = nil
+	}()
+
+	processJSON := `{
+		"user": {
+			"uid": 1000,
+			"gid": 100,
+			"additionalGids": [10, 20]
+		},
+		"args": ["sh"],
+		"cwd": "/"
+	}`
+
+	err = ioutil.WriteFile(processPath, []byte(processJSON), testFileMode)
+	assert.NoError(err)
+
+	fn, ok := execCLICommand.Action.(func(context *cli.Context) error)
+	assert.True(ok)
+
+	err = fn(ctx)
+	assert.NoError(err)
+
+	if assert.Len(cmds, 1) {
+		assert.Equal("1000", cmds[0].User)
+		assert.Equal("100", cmds[0].PrimaryGroup)
+		assert.Equal([]string{"10", "20"}, cmds[0].SupplementaryGroups)
+	}
+
+	// (uid_t)-1 is not a user ID
+	processJSON = `{
+		"user": {
+			"uid": 4294967295,
+			"gid": 100
+		},
+		"args": ["sh"],
+		"cwd": "/"
+	}`
+
+	err = ioutil.WriteFile(processPath, []byte(processJSON), testFileMode)
+	assert.NoError(err)
+
+	err = fn(ctx)
+	assert.Error(err)
+	assert.Len(cmds, 1)
+}
@@ -16,12 +16,15 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
 const unknown = "<<unknown>>"
@@ -29,6 +32,7 @@ const unknown = "<<unknown>>"
 // variables to allow tests to modify the values
 var (
 	procVersion = "/proc/version"
+	procMemInfo = "/proc/meminfo"
 	osRelease   = "/etc/os-release"
 
 	// Clear Linux has a different path (for stateless support)
@@ -137,6 +141,126 @@ func getCPUDetails() (vendor, model string, err error) {
 	return "", "", fmt.Errorf("failed to find expected fields in file %v", procCPUInfo)
 }
 
+// getCPUTopology returns the number of logical CPUs and whether
+// simultaneous multithreading (hyper-threading) is in use. The latter is
+// determined by comparing the number of logical CPUs with the number of
+// unique physical cores.
+func getCPUTopology() (cpus int, hyperThreading bool, err error) {
+	contents, err := getFileContents(procCPUInfo)
+	if err != nil {
+		return 0, false, err
+	}
+
+	type core struct {
+		physicalID string
+		coreID     string
+	}
+
+	cores := make(map[core]bool)
+
+	for _, section := range strings.Split(contents, "\n\n") {
+		var physicalID, coreID string
+		isProcessor := false
+
+		for _, line := range strings.Split(section, "\n") {
+			fields := strings.SplitN(line, ":", 2)
+			if len(fields) != 2 {
+				continue
+			}
+
+			key := strings.TrimSpace(fields[0])
+			value := strings.TrimSpace(fields[1])
+
+			switch key {
+			case "processor":
+				isProcessor = true
+			case "physical id":
+				physicalID = value
+			case "core id":
+				coreID = value
+			}
+		}
+
+		if !isProcessor {
+			continue
+		}
+
+		cpus++
+
+		if coreID != "" {
+			cores[core{physicalID: physicalID, coreID: coreID}] = true
+		}
+	}
+
+	if cpus == 0 {
+		return 0, false, fmt.Errorf("failed to find any processors in file %v", procCPUInfo)
+	}
+
+	// Topology details are not available on all systems (for
+	// example when running in some VMs).
+	hyperThreading = len(cores) > 0 && cpus > len(cores)
+
+	return cpus, hyperThreading, nil
+}
+
+// getMemInfoValues returns a map of the numeric values in procMemInfo.
+// Values are in kB, with the exception of page counts which have no unit.
+func getMemInfoValues() (map[string]uint64, error) {
+	contents, err := getFileContents(procMemInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]uint64)
+
+	for _, line := range strings.Split(contents, "\n") {
+		fields := strings.Fields(line)
+
+		// format is "<name>: <value> kB", or "<name>: <value>" for
+		// page counts.
+		switch {
+		case len(fields) == 2:
+		case len(fields) == 3 && fields[2] == "kB":
+		default:
+			continue
+		}
+
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %v in %v: %v", fields[0], procMemInfo, err)
+		}
+
+		values[strings.TrimSuffix(fields[0], ":")] = value
+	}
+
+	return values, nil
+}
+
+// getHostMemoryInfo returns the total and available amount of host memory
+// in MiB. If the kernel does not provide an estimate of the available memory
+// (MemAvailable), the amount of free memory is returned instead.
+func getHostMemoryInfo() (totalMB, availableMB uint64, err error) {
+	values, err := getMemInfoValues()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	total, ok := values["MemTotal"]
+	if !ok {
+		return 0, 0, fmt.Errorf("failed to find MemTotal in file %v", procMemInfo)
+	}
+
+	available, ok := values["MemAvailable"]
+	if !ok {
+		available, ok = values["MemFree"]
+		if !ok {
+			return 0, 0, fmt.Errorf("failed to find MemAvailable or MemFree in file %v", procMemInfo)
+		}
+	}
+
+	return total / 1024, available / 1024, nil
+}
+
 // resolvePath returns the fully resolved and expanded value of the
 // specified path.
 func resolvePath(path string) (string, error) {
@@ -189,6 +313,23 @@ func runCommand(args []string) (string, error) {
 	return runCommandFull(args, false)
 }
 
+// runCommandTimeout returns the commands space-trimmed standard output on
+// success. If the command has not finished before the specified timeout
+// expires, it is killed and an error is returned.
+func runCommandTimeout(args []string, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	bytes, err := exec.CommandContext(ctx, args[0], args[1:]...).Output()
+	if err != nil {
+		return "", err
+	}
+
+	trimmed := strings.TrimSpace(string(bytes))
+
+	return trimmed, nil
+}
+
 // writeFile write data into specified file
 func writeFile(filePath string, data string, fileMode os.FileMode) error {
 	// Normally dir should not be empty, one case is that cgroup subsystem
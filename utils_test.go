@@ -20,8 +20,10 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -288,6 +290,194 @@ foo	: bar
 	}
 }
 
+// makeCPUInfoContents returns /proc/cpuinfo-style contents for a host with
+// the specified topology.
+func makeCPUInfoContents(sockets, coresPerSocket, threadsPerCore int) string {
+	var sections []string
+
+	processor := 0
+
+	for socket := 0; socket < sockets; socket++ {
+		for thread := 0; thread < threadsPerCore; thread++ {
+			for core := 0; core < coresPerSocket; core++ {
+				sections = append(sections, fmt.Sprintf(`processor	: %d
+vendor_id	: GenuineIntel
+model name	: some CPU model
+physical id	: %d
+siblings	: %d
+core id		: %d
+cpu cores	: %d
+`, processor, socket, coresPerSocket*threadsPerCore, core, coresPerSocket))
+
+				processor++
+			}
+		}
+	}
+
+	return strings.Join(sections, "\n")
+}
+
+func TestGetCPUTopology(t *testing.T) {
+	type testData struct {
+		contents               string
+		expectedCPUs           int
+		expectedHyperThreading bool
+		expectError            bool
+	}
+
+	data := []testData{
+		{"", 0, false, true},
+		{"invalid", 0, false, true},
+		{"vendor_id	: GenuineIntel", 0, false, true},
+
+		// no topology details
+		{"processor	: 0\n\nprocessor	: 1\n", 2, false, false},
+
+		// single socket with hyper-threading
+		{makeCPUInfoContents(1, 4, 2), 8, true, false},
+
+		// dual socket with hyper-threading
+		{makeCPUInfoContents(2, 4, 2), 16, true, false},
+
+		// dual socket without hyper-threading
+		{makeCPUInfoContents(2, 4, 1), 8, false, false},
+
+		// single socket with SMT disabled
+		{makeCPUInfoContents(1, 4, 1), 4, false, false},
+	}
+
+	tmpdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	// override
+	procCPUInfo = filepath.Join(tmpdir, "cpuinfo")
+
+	_, _, err = getCPUTopology()
+	// ENOENT
+	assert.Error(t, err)
+	assert.True(t, os.IsNotExist(err))
+
+	for _, d := range data {
+		err := createFile(procCPUInfo, d.contents)
+		assert.NoError(t, err)
+
+		cpus, hyperThreading, err := getCPUTopology()
+
+		if d.expectError {
+			assert.Error(t, err, fmt.Sprintf("%+v", d))
+			continue
+		}
+
+		assert.NoError(t, err, fmt.Sprintf("%+v", d))
+		assert.Equal(t, d.expectedCPUs, cpus, fmt.Sprintf("%+v", d))
+		assert.Equal(t, d.expectedHyperThreading, hyperThreading, fmt.Sprintf("%+v", d))
+	}
+
+	// ensure the vendor and model are still found
+	err = createFile(procCPUInfo, makeCPUInfoContents(2, 4, 2))
+	assert.NoError(t, err)
+
+	vendor, model, err := getCPUDetails()
+	assert.NoError(t, err)
+	assert.Equal(t, "GenuineIntel", vendor)
+	assert.Equal(t, "some CPU model", model)
+}
+
+func TestGetHostMemoryInfo(t *testing.T) {
+	type testData struct {
+		contents          string
+		expectedTotal     uint64
+		expectedAvailable uint64
+		expectError       bool
+	}
+
+	data := []testData{
+		{"", 0, 0, true},
+		{"invalid", 0, 0, true},
+		{"MemTotal: 2048 kB", 0, 0, true},
+		{"MemTotal: foo kB\nMemAvailable: 1024 kB", 0, 0, true},
+		{"MemFree: 1024 kB\nMemAvailable: 1024 kB", 0, 0, true},
+		{"MemTotal: 2048 kB\nMemFree: 1024 kB\nMemAvailable: 1536 kB\n", 2, 1, false},
+		{"MemTotal:     4194304 kB\nMemFree:     1048576 kB\nMemAvailable: 3145728 kB\nHugePages_Total:       0\n", 4096, 3072, false},
+
+		// no MemAvailable (kernels older than 3.14)
+		{"MemTotal: 4194304 kB\nMemFree: 2097152 kB\n", 4096, 2048, false},
+	}
+
+	tmpdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	// override
+	procMemInfo = filepath.Join(tmpdir, "meminfo")
+
+	_, _, err = getHostMemoryInfo()
+	// ENOENT
+	assert.Error(t, err)
+	assert.True(t, os.IsNotExist(err))
+
+	for _, d := range data {
+		err := createFile(procMemInfo, d.contents)
+		assert.NoError(t, err)
+
+		total, available, err := getHostMemoryInfo()
+
+		if d.expectError {
+			assert.Error(t, err, fmt.Sprintf("%+v", d))
+			continue
+		}
+
+		assert.NoError(t, err, fmt.Sprintf("%+v", d))
+		assert.Equal(t, d.expectedTotal, total)
+		assert.Equal(t, d.expectedAvailable, available)
+	}
+}
+
+func TestGetMemInfoValues(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	savedProcMemInfo := procMemInfo
+	procMemInfo = filepath.Join(tmpdir, "meminfo")
+
+	defer func() {
+		procMemInfo = savedProcMemInfo
+	}()
+
+	contents := `MemTotal:        4194304 kB
+HugePages_Total:       4
+Hugepagesize:       2048 kB
+Unexpected:      1 MB
+`
+	err = createFile(procMemInfo, contents)
+	assert.NoError(err)
+
+	values, err := getMemInfoValues()
+	assert.NoError(err)
+
+	expected := map[string]uint64{
+		"MemTotal":        4194304,
+		"HugePages_Total": 4,
+		"Hugepagesize":    2048,
+	}
+
+	assert.Equal(expected, values)
+
+	err = createFile(procMemInfo, "HugePages_Total: foo\n")
+	assert.NoError(err)
+
+	_, err = getMemInfoValues()
+	assert.Error(err)
+}
+
 func TestUtilsResolvePathEmptyPath(t *testing.T) {
 	_, err := resolvePath("")
 	assert.Error(t, err)
@@ -378,6 +568,16 @@ func TestUtilsRunCommandIgnoreStderr(t *testing.T) {
 	assert.Equal(t, "", output)
 }
 
+func TestUtilsRunCommandTimeout(t *testing.T) {
+	output, err := runCommandTimeout([]string{"echo", "hello"}, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", output)
+
+	output, err = runCommandTimeout([]string{"sleep", "60"}, 10*time.Millisecond)
+	assert.Error(t, err)
+	assert.Equal(t, "", output)
+}
+
 func TestUtilsRunCommandInvalidCmds(t *testing.T) {
 	invalidCommands := [][]string{
 		{""},
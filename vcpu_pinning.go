@@ -0,0 +1,216 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	goruntime "runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/sirupsen/logrus"
+)
+
+// vcpuPinningAnnotation specifies the host CPUs the vCPUs of the VM of a
+// pod are pinned to, using the cpuset format (for example "2-5,8"). The
+// value "cpuset" uses the CPUs of the OCI "linux.resources.cpu.cpus"
+// setting instead.
+const vcpuPinningAnnotation = hypervisorAnnotationPrefix + "vcpu_pinning"
+
+// vcpuPinningFromCPUSet is the vcpuPinningAnnotation value selecting the
+// CPUs of the OCI cpuset.
+const vcpuPinningFromCPUSet = "cpuset"
+
+// maxHostCPUs is the number of CPUs the affinity mask passed to
+// sched_setaffinity(2) can describe.
+const maxHostCPUs = 1024
+
+// hostCPUCount returns the number of CPUs of the host. It is a variable
+// to allow tests to modify it.
+var hostCPUCount = goruntime.NumCPU
+
+// setThreadAffinityFunc is used to pin a thread to a host CPU. It is a
+// variable to allow tests to mock it.
+var setThreadAffinityFunc = setThreadAffinity
+
+// parseCPUList parses a list of CPUs in the cpuset format, such as
+// "0-3,6", and returns the CPUs in ascending order. CPUs must be below
+// maxHostCPUs, which is checked before a range is expanded.
+func parseCPUList(list string) ([]int, error) {
+	seen := make(map[int]bool)
+	var cpus []int
+
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+
+		bounds := strings.SplitN(field, "-", 2)
+
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil || first < 0 {
+			return nil, fmt.Errorf("Invalid CPU list %q: invalid CPU %q", list, bounds[0])
+		}
+
+		last := first
+
+		if len(bounds) == 2 {
+			last, err = strconv.Atoi(bounds[1])
+			if err != nil || last < first {
+				return nil, fmt.Errorf("Invalid CPU list %q: invalid range %q", list, field)
+			}
+		}
+
+		if last >= maxHostCPUs {
+			return nil, fmt.Errorf("Invalid CPU list %q: CPU %d is above the maximum of %d", list, last, maxHostCPUs-1)
+		}
+
+		for cpu := first; cpu <= last; cpu++ {
+			if !seen[cpu] {
+				seen[cpu] = true
+				cpus = append(cpus, cpu)
+			}
+		}
+	}
+
+	sort.Ints(cpus)
+
+	return cpus, nil
+}
+
+// getVCPUPinning returns the host CPUs requested by vcpuPinningAnnotation,
+// or nil if the annotation is not specified.
+func getVCPUPinning(ociSpec oci.CompatOCISpec) ([]int, error) {
+	value, ok := ociSpec.Annotations[vcpuPinningAnnotation]
+	if !ok {
+		return nil, nil
+	}
+
+	list := value
+
+	if value == vcpuPinningFromCPUSet {
+		list = ""
+
+		if ociSpec.Linux != nil && ociSpec.Linux.Resources != nil && ociSpec.Linux.Resources.CPU != nil {
+			list = ociSpec.Linux.Resources.CPU.Cpus
+		}
+
+		if list == "" {
+			return nil, fmt.Errorf("Invalid annotation %s=%q: the OCI configuration specifies no cpuset", vcpuPinningAnnotation, value)
+		}
+	}
+
+	cpus, err := parseCPUList(list)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid annotation %s=%q: %v", vcpuPinningAnnotation, value, err)
+	}
+
+	hostCPUs := hostCPUCount()
+
+	for _, cpu := range cpus {
+		if cpu >= hostCPUs {
+			return nil, fmt.Errorf("Cannot pin vCPUs to host CPU %d: the host only has %d CPUs", cpu, hostCPUs)
+		}
+	}
+
+	return cpus, nil
+}
+
+// vcpuPinning returns the host CPU each of the specified number of vCPUs
+// is pinned to. If there are more vCPUs than CPUs, the CPUs are shared.
+func vcpuPinning(cpus []int, vcpus int) []int {
+	if len(cpus) == 0 {
+		return nil
+	}
+
+	pinning := make([]int, vcpus)
+
+	for i := range pinning {
+		pinning[i] = cpus[i%len(cpus)]
+	}
+
+	return pinning
+}
+
+// getVCPUThreadIDs asks the hypervisor of the specified pod for the host
+// thread ID of each of its vCPUs.
+func getVCPUThreadIDs(podID string) ([]int, error) {
+	var vcpus []struct {
+		CPU      int `json:"CPU"`
+		ThreadID int `json:"thread_id"`
+	}
+
+	if err := qmpRun(podID, "query-cpus", &vcpus); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(vcpus, func(i, j int) bool {
+		return vcpus[i].CPU < vcpus[j].CPU
+	})
+
+	var threadIDs []int
+
+	for _, vcpu := range vcpus {
+		threadIDs = append(threadIDs, vcpu.ThreadID)
+	}
+
+	return threadIDs, nil
+}
+
+// setThreadAffinity pins the specified thread to a host CPU.
+func setThreadAffinity(tid, cpu int) error {
+	var mask [maxHostCPUs / 64]uint64
+
+	mask[cpu/64] |= 1 << (uint(cpu) % 64)
+
+	_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY, uintptr(tid),
+		uintptr(len(mask)*8), uintptr(unsafe.Pointer(&mask[0])))
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+// pinVCPUs pins the vCPU threads of the VM of the specified pod, which
+// must be running, to the specified host CPUs.
+func pinVCPUs(podID string, cpus []int) error {
+	threadIDs, err := getVCPUThreadIDs(podID)
+	if err != nil {
+		return fmt.Errorf("Cannot get the vCPU threads of pod %v: %v", podID, err)
+	}
+
+	return pinVCPUThreads(threadIDs, cpus)
+}
+
+// pinVCPUThreads pins the specified vCPU threads to the specified host
+// CPUs.
+func pinVCPUThreads(threadIDs []int, cpus []int) error {
+	for i, cpu := range vcpuPinning(cpus, len(threadIDs)) {
+		if err := setThreadAffinityFunc(threadIDs[i], cpu); err != nil {
+			return fmt.Errorf("Cannot pin vCPU %d (thread %d) to host CPU %d: %v", i, threadIDs[i], cpu, err)
+		}
+
+		ccLog.WithFields(logrus.Fields{
+			"vcpu":     i,
+			"thread":   threadIDs[i],
+			"host-cpu": cpu,
+		}).Debug("Pinned vCPU")
+	}
+
+	return nil
+}
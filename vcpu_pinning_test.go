@@ -0,0 +1,234 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/containers/virtcontainers/pkg/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCPUList(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		list          string
+		expectFailure bool
+		expected      []int
+	}
+
+	data := []testData{
+		{"0", false, []int{0}},
+		{"3,1", false, []int{1, 3}},
+		{"0-3", false, []int{0, 1, 2, 3}},
+		{"0-2,6,8-9", false, []int{0, 1, 2, 6, 8, 9}},
+		{" 1 , 2-3 ", false, []int{1, 2, 3}},
+		{"1,1-2", false, []int{1, 2}},
+		{"2-2", false, []int{2}},
+
+		{"", true, nil},
+		{"a", true, nil},
+		{"-1", true, nil},
+		{"1,", true, nil},
+		{"3-1", true, nil},
+		{"1-a", true, nil},
+		{"1-2-3", true, nil},
+
+		// CPUs are bounded before ranges are expanded
+		{"1023", false, []int{1023}},
+		{"1024", true, nil},
+		{"0-1024", true, nil},
+		{"0-2000000000", true, nil},
+		{"2000000000-2000000001", true, nil},
+	}
+
+	for _, d := range data {
+		cpus, err := parseCPUList(d.list)
+		if d.expectFailure {
+			assert.Error(err, "test data: %+v", d)
+			continue
+		}
+
+		assert.NoError(err, "test data: %+v", d)
+		assert.Equal(d.expected, cpus, "test data: %+v", d)
+	}
+}
+
+func TestGetVCPUPinning(t *testing.T) {
+	assert := assert.New(t)
+
+	savedHostCPUCount := hostCPUCount
+	hostCPUCount = func() int {
+		return 8
+	}
+
+	defer func() {
+		hostCPUCount = savedHostCPUCount
+	}()
+
+	type testData struct {
+		annotation    string
+		cpuset        string
+		expectFailure bool
+		expected      []int
+	}
+
+	data := []testData{
+		{"", "", false, nil},
+		{"2-3", "", false, []int{2, 3}},
+		{"2-3", "4-5", false, []int{2, 3}},
+		{"cpuset", "4-5", false, []int{4, 5}},
+		{"0-7", "", false, []int{0, 1, 2, 3, 4, 5, 6, 7}},
+
+		// not on this host
+		{"6-8", "", true, nil},
+		{"cpuset", "7,9", true, nil},
+
+		// no cpuset
+		{"cpuset", "", true, nil},
+
+		// invalid lists
+		{"foo", "", true, nil},
+		{"cpuset", "1-", true, nil},
+	}
+
+	for _, d := range data {
+		ociSpec := oci.CompatOCISpec{}
+
+		if d.annotation != "" {
+			ociSpec.Annotations = map[string]string{
+				vcpuPinningAnnotation: d.annotation,
+			}
+		}
+
+		if d.cpuset != "" {
+			ociSpec.Linux = &specs.Linux{
+				Resources: &specs.LinuxResources{
+					CPU: &specs.LinuxCPU{
+						Cpus: d.cpuset,
+					},
+				},
+			}
+		}
+
+		cpus, err := getVCPUPinning(ociSpec)
+		if d.expectFailure {
+			assert.Error(err, "test data: %+v", d)
+			continue
+		}
+
+		assert.NoError(err, "test data: %+v", d)
+		assert.Equal(d.expected, cpus, "test data: %+v", d)
+	}
+}
+
+func TestVCPUPinning(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		cpus     []int
+		vcpus    int
+		expected []int
+	}
+
+	data := []testData{
+		{nil, 4, nil},
+		{[]int{2, 3}, 0, []int{}},
+		{[]int{2, 3}, 1, []int{2}},
+		{[]int{2, 3}, 2, []int{2, 3}},
+		{[]int{4, 5, 6, 7}, 2, []int{4, 5}},
+
+		// more vCPUs than CPUs
+		{[]int{2, 3}, 5, []int{2, 3, 2, 3, 2}},
+	}
+
+	for _, d := range data {
+		pinning := vcpuPinning(d.cpus, d.vcpus)
+		assert.Equal(d.expected, pinning, "test data: %+v", d)
+	}
+}
+
+func TestPinVCPUs(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	threadIDs := []int{100, 101, 102}
+
+	commands, restore := setTestQMPServer(assert, tmpdir, testPodID, threadIDs)
+	defer restore()
+
+	pinned := make(map[int]int)
+
+	savedSetThreadAffinity := setThreadAffinityFunc
+	setThreadAffinityFunc = func(tid, cpu int) error {
+		pinned[tid] = cpu
+		return nil
+	}
+
+	defer func() {
+		setThreadAffinityFunc = savedSetThreadAffinity
+	}()
+
+	err = pinVCPUs(testPodID, []int{6, 7})
+	assert.NoError(err)
+	assert.Equal(map[int]int{100: 6, 101: 7, 102: 6}, pinned)
+
+	var executed []string
+	for command := range commands {
+		executed = append(executed, command)
+	}
+
+	assert.Equal([]string{"qmp_capabilities", "query-cpus"}, executed)
+}
+
+func TestPinVCPUsFail(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	savedPath := podRunStatePath
+	podRunStatePath = tmpdir
+
+	savedSetThreadAffinity := setThreadAffinityFunc
+	setThreadAffinityFunc = func(tid, cpu int) error {
+		return errors.New("affinity failure")
+	}
+
+	defer func() {
+		podRunStatePath = savedPath
+		setThreadAffinityFunc = savedSetThreadAffinity
+	}()
+
+	// no hypervisor
+	err = pinVCPUs(testPodID, []int{0})
+	assert.Error(err)
+
+	_, restore := setTestQMPServer(assert, tmpdir, testPodID, []int{100})
+	defer restore()
+
+	// cannot set the affinity
+	err = pinVCPUs(testPodID, []int{0})
+	assert.Error(err)
+}
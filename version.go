@@ -15,14 +15,112 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/containers/virtcontainers/pkg/oci"
 	"github.com/urfave/cli"
 )
 
+// ComponentVersionInfo stores the versions of the runtime and of the
+// components it is configured to use.
+type ComponentVersionInfo struct {
+	Runtime    RuntimeVersionInfo
+	Hypervisor string
+	Proxy      string
+	Shim       string
+	Agent      string
+}
+
+// commandVersionFunc is used to probe the version of a component. It is
+// a variable to allow tests to mock it.
+var commandVersionFunc = getCommandVersion
+
 var versionCLICommand = cli.Command{
 	Name:  "version",
 	Usage: "display version details",
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "json",
+			Usage: "display the version details in JSON format",
+		},
+		cli.BoolFlag{
+			Name:  "all",
+			Usage: "also display the versions of the configured hypervisor, proxy, shim and agent",
+		},
+	},
 	Action: func(context *cli.Context) error {
+		if !context.Bool("all") {
+			if context.Bool("json") {
+				return writeVersionJSON(context.App.Writer, getRuntimeVersionInfo())
+			}
+
+			cli.VersionPrinter(context)
+			return nil
+		}
+
+		// Without a configuration, the versions of the components are
+		// all unknown.
+		runtimeConfig, _ := context.App.Metadata["runtimeConfig"].(oci.RuntimeConfig)
+
+		info := getComponentVersionInfo(runtimeConfig)
+
+		if context.Bool("json") {
+			return writeVersionJSON(context.App.Writer, info)
+		}
+
 		cli.VersionPrinter(context)
+		writeComponentVersions(context.App.Writer, info)
+
 		return nil
 	},
 }
+
+// getComponentVersionInfo returns the versions of the runtime and of the
+// components of the specified configuration, as displayed by "cc-env".
+// The version of a component whose configuration is not valid is unknown.
+func getComponentVersionInfo(config oci.RuntimeConfig) ComponentVersionInfo {
+	info := ComponentVersionInfo{
+		Runtime:    getRuntimeVersionInfo(),
+		Hypervisor: unknown,
+		Proxy:      unknown,
+		Shim:       unknown,
+		Agent:      unknown,
+	}
+
+	if config.HypervisorConfig.HypervisorPath != "" {
+		info.Hypervisor = getHypervisorInfo(config).Version
+	}
+
+	if proxy, err := getProxyInfo(config); err == nil {
+		info.Proxy = proxy.Version
+	}
+
+	if shim, err := getShimInfo(config); err == nil {
+		info.Shim = shim.Version
+	}
+
+	if agent, err := getAgentInfo(config); err == nil {
+		info.Agent = agent.Version
+	}
+
+	return info
+}
+
+// writeComponentVersions writes the versions of the components, which
+// follow the runtime version details.
+func writeComponentVersions(w io.Writer, info ComponentVersionInfo) {
+	fmt.Fprintf(w, "hypervisor : %s\n", info.Hypervisor)
+	fmt.Fprintf(w, "proxy      : %s\n", info.Proxy)
+	fmt.Fprintf(w, "shim       : %s\n", info.Shim)
+	fmt.Fprintf(w, "agent      : %s\n", info.Agent)
+}
+
+// writeVersionJSON writes the specified version details in JSON format.
+func writeVersionJSON(w io.Writer, info interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(info)
+}
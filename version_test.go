@@ -17,11 +17,17 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"testing"
 
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/stretchr/testify/assert"
 	"github.com/urfave/cli"
 )
@@ -43,7 +49,7 @@ func TestVersion(t *testing.T) {
 	}
 
 	app := cli.NewApp()
-	ctx := cli.NewContext(app, nil, nil)
+	ctx := cli.NewContext(app, flag.NewFlagSet("", 0), nil)
 	app.Name = testAppName
 	app.Version = runtimeVersion()
 
@@ -63,3 +69,125 @@ func TestVersion(t *testing.T) {
 	err = grep(pattern, tmpfile.Name())
 	assert.NoError(t, err)
 }
+
+func TestVersionJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	savedVersion := version
+	savedCommit := commit
+
+	defer func() {
+		version = savedVersion
+		commit = savedCommit
+	}()
+
+	version = "0.1.0"
+	commit = "abcdef"
+
+	set := flag.NewFlagSet("", 0)
+	set.Bool("json", true, "")
+
+	var buf bytes.Buffer
+
+	app := cli.NewApp()
+	app.Writer = &buf
+	ctx := cli.NewContext(app, set, nil)
+
+	fn, ok := versionCLICommand.Action.(func(context *cli.Context) error)
+	assert.True(ok)
+
+	err := fn(ctx)
+	assert.NoError(err)
+
+	var info RuntimeVersionInfo
+
+	err = json.Unmarshal(buf.Bytes(), &info)
+	assert.NoError(err)
+	assert.Equal(getRuntimeVersionInfo(), info)
+	assert.Equal("0.1.0", info.Semver)
+	assert.Equal("abcdef", info.Commit)
+	assert.Equal(specs.Version, info.OCI)
+}
+
+func TestGetComponentVersionInfo(t *testing.T) {
+	assert := assert.New(t)
+
+	savedCommandVersionFunc := commandVersionFunc
+	defer func() {
+		commandVersionFunc = savedCommandVersionFunc
+	}()
+
+	versions := map[string]string{
+		"/usr/bin/qemu-lite-system-x86_64": "QEMU emulator version 2.7.1",
+		"/usr/libexec/cc-shim":             "cc-shim version 3.0.4",
+		defaultProxyPath:                   "",
+	}
+
+	commandVersionFunc = func(cmd string) (string, error) {
+		version, ok := versions[cmd]
+		if !ok {
+			return "", fmt.Errorf("no such command %q", cmd)
+		}
+
+		return version, nil
+	}
+
+	config := oci.RuntimeConfig{
+		HypervisorConfig: vc.HypervisorConfig{
+			HypervisorPath: "/usr/bin/qemu-lite-system-x86_64",
+		},
+		ProxyType:   vc.CCProxyType,
+		ShimType:    vc.CCShimType,
+		ShimConfig:  vc.CCShimConfig{Path: "/usr/libexec/cc-shim"},
+		AgentConfig: vc.HyperConfig{PauseBinPath: "/does/not/exist/pause"},
+	}
+
+	info := getComponentVersionInfo(config)
+	assert.Equal(ComponentVersionInfo{
+		Runtime:    getRuntimeVersionInfo(),
+		Hypervisor: "QEMU emulator version 2.7.1",
+		Proxy:      unknown,
+		Shim:       "cc-shim version 3.0.4",
+		Agent:      unknown,
+	}, info)
+
+	// no configuration
+	info = getComponentVersionInfo(oci.RuntimeConfig{})
+	assert.Equal(ComponentVersionInfo{
+		Runtime:    getRuntimeVersionInfo(),
+		Hypervisor: unknown,
+		Proxy:      unknown,
+		Shim:       unknown,
+		Agent:      unknown,
+	}, info)
+
+	set := flag.NewFlagSet("", 0)
+	set.Bool("all", true, "")
+	set.Bool("json", true, "")
+
+	var buf bytes.Buffer
+
+	app := cli.NewApp()
+	app.Writer = &buf
+	app.Metadata = map[string]interface{}{
+		"runtimeConfig": config,
+	}
+	ctx := cli.NewContext(app, set, nil)
+
+	fn, ok := versionCLICommand.Action.(func(context *cli.Context) error)
+	assert.True(ok)
+
+	err := fn(ctx)
+	assert.NoError(err)
+
+	var jsonInfo ComponentVersionInfo
+
+	err = json.Unmarshal(buf.Bytes(), &jsonInfo)
+	assert.NoError(err)
+	assert.Equal(getComponentVersionInfo(config), jsonInfo)
+
+	buf.Reset()
+	writeComponentVersions(&buf, jsonInfo)
+	assert.Contains(buf.String(), "hypervisor : QEMU emulator version 2.7.1\n")
+	assert.Contains(buf.String(), "agent      : "+unknown+"\n")
+}